@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/leona/helix-assist/internal/config"
 	"github.com/leona/helix-assist/internal/lsp"
 	"github.com/leona/helix-assist/internal/providers"
 	testing "github.com/leona/helix-assist/internal/testing"
@@ -22,6 +25,11 @@ func main() {
 	timeoutMs := flag.Int("timeout", 15000, "Completion timeout in milliseconds")
 	noColor := flag.Bool("no-color", false, "Disable colored output")
 
+	simulate := flag.String("simulate", "", "Replay a recorded typing session (JSON) against the completion scheduler instead of running tests")
+	speeds := flag.String("speeds", "0.5,1,2,4", "Replay speeds for --simulate, comma-separated multiples of the recorded speed")
+	latencyMs := flag.Int("latency", 400, "Simulated provider latency in milliseconds for --simulate")
+	debounceMs := flag.Int("debounce", config.DefaultConfig().Debounce, "Completion debounce in milliseconds for --simulate")
+
 	openaiKey := flag.String("openai-key", os.Getenv("OPENAI_API_KEY"), "OpenAI API key")
 	openaiModel := flag.String("openai-model", getEnvOrDefault("OPENAI_MODEL", "gpt-4.1-mini"), "OpenAI model")
 	openaiEndpoint := flag.String("openai-endpoint", getEnvOrDefault("OPENAI_ENDPOINT", "https://api.openai.com/v1"), "OpenAI API endpoint")
@@ -32,6 +40,14 @@ func main() {
 
 	flag.Parse()
 
+	if *simulate != "" {
+		if err := runSimulation(*simulate, *speeds, *latencyMs, *debounceMs, !*noColor); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *testDir == "" && *testFile == "" {
 		fmt.Fprintf(os.Stderr, "Error: Either --testdir or --file must be specified\n")
 		flag.Usage()
@@ -64,6 +80,7 @@ func main() {
 			*openaiModel,
 			*openaiModel, // chat model same as completion model
 			*openaiEndpoint,
+			false,
 			*timeoutMs,
 			logger,
 		)
@@ -133,6 +150,40 @@ func main() {
 	fmt.Print(output)
 }
 
+// runSimulation replays a session at each speed against a mock provider
+// answering after latencyMs, so the numbers reflect the scheduler alone.
+func runSimulation(path, speeds string, latencyMs, debounceMs int, useColor bool) error {
+	session, err := testing.LoadSession(path)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Debounce = debounceMs
+
+	var results []*testing.SimulationResult
+	for _, field := range strings.Split(speeds, ",") {
+		speed, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || speed <= 0 {
+			return fmt.Errorf("invalid speed %q", field)
+		}
+
+		provider := &testing.MockProvider{
+			Completions: []string{"simulated()"},
+			Latency:     time.Duration(latencyMs) * time.Millisecond,
+		}
+		log.Printf("replaying %s at %gx", path, speed)
+		result, err := testing.Simulate(context.Background(), cfg, provider, session, speed)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	fmt.Print(testing.NewFormatter(useColor).FormatSimulation(results))
+	return nil
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/handlers"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// stdinPosition is a 1-based line and byte column, as editors count them.
+type stdinPosition struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+// stdinSuggestion is one completion: Text replaces the document from Start
+// to End, which is the cursor unless the suggestion repeats code after it.
+type stdinSuggestion struct {
+	Text  string        `json:"text"`
+	Start stdinPosition `json:"start"`
+	End   stdinPosition `json:"end"`
+}
+
+type stdinResult struct {
+	Suggestions []stdinSuggestion `json:"suggestions"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// runCompleteStdin implements `helix-assist complete-stdin --line N --col M
+// [--lang ID] [--file PATH] < file`, completing the document read from
+// stdin at the cursor and printing the suggestions as JSON, for tools that
+// do not speak LSP.
+func runCompleteStdin(cfg *config.Config, registry *providers.Registry, logger *lsp.Logger, args []string) {
+	fs := flag.NewFlagSet("complete-stdin", flag.ExitOnError)
+	line := fs.Int("line", 0, "Cursor line, counted from 1")
+	col := fs.Int("col", 1, "Cursor column in bytes, counted from 1")
+	lang := fs.String("lang", "", "Language ID of the document (default: from --file, else guessed)")
+	file := fs.String("file", "", "Path of the document, used for the language and as context for the model")
+	fs.Parse(args)
+
+	if *line < 1 || *col < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: helix-assist [flags] complete-stdin --line N --col M [--lang ID] [--file PATH] < file")
+		os.Exit(2)
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		writeStdinResult(stdinResult{Error: "read stdin: " + err.Error()})
+		os.Exit(1)
+	}
+	text := string(data)
+
+	languageID := *lang
+	if languageID == "" && *file != "" {
+		languageID, _ = util.DetectLanguage(*file)
+	}
+	if languageID == "" {
+		languageID = detectLanguage(text)
+	}
+
+	path := *file
+	if path == "" {
+		path = "stdin"
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	handler := handlers.NewCompletionHandler(cfg, registry, handlers.NewLowPowerMode(cfg, registry), events.NewBus())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.CompletionTimeout)*time.Millisecond)
+	defer cancel()
+
+	position := lsp.Position{Line: *line - 1, Character: *col - 1}
+	items, err := handler.Suggest(ctx, logger, "file://"+path, languageID, text, position)
+	if err != nil {
+		writeStdinResult(stdinResult{Suggestions: []stdinSuggestion{}, Error: err.Error()})
+		os.Exit(1)
+	}
+
+	result := stdinResult{Suggestions: make([]stdinSuggestion, 0, len(items))}
+	for _, item := range items {
+		if item.TextEdit == nil {
+			continue
+		}
+		result.Suggestions = append(result.Suggestions, stdinSuggestion{
+			Text:  item.TextEdit.NewText,
+			Start: stdinPosition{Line: item.TextEdit.Range.Start.Line + 1, Col: item.TextEdit.Range.Start.Character + 1},
+			End:   stdinPosition{Line: item.TextEdit.Range.End.Line + 1, Col: item.TextEdit.Range.End.Character + 1},
+		})
+	}
+	writeStdinResult(result)
+}
+
+func writeStdinResult(result stdinResult) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(result)
+}
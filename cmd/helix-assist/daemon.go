@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// daemon tracks the editor sessions of `helix-assist daemon`.
+type daemon struct {
+	deps sessionDeps
+
+	mu       sync.Mutex
+	sessions map[*lsp.Service]net.Conn
+	wg       sync.WaitGroup
+}
+
+// runDaemon implements `helix-assist [flags] daemon`, serving every editor
+// that connects to --listen (by default a unix socket in the runtime
+// directory) until interrupted. Each connection is a session of its own,
+// while providers, their caches and the usage count are shared, so a new
+// editor starts warm.
+func runDaemon(deps sessionDeps, stopBackground context.CancelFunc) {
+	cfg, registry, logger := deps.cfg, deps.registry, deps.logger
+
+	d := &daemon{deps: deps, sessions: make(map[*lsp.Service]net.Conn)}
+	registry.SetNotifier(d.broadcast)
+	registry.SetPolicy(func(ctx context.Context, name string) error {
+		return deps.trust.PermitProvider(providers.Workspace(ctx), name)
+	})
+
+	listener, err := listenEditors(cfg, cmp.Or(cfg.Listen, "unix:"+defaultDaemonSocket()), logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Listen error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			logger.Log("daemon accept error:", err.Error())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		d.serve(conn)
+	}
+
+	logger.Log("daemon stopping,", d.count(), "sessions open")
+	d.closeAll()
+	d.wg.Wait()
+	stopBackground()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	registry.Shutdown(shutdownCtx)
+	saveUsage(cfg, logger, registry, deps.accounts)
+}
+
+// serve runs a session for conn until the editor exits or disconnects.
+// Exiting ends the session, not the daemon.
+func (d *daemon) serve(conn net.Conn) {
+	svc, err := newSession(d.deps, events.NewBus())
+	if err != nil {
+		d.deps.logger.Log("daemon session error:", err.Error())
+		conn.Close()
+		return
+	}
+	svc.SetTransport(conn, conn)
+	svc.SetExitHandler(func(code int) {
+		conn.Close()
+	})
+
+	d.mu.Lock()
+	d.sessions[svc] = conn
+	d.mu.Unlock()
+	d.deps.logger.Log("Editor connected from", conn.RemoteAddr().String(), "-", d.count(), "sessions open")
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		err := svc.Start()
+		svc.Shutdown()
+		conn.Close()
+
+		d.mu.Lock()
+		delete(d.sessions, svc)
+		d.mu.Unlock()
+
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			d.deps.logger.Log("daemon session error:", err.Error())
+		}
+		d.deps.logger.Log("Editor session ended -", d.count(), "sessions open")
+	}()
+}
+
+// broadcast shows a provider notice in every editor, as the providers
+// behind it are shared.
+func (d *daemon) broadcast(message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for svc := range d.sessions {
+		svc.SendShowMessage(lsp.MessageTypeWarning, message)
+	}
+}
+
+func (d *daemon) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.sessions)
+}
+
+// closeAll disconnects every editor, ending their sessions.
+func (d *daemon) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.sessions {
+		conn.Close()
+	}
+}
+
+// defaultDaemonSocket is where the daemon listens without --listen: the
+// user's runtime directory, or a name of the user's own in the temp
+// directory.
+func defaultDaemonSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "helix-assist.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("helix-assist-%d.sock", os.Getuid()))
+}
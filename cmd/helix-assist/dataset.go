@@ -0,0 +1,45 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/dataset"
+)
+
+// runDataset implements `helix-assist dataset export [-in file] [-out file]
+// [-include-bad]`, turning the completions marked with markGood and markBad
+// into a redacted, deduplicated training set. Statistics go to stderr.
+func runDataset(cfg *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(os.Stderr, "Usage: helix-assist dataset export [-in file] [-out file] [-include-bad]")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("dataset export", flag.ExitOnError)
+	in := fs.String("in", cmp.Or(cfg.FeedbackFile, dataset.DefaultPath()), "Feedback file written by markGood and markBad")
+	out := fs.String("out", "-", "Output JSONL file (- = stdout)")
+	includeBad := fs.Bool("include-bad", false, "Also export completions marked bad, labelled as such")
+	fs.Parse(args[1:])
+
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	stats, err := dataset.Export(*in, w, dataset.ExportOptions{IncludeBad: *includeBad})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprint(os.Stderr, stats)
+}
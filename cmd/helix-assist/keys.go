@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/leona/helix-assist/internal/handlers"
+)
+
+// runKeys implements `helix-assist keys [prefix]`, printing a Helix
+// keybinding block for the server's commands.
+func runKeys(args []string) {
+	prefix := handlers.DefaultKeyPrefix
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	bindings, err := handlers.KeyBindings(prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Print(bindings)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// acceptEditor listens on the --listen address and returns the first
+// connection, over which the session then runs as it would over stdio.
+// The listener is closed once the editor connected.
+func acceptEditor(cfg *config.Config, logger *lsp.Logger) (net.Conn, error) {
+	listener, err := listenEditors(cfg, cfg.Listen, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("Editor connected from", conn.RemoteAddr().String())
+	return conn, nil
+}
+
+// listenEditors opens the listener of a --listen address, in place of a
+// stale socket left at a unix path. Addresses beyond loopback are refused
+// unless editors sign in with a token of the --users file or
+// --listen-public opts in.
+func listenEditors(cfg *config.Config, listen string, logger *lsp.Logger) (net.Listener, error) {
+	network, address, err := config.ParseListen(listen)
+	if err != nil {
+		return nil, err
+	}
+	public := false
+	if network == "tcp" && cfg.Users == "" {
+		host, _, _ := net.SplitHostPort(address)
+		public = !isLoopback(host)
+	}
+	if public && !cfg.ListenPublic {
+		return nil, fmt.Errorf("refusing to listen on %s, which accepts unauthenticated connections, without --users or --listen-public", address)
+	}
+	if network == "unix" {
+		removeStaleSocket(address)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whoever connects can read the workspace, so the socket is the user's
+	// alone.
+	if network == "unix" {
+		if err := os.Chmod(address, 0o600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	if public {
+		fmt.Fprintf(os.Stderr, "Warning: %s accepts unauthenticated connections, keep it behind a firewall or tunnel\n", listener.Addr())
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for the editor on %s:%s\n", network, listener.Addr())
+	logger.Log("LSP service waiting for the editor on", network, listener.Addr().String())
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket a previous server left behind, so
+// listening on its path does not fail. Other files are left alone.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != fs.ModeSocket {
+		return
+	}
+	// A socket something still listens on is in use, not stale.
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: could not remove stale socket %s: %s\n", path, err.Error())
+	}
+}
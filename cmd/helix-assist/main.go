@@ -1,12 +1,16 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/events"
 	"github.com/leona/helix-assist/internal/handlers"
 	"github.com/leona/helix-assist/internal/lsp"
 	"github.com/leona/helix-assist/internal/providers"
@@ -14,9 +18,29 @@ import (
 
 var Version = "dev"
 
+// shutdownGrace bounds how long shutdown waits for cancelled provider
+// requests to return.
+const shutdownGrace = 2 * time.Second
+
 func main() {
 	cfg := config.Load()
 
+	// `helix-assist keys` needs no provider, so it runs before validation.
+	if args := flag.Args(); len(args) > 0 && args[0] == "keys" {
+		runKeys(args[1:])
+		return
+	}
+
+	// `helix-assist dataset ...` only reads local files.
+	if args := flag.Args(); len(args) > 0 && args[0] == "dataset" {
+		runDataset(cfg, args[1:])
+		return
+	}
+
+	if len(cfg.DeprecatedEnv) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: deprecated environment variables, add the %s prefix: %s\n", config.EnvPrefix, strings.Join(cfg.DeprecatedEnv, ", "))
+	}
+
 	if err := cfg.Validate(); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
 		os.Exit(1)
@@ -26,18 +50,30 @@ func main() {
 	defer logger.Close()
 	logger.Log("Starting helix-assist", "handler:", cfg.Handler)
 	logger.Log("triggerCharacters:", cfg.TriggerCharacters)
+	if len(cfg.DeprecatedEnv) > 0 {
+		logger.Log("Deprecated environment variables in use, rename to "+config.EnvPrefix+"*:", strings.Join(cfg.DeprecatedEnv, ", "))
+	}
 	registry := providers.NewRegistry()
+	registry.SetLogger(logger)
+
+	providers.SetConcurrencyLimits(cfg.ConcurrencyLimits, time.Duration(cfg.ConcurrencyQueueTimeout)*time.Millisecond, logger)
+
+	if err := providers.LoadFIMTemplates(cfg.FIMTemplates); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := providers.ConfigureTLS(providers.TLSOptions{
+		CAFile:   cfg.TLSCAFile,
+		CertFile: cfg.TLSClientCert,
+		KeyFile:  cfg.TLSClientKey,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
 
 	if cfg.OpenAIKey != "" {
-		openaiProvider := providers.NewOpenAIProvider(
-			cfg.OpenAIKey,
-			cfg.OpenAIModel,
-			cfg.OpenAIModelForChat,
-			cfg.OpenAIEndpoint,
-			cfg.FetchTimeout,
-			logger,
-		)
-		registry.Register("openai", openaiProvider)
+		registry.Register("openai", newKeyedProvider(cfg, "openai", logger))
 		chatModel := cfg.OpenAIModelForChat
 		if chatModel == "" {
 			chatModel = cfg.OpenAIModel
@@ -46,15 +82,7 @@ func main() {
 	}
 
 	if cfg.AnthropicKey != "" {
-		anthropicProvider := providers.NewAnthropicProvider(
-			cfg.AnthropicKey,
-			cfg.AnthropicModel,
-			cfg.AnthropicModelForChat,
-			cfg.AnthropicEndpoint,
-			cfg.FetchTimeout,
-			logger,
-		)
-		registry.Register("anthropic", anthropicProvider)
+		registry.Register("anthropic", newKeyedProvider(cfg, "anthropic", logger))
 		chatModel := cfg.AnthropicModelForChat
 		if chatModel == "" {
 			chatModel = cfg.AnthropicModel
@@ -62,11 +90,42 @@ func main() {
 		logger.Log("Registered Anthropic provider", "completion model:", cfg.AnthropicModel, "chat model:", chatModel)
 	}
 
+	if cfg.TogetherKey != "" {
+		registry.Register("together", newKeyedProvider(cfg, "together", logger))
+		chatModel := cfg.TogetherModelForChat
+		if chatModel == "" {
+			chatModel = cfg.TogetherModel
+		}
+		logger.Log("Registered Together AI provider", "completion model:", cfg.TogetherModel, "chat model:", chatModel, "fim:", cfg.TogetherUseFIM)
+	}
+
+	if cfg.XAIKey != "" {
+		registry.Register("xai", newKeyedProvider(cfg, "xai", logger))
+		chatModel := cfg.XAIModelForChat
+		if chatModel == "" {
+			chatModel = cfg.XAIModel
+		}
+		logger.Log("Registered xAI provider", "completion model:", cfg.XAIModel, "chat model:", chatModel)
+	}
+
+	if cfg.DeepSeekKey != "" {
+		registry.Register("deepseek", newKeyedProvider(cfg, "deepseek", logger))
+		chatModel := cfg.DeepSeekModelForChat
+		if chatModel == "" {
+			chatModel = cfg.DeepSeekModel
+		}
+		logger.Log("Registered DeepSeek provider", "completion model:", cfg.DeepSeekModel, "chat model:", chatModel, "fim:", cfg.DeepSeekUseFIM)
+	}
+
 	{
 		ollamaProvider := providers.NewOllamaProvider(
 			cfg.OllamaModel,
 			cfg.OllamaModelForChat,
 			cfg.OllamaEndpoint,
+			cfg.OllamaKeepAlive,
+			providers.DedupStrictness(cfg.DedupStrictness),
+			cfg.TrustModel,
+			cfg.OllamaAutoPull,
 			cfg.FetchTimeout,
 			logger,
 		)
@@ -78,37 +137,291 @@ func main() {
 		logger.Log("Registered Ollama provider", "completion model:", cfg.OllamaModel, "chat model:", chatModel)
 	}
 
+	if cfg.VLLMModel != "" {
+		vllmProvider := providers.NewVLLMProvider(
+			cfg.VLLMKey,
+			cfg.VLLMModel,
+			cfg.VLLMModelForChat,
+			cfg.VLLMEndpoint,
+			providers.VLLMOptions{
+				UseSuffix: cfg.VLLMUseSuffix,
+				BestOf:    cfg.VLLMBestOf,
+				TopK:      cfg.VLLMTopK,
+			},
+			cfg.FetchTimeout,
+			logger,
+		)
+		registry.Register("vllm", vllmProvider)
+		chatModel := cfg.VLLMModelForChat
+		if chatModel == "" {
+			chatModel = cfg.VLLMModel
+		}
+		logger.Log("Registered vLLM provider", "completion model:", cfg.VLLMModel, "chat model:", chatModel, "suffix:", cfg.VLLMUseSuffix)
+	}
+
+	if cfg.ReplicateKey != "" {
+		registry.Register("replicate", newKeyedProvider(cfg, "replicate", logger))
+		chatModel := cfg.ReplicateModelForChat
+		if chatModel == "" {
+			chatModel = cfg.ReplicateModel
+		}
+		logger.Log("Registered Replicate provider", "completion model:", cfg.ReplicateModel, "chat model:", chatModel)
+	}
+
+	if cfg.VertexProject != "" {
+		vertexProvider := providers.NewVertexProvider(
+			cfg.VertexProject,
+			cfg.VertexLocation,
+			cfg.VertexModel,
+			cfg.VertexModelForChat,
+			cfg.VertexCredentials,
+			cfg.FetchTimeout,
+			logger,
+		)
+		registry.Register("vertex", vertexProvider)
+		chatModel := cfg.VertexModelForChat
+		if chatModel == "" {
+			chatModel = cfg.VertexModel
+		}
+		logger.Log("Registered Vertex AI provider", "completion model:", cfg.VertexModel, "chat model:", chatModel)
+	}
+
+	if cfg.GGUFModelPath != "" {
+		if !providers.GGUFAvailable {
+			logger.Log("GGUF_MODEL_PATH is set but this binary was built without llama support")
+		}
+		ggufProvider := providers.NewGGUFProvider(
+			cfg.GGUFModelPath,
+			providers.GGUFOptions{
+				ContextSize: cfg.GGUFContextSize,
+				Threads:     cfg.GGUFThreads,
+				GPULayers:   cfg.GGUFGPULayers,
+			},
+			logger,
+		)
+		registry.Register("gguf", ggufProvider)
+		logger.Log("Registered GGUF provider", "model path:", cfg.GGUFModelPath)
+	}
+
+	if cfg.CustomEndpoint != "" {
+		bodyOverrides, _ := cfg.CustomBodyOverridesMap()
+		customProvider := providers.NewCustomProvider(
+			cfg.CustomModel,
+			cfg.CustomModelForChat,
+			cfg.CustomEndpoint,
+			providers.CustomOptions{
+				AuthHeader:     cfg.CustomAuthHeader,
+				AuthValue:      cfg.CustomAuthValue,
+				Headers:        cfg.CustomHeaders,
+				BodyOverrides:  bodyOverrides,
+				ChatPath:       cfg.CustomChatPath,
+				CompletionPath: cfg.CustomCompletionPath,
+			},
+			cfg.FetchTimeout,
+			logger,
+		)
+		registry.Register("custom", customProvider)
+		logger.Log("Registered custom provider", "endpoint:", cfg.CustomEndpoint, "model:", cfg.CustomModel)
+	}
+
+	{
+		tabbyProvider := providers.NewTabbyProvider(
+			cfg.TabbyKey,
+			cfg.TabbyEndpoint,
+			cfg.FetchTimeout,
+			logger,
+		)
+		registry.Register("tabby", tabbyProvider)
+		logger.Log("Registered Tabby provider", "endpoint:", cfg.TabbyEndpoint)
+	}
+
+	providers.SetReasoningTags(cfg.ReasoningTags)
+	providers.SetContextWindow(providers.ContextWindow{
+		Tokens:        cfg.ContextTokens,
+		PrefixShare:   cfg.ContextPrefixShare,
+		SuffixShare:   cfg.ContextSuffixShare,
+		SkeletonShare: cfg.ContextSkeletonShare,
+	})
+	providers.SetRetryPolicy(cfg.RetryMaxAttempts, time.Duration(cfg.RetryBaseDelay)*time.Millisecond, logger)
+
 	if err := registry.SetCurrent(cfg.Handler); err != nil {
 		fmt.Fprintf(os.Stderr, "Provider error: %s\n", err.Error())
 		os.Exit(1)
 	}
 
+	if cfg.FallbackHandler != "" {
+		probeInterval := time.Duration(cfg.QuotaProbeInterval) * time.Minute
+		if err := registry.SetFallback(cfg.FallbackHandler, cfg.QuotaFailureThreshold, probeInterval); err != nil {
+			fmt.Fprintf(os.Stderr, "Provider error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		logger.Log("Fallback provider:", cfg.FallbackHandler, "after", cfg.QuotaFailureThreshold, "quota errors")
+	}
+
+	for _, task := range []struct{ kind, value string }{
+		{providers.CallCompletion, cfg.CompletionHandler},
+		{providers.CallChat, cfg.ChatHandler},
+	} {
+		if task.value == "" {
+			continue
+		}
+		name, model := config.SplitHandler(task.value)
+		if err := registry.SetTaskRoute(task.kind, name, model); err != nil {
+			fmt.Fprintf(os.Stderr, "Provider error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		logger.Log("Routing", task.kind, "requests to", task.value)
+	}
+
+	if cfg.RaceHandler != "" {
+		if err := registry.SetRival(cfg.RaceHandler); err != nil {
+			fmt.Fprintf(os.Stderr, "Provider error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		logger.Log("Racing completions against:", cfg.RaceHandler)
+	}
+
+	registry.SetCompletionCache(cfg.CompletionCacheSize, time.Duration(cfg.CompletionCacheTTL)*time.Second)
+
+	if cfg.CircuitFailureThreshold > 0 {
+		registry.SetCircuitBreaker(cfg.CircuitFailureThreshold, time.Duration(cfg.CircuitCooldown)*time.Second)
+	}
+
+	bus := events.NewBus()
+	registry.Use(events.ProviderErrors(bus))
+	trust := handlers.NewWorkspaceTrust(cfg)
+
+	// `helix-assist [flags] new <kind> ...` creates files from a template.
+	if args := flag.Args(); len(args) > 0 && args[0] == "new" {
+		useWorkingDirectory(cfg, registry, trust, bus, logger)
+		runNew(cfg, registry, args[1:])
+		return
+	}
+
+	// `helix-assist [flags] complete-stdin ...` completes one document
+	// without an editor session.
+	if args := flag.Args(); len(args) > 0 && args[0] == "complete-stdin" {
+		useWorkingDirectory(cfg, registry, trust, bus, logger)
+		runCompleteStdin(cfg, registry, logger, args[1:])
+		return
+	}
+
+	// `helix-assist [flags] serve-api ...` serves the providers over an
+	// OpenAI-compatible HTTP API instead of LSP.
+	if args := flag.Args(); len(args) > 0 && args[0] == "serve-api" {
+		useWorkingDirectory(cfg, registry, trust, bus, logger)
+		runServeAPI(cfg, registry, logger, args[1:])
+		return
+	}
+
+	if cfg.ListModels {
+		listModels(cfg, registry)
+		return
+	}
+
 	if cfg.DebugQuery != "" {
 		logger.Log("Debug mode: testing provider with query:", cfg.DebugQuery)
+		useWorkingDirectory(cfg, registry, trust, bus, logger)
 		debugMode(cfg, registry, logger)
 		return
 	}
 
-	capabilities := lsp.ServerCapabilities{
-		TextDocumentSync: 1,
-		CompletionProvider: &lsp.CompletionOptions{
-			TriggerCharacters: cfg.TriggerCharacters,
-		},
-		CodeActionProvider: true,
-		ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
-			Commands: handlers.CommandKeys(),
-		},
+	// Background work stops when the server shuts down.
+	background, stopBackground := context.WithCancel(context.Background())
+	if cfg.CircuitFailureThreshold > 0 && cfg.HealthCheckInterval > 0 {
+		registry.StartHealthChecks(background, time.Duration(cfg.HealthCheckInterval)*time.Second)
+	}
+	accounts, err := loadAccounts(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if cfg.IdleRelease > 0 {
+		registry.StartIdleRelease(background, time.Duration(cfg.IdleRelease)*time.Second, func() {
+			saveUsage(cfg, logger, registry, accounts)
+		})
+	}
+	lowPower := handlers.NewLowPowerMode(cfg, registry)
+	if cfg.LowPower {
+		logger.Log(lowPower.Set(true))
+	}
+	deps := sessionDeps{
+		cfg:        cfg,
+		registry:   registry,
+		lowPower:   lowPower,
+		trust:      trust,
+		logger:     logger,
+		accounts:   accounts,
+		background: background,
 	}
 
-	svc := lsp.NewService(capabilities, logger, Version)
-	completionHandler := handlers.NewCompletionHandler(cfg, registry)
-	completionHandler.Register(svc)
-	actionHandler := handlers.NewActionHandler(cfg, registry)
-	actionHandler.Register(svc)
-	logger.Log("LSP service initialized, listening on stdin")
+	// `helix-assist [flags] daemon` serves every editor that connects to
+	// --listen from this one process.
+	if args := flag.Args(); len(args) > 0 && args[0] == "daemon" {
+		runDaemon(deps, stopBackground)
+		return
+	}
 
-	if err := svc.Start(); err != nil {
+	svc, err := newSession(deps, bus)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	registry.SetNotifier(func(message string) {
+		svc.SendShowMessage(lsp.MessageTypeWarning, message)
+	})
+	registry.SetPolicy(func(ctx context.Context, name string) error {
+		return trust.PermitProvider(cmp.Or(providers.Workspace(ctx), svc.RootPath()), name)
+	})
+	svc.OnShutdown(func() {
+		stopBackground()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		registry.Shutdown(ctx)
+		saveUsage(cfg, logger, registry, accounts)
+	})
+	if network, _, _ := config.ParseListen(cfg.Listen); network != "" {
+		conn, err := acceptEditor(cfg, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Listen error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer conn.Close()
+		svc.SetTransport(conn, conn)
+	} else {
+		logger.Log("LSP service initialized, listening on stdin")
+	}
+
+	err = svc.Start()
+	// The editor closed the connection without sending exit.
+	svc.Shutdown()
+	if err != nil {
 		logger.Log("LSP service error:", err.Error())
+	}
+	logger.Close()
+	if err != nil || !svc.ShutdownRequested() {
+		os.Exit(1)
+	}
+}
+
+// useWorkingDirectory makes the current directory the workspace of a
+// command run without an editor: its trust level gates providers and
+// hooks, which run in it.
+func useWorkingDirectory(cfg *config.Config, registry *providers.Registry, trust *handlers.WorkspaceTrust, bus *events.Bus, logger *lsp.Logger) {
+	cwd, _ := os.Getwd()
+	registry.SetPolicy(func(ctx context.Context, name string) error {
+		return trust.PermitProvider(cmp.Or(providers.Workspace(ctx), cwd), name)
+	})
+	if err := events.RunHooks(bus, events.HookOptions{
+		Commands: cfg.Hooks,
+		Timeout:  time.Duration(cfg.HookTimeout) * time.Second,
+		Dir:      func() string { return cwd },
+		Allow: func() bool {
+			return trust.Level(cwd).AllowsExternalCommands()
+		},
+		Logger: logger,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
 		os.Exit(1)
 	}
 }
@@ -129,6 +442,22 @@ func detectLanguage(content string) string {
 	}
 }
 
+// listModels prints the models served by the selected handler, one per line.
+func listModels(cfg *config.Config, registry *providers.Registry) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.FetchTimeout)*time.Millisecond)
+	defer cancel()
+
+	models, err := registry.ListModels(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, model := range models {
+		fmt.Println(model)
+	}
+}
+
 func debugMode(cfg *config.Config, registry *providers.Registry, logger *lsp.Logger) {
 	ctx := context.Background()
 	logger.Log("Calling completion with query:", cfg.DebugQuery)
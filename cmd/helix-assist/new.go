@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/scaffold"
+)
+
+// runNew implements `helix-assist new <kind> [name=value...]`, creating files
+// from a template in the current directory after confirmation.
+func runNew(cfg *config.Config, registry *providers.Registry, args []string) {
+	root, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	dirs := scaffold.Dirs(root, cfg.TemplatesDir)
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: helix-assist [flags] new <kind> [name=value...]")
+		if kinds := scaffold.Kinds(dirs...); len(kinds) > 0 {
+			fmt.Fprintf(os.Stderr, "Available kinds: %s\n", strings.Join(kinds, ", "))
+		} else {
+			fmt.Fprintf(os.Stderr, "No templates found in: %s\n", strings.Join(dirs, ", "))
+		}
+		os.Exit(1)
+	}
+
+	vars := make(map[string]string)
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid variable %q, expected name=value\n", arg)
+			os.Exit(1)
+		}
+		vars[name] = value
+	}
+
+	tmpl, err := scaffold.Load(args[0], dirs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.BlockTimeout)*time.Millisecond)
+	defer cancel()
+
+	fmt.Printf("Filling in template %s with %s...\n", tmpl.Kind, cfg.Handler)
+	files, err := scaffold.Render(ctx, registry, tmpl, vars, root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, file := range files {
+		rel, _ := filepath.Rel(root, file.Path)
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println(rel)
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println(file.Content)
+	}
+
+	fmt.Printf("Write %d file(s)? [y/N] ", len(files))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		fmt.Println("Aborted")
+		return
+	}
+
+	if err := scaffold.Write(files); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("Done")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// newKeyedProvider builds the named provider that authenticates with an
+// API key, with the key and models of cfg. Users of a shared server get
+// their own, built from the server's configuration with their keys.
+func newKeyedProvider(cfg *config.Config, name string, logger *lsp.Logger) providers.Provider {
+	switch name {
+	case "anthropic":
+		return providers.NewAnthropicProvider(
+			cfg.AnthropicKey,
+			cfg.AnthropicModel,
+			cfg.AnthropicModelForChat,
+			cfg.AnthropicEndpoint,
+			cfg.FetchTimeout,
+			logger,
+		)
+	case "deepseek":
+		return providers.NewDeepSeekProvider(
+			cfg.DeepSeekKey,
+			cfg.DeepSeekModel,
+			cfg.DeepSeekModelForChat,
+			cfg.DeepSeekEndpoint,
+			cfg.DeepSeekUseFIM,
+			cfg.FetchTimeout,
+			logger,
+		)
+	case "openai":
+		return providers.NewOpenAIProvider(
+			cfg.OpenAIKey,
+			cfg.OpenAIModel,
+			cfg.OpenAIModelForChat,
+			cfg.OpenAIEndpoint,
+			cfg.OpenAIUseFIM,
+			cfg.FetchTimeout,
+			logger,
+		)
+	case "replicate":
+		return providers.NewReplicateProvider(
+			cfg.ReplicateKey,
+			cfg.ReplicateModel,
+			cfg.ReplicateModelForChat,
+			cfg.ReplicateEndpoint,
+			cfg.FetchTimeout,
+			logger,
+		)
+	case "together":
+		return providers.NewTogetherProvider(
+			cfg.TogetherKey,
+			cfg.TogetherModel,
+			cfg.TogetherModelForChat,
+			cfg.TogetherEndpoint,
+			cfg.TogetherUseFIM,
+			cfg.FetchTimeout,
+			logger,
+		)
+	case "xai":
+		return providers.NewXAIProvider(
+			cfg.XAIKey,
+			cfg.XAIModel,
+			cfg.XAIModelForChat,
+			cfg.XAIEndpoint,
+			cfg.FetchTimeout,
+			logger,
+		)
+	}
+	return nil
+}
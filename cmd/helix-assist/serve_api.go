@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/leona/helix-assist/internal/apiserver"
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// runServeAPI implements `helix-assist serve-api [--addr HOST:PORT]
+// [--token TOKEN]`, serving an OpenAI-compatible API over the configured
+// providers until interrupted.
+func runServeAPI(cfg *config.Config, registry *providers.Registry, logger *lsp.Logger, args []string) {
+	fs := flag.NewFlagSet("serve-api", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8765", "Address to listen on")
+	token := fs.String("token", os.Getenv(config.EnvPrefix+"API_TOKEN"), "Bearer token clients must send (env: "+config.EnvPrefix+"API_TOKEN)")
+	fs.Parse(args)
+
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid address %q: %s\n", *addr, err.Error())
+		os.Exit(2)
+	}
+	// The API spends the configured keys, so it is only opened beyond this
+	// machine behind a token.
+	if !isLoopback(host) && *token == "" {
+		fmt.Fprintf(os.Stderr, "Refusing to listen on %s without --token\n", *addr)
+		os.Exit(2)
+	}
+
+	server := &http.Server{
+		Addr: *addr,
+		Handler: apiserver.New(registry, logger, apiserver.Options{
+			Token:             *token,
+			ChatTimeout:       time.Duration(cfg.ActionTimeout) * time.Millisecond,
+			CompletionTimeout: time.Duration(cfg.CompletionTimeout) * time.Millisecond,
+		}).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving the OpenAI-compatible API on http://%s/v1\n", *addr)
+	logger.Log("serve-api listening on", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "serve-api: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/handlers"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// sessionDeps is what the editor sessions of a process share: the
+// providers with their connections, caches and usage, and the settings
+// that span workspaces.
+type sessionDeps struct {
+	cfg      *config.Config
+	registry *providers.Registry
+	lowPower *handlers.LowPowerMode
+	trust    *handlers.WorkspaceTrust
+	logger   *lsp.Logger
+	// accounts are the users of the --users file, one of whom every
+	// session must sign in as when there are any.
+	accounts []userAccount
+	// background is cancelled when the process shuts down.
+	background context.Context
+}
+
+// newSession returns a Service for one editor, with handlers of its own
+// publishing to bus. Hooks subscribed to bus run in the session's
+// workspace. Closing the session cancels the provider requests it made.
+func newSession(deps sessionDeps, bus *events.Bus) (*lsp.Service, error) {
+	cfg := deps.cfg
+	capabilities := lsp.ServerCapabilities{
+		TextDocumentSync: lsp.TextDocumentSyncOptions{OpenClose: true, Change: lsp.TextDocumentSyncIncremental},
+		CompletionProvider: &lsp.CompletionOptions{
+			TriggerCharacters: cfg.TriggerCharacters,
+			ResolveProvider:   true,
+		},
+		InlineCompletionProvider: cfg.Presentation == "auto" || cfg.Presentation == "inline",
+		CodeActionProvider:       true,
+		CodeLensProvider:         &lsp.CodeLensOptions{ResolveProvider: true},
+		ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
+			Commands: handlers.CommandKeys(),
+		},
+	}
+
+	svc := lsp.NewService(capabilities, deps.logger, Version)
+	// The session switches providers without switching those of others,
+	// and its provider errors reach its own hooks.
+	svc.SetContext(events.WithBus(providers.WithSelection(deps.background, providers.NewSelection("")), bus))
+	if len(deps.accounts) > 0 {
+		svc.SetAuthenticator(authenticator(deps.accounts, deps.logger))
+	}
+	if cfg.WarmUp {
+		// Warm up once the workspace, and so its trust level, is known.
+		svc.On(lsp.EventInitialized, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+			deps.registry.WarmUp(providers.WithWorkspace(svc.Context(), svc.RootPath()))
+		})
+	}
+	if err := events.RunHooks(bus, events.HookOptions{
+		Commands: cfg.Hooks,
+		Timeout:  time.Duration(cfg.HookTimeout) * time.Second,
+		Dir:      svc.RootPath,
+		Allow: func() bool {
+			return deps.trust.Level(svc.RootPath()).AllowsExternalCommands()
+		},
+		Logger: deps.logger,
+	}); err != nil {
+		return nil, err
+	}
+
+	handlers.NewCompletionHandler(cfg, deps.registry, deps.lowPower, bus).Register(svc)
+	handlers.NewActionHandler(cfg, deps.registry, deps.lowPower, deps.trust, bus).Register(svc)
+	return svc, nil
+}
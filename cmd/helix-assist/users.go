@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// userAccount is a user of a shared server with the token they connect
+// with.
+type userAccount struct {
+	token   string
+	account *providers.Account
+}
+
+// loadAccounts returns the users of the --users file, each with providers
+// of their own for the keys they brought. Without the file there are none
+// and editors connect without a token.
+func loadAccounts(cfg *config.Config, logger *lsp.Logger) ([]userAccount, error) {
+	if cfg.Users == "" {
+		return nil, nil
+	}
+	users, err := config.LoadUsers(cfg.Users)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []userAccount
+	for _, name := range slices.Sorted(maps.Keys(users)) {
+		user := users[name]
+		userCfg := cfg.WithKeys(user.Keys)
+		own := make(map[string]providers.Provider, len(user.Keys))
+		for provider := range user.Keys {
+			own[provider] = newKeyedProvider(userCfg, provider, logger)
+		}
+		accounts = append(accounts, userAccount{token: user.Token, account: providers.NewAccount(name, own)})
+		logger.Log("User", name, "with keys for:", strings.Join(slices.Sorted(maps.Keys(user.Keys)), ", "))
+	}
+	return accounts, nil
+}
+
+// authenticator accepts the editors whose initializationOptions carry the
+// token of one of accounts, and makes the session's requests for that
+// user.
+func authenticator(accounts []userAccount, logger *lsp.Logger) func(ctx context.Context, options json.RawMessage) (context.Context, error) {
+	return func(ctx context.Context, options json.RawMessage) (context.Context, error) {
+		var opts struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(options, &opts)
+		if opts.Token == "" {
+			return nil, errors.New("this server needs a token in initializationOptions")
+		}
+		for _, user := range accounts {
+			if subtle.ConstantTimeCompare([]byte(opts.Token), []byte(user.token)) == 1 {
+				logger.Log("Editor signed in as", user.account.Name)
+				return providers.WithAccount(ctx, user.account), nil
+			}
+		}
+		return nil, errors.New("unknown token")
+	}
+}
+
+// saveUsage logs the usage of the process and of each user, and adds what
+// came since the last save to the --usage-file so totals survive restarts.
+// It runs on shutdown and after each idle release.
+func saveUsage(cfg *config.Config, logger *lsp.Logger, registry *providers.Registry, accounts []userAccount) {
+	path := usageFile(cfg)
+	save := func(tracker *providers.UsageTracker, user string) {
+		if path == "" {
+			return
+		}
+		if err := tracker.Append(path, user); err != nil {
+			logger.Log("could not save usage:", err.Error())
+		}
+	}
+
+	logger.Log(registry.Usage().Summary())
+	save(registry.Usage(), "")
+	for _, user := range accounts {
+		logger.Log(user.account.Name+":", user.account.Usage().Summary())
+		save(user.account.Usage(), user.account.Name)
+	}
+}
+
+// usageFile returns the path usage is saved to, or "" when it is not.
+func usageFile(cfg *config.Config) string {
+	switch cfg.UsageFile {
+	case "none":
+		return ""
+	case "":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(dir, "helix-assist", "usage.jsonl")
+	}
+	return cfg.UsageFile
+}
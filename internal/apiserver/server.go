@@ -0,0 +1,390 @@
+// Package apiserver serves an OpenAI-compatible HTTP API backed by a
+// provider registry, so other local tools get the same routing, fallbacks,
+// caching and middleware as the editor.
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// DefaultModel is the model name that uses the registry's own routing.
+// Any other name is a provider, optionally with a model: "ollama" or
+// "ollama:qwen2.5-coder:7b".
+const DefaultModel = "helix-assist"
+
+// maxBodyBytes bounds request bodies.
+const maxBodyBytes = 4 << 20
+
+// maxChoices bounds the n of a completion request, as num-suggestions is
+// bounded for the editor.
+const maxChoices = 10
+
+// Options configure a Server.
+type Options struct {
+	// Token, when set, is required as a bearer token on every request.
+	Token string
+	// ChatTimeout and CompletionTimeout bound each request.
+	ChatTimeout       time.Duration
+	CompletionTimeout time.Duration
+}
+
+// Server answers /v1/chat/completions, /v1/completions and /v1/models.
+type Server struct {
+	registry *providers.Registry
+	logger   *lsp.Logger
+	opts     Options
+	nextID   atomic.Int64
+}
+
+func New(registry *providers.Registry, logger *lsp.Logger, opts Options) *Server {
+	return &Server{registry: registry, logger: logger, opts: opts}
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("POST /v1/completions", s.completions)
+	mux.HandleFunc("GET /v1/models", s.models)
+	return s.authorize(mux)
+}
+
+// authorize checks the bearer token. Without one, only requests a web page
+// cannot forge are served: a page may post a form to localhost, or rebind
+// its own host name to 127.0.0.1, but sends neither a JSON body nor a
+// loopback Host.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.Token != "" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid_request_error", "missing or invalid bearer token")
+				return
+			}
+		} else if !isLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, "invalid_request_error", "requests without a token must be made to a loopback host, got "+r.Host)
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, "invalid_request_error", "request body must be sent as application/json")
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type chatMessage struct {
+	Role string `json:"role"`
+	// Content is a string or an array of content parts, of which only text
+	// parts are used.
+	Content json.RawMessage `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type completionRequest struct {
+	Model string `json:"model"`
+	// Prompt is a string or an array holding one string.
+	Prompt json.RawMessage `json:"prompt"`
+	Suffix string          `json:"suffix"`
+	N      int             `json:"n"`
+	Stream bool            `json:"stream"`
+	// Language and File are extensions giving the provider the context an
+	// editor would.
+	Language string `json:"language"`
+	File     string `json:"file"`
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+
+	systemPrompt, userPrompt, err := flattenMessages(req.Messages)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	ctx, cancel := s.requestContext(r, req.Model, s.opts.ChatTimeout)
+	defer cancel()
+	id := fmt.Sprintf("chatcmpl-%d", s.nextID.Add(1))
+	model := modelName(req.Model)
+
+	if req.Stream {
+		stream := newEventStream(w)
+		_, err := s.registry.ChatStream(ctx, systemPrompt, userPrompt, func(delta string) error {
+			return stream.send(chatChunk(id, model, map[string]string{"content": delta}, nil))
+		})
+		s.finishStream(stream, err, chatChunk(id, model, map[string]string{}, "stop"))
+		return
+	}
+
+	resp, err := s.registry.Chat(ctx, systemPrompt, userPrompt)
+	if err != nil {
+		s.writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": resp.Result},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+func (s *Server) completions(w http.ResponseWriter, r *http.Request) {
+	var req completionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+
+	prompt, err := promptText(req.Prompt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if req.N < 0 || req.N > maxChoices {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("n must be between 1 and %d, got %d", maxChoices, req.N))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r, req.Model, s.opts.CompletionTimeout)
+	defer cancel()
+	id := fmt.Sprintf("cmpl-%d", s.nextID.Add(1))
+	model := modelName(req.Model)
+	completion := providers.CompletionRequest{ContentBefore: prompt, ContentAfter: req.Suffix}
+	languageID := req.Language
+	if languageID == "" {
+		languageID = "plaintext"
+	}
+
+	if req.Stream {
+		stream := newEventStream(w)
+		_, err := s.registry.CompletionStream(ctx, completion, req.File, languageID, func(delta string) error {
+			return stream.send(completionChunk(id, model, []map[string]any{{"index": 0, "text": delta, "finish_reason": nil}}))
+		})
+		s.finishStream(stream, err, completionChunk(id, model, []map[string]any{{"index": 0, "text": "", "finish_reason": "stop"}}))
+		return
+	}
+
+	texts, err := s.registry.Completion(ctx, completion, req.File, languageID, max(req.N, 1))
+	if err != nil {
+		s.writeProviderError(w, err)
+		return
+	}
+
+	choices := make([]map[string]any, len(texts))
+	for i, text := range texts {
+		choices[i] = map[string]any{"index": i, "text": text, "finish_reason": "stop"}
+	}
+	writeJSON(w, http.StatusOK, completionChunk(id, model, choices))
+}
+
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	data := []map[string]any{{"id": DefaultModel, "object": "model", "owned_by": "helix-assist"}}
+	for _, name := range s.registry.Names() {
+		data = append(data, map[string]any{"id": name, "object": "model", "owned_by": "helix-assist"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+// requestContext bounds a request by timeout, ending it early if the client
+// goes away, and routes it to the provider model names.
+func (s *Server) requestContext(r *http.Request, model string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	if model != "" && model != DefaultModel {
+		provider, providerModel := config.SplitHandler(model)
+		ctx = providers.WithOverride(ctx, provider, providerModel)
+	}
+	return ctx, cancel
+}
+
+func (s *Server) writeProviderError(w http.ResponseWriter, err error) {
+	kind := providers.KindOf(err)
+	s.logger.Log("api request failed:", kind, err.Error())
+
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || kind == providers.ErrorKindTimeout:
+		status = http.StatusGatewayTimeout
+	case kind == providers.ErrorKindQuota || kind == providers.ErrorKindOverloaded:
+		status = http.StatusTooManyRequests
+	case kind == providers.ErrorKindContextLength:
+		status = http.StatusBadRequest
+	}
+	writeError(w, status, "api_error", err.Error())
+}
+
+// finishStream ends a stream with last, or with the error that cut it
+// short.
+func (s *Server) finishStream(stream *eventStream, err error, last any) {
+	if err != nil {
+		s.logger.Log("api stream failed:", providers.KindOf(err), err.Error())
+		stream.send(map[string]any{"error": map[string]string{"message": err.Error(), "type": "api_error"}})
+	} else {
+		stream.send(last)
+	}
+	stream.done()
+}
+
+// flattenMessages turns a conversation into the system and user prompt a
+// provider takes. A single user message is sent as is; longer
+// conversations are sent as a transcript.
+func flattenMessages(messages []chatMessage) (string, string, error) {
+	var system []string
+	type turn struct{ role, text string }
+	var turns []turn
+
+	for _, message := range messages {
+		text, err := contentText(message.Content)
+		if err != nil {
+			return "", "", err
+		}
+		switch message.Role {
+		case "system", "developer":
+			system = append(system, text)
+		default:
+			turns = append(turns, turn{message.Role, text})
+		}
+	}
+
+	if len(turns) == 0 {
+		return "", "", errors.New("messages must include a user message")
+	}
+	if len(turns) == 1 {
+		return strings.Join(system, "\n\n"), turns[0].text, nil
+	}
+
+	var b strings.Builder
+	for i, t := range turns {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		role := t.role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		fmt.Fprintf(&b, "%s: %s", role, t.text)
+	}
+	return strings.Join(system, "\n\n"), b.String(), nil
+}
+
+func contentText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("message content must be a string or an array of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func promptText(raw json.RawMessage) (string, error) {
+	var prompt string
+	if err := json.Unmarshal(raw, &prompt); err == nil {
+		return prompt, nil
+	}
+
+	var prompts []string
+	if err := json.Unmarshal(raw, &prompts); err != nil || len(prompts) != 1 {
+		return "", errors.New("prompt must be a string or an array of one string")
+	}
+	return prompts[0], nil
+}
+
+// isLoopbackHost reports whether a Host header names this machine.
+func isLoopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func modelName(model string) string {
+	if model == "" {
+		return DefaultModel
+	}
+	return model
+}
+
+func chatChunk(id, model string, delta map[string]string, finishReason any) map[string]any {
+	return map[string]any{
+		"id":      id,
+		"object":  "chat.completion.chunk",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+	}
+}
+
+func completionChunk(id, model string, choices []map[string]any) map[string]any {
+	return map[string]any{
+		"id":      id,
+		"object":  "text_completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": choices,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]string{"message": message, "type": kind}})
+}
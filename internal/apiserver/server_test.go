@@ -0,0 +1,98 @@
+package apiserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leona/helix-assist/internal/apiserver"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	harness "github.com/leona/helix-assist/internal/testing"
+)
+
+func newServer(token string) http.Handler {
+	registry := providers.NewRegistry()
+	registry.Register("mock", &harness.MockProvider{Completions: []string{"one", "two"}, ChatResult: "hello"})
+	registry.SetCurrent("mock")
+	return apiserver.New(registry, lsp.NewLogger(""), apiserver.Options{
+		Token:             token,
+		ChatTimeout:       time.Second,
+		CompletionTimeout: time.Second,
+	}).Handler()
+}
+
+func TestRequests(t *testing.T) {
+	chat := `{"messages": [{"role": "user", "content": "hi"}]}`
+	tests := []struct {
+		name        string
+		token       string
+		method      string
+		path        string
+		host        string
+		contentType string
+		auth        string
+		body        string
+		status      int
+		contains    string
+	}{
+		{"chat", "", "POST", "/v1/chat/completions", "127.0.0.1:8765", "application/json", "", chat, 200, `"content":"hello"`},
+		{"charset", "", "POST", "/v1/chat/completions", "localhost:8765", "application/json; charset=utf-8", "", chat, 200, `"content":"hello"`},
+		{"completion", "", "POST", "/v1/completions", "[::1]:8765", "application/json", "", `{"prompt": "x", "n": 2}`, 200, `"text":"two"`},
+		{"models", "", "GET", "/v1/models", "127.0.0.1:8765", "", "", "", 200, `"id":"mock"`},
+		{"form post", "", "POST", "/v1/chat/completions", "127.0.0.1:8765", "application/x-www-form-urlencoded", "", chat, 415, "application/json"},
+		{"text post", "", "POST", "/v1/chat/completions", "127.0.0.1:8765", "text/plain", "", chat, 415, "application/json"},
+		{"rebound host", "", "POST", "/v1/chat/completions", "evil.example:8765", "application/json", "", chat, 403, "loopback"},
+		{"rebound models", "", "GET", "/v1/models", "evil.example", "", "", "", 403, "loopback"},
+		{"n too large", "", "POST", "/v1/completions", "127.0.0.1:8765", "application/json", "", `{"prompt": "x", "n": 1000}`, 400, "n must be"},
+		{"negative n", "", "POST", "/v1/completions", "127.0.0.1:8765", "application/json", "", `{"prompt": "x", "n": -1}`, 400, "n must be"},
+		{"missing token", "secret", "POST", "/v1/chat/completions", "127.0.0.1:8765", "application/json", "", chat, 401, "bearer token"},
+		{"wrong token", "secret", "POST", "/v1/chat/completions", "127.0.0.1:8765", "application/json", "Bearer nope", chat, 401, "bearer token"},
+		{"token any host", "secret", "POST", "/v1/chat/completions", "gpu-box:8765", "application/json", "Bearer secret", chat, 200, `"content":"hello"`},
+		{"token still needs json", "secret", "POST", "/v1/chat/completions", "gpu-box:8765", "text/plain", "Bearer secret", chat, 415, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Host = tt.host
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			newServer(tt.token).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("body %s does not contain %s", rec.Body, tt.contains)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("body is not JSON: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestStreamedChat(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Host = "127.0.0.1:8765"
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	newServer("").ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type %q, want text/event-stream", got)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"content":"hello"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("unexpected stream:\n%s", body)
+	}
+}
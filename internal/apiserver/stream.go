@@ -0,0 +1,48 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// eventStream writes server-sent events the way OpenAI streams responses:
+// one JSON object per data line, ended by [DONE].
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	flusher, _ := w.(http.Flusher)
+	return &eventStream{w: w, flusher: flusher}
+}
+
+func (s *eventStream) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+func (s *eventStream) done() {
+	s.write([]byte("[DONE]"))
+}
+
+func (s *eventStream) write(data []byte) error {
+	if !s.started {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
@@ -1,59 +1,300 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"os"
+	"net"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Handler                string
-	OpenAIKey              string
-	OpenAIModel            string
-	OpenAIModelForChat     string
-	OpenAIEndpoint         string
-	AnthropicKey           string
-	AnthropicModel         string
-	AnthropicModelForChat  string
-	AnthropicEndpoint      string
-	OllamaModel            string
-	OllamaModelForChat     string
-	OllamaEndpoint         string
-	Debounce               int
-	TriggerCharacters      []string
-	NumSuggestions         int
-	LogFile                string
-	FetchTimeout           int
-	ActionTimeout          int
-	CompletionTimeout      int
-	DebugQuery             string
-	EnableProgressSpinner  bool
-	ProgressUpdateInterval int
+	Handler               string
+	OpenAIKey             string
+	OpenAIModel           string
+	OpenAIModelForChat    string
+	OpenAIEndpoint        string
+	OpenAIUseFIM          bool
+	AnthropicKey          string
+	AnthropicModel        string
+	AnthropicModelForChat string
+	AnthropicEndpoint     string
+	OllamaModel           string
+	OllamaModelForChat    string
+	OllamaEndpoint        string
+	OllamaKeepAlive       string
+	OllamaAutoPull        bool
+	DedupStrictness       string
+	// CompletionCacheSize and CompletionCacheTTL bound the cache of
+	// completion results; a size of 0 disables it.
+	CompletionCacheSize int
+	CompletionCacheTTL  int
+	// Hooks maps event kinds to external commands run for each event.
+	Hooks       map[string][]string
+	HookTimeout int
+	// IssuePattern matches issue references, whose first group (or whole
+	// match) is the ID that IssueCommand looks up; IssueURL is a template
+	// with {id} linking to the issue.
+	IssuePattern string
+	IssueCommand string
+	IssueURL     string
+	// FeedbackFile is where markGood and markBad record completions; empty
+	// means helix-assist/feedback.jsonl in the user config directory.
+	FeedbackFile string
+	// UsageFile is where the token usage of each run is added on shutdown;
+	// empty means helix-assist/usage.jsonl in the user config directory,
+	// and "none" keeps it in the log only.
+	UsageFile  string
+	TrustModel bool
+	// FIMTemplates defines FIM prompt formats for further models, as a JSON
+	// array or the path of a JSON file.
+	FIMTemplates string
+	// DeleteSuffixOverlap removes the code after the cursor that a
+	// completion repeats with an additional edit; when off, the repeated
+	// end is cut from the completion instead.
+	DeleteSuffixOverlap bool
+	// MaxLineLength skips automatic completion on lines longer than this
+	// many characters, such as minified code. 0 disables the check.
+	MaxLineLength int
+	// Review sends files for an AI review in the background, publishing the
+	// findings as diagnostics: off, save (after each save) or idle (once
+	// editing pauses for ReviewIdle milliseconds).
+	Review     string
+	ReviewIdle int
+	// OnSave lists the checks run after each save, each publishing its
+	// findings as diagnostics: review, docstrings and fix (a dry run of
+	// fix & complete that reports what it would change). Empty runs none.
+	OnSave []string
+	// SaveCleanup answers willSaveWaitUntil with the model's trivial fixes,
+	// such as unused imports and obvious typos, applied by the editor
+	// before the file is written. The file is saved unchanged when they do
+	// not arrive within SaveCleanupTimeout milliseconds.
+	SaveCleanup        bool
+	SaveCleanupTimeout int
+	// ReasoningTags names the tags, such as think, whose blocks are
+	// stripped from model output. Empty disables stripping.
+	ReasoningTags []string
+	// ContextTokens is the budget for the code around the cursor sent with
+	// FIM completions, split between the prefix, the suffix and an outline
+	// of the rest of the file by the shares below.
+	ContextTokens           int
+	ContextPrefixShare      float64
+	ContextSuffixShare      float64
+	ContextSkeletonShare    float64
+	WarmUp                  bool
+	VLLMKey                 string
+	VLLMModel               string
+	VLLMModelForChat        string
+	VLLMEndpoint            string
+	VLLMUseSuffix           bool
+	VLLMBestOf              int
+	VLLMTopK                int
+	DeepSeekKey             string
+	DeepSeekModel           string
+	DeepSeekModelForChat    string
+	DeepSeekEndpoint        string
+	DeepSeekUseFIM          bool
+	XAIKey                  string
+	XAIModel                string
+	XAIModelForChat         string
+	XAIEndpoint             string
+	TogetherKey             string
+	TogetherModel           string
+	TogetherModelForChat    string
+	TogetherEndpoint        string
+	TogetherUseFIM          bool
+	ReplicateKey            string
+	ReplicateModel          string
+	ReplicateModelForChat   string
+	ReplicateEndpoint       string
+	VertexProject           string
+	VertexLocation          string
+	VertexModel             string
+	VertexModelForChat      string
+	VertexCredentials       string
+	TabbyKey                string
+	TabbyEndpoint           string
+	ManifestContext         bool
+	SnippetCompletions      bool
+	Presentation            string
+	BlameContext            bool
+	APIHintsDir             string
+	TemplatesDir            string
+	ResponseLanguage        string
+	PromptInstructions      string
+	ProjectInstructionsFile string
+	GGUFModelPath           string
+	GGUFContextSize         int
+	GGUFThreads             int
+	GGUFGPULayers           int
+	CustomEndpoint          string
+	CustomModel             string
+	CustomModelForChat      string
+	CustomAuthHeader        string
+	CustomAuthValue         string
+	CustomHeaders           map[string]string
+	CustomBodyOverrides     string
+	CustomChatPath          string
+	CustomCompletionPath    string
+	Debounce                int
+	TriggerCharacters       []string
+	NumSuggestions          int
+	LogFile                 string
+	Listen                  string
+	ListenPublic            bool
+	Users                   string
+	FetchTimeout            int
+	TLSCAFile               string
+	TLSClientCert           string
+	TLSClientKey            string
+	WorkspaceTrust          string
+	ActionTimeout           int
+	BlockTimeout            int
+	CompletionTimeout       int
+	DebugQuery              string
+	ListModels              bool
+	EnableProgressSpinner   bool
+	ProgressUpdateInterval  int
+	FallbackHandler         string
+	// CompletionHandler and ChatHandler route completions and code actions
+	// to their own provider, as "provider" or "provider:model".
+	CompletionHandler       string
+	ChatHandler             string
+	RaceHandler             string
+	QuotaFailureThreshold   int
+	QuotaProbeInterval      int
+	RetryMaxAttempts        int
+	RetryBaseDelay          int
+	ConcurrencyLimits       map[string]int
+	ConcurrencyQueueTimeout int
+	CircuitFailureThreshold int
+	CircuitCooldown         int
+	HealthCheckInterval     int
+	IdleRelease             int
+	OutputFilter            string
+	OutputFilterMinLength   int
+	ChangeBurstLines        int
+	ChangeBurstCooldown     int
+	LowPower                bool
+	LowPowerDebounce        int
+	LowPowerContextLines    int
+	LowPowerHandler         string
+	CompletionSort          string
+	CompletionSortThreshold float64
+	CombinedMode            bool
+	CombinedModeDelay       int
+	SkipLocalIdentifiers    bool
+	CancellableActions      bool
+	// StructuredActions asks providers that support it for code action
+	// results as JSON with the replacement, an explanation and a
+	// confidence.
+	StructuredActions bool
+	ActionPreview     bool
+	// DeprecatedEnv lists the unprefixed environment variables that were
+	// used, for a startup warning.
+	DeprecatedEnv []string
+
+	// loadProblems collects env values Load could not parse, for Validate.
+	loadProblems []string
 }
 
+// Limits enforced by Validate.
+const (
+	maxDebounce    = 5000
+	maxSuggestions = 10
+)
+
 func DefaultConfig() *Config {
 	return &Config{
-		Handler:                "openai",
-		OpenAIModel:            "gpt-4.1",
-		OpenAIModelForChat:     "gpt-5",
-		OpenAIEndpoint:         "https://api.openai.com/v1",
-		AnthropicModel:         "claude-haiku-4-5",
-		AnthropicModelForChat:  "claude-sonnet-4-5",
-		AnthropicEndpoint:      "https://api.anthropic.com",
-		OllamaModel:            "qwen2.5-coder",
-		OllamaModelForChat:     "qwen2.5-coder",
-		OllamaEndpoint:         "http://localhost:11434",
-		Debounce:               200,
-		TriggerCharacters:      []string{"{", "(", " "},
-		NumSuggestions:         1,
-		FetchTimeout:           15000,
-		ActionTimeout:          15000,
-		CompletionTimeout:      15000,
-		EnableProgressSpinner:  true,
-		ProgressUpdateInterval: 200,
+		Handler:                 "openai",
+		OpenAIModel:             "gpt-4.1",
+		OpenAIModelForChat:      "gpt-5",
+		OpenAIEndpoint:          "https://api.openai.com/v1",
+		AnthropicModel:          "claude-haiku-4-5",
+		AnthropicModelForChat:   "claude-sonnet-4-5",
+		AnthropicEndpoint:       "https://api.anthropic.com",
+		OllamaModel:             "qwen2.5-coder",
+		OllamaModelForChat:      "qwen2.5-coder",
+		OllamaEndpoint:          "http://localhost:11434",
+		OllamaKeepAlive:         "30m",
+		DedupStrictness:         "conservative",
+		WarmUp:                  true,
+		VLLMEndpoint:            "http://localhost:8000/v1",
+		VLLMUseSuffix:           true,
+		DeepSeekModel:           "deepseek-chat",
+		DeepSeekModelForChat:    "deepseek-chat",
+		DeepSeekEndpoint:        "https://api.deepseek.com",
+		DeepSeekUseFIM:          true,
+		XAIModel:                "grok-code-fast-1",
+		XAIModelForChat:         "grok-4",
+		XAIEndpoint:             "https://api.x.ai/v1",
+		TogetherModel:           "Qwen/Qwen2.5-Coder-32B-Instruct",
+		TogetherModelForChat:    "Qwen/Qwen2.5-Coder-32B-Instruct",
+		TogetherEndpoint:        "https://api.together.xyz/v1",
+		TogetherUseFIM:          true,
+		TabbyEndpoint:           "http://localhost:8080",
+		ReplicateModel:          "meta/meta-llama-3-70b-instruct",
+		ReplicateEndpoint:       "https://api.replicate.com/v1",
+		VertexLocation:          "us-central1",
+		VertexModel:             "gemini-2.5-flash",
+		VertexModelForChat:      "gemini-2.5-pro",
+		ManifestContext:         true,
+		SnippetCompletions:      true,
+		Presentation:            "auto",
+		APIHintsDir:             ".helix-assist/hints",
+		TemplatesDir:            ".helix-assist/templates",
+		ProjectInstructionsFile: ".helix-assist.md",
+		GGUFContextSize:         4096,
+		CustomAuthHeader:        "Authorization",
+		CustomChatPath:          "/chat/completions",
+		Debounce:                200,
+		TriggerCharacters:       []string{"{", "(", " "},
+		NumSuggestions:          1,
+		FetchTimeout:            15000,
+		ActionTimeout:           15000,
+		BlockTimeout:            60000,
+		CompletionTimeout:       15000,
+		EnableProgressSpinner:   true,
+		ProgressUpdateInterval:  200,
+		QuotaFailureThreshold:   3,
+		RetryMaxAttempts:        3,
+		RetryBaseDelay:          250,
+		ConcurrencyLimits:       map[string]int{"ollama": 2},
+		ConcurrencyQueueTimeout: 5000,
+		WorkspaceTrust:          "trusted",
+		CircuitFailureThreshold: 3,
+		CircuitCooldown:         30,
+		HealthCheckInterval:     60,
+		IdleRelease:             600,
+		QuotaProbeInterval:      5,
+		OutputFilter:            "off",
+		OutputFilterMinLength:   120,
+		ChangeBurstLines:        200,
+		ChangeBurstCooldown:     3000,
+		LowPowerDebounce:        800,
+		LowPowerContextLines:    40,
+		CompletionSort:          "first",
+		CompletionSortThreshold: 0.6,
+		CombinedModeDelay:       300,
+		CancellableActions:      true,
+		ActionPreview:           true,
+		CompletionCacheSize:     256,
+		CompletionCacheTTL:      300,
+		HookTimeout:             10,
+		DeleteSuffixOverlap:     true,
+		MaxLineLength:           5000,
+		Review:                  "off",
+		ReviewIdle:              10000,
+		SaveCleanupTimeout:      1000,
+		ReasoningTags:           []string{"think"},
+		ContextTokens:           1024,
+		ContextPrefixShare:      0.7,
+		ContextSuffixShare:      0.2,
+		ContextSkeletonShare:    0.1,
 	}
 }
 
@@ -62,10 +303,11 @@ func Load() *Config {
 	cfg := DefaultConfig()
 
 	// Define flags
-	handler := flag.String("handler", getEnvOrDefault("HANDLER", cfg.Handler), "Provider: openai, anthropic, or ollama")
+	handler := flag.String("handler", getEnvOrDefault("HANDLER", cfg.Handler), "Provider: openai, anthropic, ollama, vllm, deepseek, xai, together, tabby, custom, gguf, vertex, or replicate")
 	openaiKey := flag.String("openai-key", getEnvOrDefault("OPENAI_API_KEY", ""), "OpenAI API key")
 	openaiModel := flag.String("openai-model", getEnvOrDefault("OPENAI_MODEL", cfg.OpenAIModel), "OpenAI model")
 	openaiEndpoint := flag.String("openai-endpoint", getEnvOrDefault("OPENAI_ENDPOINT", cfg.OpenAIEndpoint), "OpenAI API endpoint")
+	openaiUseFIM := flag.Bool("openai-use-fim", getEnvOrDefaultBool("OPENAI_USE_FIM", cfg.OpenAIUseFIM), "Complete through the legacy /completions endpoint with suffix (e.g. gpt-3.5-turbo-instruct or a compatible coder server)")
 	anthropicKey := flag.String("anthropic-key", getEnvOrDefault("ANTHROPIC_API_KEY", ""), "Anthropic API key")
 	anthropicModel := flag.String("anthropic-model", getEnvOrDefault("ANTHROPIC_MODEL", cfg.AnthropicModel), "Anthropic model")
 	anthropicEndpoint := flag.String("anthropic-endpoint", getEnvOrDefault("ANTHROPIC_ENDPOINT", cfg.AnthropicEndpoint), "Anthropic API endpoint")
@@ -73,17 +315,137 @@ func Load() *Config {
 	anthropicModelForChat := flag.String("anthropic-model-for-chat", getEnvOrDefault("ANTHROPIC_MODEL_FOR_CHAT", cfg.AnthropicModelForChat), "Anthropic model for chat actions (defaults to anthropic-model)")
 	ollamaModel := flag.String("ollama-model", getEnvOrDefault("OLLAMA_MODEL", cfg.OllamaModel), "Ollama model")
 	ollamaEndpoint := flag.String("ollama-endpoint", getEnvOrDefault("OLLAMA_ENDPOINT", cfg.OllamaEndpoint), "Ollama API endpoint")
+	ollamaKeepAlive := flag.String("ollama-keep-alive", getEnvOrDefault("OLLAMA_KEEP_ALIVE", cfg.OllamaKeepAlive), "How long Ollama keeps models loaded after a request, e.g. 30m, 3600 (seconds) or -1 (forever); empty = daemon default")
+	ollamaAutoPull := flag.Bool("ollama-auto-pull", getEnvOrDefaultBool("OLLAMA_AUTO_PULL", cfg.OllamaAutoPull), "Pull Ollama models the daemon does not have yet, reporting progress in the editor")
+	dedupStrictness := flag.String("dedup-strictness", getEnvOrDefault("DEDUP_STRICTNESS", cfg.DedupStrictness), "How eagerly Ollama completions repeating the code after the cursor are trimmed: off, conservative, or aggressive")
+	trustModel := flag.Bool("trust-model", getEnvOrDefaultBool("TRUST_MODEL", cfg.TrustModel), "Skip completion cleanup heuristics except special-token stripping, for FIM-native models such as Codestral")
+	structuredActions := flag.Bool("structured-actions", getEnvOrDefaultBool("STRUCTURED_ACTIONS", cfg.StructuredActions), "Request code action results as JSON (replacement, explanation, confidence) from providers that support structured output")
+	feedbackFile := flag.String("feedback-file", getEnvOrDefault("FEEDBACK_FILE", cfg.FeedbackFile), "JSONL file the markGood and markBad commands write to (default: feedback.jsonl in the user config directory)")
+	usageFile := flag.String("usage-file", getEnvOrDefault("USAGE_FILE", cfg.UsageFile), "JSONL file the token usage of each run is added to on shutdown, or none (default: usage.jsonl in the user config directory)")
+	hooks := flag.String("hooks", getEnvOrDefault("HOOKS", ""), "External commands run on events, as event=command pairs separated by || (the event is sent as JSON on stdin)")
+	issuePattern := flag.String("issue-pattern", getEnvOrDefault("ISSUE_PATTERN", cfg.IssuePattern), "Regular expression matching issue references such as PROJ-123 in selections and commit messages; the first group, if any, is the ID (empty = disabled)")
+	issueCommand := flag.String("issue-command", getEnvOrDefault("ISSUE_COMMAND", cfg.IssueCommand), "Shell command printing an issue's title and description, given its ID in HELIX_ASSIST_ISSUE_ID, for chat prompts")
+	issueURL := flag.String("issue-url", getEnvOrDefault("ISSUE_URL", cfg.IssueURL), "Issue link template with {id}, passed to the issue command as HELIX_ASSIST_ISSUE_URL and shown in prompts")
+	hookTimeout := cfg.durationFlag("hook-timeout", "HOOK_TIMEOUT", cfg.HookTimeout, time.Second, "Seconds a hook may run before it is killed")
+	completionCacheSize := flag.Int("completion-cache-size", getEnvOrDefaultInt("COMPLETION_CACHE_SIZE", cfg.CompletionCacheSize), "Completion results kept to answer retyped code instantly (0 = no cache)")
+	completionCacheTTL := cfg.durationFlag("completion-cache-ttl", "COMPLETION_CACHE_TTL", cfg.CompletionCacheTTL, time.Second, "Seconds a cached completion stays valid")
+	fimTemplates := flag.String("fim-templates", getEnvOrDefault("FIM_TEMPLATES", cfg.FIMTemplates), "FIM prompt templates for further models: a JSON array, or the path of a JSON file")
+	deleteSuffixOverlap := flag.Bool("delete-suffix-overlap", getEnvOrDefaultBool("DELETE_SUFFIX_OVERLAP", cfg.DeleteSuffixOverlap), "Delete code after the cursor that a completion repeats (false = cut the repeat from the completion)")
+	maxLineLength := flag.Int("max-line-length", getEnvOrDefaultInt("MAX_LINE_LENGTH", cfg.MaxLineLength), "Skip completion on lines longer than this many characters (0 = no limit)")
+	review := flag.String("review", getEnvOrDefault("REVIEW", cfg.Review), "Background AI review published as diagnostics: off, save, or idle")
+	reviewIdle := flag.Int("review-idle", getEnvOrDefaultInt("REVIEW_IDLE", cfg.ReviewIdle), "Milliseconds without edits before a review in idle mode")
+	onSave := flag.String("on-save", getEnvOrDefault("ON_SAVE", "off"), "Checks run after each save, published as diagnostics, comma-separated: review, docstrings, fix (off = none)")
+	saveCleanup := flag.Bool("save-cleanup", getEnvOrDefaultBool("SAVE_CLEANUP", cfg.SaveCleanup), "Apply the model's trivial fixes, such as unused imports and typos, before each manual save")
+	saveCleanupTimeout := cfg.durationFlag("save-cleanup-timeout", "SAVE_CLEANUP_TIMEOUT", cfg.SaveCleanupTimeout, time.Millisecond, "Longest a save waits for cleanup fixes before going ahead without them (ms)")
+	reasoningTags := flag.String("reasoning-tags", getEnvOrDefault("REASONING_TAGS", strings.Join(cfg.ReasoningTags, ",")), "Tags whose blocks are stripped from model output, comma-separated (off = keep everything)")
+	contextTokens := flag.Int("context-tokens", getEnvOrDefaultInt("CONTEXT_TOKENS", cfg.ContextTokens), "Token budget for the code around the cursor sent with FIM completions (files that fit are sent whole)")
+	contextPrefixShare := flag.Float64("context-prefix-share", getEnvOrDefaultFloat("CONTEXT_PREFIX_SHARE", cfg.ContextPrefixShare), "Share (0-1) of the context budget for the code before the cursor")
+	contextSuffixShare := flag.Float64("context-suffix-share", getEnvOrDefaultFloat("CONTEXT_SUFFIX_SHARE", cfg.ContextSuffixShare), "Share (0-1) of the context budget for the code after the cursor")
+	contextSkeletonShare := flag.Float64("context-skeleton-share", getEnvOrDefaultFloat("CONTEXT_SKELETON_SHARE", cfg.ContextSkeletonShare), "Share (0-1) of the context budget for an outline of the declarations outside the window")
+	warmUp := flag.Bool("warm-up", getEnvOrDefaultBool("WARM_UP", cfg.WarmUp), "Load the completion model at startup so the first completion does not wait for it (Ollama)")
+	vllmKey := flag.String("vllm-key", getEnvOrDefault("VLLM_API_KEY", ""), "vLLM API key (only if the server was started with --api-key)")
+	vllmModel := flag.String("vllm-model", getEnvOrDefault("VLLM_MODEL", cfg.VLLMModel), "vLLM served model name")
+	vllmModelForChat := flag.String("vllm-model-for-chat", getEnvOrDefault("VLLM_MODEL_FOR_CHAT", cfg.VLLMModelForChat), "vLLM model for chat actions (defaults to vllm-model)")
+	vllmEndpoint := flag.String("vllm-endpoint", getEnvOrDefault("VLLM_ENDPOINT", cfg.VLLMEndpoint), "vLLM OpenAI-compatible API endpoint")
+	vllmUseSuffix := flag.Bool("vllm-use-suffix", getEnvOrDefaultBool("VLLM_USE_SUFFIX", cfg.VLLMUseSuffix), "Send code after the cursor as suffix (model must support FIM)")
+	vllmBestOf := flag.Int("vllm-best-of", getEnvOrDefaultInt("VLLM_BEST_OF", cfg.VLLMBestOf), "vLLM best_of sampling parameter (0 = server default)")
+	vllmTopK := flag.Int("vllm-top-k", getEnvOrDefaultInt("VLLM_TOP_K", cfg.VLLMTopK), "vLLM top_k sampling parameter (0 = server default)")
+	deepseekKey := flag.String("deepseek-key", getEnvOrDefault("DEEPSEEK_API_KEY", ""), "DeepSeek API key")
+	deepseekModel := flag.String("deepseek-model", getEnvOrDefault("DEEPSEEK_MODEL", cfg.DeepSeekModel), "DeepSeek model for completions (deepseek-chat or deepseek-coder)")
+	deepseekModelForChat := flag.String("deepseek-model-for-chat", getEnvOrDefault("DEEPSEEK_MODEL_FOR_CHAT", cfg.DeepSeekModelForChat), "DeepSeek model for chat actions (defaults to deepseek-model)")
+	deepseekEndpoint := flag.String("deepseek-endpoint", getEnvOrDefault("DEEPSEEK_ENDPOINT", cfg.DeepSeekEndpoint), "DeepSeek API endpoint")
+	deepseekUseFIM := flag.Bool("deepseek-use-fim", getEnvOrDefaultBool("DEEPSEEK_USE_FIM", cfg.DeepSeekUseFIM), "Use DeepSeek's beta FIM endpoint for completions")
+	xaiKey := flag.String("xai-key", getEnvOrDefault("XAI_API_KEY", ""), "xAI API key")
+	xaiModel := flag.String("xai-model", getEnvOrDefault("XAI_MODEL", cfg.XAIModel), "xAI model for completions")
+	xaiModelForChat := flag.String("xai-model-for-chat", getEnvOrDefault("XAI_MODEL_FOR_CHAT", cfg.XAIModelForChat), "xAI model for chat actions (defaults to xai-model)")
+	xaiEndpoint := flag.String("xai-endpoint", getEnvOrDefault("XAI_ENDPOINT", cfg.XAIEndpoint), "xAI API endpoint")
+	togetherKey := flag.String("together-key", getEnvOrDefault("TOGETHER_API_KEY", ""), "Together AI API key")
+	togetherModel := flag.String("together-model", getEnvOrDefault("TOGETHER_MODEL", cfg.TogetherModel), "Together AI model for completions")
+	togetherModelForChat := flag.String("together-model-for-chat", getEnvOrDefault("TOGETHER_MODEL_FOR_CHAT", cfg.TogetherModelForChat), "Together AI model for chat actions (defaults to together-model)")
+	togetherEndpoint := flag.String("together-endpoint", getEnvOrDefault("TOGETHER_ENDPOINT", cfg.TogetherEndpoint), "Together AI API endpoint")
+	togetherUseFIM := flag.Bool("together-use-fim", getEnvOrDefaultBool("TOGETHER_USE_FIM", cfg.TogetherUseFIM), "Send FIM prompts to Together's completions endpoint")
+	tabbyKey := flag.String("tabby-key", getEnvOrDefault("TABBY_API_KEY", ""), "Tabby auth token")
+	replicateKey := flag.String("replicate-key", getEnvOrDefault("REPLICATE_API_TOKEN", ""), "Replicate API token")
+	replicateModel := flag.String("replicate-model", getEnvOrDefault("REPLICATE_MODEL", cfg.ReplicateModel), "Replicate model for completions (owner/name or owner/name:version)")
+	replicateModelForChat := flag.String("replicate-model-for-chat", getEnvOrDefault("REPLICATE_MODEL_FOR_CHAT", ""), "Replicate model for chat actions (defaults to replicate-model)")
+	replicateEndpoint := flag.String("replicate-endpoint", getEnvOrDefault("REPLICATE_ENDPOINT", cfg.ReplicateEndpoint), "Replicate API endpoint")
+	vertexProject := flag.String("vertex-project", getEnvOrDefault("VERTEX_PROJECT", ""), "Google Cloud project for Vertex AI")
+	vertexLocation := flag.String("vertex-location", getEnvOrDefault("VERTEX_LOCATION", cfg.VertexLocation), "Vertex AI region, or global")
+	vertexModel := flag.String("vertex-model", getEnvOrDefault("VERTEX_MODEL", cfg.VertexModel), "Vertex AI model for completions")
+	vertexModelForChat := flag.String("vertex-model-for-chat", getEnvOrDefault("VERTEX_MODEL_FOR_CHAT", cfg.VertexModelForChat), "Vertex AI model for chat actions (defaults to vertex-model)")
+	vertexCredentials := flag.String("vertex-credentials", getEnvOrDefault("VERTEX_CREDENTIALS", ""), "Service account JSON file (empty = Application Default Credentials)")
+	tabbyEndpoint := flag.String("tabby-endpoint", getEnvOrDefault("TABBY_ENDPOINT", cfg.TabbyEndpoint), "Tabby server endpoint")
+	presentation := flag.String("presentation", getEnvOrDefault("PRESENTATION", cfg.Presentation), "How suggestions reach the editor: auto, list, inline, or ghost")
+	snippetCompletions := flag.Bool("snippet-completions", getEnvOrDefaultBool("SNIPPET_COMPLETIONS", cfg.SnippetCompletions), "Send completions as snippets with tabstops at empty argument lists and TODO bodies, when the editor supports snippets")
+	blameContext := flag.Bool("blame-context", getEnvOrDefaultBool("BLAME_CONTEXT", cfg.BlameContext), "Include a git blame summary (commit, author, date and message per line range) of the selection in explain prompts and reviews")
+	manifestContext := flag.Bool("manifest-context", getEnvOrDefaultBool("MANIFEST_CONTEXT", cfg.ManifestContext), "Include dependencies from go.mod, package.json, Cargo.toml or pyproject.toml in code action prompts")
+	apiHintsDir := flag.String("api-hints-dir", getEnvOrDefault("API_HINTS_DIR", cfg.APIHintsDir), "Directory of API hint files added to code action prompts for matching imports (empty = disabled)")
+	templatesDir := flag.String("templates-dir", getEnvOrDefault("TEMPLATES_DIR", cfg.TemplatesDir), "Project directory of file templates for `helix-assist new` (user templates live in the config directory)")
+	responseLanguage := flag.String("response-language", getEnvOrDefault("RESPONSE_LANGUAGE", ""), "Natural language for generated comments and explanations (e.g. German, Japanese)")
+	promptInstructions := flag.String("prompt-instructions", getEnvOrDefault("PROMPT_INSTRUCTIONS", ""), "Extra instructions appended to code action prompts ({git_branch}, {os}, {date}, {project_name} are expanded)")
+	projectInstructionsFile := flag.String("project-instructions-file", getEnvOrDefault("PROJECT_INSTRUCTIONS_FILE", cfg.ProjectInstructionsFile), "Instructions file read from the workspace root (empty = disabled)")
+	ggufModelPath := flag.String("gguf-model-path", getEnvOrDefault("GGUF_MODEL_PATH", ""), "Path to a GGUF model for in-process inference (requires a llama build)")
+	ggufContextSize := flag.Int("gguf-context-size", getEnvOrDefaultInt("GGUF_CONTEXT_SIZE", cfg.GGUFContextSize), "Context window in tokens for the GGUF model")
+	ggufThreads := flag.Int("gguf-threads", getEnvOrDefaultInt("GGUF_THREADS", 0), "Threads used for GGUF inference (0 = llama.cpp default)")
+	ggufGPULayers := flag.Int("gguf-gpu-layers", getEnvOrDefaultInt("GGUF_GPU_LAYERS", 0), "Layers offloaded to the GPU for GGUF inference")
+	customEndpoint := flag.String("custom-endpoint", getEnvOrDefault("CUSTOM_ENDPOINT", ""), "Base URL of a custom OpenAI-compatible gateway")
+	customModel := flag.String("custom-model", getEnvOrDefault("CUSTOM_MODEL", ""), "Custom provider model for completions")
+	customModelForChat := flag.String("custom-model-for-chat", getEnvOrDefault("CUSTOM_MODEL_FOR_CHAT", ""), "Custom provider model for chat actions (defaults to custom-model)")
+	customAuthHeader := flag.String("custom-auth-header", getEnvOrDefault("CUSTOM_AUTH_HEADER", cfg.CustomAuthHeader), "Header carrying the custom provider credential")
+	customAuthValue := flag.String("custom-auth-value", getEnvOrDefault("CUSTOM_AUTH_VALUE", ""), "Full value of the auth header, e.g. \"Bearer sk-...\"")
+	customHeaders := flag.String("custom-headers", getEnvOrDefault("CUSTOM_HEADERS", ""), "Extra headers for the custom provider (Name: value, separated by ||)")
+	customBodyOverrides := flag.String("custom-body-overrides", getEnvOrDefault("CUSTOM_BODY_OVERRIDES", ""), "JSON object merged over every custom provider request body")
+	customChatPath := flag.String("custom-chat-path", getEnvOrDefault("CUSTOM_CHAT_PATH", cfg.CustomChatPath), "Path of the chat endpoint, relative to custom-endpoint")
+	customCompletionPath := flag.String("custom-completion-path", getEnvOrDefault("CUSTOM_COMPLETION_PATH", ""), "Path of a FIM /completions endpoint (empty = complete through chat)")
 	ollamaModelForChat := flag.String("ollama-model-for-chat", getEnvOrDefault("OLLAMA_MODEL_FOR_CHAT", cfg.OllamaModelForChat), "Ollama model for chat actions (defaults to ollama-model)")
-	debounce := flag.Int("debounce", getEnvOrDefaultInt("DEBOUNCE", cfg.Debounce), "Debounce delay (ms)")
+	debounce := cfg.durationFlag("debounce", "DEBOUNCE", cfg.Debounce, time.Millisecond, "Debounce delay (ms)")
 	triggerChars := flag.String("trigger-chars", getEnvOrDefault("TRIGGER_CHARACTERS", "{||(|| "), "Completion trigger characters (separated by ||)")
 	numSuggestions := flag.Int("num-suggestions", getEnvOrDefaultInt("NUM_SUGGESTIONS", cfg.NumSuggestions), "Number of suggestions")
 	logFile := flag.String("log-file", getEnvOrDefault("LOG_FILE", "~/.cache/helix-assist.log"), "Log file path")
-	fetchTimeout := flag.Int("fetch-timeout", getEnvOrDefaultInt("FETCH_TIMEOUT", cfg.FetchTimeout), "Fetch timeout (ms)")
-	actionTimeout := flag.Int("action-timeout", getEnvOrDefaultInt("ACTION_TIMEOUT", cfg.ActionTimeout), "Action timeout (ms)")
-	completionTimeout := flag.Int("completion-timeout", getEnvOrDefaultInt("COMPLETION_TIMEOUT", cfg.CompletionTimeout), "Completion timeout (ms)")
+	listen := flag.String("listen", getEnvOrDefault("LISTEN", cfg.Listen), "Serve the editor on tcp:PORT, tcp:HOST:PORT or unix:/path instead of stdio")
+	listenPublic := flag.Bool("listen-public", getEnvOrDefaultBool("LISTEN_PUBLIC", cfg.ListenPublic), "Allow --listen on a tcp address beyond loopback, which anyone reaching it can connect to")
+	users := flag.String("users", getEnvOrDefault("USERS", cfg.Users), "JSON file of the users allowed to connect, with their tokens and API keys")
+	fetchTimeout := cfg.durationFlag("fetch-timeout", "FETCH_TIMEOUT", cfg.FetchTimeout, time.Millisecond, "Fetch timeout (ms)")
+	tlsCAFile := flag.String("tls-ca-file", getEnvOrDefault("TLS_CA_FILE", ""), "PEM CA bundle trusted for provider connections in addition to the system roots")
+	tlsClientCert := flag.String("tls-client-cert", getEnvOrDefault("TLS_CLIENT_CERT", ""), "PEM client certificate presented to provider servers (mTLS)")
+	tlsClientKey := flag.String("tls-client-key", getEnvOrDefault("TLS_CLIENT_KEY", ""), "PEM private key for tls-client-cert")
+	workspaceTrust := flag.String("workspace-trust", getEnvOrDefault("WORKSPACE_TRUST", cfg.WorkspaceTrust), "Trust level for workspaces without a stored level: trusted, restricted, or untrusted")
+	actionTimeout := cfg.durationFlag("action-timeout", "ACTION_TIMEOUT", cfg.ActionTimeout, time.Millisecond, "Action timeout (ms)")
+	blockTimeout := cfg.durationFlag("block-timeout", "BLOCK_TIMEOUT", cfg.BlockTimeout, time.Millisecond, "Timeout for the complete-block action (ms)")
+	completionTimeout := cfg.durationFlag("completion-timeout", "COMPLETION_TIMEOUT", cfg.CompletionTimeout, time.Millisecond, "Completion timeout (ms)")
 	debugQuery := flag.String("debug-query", "", "Debug mode: test provider with a query and exit")
-	enableProgressSpinner := flag.Bool("enable-progress-spinner", getEnvOrDefaultBool("ENABLE_PROGRESS_SPINNER", cfg.EnableProgressSpinner), "Enable animated progress spinner")
-	progressUpdateInterval := flag.Int("progress-update-interval", getEnvOrDefaultInt("PROGRESS_UPDATE_INTERVAL", cfg.ProgressUpdateInterval), "Progress update interval (ms)")
+	listModels := flag.Bool("list-models", false, "Print the models available from the selected handler and exit")
+	enableProgressSpinner := flag.Bool("enable-progress-spinner", getEnvOrDefaultBool("ENABLE_PROGRESS_SPINNER", cfg.EnableProgressSpinner), "Report completion and action progress in the editor statusline")
+	progressUpdateInterval := cfg.durationFlag("progress-update-interval", "PROGRESS_UPDATE_INTERVAL", cfg.ProgressUpdateInterval, time.Millisecond, "Progress update interval (ms)")
+	completionHandler := flag.String("completion-handler", getEnvOrDefault("COMPLETION_HANDLER", cfg.CompletionHandler), "Provider for completions, optionally with a model, e.g. ollama:qwen2.5-coder:7b (empty = handler)")
+	chatHandler := flag.String("chat-handler", getEnvOrDefault("CHAT_HANDLER", cfg.ChatHandler), "Provider for code actions, optionally with a model, e.g. anthropic:claude-sonnet-4-5 (empty = handler)")
+	fallbackHandler := flag.String("fallback-handler", getEnvOrDefault("FALLBACK_HANDLER", cfg.FallbackHandler), "Provider to switch to when the main provider's quota is exhausted (e.g. ollama)")
+	raceHandler := flag.String("race-handler", getEnvOrDefault("RACE_HANDLER", cfg.RaceHandler), "Provider raced against the main provider for completions; the first non-empty result wins")
+	quotaFailureThreshold := flag.Int("quota-failure-threshold", getEnvOrDefaultInt("QUOTA_FAILURE_THRESHOLD", cfg.QuotaFailureThreshold), "Consecutive quota errors before switching to the fallback provider")
+	quotaProbeInterval := cfg.durationFlag("quota-probe-interval", "QUOTA_PROBE_INTERVAL", cfg.QuotaProbeInterval, time.Minute, "Minutes between re-probes of a quota-exhausted provider")
+	retryMaxAttempts := flag.Int("retry-max-attempts", getEnvOrDefaultInt("RETRY_MAX_ATTEMPTS", cfg.RetryMaxAttempts), "Attempts per request on rate limits, 5xx and connection errors (1 = no retries)")
+	retryBaseDelay := cfg.durationFlag("retry-base-delay", "RETRY_BASE_DELAY", cfg.RetryBaseDelay, time.Millisecond, "Initial retry backoff in milliseconds, doubled after each attempt")
+	concurrencyLimits := flag.String("concurrency-limits", getEnvOrDefault("CONCURRENCY_LIMITS", "ollama=2"), "Maximum concurrent requests per provider, e.g. ollama=1,vllm=4 (unlisted = unlimited)")
+	concurrencyQueueTimeout := cfg.durationFlag("concurrency-queue-timeout", "CONCURRENCY_QUEUE_TIMEOUT", cfg.ConcurrencyQueueTimeout, time.Millisecond, "How long a request over the concurrency limit waits before it is shed (ms)")
+	circuitFailureThreshold := flag.Int("circuit-failure-threshold", getEnvOrDefaultInt("CIRCUIT_FAILURE_THRESHOLD", cfg.CircuitFailureThreshold), "Consecutive connection/timeout/server errors before a provider is paused (0 = disabled)")
+	circuitCooldown := cfg.durationFlag("circuit-cooldown", "CIRCUIT_COOLDOWN", cfg.CircuitCooldown, time.Second, "Seconds a failing provider is paused before it is tried again")
+	healthCheckInterval := cfg.durationFlag("health-check-interval", "HEALTH_CHECK_INTERVAL", cfg.HealthCheckInterval, time.Second, "Seconds between provider health probes (0 = disabled)")
+	idleRelease := cfg.durationFlag("idle-release", "IDLE_RELEASE", cfg.IdleRelease, time.Second, "Seconds without requests after which provider connections and loaded models are released (0 = never)")
+	outputFilter := flag.String("output-filter", getEnvOrDefault("OUTPUT_FILTER", cfg.OutputFilter), "Handling of output that reproduces license headers or long repeated blocks: off, flag, or drop")
+	outputFilterMinLength := flag.Int("output-filter-min-length", getEnvOrDefaultInt("OUTPUT_FILTER_MIN_LENGTH", cfg.OutputFilterMinLength), "Minimum matching characters before the output filter triggers")
+	changeBurstLines := flag.Int("change-burst-lines", getEnvOrDefaultInt("CHANGE_BURST_LINES", cfg.ChangeBurstLines), "Lines changed within a second that pause auto-completions, e.g. a paste or refactor (0 = disabled)")
+	changeBurstCooldown := cfg.durationFlag("change-burst-cooldown", "CHANGE_BURST_COOLDOWN", cfg.ChangeBurstCooldown, time.Millisecond, "Milliseconds completions stay paused after a change burst")
+	lowPower := flag.Bool("low-power", getEnvOrDefaultBool("LOW_POWER", cfg.LowPower), "Start in low-power mode: longer debounce, one suggestion, smaller context")
+	lowPowerDebounce := cfg.durationFlag("low-power-debounce", "LOW_POWER_DEBOUNCE", cfg.LowPowerDebounce, time.Millisecond, "Completion debounce in milliseconds while in low-power mode")
+	lowPowerContextLines := flag.Int("low-power-context-lines", getEnvOrDefaultInt("LOW_POWER_CONTEXT_LINES", cfg.LowPowerContextLines), "Lines before the cursor sent for completions in low-power mode (a quarter of that after it)")
+	lowPowerHandler := flag.String("low-power-handler", getEnvOrDefault("LOW_POWER_HANDLER", cfg.LowPowerHandler), "Cheaper provider to switch to in low-power mode, e.g. ollama (empty = keep current)")
+	completionSort := flag.String("completion-sort", getEnvOrDefault("COMPLETION_SORT", cfg.CompletionSort), "Ranking of AI items against native LSP results: first, last, or interleaved")
+	completionSortThreshold := flag.Float64("completion-sort-threshold", getEnvOrDefaultFloat("COMPLETION_SORT_THRESHOLD", cfg.CompletionSortThreshold), "Score (0-1) above which interleaved AI items rank first")
+	combinedMode := flag.Bool("combined-mode", getEnvOrDefaultBool("COMBINED_MODE", cfg.CombinedMode), "Tune completions for running alongside a native language server")
+	combinedModeDelay := cfg.durationFlag("combined-mode-delay", "COMBINED_MODE_DELAY", cfg.CombinedModeDelay, time.Millisecond, "Minimum time (ms) before AI results are sent in combined mode")
+	skipLocalIdentifiers := flag.Bool("skip-local-identifiers", getEnvOrDefaultBool("SKIP_LOCAL_IDENTIFIERS", cfg.SkipLocalIdentifiers), "Skip provider calls while typing a name declared in the buffer")
+	cancellableActions := flag.Bool("cancellable-actions", getEnvOrDefaultBool("CANCELLABLE_ACTIONS", cfg.CancellableActions), "Report code actions as cancellable editor progress with a countdown")
+	actionPreview := flag.Bool("action-preview", getEnvOrDefaultBool("ACTION_PREVIEW", cfg.ActionPreview), "Show the latest streamed line of a code action in its progress message")
 
 	flag.Parse()
 
@@ -92,6 +454,7 @@ func Load() *Config {
 	cfg.OpenAIModel = *openaiModel
 	cfg.OpenAIModelForChat = *openaiModelForChat
 	cfg.OpenAIEndpoint = *openaiEndpoint
+	cfg.OpenAIUseFIM = *openaiUseFIM
 	cfg.AnthropicKey = *anthropicKey
 	cfg.AnthropicModel = *anthropicModel
 	cfg.AnthropicModelForChat = *anthropicModelForChat
@@ -99,57 +462,526 @@ func Load() *Config {
 	cfg.OllamaModel = *ollamaModel
 	cfg.OllamaModelForChat = *ollamaModelForChat
 	cfg.OllamaEndpoint = *ollamaEndpoint
+	cfg.OllamaKeepAlive = *ollamaKeepAlive
+	cfg.OllamaAutoPull = *ollamaAutoPull
+	cfg.WarmUp = *warmUp
+	cfg.DedupStrictness = *dedupStrictness
+	cfg.TrustModel = *trustModel
+	cfg.StructuredActions = *structuredActions
+	cfg.FeedbackFile = *feedbackFile
+	cfg.UsageFile = *usageFile
+	cfg.Hooks, cfg.loadProblems = parseHooks(*hooks, cfg.loadProblems)
+	cfg.HookTimeout = *hookTimeout
+	cfg.IssuePattern = *issuePattern
+	cfg.IssueCommand = *issueCommand
+	cfg.IssueURL = *issueURL
+	cfg.CompletionCacheSize = *completionCacheSize
+	cfg.CompletionCacheTTL = *completionCacheTTL
+	cfg.FIMTemplates = *fimTemplates
+	cfg.DeleteSuffixOverlap = *deleteSuffixOverlap
+	cfg.MaxLineLength = *maxLineLength
+	cfg.Review = *review
+	cfg.ReviewIdle = *reviewIdle
+	cfg.SaveCleanup = *saveCleanup
+	cfg.SaveCleanupTimeout = *saveCleanupTimeout
+	cfg.OnSave = nil
+	if *onSave != "off" {
+		for _, check := range strings.Split(*onSave, ",") {
+			if check = strings.TrimSpace(check); check != "" && !slices.Contains(cfg.OnSave, check) {
+				cfg.OnSave = append(cfg.OnSave, check)
+			}
+		}
+	}
+	cfg.ReasoningTags = nil
+	if *reasoningTags != "off" {
+		for _, tag := range strings.Split(*reasoningTags, ",") {
+			if tag = strings.Trim(strings.TrimSpace(tag), "<>"); tag != "" {
+				cfg.ReasoningTags = append(cfg.ReasoningTags, tag)
+			}
+		}
+	}
+	cfg.ContextTokens = *contextTokens
+	cfg.ContextPrefixShare = *contextPrefixShare
+	cfg.ContextSuffixShare = *contextSuffixShare
+	cfg.ContextSkeletonShare = *contextSkeletonShare
+	cfg.VLLMKey = *vllmKey
+	cfg.VLLMModel = *vllmModel
+	cfg.VLLMModelForChat = *vllmModelForChat
+	cfg.VLLMEndpoint = *vllmEndpoint
+	cfg.VLLMUseSuffix = *vllmUseSuffix
+	cfg.VLLMBestOf = *vllmBestOf
+	cfg.VLLMTopK = *vllmTopK
+	cfg.DeepSeekKey = *deepseekKey
+	cfg.DeepSeekModel = *deepseekModel
+	cfg.DeepSeekModelForChat = *deepseekModelForChat
+	cfg.DeepSeekEndpoint = *deepseekEndpoint
+	cfg.DeepSeekUseFIM = *deepseekUseFIM
+	cfg.XAIKey = *xaiKey
+	cfg.XAIModel = *xaiModel
+	cfg.XAIModelForChat = *xaiModelForChat
+	cfg.XAIEndpoint = *xaiEndpoint
+	cfg.TogetherKey = *togetherKey
+	cfg.TogetherModel = *togetherModel
+	cfg.TogetherModelForChat = *togetherModelForChat
+	cfg.TogetherEndpoint = *togetherEndpoint
+	cfg.TogetherUseFIM = *togetherUseFIM
+	cfg.TabbyKey = *tabbyKey
+	cfg.TabbyEndpoint = *tabbyEndpoint
+	cfg.ReplicateKey = *replicateKey
+	cfg.ReplicateModel = *replicateModel
+	cfg.ReplicateModelForChat = *replicateModelForChat
+	cfg.ReplicateEndpoint = *replicateEndpoint
+	cfg.VertexProject = *vertexProject
+	cfg.VertexLocation = *vertexLocation
+	cfg.VertexModel = *vertexModel
+	cfg.VertexModelForChat = *vertexModelForChat
+	cfg.VertexCredentials = *vertexCredentials
+	cfg.ManifestContext = *manifestContext
+	cfg.BlameContext = *blameContext
+	cfg.SnippetCompletions = *snippetCompletions
+	cfg.Presentation = *presentation
+	cfg.APIHintsDir = *apiHintsDir
+	cfg.TemplatesDir = *templatesDir
+	cfg.ResponseLanguage = *responseLanguage
+	cfg.PromptInstructions = *promptInstructions
+	cfg.ProjectInstructionsFile = *projectInstructionsFile
+	cfg.GGUFModelPath = *ggufModelPath
+	cfg.GGUFContextSize = *ggufContextSize
+	cfg.GGUFThreads = *ggufThreads
+	cfg.GGUFGPULayers = *ggufGPULayers
+	cfg.CustomEndpoint = *customEndpoint
+	cfg.CustomModel = *customModel
+	cfg.CustomModelForChat = *customModelForChat
+	cfg.CustomAuthHeader = *customAuthHeader
+	cfg.CustomAuthValue = *customAuthValue
+	cfg.CustomHeaders = parseHeaders(*customHeaders)
+	cfg.CustomBodyOverrides = *customBodyOverrides
+	cfg.CustomChatPath = *customChatPath
+	cfg.CustomCompletionPath = *customCompletionPath
 	cfg.Debounce = *debounce
 	cfg.TriggerCharacters = strings.Split(*triggerChars, "||")
 	cfg.NumSuggestions = *numSuggestions
 	cfg.LogFile = *logFile
+	cfg.Listen = *listen
+	cfg.ListenPublic = *listenPublic
+	cfg.Users = *users
 	cfg.FetchTimeout = *fetchTimeout
+	cfg.TLSCAFile = *tlsCAFile
+	cfg.TLSClientCert = *tlsClientCert
+	cfg.TLSClientKey = *tlsClientKey
+	cfg.WorkspaceTrust = *workspaceTrust
 	cfg.ActionTimeout = *actionTimeout
+	cfg.BlockTimeout = *blockTimeout
 	cfg.CompletionTimeout = *completionTimeout
 	cfg.DebugQuery = *debugQuery
+	cfg.ListModels = *listModels
 	cfg.EnableProgressSpinner = *enableProgressSpinner
 	cfg.ProgressUpdateInterval = *progressUpdateInterval
+	cfg.FallbackHandler = *fallbackHandler
+	cfg.CompletionHandler = *completionHandler
+	cfg.ChatHandler = *chatHandler
+	cfg.RaceHandler = *raceHandler
+	cfg.QuotaFailureThreshold = *quotaFailureThreshold
+	cfg.QuotaProbeInterval = *quotaProbeInterval
+	cfg.RetryMaxAttempts = *retryMaxAttempts
+	cfg.RetryBaseDelay = *retryBaseDelay
+	cfg.ConcurrencyLimits, cfg.loadProblems = parseLimits(*concurrencyLimits, cfg.loadProblems)
+	cfg.ConcurrencyQueueTimeout = *concurrencyQueueTimeout
+	cfg.CircuitFailureThreshold = *circuitFailureThreshold
+	cfg.CircuitCooldown = *circuitCooldown
+	cfg.HealthCheckInterval = *healthCheckInterval
+	cfg.IdleRelease = *idleRelease
+	cfg.OutputFilter = *outputFilter
+	cfg.OutputFilterMinLength = *outputFilterMinLength
+	cfg.ChangeBurstLines = *changeBurstLines
+	cfg.ChangeBurstCooldown = *changeBurstCooldown
+	cfg.LowPower = *lowPower
+	cfg.LowPowerDebounce = *lowPowerDebounce
+	cfg.LowPowerContextLines = *lowPowerContextLines
+	cfg.LowPowerHandler = *lowPowerHandler
+	cfg.CompletionSort = *completionSort
+	cfg.CompletionSortThreshold = *completionSortThreshold
+	cfg.CombinedMode = *combinedMode
+	cfg.CombinedModeDelay = *combinedModeDelay
+	cfg.SkipLocalIdentifiers = *skipLocalIdentifiers
+	cfg.CancellableActions = *cancellableActions
+	cfg.ActionPreview = *actionPreview
+	cfg.DeprecatedEnv = slices.Sorted(slices.Values(legacyEnv))
 
 	return cfg
 }
 
 func (c *Config) Validate() error {
-	validHandlers := []string{"openai", "anthropic", "ollama"}
+	validHandlers := []string{"openai", "anthropic", "ollama", "vllm", "deepseek", "xai", "together", "tabby", "custom", "gguf", "vertex", "replicate"}
+
+	problems := slices.Clone(c.loadProblems)
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
 
 	if !slices.Contains(validHandlers, c.Handler) {
-		return &ConfigError{
-			Message: fmt.Sprintf("handler must be one of: %s", strings.Join(validHandlers, ", ")),
-		}
+		report("HANDLER must be one of: %s", strings.Join(validHandlers, ", "))
 	}
 
 	if c.Handler == "openai" && c.OpenAIKey == "" {
-		return &ConfigError{Message: "OpenAI API key is required when using openai handler"}
+		report("OPENAI_API_KEY is required when using openai handler")
 	}
 
 	if c.Handler == "anthropic" && c.AnthropicKey == "" {
-		return &ConfigError{Message: "Anthropic API key is required when using anthropic handler"}
+		report("ANTHROPIC_API_KEY is required when using anthropic handler")
+	}
+
+	if c.Handler == "replicate" && c.ReplicateKey == "" {
+		report("REPLICATE_API_TOKEN is required when using replicate handler")
+	}
+
+	if c.Handler == "vertex" && c.VertexProject == "" {
+		report("VERTEX_PROJECT is required when using vertex handler")
+	}
+
+	if c.Handler == "gguf" && c.GGUFModelPath == "" {
+		report("GGUF_MODEL_PATH is required when using gguf handler")
+	}
+
+	if c.Handler == "custom" && (c.CustomEndpoint == "" || c.CustomModel == "") {
+		report("CUSTOM_ENDPOINT and CUSTOM_MODEL are required when using custom handler")
+	}
+
+	if c.CustomBodyOverrides != "" {
+		if _, err := c.CustomBodyOverridesMap(); err != nil {
+			report("CUSTOM_BODY_OVERRIDES must be a JSON object: %s", err.Error())
+		}
+	}
+
+	if c.Handler == "together" && c.TogetherKey == "" {
+		report("TOGETHER_API_KEY is required when using together handler")
+	}
+
+	if c.Handler == "xai" && c.XAIKey == "" {
+		report("XAI_API_KEY is required when using xai handler")
+	}
+
+	if c.Handler == "deepseek" && c.DeepSeekKey == "" {
+		report("DEEPSEEK_API_KEY is required when using deepseek handler")
+	}
+
+	if c.Handler == "vllm" && c.VLLMModel == "" {
+		report("VLLM_MODEL is required when using vllm handler")
+	}
+
+	if (c.TLSClientCert == "") != (c.TLSClientKey == "") {
+		report("TLS_CLIENT_CERT and TLS_CLIENT_KEY must be set together")
+	}
+
+	if c.OllamaKeepAlive != "" && c.OllamaKeepAlive != "-1" {
+		_, durErr := time.ParseDuration(c.OllamaKeepAlive)
+		_, numErr := strconv.Atoi(c.OllamaKeepAlive)
+		if durErr != nil && numErr != nil {
+			report("OLLAMA_KEEP_ALIVE must be a duration such as 30m, a number of seconds, or -1, got %q", c.OllamaKeepAlive)
+		}
+	}
+
+	validStrictness := []string{"off", "conservative", "aggressive"}
+
+	if !slices.Contains(validStrictness, c.DedupStrictness) {
+		report("DEDUP_STRICTNESS must be one of: %s", strings.Join(validStrictness, ", "))
+	}
+
+	validTrust := []string{"trusted", "restricted", "untrusted"}
+
+	if !slices.Contains(validTrust, c.WorkspaceTrust) {
+		report("WORKSPACE_TRUST must be one of: %s", strings.Join(validTrust, ", "))
+	}
+
+	validFilters := []string{"off", "flag", "drop"}
+
+	if !slices.Contains(validFilters, c.OutputFilter) {
+		report("OUTPUT_FILTER must be one of: %s", strings.Join(validFilters, ", "))
+	}
+
+	validSorts := []string{"first", "last", "interleaved"}
+
+	if !slices.Contains(validSorts, c.CompletionSort) {
+		report("COMPLETION_SORT must be one of: %s", strings.Join(validSorts, ", "))
+	}
+
+	validPresentations := []string{"auto", "list", "inline", "ghost"}
+
+	if !slices.Contains(validPresentations, c.Presentation) {
+		report("PRESENTATION must be one of: %s", strings.Join(validPresentations, ", "))
+	}
+
+	checkRange := func(name string, value, lo, hi int, unit string) {
+		if value < lo || value > hi {
+			report("%s must be between %d and %d%s, got %d%s", name, lo, hi, unit, value, unit)
+		}
+	}
+
+	checkRange("DEBOUNCE", c.Debounce, 0, maxDebounce, "ms")
+	checkRange("LOW_POWER_DEBOUNCE", c.LowPowerDebounce, 0, maxDebounce, "ms")
+	checkRange("NUM_SUGGESTIONS", c.NumSuggestions, 1, maxSuggestions, "")
+	checkRange("HOOK_TIMEOUT", c.HookTimeout, 1, 3600, "s")
+	checkRange("MAX_LINE_LENGTH", c.MaxLineLength, 0, 10000000, "")
+	for _, tag := range c.ReasoningTags {
+		if strings.ContainsAny(tag, " <>/") {
+			report("REASONING_TAGS must list tag names such as think, got %q", tag)
+		}
+	}
+	validReviews := []string{"off", "save", "idle"}
+	if !slices.Contains(validReviews, c.Review) {
+		report("REVIEW must be one of: %s", strings.Join(validReviews, ", "))
+	}
+	checkRange("REVIEW_IDLE", c.ReviewIdle, 1000, 3600000, "ms")
+	checkRange("SAVE_CLEANUP_TIMEOUT", c.SaveCleanupTimeout, 100, 10000, "ms")
+	if _, _, err := ParseListen(c.Listen); err != nil {
+		report("LISTEN %s", err.Error())
+	}
+
+	if c.Users != "" {
+		if _, err := LoadUsers(c.Users); err != nil {
+			report("USERS %s", err.Error())
+		}
+	}
+	validOnSave := []string{"review", "docstrings", "fix"}
+	for _, check := range c.OnSave {
+		if !slices.Contains(validOnSave, check) {
+			report("ON_SAVE must list checks from: %s, got %q", strings.Join(validOnSave, ", "), check)
+		}
+	}
+	if c.IssuePattern != "" {
+		if _, err := regexp.Compile(c.IssuePattern); err != nil {
+			report("ISSUE_PATTERN is not a valid regular expression: %s", err.Error())
+		}
+	} else if c.IssueCommand != "" || c.IssueURL != "" {
+		report("ISSUE_COMMAND and ISSUE_URL need ISSUE_PATTERN")
+	}
+
+	checkRange("COMPLETION_CACHE_SIZE", c.CompletionCacheSize, 0, 100000, "")
+	checkRange("RETRY_MAX_ATTEMPTS", c.RetryMaxAttempts, 1, 10, "")
+	checkRange("RETRY_BASE_DELAY", c.RetryBaseDelay, 0, 10000, "ms")
+	checkRange("PROGRESS_UPDATE_INTERVAL", c.ProgressUpdateInterval, 50, 5000, "ms")
+	checkRange("COMBINED_MODE_DELAY", c.CombinedModeDelay, 0, maxDebounce, "ms")
+
+	// A timeout no longer than the debounce expires before the request is
+	// even sent.
+	debounce := max(c.Debounce, c.LowPowerDebounce)
+	for _, timeout := range []struct {
+		name  string
+		value int
+	}{
+		{"FETCH_TIMEOUT", c.FetchTimeout},
+		{"ACTION_TIMEOUT", c.ActionTimeout},
+		{"BLOCK_TIMEOUT", c.BlockTimeout},
+		{"COMPLETION_TIMEOUT", c.CompletionTimeout},
+	} {
+		if timeout.value <= debounce {
+			report("%s must be greater than the debounce (%dms), got %dms", timeout.name, debounce, timeout.value)
+		}
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"VLLM_BEST_OF", c.VLLMBestOf},
+		{"VLLM_TOP_K", c.VLLMTopK},
+		{"GGUF_THREADS", c.GGUFThreads},
+		{"GGUF_GPU_LAYERS", c.GGUFGPULayers},
+		{"QUOTA_FAILURE_THRESHOLD", c.QuotaFailureThreshold},
+		{"QUOTA_PROBE_INTERVAL", c.QuotaProbeInterval},
+		{"CIRCUIT_FAILURE_THRESHOLD", c.CircuitFailureThreshold},
+		{"CIRCUIT_COOLDOWN", c.CircuitCooldown},
+		{"HEALTH_CHECK_INTERVAL", c.HealthCheckInterval},
+		{"IDLE_RELEASE", c.IdleRelease},
+		{"OUTPUT_FILTER_MIN_LENGTH", c.OutputFilterMinLength},
+		{"CHANGE_BURST_LINES", c.ChangeBurstLines},
+		{"CHANGE_BURST_COOLDOWN", c.ChangeBurstCooldown},
+		{"CONCURRENCY_QUEUE_TIMEOUT", c.ConcurrencyQueueTimeout},
+		{"LOW_POWER_CONTEXT_LINES", c.LowPowerContextLines},
+	} {
+		if setting.value < 0 {
+			report("%s must not be negative, got %d", setting.name, setting.value)
+		}
+	}
+
+	if c.GGUFModelPath != "" && c.GGUFContextSize < 512 {
+		report("GGUF_CONTEXT_SIZE must be at least 512, got %d", c.GGUFContextSize)
+	}
+
+	if c.ContextTokens < 64 {
+		report("CONTEXT_TOKENS must be at least 64, got %d", c.ContextTokens)
 	}
 
+	for _, share := range []struct {
+		name  string
+		value float64
+	}{
+		{"CONTEXT_PREFIX_SHARE", c.ContextPrefixShare},
+		{"CONTEXT_SUFFIX_SHARE", c.ContextSuffixShare},
+		{"CONTEXT_SKELETON_SHARE", c.ContextSkeletonShare},
+	} {
+		if share.value < 0 || share.value > 1 {
+			report("%s must be between 0 and 1, got %g", share.name, share.value)
+		}
+	}
+	if sum := c.ContextPrefixShare + c.ContextSuffixShare + c.ContextSkeletonShare; sum > 1.0001 {
+		report("CONTEXT_PREFIX_SHARE, CONTEXT_SUFFIX_SHARE and CONTEXT_SKELETON_SHARE must add up to at most 1, got %g", sum)
+	}
+
+	if c.CompletionSortThreshold < 0 || c.CompletionSortThreshold > 1 {
+		report("COMPLETION_SORT_THRESHOLD must be between 0 and 1, got %g", c.CompletionSortThreshold)
+	}
+
+	if c.FallbackHandler != "" {
+		if !slices.Contains(validHandlers, c.FallbackHandler) {
+			report("FALLBACK_HANDLER must be one of: %s", strings.Join(validHandlers, ", "))
+		} else if c.FallbackHandler == c.Handler {
+			report("FALLBACK_HANDLER must differ from HANDLER")
+		}
+	}
+
+	for _, task := range []struct{ name, value string }{
+		{"COMPLETION_HANDLER", c.CompletionHandler},
+		{"CHAT_HANDLER", c.ChatHandler},
+	} {
+		if provider, _ := SplitHandler(task.value); task.value != "" && !slices.Contains(validHandlers, provider) {
+			report("%s must start with one of: %s", task.name, strings.Join(validHandlers, ", "))
+		}
+	}
+
+	if c.LowPowerHandler != "" && !slices.Contains(validHandlers, c.LowPowerHandler) {
+		report("LOW_POWER_HANDLER must be one of: %s", strings.Join(validHandlers, ", "))
+	}
+
+	if c.RaceHandler != "" {
+		if !slices.Contains(validHandlers, c.RaceHandler) {
+			report("RACE_HANDLER must be one of: %s", strings.Join(validHandlers, ", "))
+		} else if c.RaceHandler == c.Handler {
+			report("RACE_HANDLER must differ from HANDLER")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Message: strings.Join(problems, "; "), Problems: problems}
+	}
 	return nil
 }
 
+// CustomBodyOverridesMap parses CustomBodyOverrides.
+func (c *Config) CustomBodyOverridesMap() (map[string]any, error) {
+	if c.CustomBodyOverrides == "" {
+		return nil, nil
+	}
+
+	var overrides map[string]any
+	if err := json.Unmarshal([]byte(c.CustomBodyOverrides), &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// ConfigError reports every invalid setting found by Validate, each named by
+// its environment variable without the HELIX_ASSIST_ prefix.
 type ConfigError struct {
-	Message string
+	Message  string
+	Problems []string
 }
 
 func (e *ConfigError) Error() string {
+	if len(e.Problems) > 1 {
+		return fmt.Sprintf("%d problems:\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+	}
 	return e.Message
 }
 
+// parseHeaders parses "Name: value" pairs separated by ||.
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, "||") {
+		name, val, ok := strings.Cut(pair, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	return headers
+}
+
+// parseLimits parses name=count pairs separated by commas, reporting
+// malformed pairs as problems.
+func parseLimits(value string, problems []string) (map[string]int, []string) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, count, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || err != nil || n < 0 {
+			problems = append(problems, fmt.Sprintf("CONCURRENCY_LIMITS: invalid entry %q, expected provider=count", pair))
+			continue
+		}
+		limits[strings.TrimSpace(name)] = n
+	}
+	return limits, problems
+}
+
+// parseHooks parses a JSON object of commands by event, each a command or
+// a list of them, or else event=command pairs separated by ||, which
+// leaves no way to write a command containing || itself. It reports
+// malformed pairs as problems. An event may have several commands.
+func parseHooks(value string, problems []string) (map[string][]string, []string) {
+	hooks := make(map[string][]string)
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &entries); err != nil {
+			return hooks, append(problems, fmt.Sprintf("HOOKS: invalid JSON: %s", err.Error()))
+		}
+		for event, raw := range entries {
+			var commands []string
+			var command string
+			if err := json.Unmarshal(raw, &command); err == nil {
+				commands = []string{command}
+			} else if err := json.Unmarshal(raw, &commands); err != nil {
+				problems = append(problems, fmt.Sprintf("HOOKS: %s must be a command or a list of commands", event))
+				continue
+			}
+			for _, command := range commands {
+				if strings.TrimSpace(command) == "" {
+					problems = append(problems, fmt.Sprintf("HOOKS: empty command for %s", event))
+					continue
+				}
+				hooks[event] = append(hooks[event], command)
+			}
+		}
+		return hooks, problems
+	}
+	for _, pair := range strings.Split(value, "||") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		event, command, ok := strings.Cut(pair, "=")
+		event, command = strings.TrimSpace(event), strings.TrimSpace(command)
+		if !ok || event == "" || command == "" {
+			problems = append(problems, fmt.Sprintf("HOOKS: invalid entry %q, expected event=command; commands containing || need the JSON form", pair))
+			continue
+		}
+		hooks[event] = append(hooks[event], command)
+	}
+	return hooks, problems
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvOrDefaultInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -157,11 +989,58 @@ func getEnvOrDefaultInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvOrDefaultFloat(key string, defaultValue float64) float64 {
+	if value := lookupEnv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvOrDefaultBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
 	}
 	return defaultValue
 }
+
+// ParseListen returns the network and address of a listen setting. A bare
+// tcp port listens on loopback only, as the server reads and edits the
+// workspace for whoever connects. Both are empty for stdio.
+func ParseListen(value string) (network, address string, err error) {
+	if value == "" || value == "stdio" {
+		return "", "", nil
+	}
+
+	network, address, _ = strings.Cut(value, ":")
+	switch network {
+	case "tcp":
+		if !strings.Contains(address, ":") {
+			address = net.JoinHostPort("127.0.0.1", address)
+		}
+		_, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return "", "", fmt.Errorf("must be tcp:PORT or tcp:HOST:PORT, got %q", value)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("needs a port between 1 and 65535, got %q", port)
+		}
+	case "unix":
+		if address == "" {
+			return "", "", fmt.Errorf("must be unix:/path, got %q", value)
+		}
+	default:
+		return "", "", fmt.Errorf("must be stdio, tcp:PORT, tcp:HOST:PORT or unix:/path, got %q", value)
+	}
+	return network, address, nil
+}
+
+// SplitHandler splits a "provider:model" setting. The model is empty when
+// only a provider is given; it may itself contain colons, as Ollama tags do.
+func SplitHandler(value string) (provider, model string) {
+	provider, model, _ = strings.Cut(value, ":")
+	return provider, model
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		want     map[string][]string
+		problems int
+	}{
+		{"pairs", "a=x||b=y", map[string][]string{"a": {"x"}, "b": {"y"}}, 0},
+		{"json", `{"a": "x || true", "b": ["y", "z"]}`, map[string][]string{"a": {"x || true"}, "b": {"y", "z"}}, 0},
+		{"shell or in pairs", "a=x || true", map[string][]string{"a": {"x"}}, 1},
+		{"bad json", `{"a": 1}`, map[string][]string{}, 1},
+		{"empty", "", map[string][]string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems := parseHooks(tt.value, nil)
+			if !maps.EqualFunc(got, tt.want, slices.Equal) || len(problems) != tt.problems {
+				t.Errorf("got %v with problems %q, want %v with %d", got, problems, tt.want, tt.problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// parseDuration reads a Go duration string such as "1.5s" or "250ms", or a
+// bare number counted in unit, and returns it as a whole number of units.
+func parseDuration(value string, unit time.Duration) (int, error) {
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return int(math.Round(number)), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. %s)", value, durationExamples(unit))
+	}
+	return int(d.Round(unit) / unit), nil
+}
+
+func durationExamples(unit time.Duration) string {
+	switch unit {
+	case time.Minute:
+		return "5, 90s or 1h"
+	case time.Second:
+		return "30, 1.5m or 500ms"
+	}
+	return "1500, 1.5s or 250ms"
+}
+
+// durationValue is a flag holding a duration as a count of unit.
+type durationValue struct {
+	target *int
+	unit   time.Duration
+}
+
+func (v *durationValue) String() string {
+	if v.target == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.target)
+}
+
+func (v *durationValue) Set(value string) error {
+	n, err := parseDuration(value, v.unit)
+	if err != nil {
+		return err
+	}
+	*v.target = n
+	return nil
+}
+
+// durationFlag defines a flag whose value, like the env variable it defaults
+// from, is either a number in unit or a duration string. An env value that
+// does not parse is reported by Validate.
+func (c *Config) durationFlag(name, env string, value int, unit time.Duration, usage string) *int {
+	if raw := lookupEnv(env); raw != "" {
+		if n, err := parseDuration(raw, unit); err == nil {
+			value = n
+		} else {
+			c.loadProblems = append(c.loadProblems, fmt.Sprintf("%s: %s", env, err.Error()))
+		}
+	}
+
+	target := &value
+	flag.Var(&durationValue{target: target, unit: unit}, name, usage)
+	return target
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"slices"
+)
+
+// EnvPrefix namespaces every environment variable read by Load. The
+// unprefixed names used before the namespace existed are still honoured, but
+// reported through Config.DeprecatedEnv.
+const EnvPrefix = "HELIX_ASSIST_"
+
+// vendorEnv are the providers' own conventional key variables. Other tools
+// read them too, so they stay accepted without a prefix or warning.
+var vendorEnv = map[string]bool{
+	"OPENAI_API_KEY":      true,
+	"ANTHROPIC_API_KEY":   true,
+	"DEEPSEEK_API_KEY":    true,
+	"XAI_API_KEY":         true,
+	"TOGETHER_API_KEY":    true,
+	"REPLICATE_API_TOKEN": true,
+}
+
+// legacyEnv collects the deprecated names seen while loading.
+var legacyEnv []string
+
+// lookupEnv returns HELIX_ASSIST_<key>, falling back to the legacy <key>.
+func lookupEnv(key string) string {
+	if value := os.Getenv(EnvPrefix + key); value != "" {
+		return value
+	}
+
+	value := os.Getenv(key)
+	if value != "" && !vendorEnv[key] && !slices.Contains(legacyEnv, key) {
+		legacyEnv = append(legacyEnv, key)
+	}
+	return value
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Settings are the options an editor may change while the server runs, sent
+// in workspace/didChangeConfiguration. Options left out are nil and keep
+// their current value. Every other option is fixed at startup, and other
+// keys are ignored.
+type Settings struct {
+	// Debounce is the completion debounce in milliseconds.
+	Debounce       *int `json:"debounce"`
+	NumSuggestions *int `json:"numSuggestions"`
+	// Handler is the provider to use, optionally with its model, as in
+	// "ollama:qwen2.5-coder:7b".
+	Handler *string `json:"handler"`
+	// TriggerCharacters limits which of the trigger characters advertised
+	// at startup request a completion.
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+// ParseSettings reads and validates settings. They may be given bare or
+// under a "helix-assist" key, as editors that share one configuration
+// between servers send them.
+func ParseSettings(raw json.RawMessage) (Settings, error) {
+	var settings Settings
+	if len(raw) == 0 || string(raw) == "null" {
+		return settings, nil
+	}
+
+	var nested struct {
+		Settings *json.RawMessage `json:"helix-assist"`
+	}
+	if err := json.Unmarshal(raw, &nested); err != nil {
+		return settings, fmt.Errorf("settings must be an object: %w", err)
+	}
+	if nested.Settings != nil {
+		raw = *nested.Settings
+	}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return settings, fmt.Errorf("invalid settings: %w", err)
+	}
+
+	var problems []string
+	if d := settings.Debounce; d != nil && (*d < 0 || *d > maxDebounce) {
+		problems = append(problems, fmt.Sprintf("debounce must be between 0 and %dms, got %dms", maxDebounce, *d))
+	}
+	if n := settings.NumSuggestions; n != nil && (*n < 1 || *n > maxSuggestions) {
+		problems = append(problems, fmt.Sprintf("numSuggestions must be between 1 and %d, got %d", maxSuggestions, *n))
+	}
+	if h := settings.Handler; h != nil && strings.TrimSpace(*h) == "" {
+		problems = append(problems, "handler must not be empty")
+	}
+	if len(problems) > 0 {
+		return settings, errors.New(strings.Join(problems, "; "))
+	}
+	return settings, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// User is one user of a shared server, as listed in the users file.
+type User struct {
+	// Token is what the user's editor sends as the token
+	// initializationOption.
+	Token string `json:"token"`
+	// Keys are the user's own API keys by provider name, used for their
+	// requests in place of the server's.
+	Keys map[string]string `json:"keys"`
+}
+
+// userKeyProviders are the providers a user may bring an API key for.
+var userKeyProviders = []string{"anthropic", "deepseek", "openai", "replicate", "together", "xai"}
+
+// LoadUsers reads the users file at path, a JSON object of users by name:
+//
+//	{"alice": {"token": "...", "keys": {"openai": "sk-..."}}}
+//
+// Every user needs a token of their own.
+func LoadUsers(path string) (map[string]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users map[string]User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s lists no users", path)
+	}
+
+	tokens := make(map[string]string, len(users))
+	for name, user := range users {
+		if user.Token == "" {
+			return nil, fmt.Errorf("user %s has no token", name)
+		}
+		if other, ok := tokens[user.Token]; ok {
+			return nil, fmt.Errorf("users %s and %s have the same token", min(name, other), max(name, other))
+		}
+		tokens[user.Token] = name
+		for provider := range user.Keys {
+			if !slices.Contains(userKeyProviders, provider) {
+				return nil, fmt.Errorf("user %s has a key for %s, keys are for: %s", name, provider, strings.Join(userKeyProviders, ", "))
+			}
+		}
+	}
+	return users, nil
+}
+
+// WithKeys returns a copy of c with keys, by provider name, in place of
+// the configured API keys.
+func (c *Config) WithKeys(keys map[string]string) *Config {
+	cfg := *c
+	for provider, key := range keys {
+		switch provider {
+		case "anthropic":
+			cfg.AnthropicKey = key
+		case "deepseek":
+			cfg.DeepSeekKey = key
+		case "openai":
+			cfg.OpenAIKey = key
+		case "replicate":
+			cfg.ReplicateKey = key
+		case "together":
+			cfg.TogetherKey = key
+		case "xai":
+			cfg.XAIKey = key
+		}
+	}
+	return &cfg
+}
@@ -0,0 +1,92 @@
+// Package dataset stores completions the user marked good or bad, as
+// prefix/suffix/completion triples for fine-tuning self-hosted models. The
+// file never leaves the machine.
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Labels given with the markGood and markBad commands.
+const (
+	LabelGood = "good"
+	LabelBad  = "bad"
+)
+
+// Record is one marked completion.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Label      string    `json:"label"`
+	File       string    `json:"file,omitempty"`
+	LanguageID string    `json:"languageId,omitempty"`
+	Provider   string    `json:"provider,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Prefix     string    `json:"prefix"`
+	Suffix     string    `json:"suffix"`
+	Completion string    `json:"completion"`
+	// Accepted is set when the completion was inserted into the document.
+	Accepted bool `json:"accepted"`
+}
+
+// DefaultPath is where records are kept unless configured otherwise.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "helix-assist", "feedback.jsonl")
+}
+
+// Append adds record to the JSONL file at path, creating it readable only
+// by the user.
+func Append(path string, record Record) error {
+	if path == "" {
+		return fmt.Errorf("no feedback file configured")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the records in the JSONL file at path.
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// IncludeBad keeps records labelled bad, for preference training;
+	// otherwise only good ones are exported.
+	IncludeBad bool
+	// Home is the user's home directory, replaced in the output. Empty
+	// means os.UserHomeDir.
+	Home string
+}
+
+// Example is one line of the exported training set.
+type Example struct {
+	Language   string `json:"language,omitempty"`
+	Prefix     string `json:"prefix"`
+	Suffix     string `json:"suffix"`
+	Completion string `json:"completion"`
+	Label      string `json:"label"`
+}
+
+// Stats summarises an export.
+type Stats struct {
+	Read       int
+	Skipped    int
+	Duplicates int
+	Written    int
+	Labels     map[string]int
+	Languages  map[string]int
+	// Redactions counts replacements by kind of data.
+	Redactions map[string]int
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Read %d records, wrote %d examples (%d duplicates, %d filtered out)\n", s.Read, s.Written, s.Duplicates, s.Skipped)
+	fmt.Fprintf(&b, "Labels: %s\n", formatCounts(s.Labels))
+	fmt.Fprintf(&b, "Languages: %s\n", formatCounts(s.Languages))
+	fmt.Fprintf(&b, "Redactions: %s\n", formatCounts(s.Redactions))
+	return b.String()
+}
+
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	keys := slices.Sorted(maps.Keys(counts))
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s %d", key, counts[key])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// redaction replaces matches of pattern, keeping submatch 1 when the
+// pattern has one, so an assignment keeps its name.
+type redaction struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+// redactions are applied in order; secrets come first so that an email
+// inside a connection string is counted as part of the credential.
+var redactions = []redaction{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"api-key", regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|xai-[A-Za-z0-9]{20,}|gh[pousr]_[A-Za-z0-9]{30,}|glpat-[A-Za-z0-9_-]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|AKIA[0-9A-Z]{16})\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`)},
+	{"url-credentials", regexp.MustCompile(`(\b[a-z][a-z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`)},
+	{"secret", regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api_?key|access_?key)["']?\s*[:=]\s*)["'][^"'\n]{4,}["']`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{"ip", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)},
+}
+
+// Redact replaces credentials, email and IP addresses, and the home
+// directory in text with placeholders, counting replacements by kind in
+// counts.
+func Redact(text, home string, counts map[string]int) string {
+	for _, r := range redactions {
+		text = r.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			counts[r.kind]++
+			placeholder := "<" + strings.ToUpper(r.kind) + ">"
+			if sub := r.pattern.FindStringSubmatch(match); len(sub) > 1 && sub[1] != "" {
+				return sub[1] + placeholder
+			}
+			return placeholder
+		})
+	}
+	if home != "" && home != "/" && strings.Contains(text, home) {
+		counts["home"] += strings.Count(text, home)
+		text = strings.ReplaceAll(text, home, "~")
+	}
+	return text
+}
+
+// Export reads the records at path, redacts them, drops duplicates and
+// writes the examples to w as JSONL.
+func Export(path string, w io.Writer, opts ExportOptions) (Stats, error) {
+	stats := Stats{Labels: map[string]int{}, Languages: map[string]int{}, Redactions: map[string]int{}}
+
+	records, err := Read(path)
+	if err != nil {
+		return stats, err
+	}
+	stats.Read = len(records)
+
+	home := opts.Home
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	home = filepath.Clean(home)
+
+	seen := map[[sha256.Size]byte]bool{}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, record := range records {
+		if record.Label != LabelGood && !(opts.IncludeBad && record.Label == LabelBad) {
+			stats.Skipped++
+			continue
+		}
+		if strings.TrimSpace(record.Completion) == "" {
+			stats.Skipped++
+			continue
+		}
+
+		redacted := map[string]int{}
+		example := Example{
+			Language:   record.LanguageID,
+			Prefix:     Redact(record.Prefix, home, redacted),
+			Suffix:     Redact(record.Suffix, home, redacted),
+			Completion: Redact(record.Completion, home, redacted),
+			Label:      record.Label,
+		}
+
+		key := sha256.Sum256([]byte(example.Label + "\x00" + example.Prefix + "\x00" + example.Suffix + "\x00" + strings.TrimSpace(example.Completion)))
+		if seen[key] {
+			stats.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		if err := enc.Encode(example); err != nil {
+			return stats, err
+		}
+		stats.Written++
+		for kind, n := range redacted {
+			stats.Redactions[kind] += n
+		}
+		stats.Labels[example.Label]++
+		stats.Languages[cmp.Or(example.Language, "unknown")]++
+	}
+	return stats, nil
+}
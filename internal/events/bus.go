@@ -0,0 +1,132 @@
+// Package events is an in-process publish/subscribe bus. Handlers publish
+// what happens to completions and code actions; cross-cutting consumers
+// such as the suggestion history, the transcript and any future stats or
+// plugins subscribe to it instead of being called from the handlers.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// Kind names an event.
+type Kind string
+
+const (
+	// CompletionRequested is published when a completion is sent to a
+	// provider.
+	CompletionRequested Kind = "completion.requested"
+	// CompletionOffered is published with the suggestions shown to the
+	// user.
+	CompletionOffered Kind = "completion.offered"
+	// CompletionAccepted is published when the document changes to contain
+	// an offered suggestion at the position it was offered.
+	CompletionAccepted Kind = "completion.accepted"
+	// ActionExecuted is published after a code action got its response.
+	ActionExecuted Kind = "action.executed"
+	// ProviderError is published for every failed provider call.
+	ProviderError Kind = "provider.error"
+)
+
+// Event describes one occurrence. Fields not meaningful for a kind are left
+// empty.
+type Event struct {
+	Kind Kind
+	Time time.Time
+
+	URI        string
+	LanguageID string
+	Position   lsp.Position
+	// ContentBefore and ContentAfter are the document text before and after
+	// the cursor, for completion events.
+	ContentBefore string
+	ContentAfter  string
+	// Suggestions holds the offered suggestions, or the accepted one.
+	Suggestions []string
+
+	// Command, Prompt and Response describe an executed code action. For
+	// provider errors Command is the call kind.
+	Command  string
+	Prompt   string
+	Response string
+
+	// Provider and Model are the provider and model that handled the call,
+	// when known.
+	Provider string
+	Model    string
+	Err      error
+}
+
+// Handler receives events. Handlers run synchronously in the publishing
+// goroutine, in subscription order, so they must not block; slow work
+// belongs in a goroutine of the handler's own.
+type Handler func(Event)
+
+type subscription struct {
+	id      int
+	kinds   map[Kind]bool
+	handler Handler
+}
+
+// Bus delivers published events to subscribers. A nil *Bus drops every
+// event, so publishers need not check for one.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []subscription
+	nextID int
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handler for each published event of the given kinds, or
+// of every kind when none are given. The returned function unsubscribes.
+func (b *Bus) Subscribe(handler Handler, kinds ...Kind) func() {
+	sub := subscription{handler: handler}
+	if len(kinds) > 0 {
+		sub.kinds = make(map[Kind]bool, len(kinds))
+		for _, kind := range kinds {
+			sub.kinds[kind] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s.id == sub.id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers event to its subscribers, stamping its time if unset.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.kinds == nil || sub.kinds[event.Kind] {
+			sub.handler(event)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// Kinds lists every event kind, in the order they are documented.
+var Kinds = []Kind{CompletionRequested, CompletionOffered, CompletionAccepted, ActionExecuted, ProviderError}
+
+// HookOptions configures RunHooks.
+type HookOptions struct {
+	// Commands maps event kinds to shell commands run for each event of
+	// that kind.
+	Commands map[string][]string
+	// Timeout bounds each run; a hook still running then is killed.
+	Timeout time.Duration
+	// Dir returns the directory hooks run in, normally the workspace root.
+	Dir func() string
+	// Allow reports whether hooks may run now. Events published while it
+	// returns false are skipped.
+	Allow  func() bool
+	Logger *lsp.Logger
+}
+
+// maxHookProcesses bounds the hook processes running at once for one
+// RunHooks. Events beyond it are skipped rather than queued, so a burst of
+// completions cannot pile up processes behind a slow hook.
+const maxHookProcesses = 8
+
+// RunHooks subscribes the configured external commands to bus. Each event
+// is written to the command's stdin as JSON, with its kind also in the
+// HELIX_ASSIST_EVENT environment variable. Hooks run in the background, one
+// process per event and at most maxHookProcesses at once; their output goes
+// to the log.
+func RunHooks(bus *Bus, opts HookOptions) error {
+	running := make(chan struct{}, maxHookProcesses)
+	for kind, commands := range opts.Commands {
+		if !slices.Contains(Kinds, Kind(kind)) {
+			return fmt.Errorf("unknown hook event %q, expected one of: %s", kind, joinKinds())
+		}
+		for _, command := range commands {
+			bus.Subscribe(func(event Event) {
+				if opts.Allow != nil && !opts.Allow() {
+					return
+				}
+				select {
+				case running <- struct{}{}:
+				default:
+					opts.Logger.Log("hook", event.Kind, "skipped:", maxHookProcesses, "hooks still running")
+					return
+				}
+				go func() {
+					defer func() { <-running }()
+					runHook(command, event, opts)
+				}()
+			}, Kind(kind))
+		}
+	}
+	return nil
+}
+
+func runHook(command string, event Event, opts HookOptions) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		opts.Logger.Log("hook:", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "HELIX_ASSIST_EVENT="+string(event.Kind))
+	if opts.Dir != nil {
+		cmd.Dir = opts.Dir()
+	}
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		opts.Logger.Log("hook", event.Kind, "output:", strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		opts.Logger.Log("hook", event.Kind, "failed:", command+":", err.Error())
+	}
+}
+
+func joinKinds() string {
+	names := make([]string, len(Kinds))
+	for i, kind := range Kinds {
+		names[i] = string(kind)
+	}
+	return strings.Join(names, ", ")
+}
+
+// MarshalJSON encodes the fields set for the event's kind, with the error
+// as its message.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type eventJSON struct {
+		Kind          Kind          `json:"kind"`
+		Time          time.Time     `json:"time"`
+		URI           string        `json:"uri,omitempty"`
+		LanguageID    string        `json:"languageId,omitempty"`
+		Position      *lsp.Position `json:"position,omitempty"`
+		ContentBefore string        `json:"contentBefore,omitempty"`
+		ContentAfter  string        `json:"contentAfter,omitempty"`
+		Suggestions   []string      `json:"suggestions,omitempty"`
+		Command       string        `json:"command,omitempty"`
+		Prompt        string        `json:"prompt,omitempty"`
+		Response      string        `json:"response,omitempty"`
+		Provider      string        `json:"provider,omitempty"`
+		Model         string        `json:"model,omitempty"`
+		Error         string        `json:"error,omitempty"`
+	}
+
+	out := eventJSON{
+		Kind:          e.Kind,
+		Time:          e.Time,
+		URI:           e.URI,
+		LanguageID:    e.LanguageID,
+		ContentBefore: e.ContentBefore,
+		ContentAfter:  e.ContentAfter,
+		Suggestions:   e.Suggestions,
+		Command:       e.Command,
+		Prompt:        e.Prompt,
+		Response:      e.Response,
+		Provider:      e.Provider,
+		Model:         e.Model,
+	}
+	if strings.HasPrefix(string(e.Kind), "completion.") {
+		out.Position = &e.Position
+	}
+	if e.Err != nil {
+		out.Error = e.Err.Error()
+	}
+	return json.Marshal(out)
+}
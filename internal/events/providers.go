@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"errors"
+
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// providerErrors is registry middleware publishing failed provider calls.
+type providerErrors struct {
+	bus *Bus
+}
+
+type busKey struct{}
+
+// ProviderErrors returns middleware that publishes a ProviderError event for
+// every failed call through the registry, on the bus of the call's context
+// (see WithBus) or else on bus. Cancelled calls are not errors.
+func ProviderErrors(bus *Bus) providers.Middleware {
+	return providerErrors{bus: bus}
+}
+
+// WithBus returns a context whose failed provider calls are published on
+// bus: that of the editor session they are made for, when several share a
+// registry, so the session's hooks see them.
+func WithBus(ctx context.Context, bus *Bus) context.Context {
+	return context.WithValue(ctx, busKey{}, bus)
+}
+
+func (m providerErrors) BeforeRequest(ctx context.Context, call *providers.Call) (*providers.Result, error) {
+	return nil, nil
+}
+
+func (m providerErrors) AfterResponse(ctx context.Context, call *providers.Call, result *providers.Result, err error) error {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		bus, ok := ctx.Value(busKey{}).(*Bus)
+		if !ok {
+			bus = m.bus
+		}
+		bus.Publish(Event{Kind: ProviderError, Command: call.Kind, Provider: call.Provider, Err: err})
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// acceptanceTracker turns document changes into CompletionAccepted events.
+// LSP does not report which completion item the user picked, so the latest
+// offer per document is kept until the document shows one of its
+// suggestions inserted at the cursor, or the text before the cursor
+// changes.
+type acceptanceTracker struct {
+	mu     sync.Mutex
+	offers map[string]events.Event
+	bus    *events.Bus
+}
+
+func newAcceptanceTracker(bus *events.Bus) *acceptanceTracker {
+	t := &acceptanceTracker{offers: make(map[string]events.Event), bus: bus}
+	bus.Subscribe(t.offered, events.CompletionOffered)
+	return t
+}
+
+func (t *acceptanceTracker) offered(event events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offers[event.URI] = event
+}
+
+// changed checks the new text of the document at uri against its offer.
+func (t *acceptanceTracker) changed(uri, text string) {
+	t.mu.Lock()
+	offer, ok := t.offers[uri]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	rest, ok := strings.CutPrefix(text, offer.ContentBefore)
+	if !ok {
+		delete(t.offers, uri)
+		t.mu.Unlock()
+		return
+	}
+
+	accepted := ""
+	for _, suggestion := range offer.Suggestions {
+		if strings.HasPrefix(rest, suggestion) && len(suggestion) > len(accepted) {
+			accepted = suggestion
+		}
+	}
+	if accepted != "" {
+		delete(t.offers, uri)
+	}
+	t.mu.Unlock()
+
+	if accepted != "" {
+		t.bus.Publish(events.Event{
+			Kind:          events.CompletionAccepted,
+			URI:           uri,
+			LanguageID:    offer.LanguageID,
+			Position:      offer.Position,
+			ContentBefore: offer.ContentBefore,
+			ContentAfter:  offer.ContentAfter,
+			Suggestions:   []string{accepted},
+			Provider:      offer.Provider,
+			Model:         offer.Model,
+		})
+	}
+}
+
+func (t *acceptanceTracker) register(svc *lsp.Service) {
+	svc.On(lsp.EventDidChange, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.DidChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+		// Changes may be incremental; the store has the whole text.
+		if buffer, ok := svc.Buffers.Get(params.TextDocument.URI); ok {
+			t.changed(params.TextDocument.URI, buffer.Text)
+		}
+	})
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/dataset"
+	"github.com/leona/helix-assist/internal/events"
 	"github.com/leona/helix-assist/internal/lsp"
 	"github.com/leona/helix-assist/internal/providers"
 	"github.com/leona/helix-assist/internal/util"
@@ -20,30 +28,70 @@ type CodeActionCommand struct {
 var Commands = []CodeActionCommand{
 	{Key: "fixComplete", Label: "AI: Complete/Fix Code"},
 	{Key: "explainComments", Label: "AI: Explain code with comments"},
+	{Key: "explainCode", Label: "AI: Explain code"},
+	{Key: "summarizeCode", Label: "AI: Summarize code"},
+	{Key: "reviewCode", Label: "AI: Review code"},
 	{Key: "codeFromComment", Label: "AI: Code from comment"},
+	{Key: "completeBlock", Label: "AI: Complete until end of block"},
+	{Key: "documentCode", Label: "AI: Document code"},
+	{Key: "generateTests", Label: "AI: Generate tests"},
+	{Key: "generateFromSkeleton", Label: "AI: Generate file from skeleton (preview)"},
 }
 
 func CommandKeys() []string {
-	keys := make([]string, len(Commands))
+	keys := make([]string, len(Commands), len(Commands)+1+len(workspaceCommands))
 	for i, cmd := range Commands {
 		keys[i] = cmd.Key
 	}
+	keys = append(keys, newFromTemplateCommand)
+	for _, cmd := range workspaceCommands {
+		keys = append(keys, cmd.Name)
+	}
 	return keys
 }
 
 type ActionHandler struct {
-	cfg      *config.Config
-	registry *providers.Registry
+	cfg        *config.Config
+	registry   *providers.Registry
+	lowPower   *LowPowerMode
+	manifests  *manifestCache
+	transcript *transcript
+	trust      *WorkspaceTrust
+	journal    *journal
+	events     *events.Bus
+	feedback   *feedback
+	review     *reviewer
+	issues     *issueResolver
 }
 
-func NewActionHandler(cfg *config.Config, registry *providers.Registry) *ActionHandler {
+func NewActionHandler(cfg *config.Config, registry *providers.Registry, lowPower *LowPowerMode, trust *WorkspaceTrust, bus *events.Bus) *ActionHandler {
 	return &ActionHandler{
-		cfg:      cfg,
-		registry: registry,
+		cfg:        cfg,
+		registry:   registry,
+		lowPower:   lowPower,
+		trust:      trust,
+		manifests:  newManifestCache(),
+		transcript: newTranscript(),
+		journal:    newJournal(journalDir()),
+		events:     bus,
+		feedback:   newFeedback(bus, cmp.Or(cfg.FeedbackFile, dataset.DefaultPath())),
+		review:     newReviewer(cfg, registry, lowPower, trust),
+		issues:     newIssueResolver(cfg),
 	}
 }
 
 func (h *ActionHandler) Register(svc *lsp.Service) {
+	h.events.Subscribe(func(event events.Event) {
+		h.transcript.record(transcriptEntry{
+			Time:     event.Time,
+			Command:  event.Command,
+			File:     relativePath(svc.RootPath(), event.URI),
+			Provider: event.Provider,
+			Prompt:   event.Prompt,
+			Response: event.Response,
+		})
+	}, events.ActionExecuted)
+
 	svc.On(lsp.EventCodeAction, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
 		var params lsp.CodeActionParams
 
@@ -55,6 +103,11 @@ func (h *ActionHandler) Register(svc *lsp.Service) {
 		svc.Buffers.SetCurrentURI(params.TextDocument.URI)
 		actions := make([]lsp.CodeAction, 0, len(Commands))
 
+		if buffer, ok := svc.Buffers.Get(params.TextDocument.URI); ok && buffer.Binary {
+			svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: actions})
+			return
+		}
+
 		for _, cmd := range Commands {
 			diagnosticMsgs := make([]string, 0, len(params.Context.Diagnostics))
 
@@ -79,6 +132,8 @@ func (h *ActionHandler) Register(svc *lsp.Service) {
 			})
 		}
 
+		actions = append(actions, h.templateActions(svc, params.Range)...)
+
 		svc.Send(&lsp.JSONRPCMessage{
 			ID:     msg.ID,
 			Result: actions,
@@ -88,6 +143,10 @@ func (h *ActionHandler) Register(svc *lsp.Service) {
 	svc.On(lsp.EventExecuteCommand, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
 		h.executeCommand(svc, msg)
 	})
+
+	h.registerCodeLens(svc)
+	h.review.register(svc)
+	h.registerSaveCleanup(svc)
 }
 
 func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
@@ -104,6 +163,45 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 		return
 	}
 
+	switch params.Command {
+	case usageCommand:
+		h.showUsage(svc, msg)
+		return
+	case lowPowerCommand:
+		h.toggleLowPower(svc, msg)
+		return
+	case setProviderCommand:
+		h.setProvider(svc, msg, stringArgs(params.Arguments))
+		return
+	case setModelCommand:
+		h.setModel(svc, msg, stringArgs(params.Arguments))
+		return
+	case listModelsCommand:
+		h.listModels(svc, msg)
+		return
+	case exportTranscriptCommand:
+		h.exportTranscript(svc, msg, stringArgs(params.Arguments))
+		return
+	case importTranscriptCommand:
+		h.importTranscript(svc, msg, stringArgs(params.Arguments))
+		return
+	case setTrustCommand:
+		h.setTrust(svc, msg, stringArgs(params.Arguments))
+		return
+	case revertLastCommand:
+		h.revertLast(svc, msg)
+		return
+	case clearCacheCommand:
+		h.clearCache(svc, msg)
+		return
+	case markGoodCommand:
+		h.markLast(svc, msg, dataset.LabelGood)
+		return
+	case markBadCommand:
+		h.markLast(svc, msg, dataset.LabelBad)
+		return
+	}
+
 	if len(params.Arguments) == 0 {
 		svc.Logger.Log("executeCommand: no arguments")
 		return
@@ -123,21 +221,63 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 		return
 	}
 
-	currentURI := svc.Buffers.CurrentURI()
+	currentURI := cmp.Or(cmdArg.URI, svc.Buffers.CurrentURI())
 
 	if currentURI == "" {
 		svc.Logger.Log("executeCommand: no current URI")
 		return
 	}
+	// The range is byte-based from here on, and encoded back in edits.
+	cmdArg.Range = svc.Buffers.DecodeRange(currentURI, cmdArg.Range)
 
-	var progress *util.ProgressIndicator
+	if params.Command == newFromTemplateCommand {
+		h.newFromTemplate(svc, currentURI, cmdArg)
+		return
+	}
 
-	if h.cfg.EnableProgressSpinner {
-		progress = util.NewProgressIndicator(svc, h.cfg)
-		progress.Start()
-		defer progress.Stop()
-	} else {
-		svc.SendShowMessage(lsp.MessageTypeInfo, "Executing "+params.Command+"...")
+	if buffer, ok := svc.Buffers.Get(currentURI); ok && buffer.Binary {
+		svc.Logger.Log("executeCommand: ignoring binary document", currentURI)
+		return
+	}
+
+	if params.Command == "generateFromSkeleton" {
+		buffer, ok := svc.Buffers.Get(currentURI)
+		if !ok {
+			svc.Logger.Log("executeCommand: buffer not found")
+			return
+		}
+		h.generateFromSkeleton(svc, currentURI, buffer)
+		return
+	}
+
+	timeout := time.Duration(h.cfg.ActionTimeout) * time.Millisecond
+	if params.Command == "completeBlock" {
+		timeout = time.Duration(h.cfg.BlockTimeout) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(sessionContext(svc, h.lowPower), timeout)
+	defer cancel()
+	ctx = providers.WithOverride(ctx, cmdArg.Provider, cmdArg.Model)
+
+	status := "done"
+	cancellable := false
+	var progress *util.CancellableProgress
+
+	if h.cfg.CancellableActions {
+		progress, cancellable = util.StartCancellableProgress(svc, "AI: "+params.Command, timeout, cancel)
+		if cancellable {
+			defer func() { progress.Stop(status) }()
+		}
+	}
+
+	var spinner *util.ProgressIndicator
+	if !cancellable {
+		if h.cfg.EnableProgressSpinner && util.ProgressSupported(svc) {
+			spinner = util.NewProgressIndicator(svc, h.cfg, "AI: "+params.Command)
+			spinner.Start()
+			defer spinner.Stop()
+		} else {
+			svc.SendShowMessage(lsp.MessageTypeInfo, "Executing "+params.Command+"...")
+		}
 	}
 
 	content := svc.Buffers.GetContentFromRange(currentURI, cmdArg.Range)
@@ -158,6 +298,15 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 	// Build action-specific prompts
 	var systemPrompt, userPrompt string
 
+	// Most actions replace the selection; completeBlock inserts at the
+	// cursor.
+	editRange := cmdArg.Range
+	insertAtCursor := false
+	// Explanations and tests are opened as a document of their own rather
+	// than edited into the source.
+	showResult := false
+	showTests := false
+
 	switch params.Command {
 	case "fixComplete":
 		systemPrompt = providers.BuildFixCompleteSystemPrompt(buffer.LanguageID)
@@ -165,23 +314,115 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 	case "explainComments":
 		systemPrompt = providers.BuildExplainCommentsSystemPrompt(buffer.LanguageID)
 		userPrompt = providers.BuildExplainCommentsUserPrompt(dedented)
+	case "explainCode":
+		systemPrompt = providers.BuildExplainSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildExplainUserPrompt(dedented)
+		showResult = true
+	case "summarizeCode":
+		systemPrompt = providers.BuildSummarizeSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildSummarizeUserPrompt(dedented)
+		showResult = true
+	case "reviewCode":
+		systemPrompt = providers.BuildReviewSelectionSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildReviewSelectionUserPrompt(dedented)
+		showResult = true
 	case "codeFromComment":
 		systemPrompt = providers.BuildCodeFromCommentSystemPrompt(buffer.LanguageID)
 		userPrompt = providers.BuildCodeFromCommentUserPrompt(dedented)
+	case "completeBlock":
+		cursor := cmdArg.Range.Start
+		parts := util.GetContent(buffer.Text, cursor.Line, cursor.Character)
+		systemPrompt = providers.BuildCompleteBlockSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildCompleteBlockUserPrompt(currentURI, parts.ContentBefore, parts.ContentImmediatelyAfter+"\n"+parts.ContentAfter)
+		editRange = lsp.Range{Start: cursor, End: cursor}
+		insertAtCursor = true
+	case "documentCode":
+		systemPrompt = providers.BuildDocumentSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildDocumentUserPrompt(dedented)
+	case "generateTests":
+		systemPrompt = providers.BuildGenerateTestsSystemPrompt(buffer.LanguageID)
+		userPrompt = providers.BuildGenerateTestsUserPrompt(dedented)
+		showTests = true
 	default:
 		svc.Logger.Log("executeCommand: unknown command:", params.Command)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
-	defer cancel()
-
-	resp, err := h.registry.Chat(ctx, systemPrompt, userPrompt)
+	root := svc.RootPath()
+	// Manifests are workspace content.
+	if h.cfg.ManifestContext && h.trust.Level(root).allowsWorkspaceContent() {
+		dir := filepath.Dir(strings.TrimPrefix(currentURI, "file://"))
+		systemPrompt = providers.WithDependencies(systemPrompt, h.manifests.dependencies(dir, root))
+	}
+	if h.cfg.APIHintsDir != "" {
+		dir := h.cfg.APIHintsDir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		// Hints kept in the workspace are workspace content.
+		if filepath.IsAbs(h.cfg.APIHintsDir) || h.trust.Level(root).allowsWorkspaceContent() {
+			systemPrompt = providers.WithAPIHints(systemPrompt, matchingAPIHints(dir, buffer.Text))
+		}
+	}
+	// Blame runs git, which repository config can make run other programs.
+	var blame string
+	if h.cfg.BlameContext && (params.Command == "explainComments" || params.Command == "explainCode") && h.trust.Level(root).AllowsExternalCommands() {
+		start, end := rangeLines(cmdArg.Range)
+		blame = blameSummary(strings.TrimPrefix(currentURI, "file://"), start, end)
+		systemPrompt = providers.WithBlame(systemPrompt, blame)
+	}
+	if h.issues != nil && h.trust.Level(root).AllowsExternalCommands() {
+		if ids := h.issues.references(dedented, blame); len(ids) > 0 {
+			systemPrompt = providers.WithIssues(systemPrompt, h.issues.describe(svc.Logger, root, ids))
+		}
+	}
+	systemPrompt = providers.WithResponseLanguage(systemPrompt, h.cfg.ResponseLanguage)
+	systemPrompt = providers.WithInstructions(systemPrompt, h.instructions(root))
+	systemPrompt = providers.WithConversation(systemPrompt, h.transcript.conversation())
+
+	lines := 1
+	var generated strings.Builder
+	chat := h.registry.ChatStream
+	if h.cfg.StructuredActions && !showResult {
+		// Structured results arrive whole: a preview of half a JSON object
+		// would show nothing useful.
+		chat = func(ctx context.Context, systemPrompt, userPrompt string, _ providers.StreamFunc) (*providers.ChatResponse, error) {
+			return h.registry.ChatStructured(ctx, systemPrompt, userPrompt)
+		}
+	}
+	// A fallback taking over mid-stream starts the preview over.
+	streamCtx := providers.WithStreamRestart(ctx, func() {
+		lines = 1
+		generated.Reset()
+	})
+	resp, err := chat(streamCtx, systemPrompt, userPrompt, func(delta string) error {
+		lines += strings.Count(delta, "\n")
+		if h.cfg.ActionPreview {
+			generated.WriteString(delta)
+		}
+		switch {
+		case cancellable:
+			progress.SetGenerated(lines)
+			if h.cfg.ActionPreview {
+				progress.SetPreview(generated.String())
+			}
+		case spinner != nil && h.cfg.ActionPreview:
+			spinner.SetPreview(generated.String())
+		}
+		return nil
+	})
 	if err != nil {
-		svc.Logger.Log("chat failed:", err.Error())
+		if errors.Is(ctx.Err(), context.Canceled) {
+			status = "cancelled"
+			svc.Logger.Log("chat cancelled by user:", params.Command)
+			return
+		}
+
+		status = "failed"
+		svc.Logger.Log("chat failed:", providers.KindOf(err), err.Error())
 		svc.SendDiagnostics([]lsp.Diagnostic{
 			{
-				Message:  err.Error(),
+				Message:  chatErrorMessage(err),
 				Severity: lsp.SeverityError,
 				Range:    cmdArg.Range,
 			},
@@ -193,6 +434,7 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 	svc.Logger.Log("chat response result:", resp.Result)
 
 	if resp.Result == "" {
+		status = "no result"
 		svc.Logger.Log("chat: no completion found")
 		svc.SendDiagnostics([]lsp.Diagnostic{
 			{
@@ -204,29 +446,139 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 		return
 	}
 
-	// Fix indentation: trim blank lines, dedent AI output, re-indent to original level
-	result := util.TrimBlankLines(resp.Result)
-	result = util.DedentContent(result)
-	result = util.IndentContent(result, indent) + "\n"
-	svc.Logger.Log("received chat result:", result)
-
-	svc.Send(&lsp.JSONRPCMessage{
-		Method: lsp.EventApplyEdit,
-		ID:     msg.ID,
-		Params: mustMarshal(lsp.ApplyWorkspaceEditParams{
-			Label: params.Command,
-			Edit: lsp.WorkspaceEdit{
-				Changes: map[string][]lsp.TextEdit{
-					currentURI: {
-						{
-							Range:   cmdArg.Range,
-							NewText: result,
-						},
+	if h.cfg.OutputFilter != OutputFilterOff {
+		if reason := contaminationReason(resp.Result, h.cfg.OutputFilterMinLength); reason != "" {
+			svc.Logger.Log("chat result", reason)
+			if h.cfg.OutputFilter == OutputFilterDrop {
+				status = "filtered"
+				svc.SendDiagnostics([]lsp.Diagnostic{
+					{
+						Message:  "Result withheld: it " + reason,
+						Severity: lsp.SeverityWarning,
+						Range:    cmdArg.Range,
 					},
-				},
-			},
-		}),
+				}, 0)
+				return
+			}
+			svc.SendShowMessage(lsp.MessageTypeWarning, "Possible license contamination: the result "+reason)
+		}
+	}
+
+	h.events.Publish(events.Event{
+		Kind:     events.ActionExecuted,
+		URI:      currentURI,
+		Command:  params.Command,
+		Provider: cmp.Or(cmdArg.Provider, h.registry.Selected(ctx)),
+		Prompt:   userPrompt,
+		Response: resp.Result,
 	})
+
+	if resp.Structured {
+		svc.Logger.Log("structured result, confidence", resp.Confidence, "explanation:", resp.Explanation)
+		if resp.Explanation != "" {
+			svc.SendShowMessage(lsp.MessageTypeInfo, fmt.Sprintf("%s (confidence %.0f%%)", resp.Explanation, resp.Confidence*100))
+		}
+	}
+
+	if showResult {
+		h.showResult(svc, msg, params.Command, currentURI, resp.Result)
+		return
+	}
+	if showTests {
+		if err := h.showTests(svc, currentURI, buffer.LanguageID, resp.Result); err != nil {
+			status = "failed"
+			h.replyError(svc, msg, err)
+			return
+		}
+		h.reply(svc, msg, nil)
+		return
+	}
+
+	var result string
+	if insertAtCursor {
+		// The continuation already carries its own indentation relative to
+		// the cursor line.
+		result = strings.TrimRight(resp.Result, " \t\n")
+	} else {
+		// Fix indentation: trim blank lines, dedent AI output, re-indent to original level
+		result = util.TrimBlankLines(resp.Result)
+		result = util.DedentContent(result)
+		result = util.IndentContent(result, indent) + "\n"
+	}
+	svc.Logger.Log("received chat result:", result)
+
+	// The result was generated for the document as it was; edits made
+	// meanwhile would be overwritten or misplaced.
+	current, ok := svc.Buffers.Get(currentURI)
+	if !ok || current.Version != buffer.Version {
+		status = "discarded"
+		h.replyError(svc, msg, fmt.Errorf("%s result discarded: the document changed while it was generated", params.Command))
+		return
+	}
+
+	// The provider may have used up most of the action timeout.
+	applyCtx, cancelApply := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelApply()
+
+	edit := lsp.TextEdit{Range: editRange, NewText: result}
+	if err := applyEdit(applyCtx, svc, params.Command, currentURI, buffer.Version, edit); err != nil {
+		status = "failed"
+		h.replyError(svc, msg, err)
+		return
+	}
+	h.recordEdit(svc, params.Command, currentURI, current.Text, editRange, result)
+	h.reply(svc, msg, nil)
+}
+
+// applyEdit applies byteEdits, with byte-based ranges, to the document at
+// uri with workspace/applyEdit, as a single undoable step. Clients that
+// support versioned edits reject them if the document is no longer at
+// version.
+func applyEdit(ctx context.Context, svc *lsp.Service, label, uri string, version int, byteEdits ...lsp.TextEdit) error {
+	edits := make([]lsp.TextEdit, len(byteEdits))
+	for i, edit := range byteEdits {
+		edits[i] = lsp.TextEdit{Range: svc.Buffers.EncodeRange(uri, edit.Range), NewText: edit.NewText}
+	}
+
+	edit := lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{uri: edits}}
+	if svc.ClientCapabilities().Workspace.WorkspaceEdit.DocumentChanges {
+		edit = lsp.WorkspaceEdit{DocumentChanges: []lsp.TextDocumentEdit{{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: version},
+			Edits:        edits,
+		}}}
+	}
+
+	resp, err := svc.Call(ctx, lsp.EventApplyEdit, lsp.ApplyWorkspaceEditParams{Label: label, Edit: edit})
+	if err != nil {
+		return err
+	}
+
+	var result lsp.ApplyWorkspaceEditResult
+	if err := lsp.DecodeResult(resp, &result); err == nil && !result.Applied {
+		return fmt.Errorf("editor did not apply the %s edit: %s", label, cmp.Or(result.FailureReason, "no reason given"))
+	}
+	return nil
+}
+
+// chatErrorMessage turns a provider failure into a diagnostic message that
+// tells the user what to fix rather than echoing the raw API body.
+func chatErrorMessage(err error) string {
+	switch providers.KindOf(err) {
+	case providers.ErrorKindAuth:
+		return "Provider rejected the API key: " + err.Error()
+	case providers.ErrorKindQuota:
+		return "Provider quota or rate limit exceeded: " + err.Error()
+	case providers.ErrorKindTimeout:
+		return "Provider request timed out, try a smaller selection or a longer ACTION_TIMEOUT"
+	case providers.ErrorKindContextLength:
+		return "Selection is too large for the model's context window"
+	case providers.ErrorKindModelNotFound:
+		return "Configured model was not found: " + err.Error()
+	case providers.ErrorKindNetwork:
+		return "Could not reach provider: " + err.Error()
+	default:
+		return err.Error()
+	}
 }
 
 func mustMarshal(v any) json.RawMessage {
@@ -236,3 +588,23 @@ func mustMarshal(v any) json.RawMessage {
 	}
 	return data
 }
+
+// instructions combines the configured prompt instructions with the project
+// instructions file, expanding prompt variables at request time. The project
+// file is skipped in workspaces that are not trusted.
+func (h *ActionHandler) instructions(root string) string {
+	parts := []string{h.cfg.PromptInstructions}
+
+	if h.cfg.ProjectInstructionsFile != "" && h.trust.Level(root).allowsWorkspaceContent() {
+		path := h.cfg.ProjectInstructionsFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			text, _ := util.DecodeText(data)
+			parts = append(parts, text)
+		}
+	}
+
+	return providers.ExpandPromptVariables(strings.TrimSpace(strings.Join(parts, "\n\n")), root)
+}
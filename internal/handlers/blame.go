@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+const (
+	// blameTimeout bounds a git blame run, so a slow repository never holds
+	// up an action.
+	blameTimeout = 3 * time.Second
+	// maxBlameEntries caps the line ranges listed per prompt.
+	maxBlameEntries = 20
+)
+
+// blameEntry is a run of consecutive lines last changed by one commit.
+type blameEntry struct {
+	start, end int
+	commit     string
+	author     string
+	time       time.Time
+	summary    string
+}
+
+// blameSummary describes who last changed lines start through end
+// (0-based, inclusive) of the file at path and why, from git blame. Blame
+// reads the file as saved, so lines edited since may be attributed
+// loosely. It returns "" outside a git repository or when git fails.
+func blameSummary(path string, start, end int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), blameTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start+1, end+1), "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	entries := parseBlame(output)
+	if len(entries) > maxBlameEntries {
+		entries = entries[len(entries)-maxBlameEntries:]
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		lines := fmt.Sprintf("line %d", entry.start)
+		if entry.end > entry.start {
+			lines = fmt.Sprintf("lines %d-%d", entry.start, entry.end)
+		}
+		if strings.Trim(entry.commit, "0") == "" {
+			fmt.Fprintf(&b, "- %s: not committed yet\n", lines)
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: %.8s by %s, %s: %s\n", lines, entry.commit, entry.author, entry.time.Format("2006-01-02"), entry.summary)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// rangeLines returns the first and last line r covers, not counting a last
+// line it only reaches the start of.
+func rangeLines(r lsp.Range) (int, int) {
+	end := r.End.Line
+	if r.End.Character == 0 && end > r.Start.Line {
+		end--
+	}
+	return r.Start.Line, end
+}
+
+// parseBlame reads git blame --porcelain output into runs of lines, with
+// 1-based line numbers. Porcelain output gives a commit's details only the
+// first time the commit appears.
+func parseBlame(output []byte) []blameEntry {
+	type commitInfo struct {
+		author  string
+		time    time.Time
+		summary string
+	}
+	commits := make(map[string]*commitInfo)
+
+	var entries []blameEntry
+	var current *commitInfo
+	var commit string
+	line := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			// The line's content ends its entry.
+			info := commits[commit]
+			if n := len(entries); n > 0 && entries[n-1].commit == commit && entries[n-1].end == line-1 {
+				entries[n-1].end = line
+				continue
+			}
+			entries = append(entries, blameEntry{start: line, end: line, commit: commit, author: info.author, time: info.time, summary: info.summary})
+		case strings.HasPrefix(text, "author "):
+			current.author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-time "):
+			if seconds, err := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64); err == nil {
+				current.time = time.Unix(seconds, 0)
+			}
+		case strings.HasPrefix(text, "summary "):
+			current.summary = strings.TrimPrefix(text, "summary ")
+		default:
+			// A header: <commit> <original line> <final line> [<group size>].
+			fields := strings.Fields(text)
+			if len(fields) < 3 || len(fields[0]) != 40 {
+				continue
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			commit, line = fields[0], n
+			if commits[commit] == nil {
+				commits[commit] = &commitInfo{}
+			}
+			current = commits[commit]
+		}
+	}
+	return entries
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// burstWindow is the span over which changed lines are summed to detect a
+// paste or automated refactor.
+const burstWindow = time.Second
+
+type changeEvent struct {
+	at    time.Time
+	lines int
+}
+
+// changeGate suppresses auto-completions for a cool-down period after a
+// burst of edits, when every keystroke-triggered request would be wasted.
+type changeGate struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	events    []changeEvent
+	until     time.Time
+}
+
+func newChangeGate(threshold int, cooldown time.Duration) *changeGate {
+	return &changeGate{threshold: threshold, cooldown: cooldown}
+}
+
+// observe records lines changed at now and starts the cool-down once the
+// lines changed within burstWindow reach the threshold.
+func (g *changeGate) observe(lines int, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	kept := g.events[:0]
+	total := lines
+	for _, e := range g.events {
+		if now.Sub(e.at) < burstWindow {
+			kept = append(kept, e)
+			total += e.lines
+		}
+	}
+	g.events = append(kept, changeEvent{at: now, lines: lines})
+
+	if total < g.threshold {
+		return false
+	}
+
+	g.events = g.events[:0]
+	g.until = now.Add(g.cooldown)
+	return true
+}
+
+// suppressed reports whether completions are paused at now.
+func (g *changeGate) suppressed(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return now.Before(g.until)
+}
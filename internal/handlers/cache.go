@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// clearCacheCommand drops the cached completions, for when a model or the
+// code it was shown changed in ways the cache cannot see. It takes no
+// arguments.
+const clearCacheCommand = "helix-assist.clearCache"
+
+func (h *ActionHandler) clearCache(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	h.reply(svc, msg, fmt.Sprintf("Cleared %d cached completions", h.registry.ClearCompletionCache()))
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// saveFix is one trivial fix the model proposed before a save, on a 1-based
+// line.
+type saveFix struct {
+	Line int    `json:"line"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+func (h *ActionHandler) registerSaveCleanup(svc *lsp.Service) {
+	if !h.cfg.SaveCleanup {
+		return
+	}
+
+	svc.Capabilities.TextDocumentSync.WillSaveWaitUntil = true
+	svc.On(lsp.EventWillSaveWaitUntil, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.WillSaveTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Log("willSaveWaitUntil parse error:", err.Error())
+			h.reply(svc, msg, []lsp.TextEdit{})
+			return
+		}
+		h.reply(svc, msg, h.saveCleanup(svc, params))
+	})
+}
+
+// saveCleanup returns the edits to apply before the document is written.
+// Any failure, or an answer later than the timeout, saves the file as it
+// is: a save must never wait on the model for long.
+func (h *ActionHandler) saveCleanup(svc *lsp.Service, params lsp.WillSaveTextDocumentParams) []lsp.TextEdit {
+	edits := []lsp.TextEdit{}
+	uri := params.TextDocument.URI
+
+	// Saves the editor makes on its own are left alone.
+	if params.Reason != lsp.SaveReasonManual {
+		return edits
+	}
+	buffer, ok := svc.Buffers.Get(uri)
+	if !ok || buffer.Binary || strings.TrimSpace(buffer.Text) == "" || len(buffer.Text) > maxReviewBytes {
+		return edits
+	}
+	if h.lowPower.Enabled() {
+		svc.Logger.Log("skipping save cleanup in low-power mode:", uri)
+		return edits
+	}
+
+	ctx, cancel := context.WithTimeout(sessionContext(svc, h.lowPower), time.Duration(h.cfg.SaveCleanupTimeout)*time.Millisecond)
+	defer cancel()
+
+	systemPrompt := providers.BuildSaveCleanupSystemPrompt(buffer.LanguageID)
+	resp, err := h.registry.Chat(ctx, systemPrompt, providers.BuildReviewUserPrompt(relativePath(svc.RootPath(), uri), numberLines(buffer.Text)))
+	if err != nil {
+		svc.Logger.Log("save cleanup skipped:", providers.KindOf(err), err.Error())
+		return edits
+	}
+
+	fixes, err := parseSaveFixes(resp.Result)
+	if err != nil {
+		svc.Logger.Log("save cleanup result not understood:", err.Error())
+		return edits
+	}
+
+	encoding := svc.Buffers.PositionEncoding()
+	for _, edit := range saveFixEdits(fixes, buffer.Text) {
+		edit.Range = lsp.EncodeRange(buffer.Text, edit.Range, encoding)
+		edits = append(edits, edit)
+	}
+	svc.Logger.Log("save cleanup edits:", len(edits))
+	return edits
+}
+
+// parseSaveFixes reads the JSON array of fixes from a cleanup result,
+// tolerating code fences and text around it.
+func parseSaveFixes(result string) ([]saveFix, error) {
+	result = stripCodeFence(strings.TrimSpace(result))
+	start, end := strings.Index(result, "["), strings.LastIndex(result, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in %.80q", result)
+	}
+
+	var fixes []saveFix
+	if err := json.Unmarshal([]byte(result[start:end+1]), &fixes); err != nil {
+		return nil, err
+	}
+	return fixes, nil
+}
+
+// saveFixEdits turns fixes into edits of text. A fix applies only where its
+// old text occurs exactly once on its line; an empty replacement of the
+// whole line removes the line. Only the first fix of a line is kept, so
+// the edits never overlap.
+func saveFixEdits(fixes []saveFix, text string) []lsp.TextEdit {
+	lines := strings.Split(text, "\n")
+	seen := make(map[int]bool)
+	var edits []lsp.TextEdit
+	for _, fix := range fixes {
+		if fix.Line < 1 || fix.Line > len(lines) || fix.Old == "" || fix.Old == fix.New || seen[fix.Line] {
+			continue
+		}
+		line := fix.Line - 1
+		if strings.Count(lines[line], fix.Old) != 1 {
+			continue
+		}
+		seen[fix.Line] = true
+
+		if fix.New == "" && strings.TrimSpace(lines[line]) == strings.TrimSpace(fix.Old) {
+			r := lsp.Range{Start: lsp.Position{Line: line}, End: lsp.Position{Line: line + 1}}
+			if line+1 == len(lines) {
+				r.End = lsp.Position{Line: line, Character: len(lines[line])}
+			}
+			edits = append(edits, lsp.TextEdit{Range: r})
+			continue
+		}
+
+		start := strings.Index(lines[line], fix.Old)
+		edits = append(edits, lsp.TextEdit{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: line, Character: start},
+				End:   lsp.Position{Line: line, Character: start + len(fix.Old)},
+			},
+			NewText: fix.New,
+		})
+	}
+	return edits
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// functionLenses are the commands shown above every function.
+var functionLenses = []CodeActionCommand{
+	{Key: "explainCode", Label: "AI: explain"},
+	{Key: "generateTests", Label: "AI: generate tests"},
+	{Key: "documentCode", Label: "AI: document"},
+}
+
+// functionDeclRe matches lines that start a function or method declaration.
+var functionDeclRe = regexp.MustCompile(`^\s*(?:export\s+)?(?:pub(?:\([a-z]+\))?\s+)?(?:(?:public|private|protected|static|async|override|suspend)\s+)*(?:func|def|fn|function|fun)\b`)
+
+// codeLensData is what an unresolved lens carries until it is resolved.
+type codeLensData struct {
+	URI     string    `json:"uri"`
+	Command string    `json:"command"`
+	Range   lsp.Range `json:"range"`
+}
+
+func (h *ActionHandler) registerCodeLens(svc *lsp.Service) {
+	svc.On(lsp.EventCodeLens, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.CodeLensParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Log("codeLens parse error:", err.Error())
+			svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: []lsp.CodeLens{}})
+			return
+		}
+
+		lenses := []lsp.CodeLens{}
+		buffer, ok := svc.Buffers.Get(params.TextDocument.URI)
+		if !ok || buffer.Binary {
+			svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: lenses})
+			return
+		}
+
+		// Commands are filled in by codeLens/resolve, so listing the lenses
+		// of a large file stays cheap.
+		for _, r := range functionRanges(buffer.Text) {
+			for _, cmd := range functionLenses {
+				lenses = append(lenses, lsp.CodeLens{
+					Range: lsp.Range{Start: r.Start, End: r.Start},
+					Data:  mustMarshal(codeLensData{URI: params.TextDocument.URI, Command: cmd.Key, Range: lsp.EncodeRange(buffer.Text, r, svc.Buffers.PositionEncoding())}),
+				})
+			}
+		}
+
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: lenses})
+	})
+
+	svc.On(lsp.EventCodeLensResolve, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var lens lsp.CodeLens
+		var data codeLensData
+		err := json.Unmarshal(msg.Params, &lens)
+		if err == nil {
+			err = json.Unmarshal(lens.Data, &data)
+		}
+		if err != nil {
+			svc.Logger.Log("codeLens/resolve parse error:", err.Error())
+			svc.Send(&lsp.JSONRPCMessage{
+				ID:    msg.ID,
+				Error: &lsp.RPCError{Code: lsp.ErrorCodeInvalidParams, Message: "invalid code lens: " + err.Error()},
+			})
+			return
+		}
+
+		for _, cmd := range functionLenses {
+			if cmd.Key != data.Command {
+				continue
+			}
+			lens.Command = &lsp.Command{
+				Title:     cmd.Label,
+				Command:   cmd.Key,
+				Arguments: []any{lsp.CommandArgument{Range: data.Range, URI: data.URI}},
+			}
+			break
+		}
+
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: lens})
+	})
+}
+
+// functionRanges finds the functions in text, each as whole lines from its
+// declaration through the end of its body. Bodies end at the matching
+// closing brace, or for indentation-based languages at the next line
+// indented no deeper than the declaration. Declarations without a body,
+// such as interface methods, are skipped.
+func functionRanges(text string) []lsp.Range {
+	lines := strings.Split(text, "\n")
+	var ranges []lsp.Range
+
+	for i, line := range lines {
+		if !functionDeclRe.MatchString(line) {
+			continue
+		}
+
+		end, ok := indentBodyEnd(lines, i)
+		if !ok {
+			end, ok = braceBodyEnd(lines, i)
+		}
+		if !ok {
+			continue
+		}
+
+		r := lsp.Range{Start: lsp.Position{Line: i}, End: lsp.Position{Line: end + 1}}
+		if end+1 >= len(lines) {
+			r.End = lsp.Position{Line: end, Character: len(lines[end])}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// braceBodyEnd returns the line closing the brace-delimited body that opens
+// on the declaration at start or within the few lines of signature after
+// it. Braces in strings and comments are counted too, which is good enough
+// to place a lens.
+func braceBodyEnd(lines []string, start int) (int, bool) {
+	depth := 0
+	opened := false
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if !opened && i > start && (i > start+5 || functionDeclRe.MatchString(line)) {
+			return 0, false
+		}
+		for _, c := range line {
+			switch c {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		// Checked per line, so braces closing within the signature, as in
+		// interface{}, do not end the function.
+		if opened && depth <= 0 {
+			return i, true
+		}
+		// A signature ending without a body, e.g. a method in an interface.
+		if !opened && strings.HasSuffix(strings.TrimSpace(line), ";") {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// indentBodyEnd returns the last line of an indentation-delimited body, as
+// in Python, whose declaration at start ends with a colon.
+func indentBodyEnd(lines []string, start int) (int, bool) {
+	if !strings.HasSuffix(strings.TrimSpace(lines[start]), ":") {
+		return 0, false
+	}
+
+	indent := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " \t")
+		if trimmed == "" {
+			continue
+		}
+		if len(lines[i])-len(trimmed) <= indent {
+			break
+		}
+		end = i
+	}
+	return end, end > start
+}
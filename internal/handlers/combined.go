@@ -0,0 +1,20 @@
+package handlers
+
+import "strings"
+
+// isTrivialSuggestion reports whether hint only completes the current word to
+// an identifier that already exists in the buffer, which a native language
+// server would trivially provide.
+func isTrivialSuggestion(hint, word string, idx *symbolIndex) bool {
+	trimmed := strings.TrimSpace(hint)
+	if trimmed == "" || strings.ContainsAny(trimmed, " \t\n") {
+		return false
+	}
+
+	completed := word + trimmed
+	if identifierRe.FindString(completed) != completed {
+		return false
+	}
+
+	return idx.has(completed)
+}
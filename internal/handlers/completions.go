@@ -3,12 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/events"
 	"github.com/leona/helix-assist/internal/lsp"
 	"github.com/leona/helix-assist/internal/providers"
 	"github.com/leona/helix-assist/internal/util"
@@ -17,52 +21,159 @@ import (
 type CompletionHandler struct {
 	cfg      *config.Config
 	registry *providers.Registry
+	symbols  *symbolCache
+	changes  *changeGate
+	lowPower *LowPowerMode
+	history  *suggestionHistory
+	events   *events.Bus
+	accepts  *acceptanceTracker
+	settings *liveSettings
+	deferred *deferredItems
 
 	mu            sync.Mutex
-	cancelCurrent context.CancelFunc
+	cancelCurrent context.CancelCauseFunc
 	timer         *time.Timer
 	requestID     atomic.Uint64
 	lastTrigger   time.Time
 	lastContent   string
-	pendingMsgID  *int
+	pendingMsg    *lsp.JSONRPCMessage
 }
 
-func NewCompletionHandler(cfg *config.Config, registry *providers.Registry) *CompletionHandler {
-	return &CompletionHandler{
+func NewCompletionHandler(cfg *config.Config, registry *providers.Registry, lowPower *LowPowerMode, bus *events.Bus) *CompletionHandler {
+	h := &CompletionHandler{
 		cfg:      cfg,
 		registry: registry,
+		symbols:  newSymbolCache(),
+		lowPower: lowPower,
+		history:  newSuggestionHistory(),
+		events:   bus,
+		accepts:  newAcceptanceTracker(bus),
+		settings: newLiveSettings(cfg),
+		deferred: &deferredItems{},
 	}
+	bus.Subscribe(h.history.observe, events.CompletionOffered)
+	return h
 }
 
 func (h *CompletionHandler) Register(svc *lsp.Service) {
+	h.accepts.register(svc)
+	h.registerSettings(svc)
+	h.registerResolve(svc)
+
+	if h.cfg.ChangeBurstLines > 0 {
+		h.changes = newChangeGate(h.cfg.ChangeBurstLines, time.Duration(h.cfg.ChangeBurstCooldown)*time.Millisecond)
+		svc.Buffers.SetChangeObserver(func(uri string, lines int) {
+			if h.changes.observe(lines, time.Now()) {
+				svc.Logger.Log("change burst detected, pausing completions for", h.cfg.ChangeBurstCooldown, "ms")
+			}
+		})
+	}
+
+	svc.On(lsp.EventCancelRequest, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.CancelParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Log("cancelRequest parse error:", err.Error())
+			return
+		}
+		h.cancelRequest(svc, params.ID)
+	})
+
 	svc.On(lsp.EventCompletion, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
 		var params lsp.CompletionParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
 			svc.Logger.Log("completion parse error:", err.Error())
-			h.sendEmptyCompletion(svc, msg.ID)
+			h.sendEmptyCompletion(svc, msg)
 			return
 		}
 
-		buffer, ok := svc.Buffers.Get(params.TextDocument.URI)
-		if !ok {
-			h.sendEmptyCompletion(svc, msg.ID)
+		// Clients shown inline completions get the suggestions there.
+		if _, ok := h.presenter(svc).(inlinePresenter); ok {
+			h.sendEmptyCompletion(svc, msg)
 			return
 		}
+		h.handleCompletion(svc, msg, params)
+	})
 
-		content := util.GetContent(buffer.Text, params.Position.Line, params.Position.Character)
-
-		// Skip completion in certain cases
-		if h.shouldSkip(content, buffer.Text) {
-			svc.Logger.Log("skipping completion - invalid context")
-			h.sendEmptyCompletion(svc, msg.ID)
+	svc.On(lsp.EventInlineCompletion, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.InlineCompletionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Log("inlineCompletion parse error:", err.Error())
+			h.sendEmptyCompletion(svc, msg)
 			return
 		}
 
-		// Schedule the completion with debouncing and cancellation
-		h.scheduleCompletion(svc, msg, params, buffer, content)
+		if _, ok := h.presenter(svc).(inlinePresenter); !ok {
+			h.sendEmptyCompletion(svc, msg)
+			return
+		}
+		h.handleCompletion(svc, msg, lsp.CompletionParams{TextDocument: params.TextDocument, Position: params.Position})
 	})
 }
 
+// presenter returns how suggestions reach the client.
+func (h *CompletionHandler) presenter(svc *lsp.Service) presenter {
+	return presenterFor(h.cfg.Presentation, svc.ClientCapabilities())
+}
+
+// handleCompletion checks that a completion is worth requesting at the
+// position of params, and schedules it if so.
+func (h *CompletionHandler) handleCompletion(svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams) {
+	buffer, ok := svc.Buffers.Get(params.TextDocument.URI)
+	if !ok || buffer.Binary {
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+	// Positions are byte-based from here on; the items sent are encoded
+	// back for the client.
+	params.Position = lsp.DecodePosition(buffer.Text, params.Position, svc.Buffers.PositionEncoding())
+
+	// Trigger characters are advertised once, at startup; those removed
+	// from the settings since are ignored here.
+	if c := params.Context; c != nil && c.TriggerKind == lsp.CompletionTriggerCharacter && !h.settings.triggers(c.TriggerCharacter) {
+		svc.Logger.Log("skipping completion - trigger character disabled:", c.TriggerCharacter)
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	if h.changes != nil && h.changes.suppressed(time.Now()) {
+		svc.Logger.Log("skipping completion - large edit in progress")
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	content := util.GetContent(buffer.Text, params.Position.Line, params.Position.Character)
+
+	if n := content.CursorLineLength(); h.cfg.MaxLineLength > 0 && n > h.cfg.MaxLineLength {
+		svc.Logger.Log("skipping completion - line is", n, "characters long")
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	// Skip completion in certain cases
+	if h.shouldSkip(content, buffer.Text) {
+		svc.Logger.Log("skipping completion - invalid context")
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	// The editor fills bytes it could not decode with U+FFFD; a
+	// completion built on them would repeat the mojibake.
+	if strings.ContainsRune(content.LastLine+content.ContentImmediatelyAfter, utf8.RuneError) {
+		svc.Logger.Log("skipping completion - line has undecodable characters")
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	if h.isTypingLocalSymbol(content, buffer) {
+		svc.Logger.Log("skipping completion - typing local identifier")
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	// Schedule the completion with debouncing and cancellation
+	h.scheduleCompletion(svc, msg, params, buffer, content)
+}
+
 func (h *CompletionHandler) shouldSkip(content util.ContentParts, fullText string) bool {
 	lastChar := content.LastCharacter
 
@@ -91,30 +202,52 @@ func (h *CompletionHandler) shouldSkip(content util.ContentParts, fullText strin
 	return false
 }
 
+// isTypingLocalSymbol reports whether the cursor is at the end of a word that
+// prefixes an identifier already in the buffer, where AI adds nothing over
+// word-based or native completion.
+func (h *CompletionHandler) isTypingLocalSymbol(content util.ContentParts, buffer *lsp.Buffer) bool {
+	if !h.cfg.SkipLocalIdentifiers && !h.cfg.CombinedMode {
+		return false
+	}
+
+	// Mid-word, the user is editing an identifier rather than typing one.
+	if after := content.ContentImmediatelyAfter; after != "" && isIdentByte(after[0]) {
+		return false
+	}
+
+	word := currentWord(content.LastLine)
+	idx := h.symbols.get(buffer)
+
+	if h.cfg.SkipLocalIdentifiers && idx.isTypingLocal(word) {
+		return true
+	}
+	return h.cfg.CombinedMode && idx.matchesPrefix(word)
+}
+
 func (h *CompletionHandler) scheduleCompletion(svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams, buffer *lsp.Buffer, content util.ContentParts) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	// Cancel any previous pending request
 	if h.cancelCurrent != nil {
-		h.cancelCurrent()
+		h.cancelCurrent(nil)
 		h.cancelCurrent = nil
 	}
 	if h.timer != nil {
-		if h.timer.Stop() && h.pendingMsgID != nil {
+		if h.timer.Stop() && h.pendingMsg != nil {
 			// Timer stopped before firing - executeCompletion never ran,
 			// so the editor is still waiting for a response.
-			h.sendEmptyCompletion(svc, h.pendingMsgID)
+			h.sendEmptyCompletion(svc, h.pendingMsg)
 		}
 		h.timer = nil
 	}
-	h.pendingMsgID = nil
+	h.pendingMsg = nil
 
 	// Check if content is same as last request (duplicate trigger)
 	contentKey := content.ContentBefore
 	if h.lastContent == contentKey && time.Since(h.lastTrigger) < 500*time.Millisecond {
 		svc.Logger.Log("skipping duplicate completion request")
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.sendEmptyCompletion(svc, msg)
 		return
 	}
 	h.lastContent = contentKey
@@ -126,27 +259,30 @@ func (h *CompletionHandler) scheduleCompletion(svc *lsp.Service, msg *lsp.JSONRP
 	uri := params.TextDocument.URI
 	languageID := buffer.LanguageID
 
-	ctx, cancel := context.WithCancel(context.Background())
+	received := time.Now()
+
+	ctx, cancel := context.WithCancelCause(sessionContext(svc, h.lowPower))
 	h.cancelCurrent = cancel
-	h.pendingMsgID = msg.ID
+	h.pendingMsg = msg
 
-	h.timer = time.AfterFunc(time.Duration(h.cfg.Debounce)*time.Millisecond, func() {
-		h.executeCompletion(ctx, svc, msg, params, version, uri, languageID, content, reqID)
+	debounce, _ := h.settings.get()
+	h.timer = time.AfterFunc(time.Duration(h.lowPower.debounce(debounce))*time.Millisecond, func() {
+		h.executeCompletion(ctx, svc, msg, params, version, uri, languageID, content, reqID, received)
 	})
 }
 
-func (h *CompletionHandler) executeCompletion(ctx context.Context, svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams, version int, uri, languageID string, content util.ContentParts, reqID uint64) {
+func (h *CompletionHandler) executeCompletion(ctx context.Context, svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams, version int, uri, languageID string, content util.ContentParts, reqID uint64, received time.Time) {
 	defer func() {
 		if r := recover(); r != nil {
 			svc.Logger.Log("completion panic:", r)
-			h.sendEmptyCompletion(svc, msg.ID)
+			h.sendEmptyCompletion(svc, msg)
 		}
 	}()
 
 	// Check if this request is still current
 	if h.requestID.Load() != reqID {
 		svc.Logger.Log("skipping stale completion request")
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.sendEmptyCompletion(svc, msg)
 		return
 	}
 
@@ -154,14 +290,14 @@ func (h *CompletionHandler) executeCompletion(ctx context.Context, svc *lsp.Serv
 	buffer, ok := svc.Buffers.Get(uri)
 	if !ok || buffer.Version > version {
 		svc.Logger.Log("skipping completion - buffer changed")
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.sendEmptyCompletion(svc, msg)
 		return
 	}
 
 	// Re-check context
 	if ctx.Err() != nil {
 		svc.Logger.Log("completion cancelled before execution")
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.sendCancelled(svc, ctx, msg)
 		return
 	}
 
@@ -170,7 +306,7 @@ func (h *CompletionHandler) executeCompletion(ctx context.Context, svc *lsp.Serv
 	// Start progress indicator
 	var progress *util.ProgressIndicator
 	if h.cfg.EnableProgressSpinner {
-		progress = util.NewProgressIndicator(svc, h.cfg)
+		progress = util.NewProgressIndicator(svc, h.cfg, "AI completion")
 		progress.Start()
 		defer progress.Stop()
 	}
@@ -179,63 +315,300 @@ func (h *CompletionHandler) executeCompletion(ctx context.Context, svc *lsp.Serv
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.cfg.CompletionTimeout)*time.Millisecond)
 	defer cancel()
 
-	// Build content after
-	contentAfter := content.ContentImmediatelyAfter
-	if content.ContentAfter != "" {
-		if contentAfter != "" {
-			contentAfter += "\n" + content.ContentAfter
-		} else {
-			contentAfter = content.ContentAfter
+	fullAfter := contentAfterCursor(content)
+
+	h.events.Publish(events.Event{
+		Kind:          events.CompletionRequested,
+		URI:           uri,
+		Position:      params.Position,
+		ContentBefore: content.ContentBefore,
+	})
+
+	ctx, served := providers.WithServed(ctx)
+	validHints, flagged, err := h.suggestions(ctx, svc.Logger, uri, languageID, buffer, content)
+	if err != nil {
+		if ctx.Err() != nil {
+			svc.Logger.Log("completion cancelled:", context.Cause(ctx))
+			h.sendCancelled(svc, ctx, msg)
+			return
 		}
+		svc.Logger.Log("completion error:", providers.KindOf(err), err.Error())
+		h.sendEmptyCompletion(svc, msg)
+		return
+	}
+
+	svc.Logger.Log("completion results:", len(validHints))
+
+	if len(validHints) == 0 {
+		h.sendEmptyCompletion(svc, msg)
+		return
 	}
 
-	hints, err := h.registry.Completion(ctx, providers.CompletionRequest{
+	// A request at the same position with the same text before the cursor
+	// is a regenerate: annotate what changed since the last attempt.
+	key := historyKey(uri, params.Position.Line, params.Position.Character)
+	previous := h.history.previous(key, content.ContentBefore)
+
+	present := h.presenter(svc)
+	_, listed := present.(listPresenter)
+	caps := svc.ClientCapabilities()
+	snippets := listed && h.cfg.SnippetCompletions && caps.TextDocument.Completion.CompletionItem.SnippetSupport
+	markdown := markdownDocs(caps)
+	// Documentation and overlap edits are computed in
+	// completionItem/resolve where the client resolves them, for the items
+	// it shows, keeping lists of several multi-line suggestions small.
+	deferDocs, deferEdits := resolveSupport(caps)
+	deferDocs, deferEdits = deferDocs && listed, deferEdits && listed && h.cfg.DeleteSuffixOverlap
+	var overlap *deferredOverlap
+	if deferEdits {
+		overlap = &deferredOverlap{
+			after:    content.ContentImmediatelyAfter,
+			position: params.Position,
+			document: buffer.Text,
+			encoding: svc.Buffers.PositionEncoding(),
+		}
+	}
+	items := make([]lsp.CompletionItem, 0, len(validHints))
+	offered := make([]string, 0, len(validHints))
+	var deferred []deferredItem
+	for i, hint := range validHints {
+		item := h.insertionItem(hint, content, params.Position, i)
+		if !deferEdits {
+			item.AdditionalTextEdits = h.overlapEdits(item.TextEdit.NewText, content.ContentImmediatelyAfter, params.Position)
+		}
+		encodeItem(&item, buffer.Text, svc.Buffers.PositionEncoding())
+		offered = append(offered, item.TextEdit.NewText)
+		change := ""
+		if len(previous) > 0 {
+			change = describeChange(previous[min(i, len(previous)-1)], item.TextEdit.NewText)
+		}
+		if deferDocs || deferEdits {
+			deferred = append(deferred, deferredItem{text: item.TextEdit.NewText, languageID: languageID, change: change})
+			item.Data = mustMarshal(completionItemData{Request: reqID, Index: i})
+		}
+		if !deferDocs {
+			item.Documentation = suggestionDocs(item.TextEdit.NewText, languageID, served, change, markdown)
+		}
+		if reason, ok := flagged[hint]; ok {
+			flagItem(&item, reason)
+		}
+		if snippets {
+			snippetItem(&item)
+		}
+		items = append(items, item)
+	}
+
+	if deferred != nil {
+		h.deferred.set(reqID, *served, deferDocs, markdown, overlap, deferred)
+	}
+
+	h.events.Publish(events.Event{
+		Kind:          events.CompletionOffered,
+		URI:           uri,
+		LanguageID:    languageID,
+		Position:      params.Position,
 		ContentBefore: content.ContentBefore,
+		ContentAfter:  fullAfter,
+		Suggestions:   offered,
+		Provider:      served.Provider,
+		Model:         served.Model,
+	})
+
+	// Let the native server's results render first when running alongside one.
+	if h.cfg.CombinedMode {
+		if wait := time.Duration(h.cfg.CombinedModeDelay)*time.Millisecond - time.Since(received); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				h.sendCancelled(svc, ctx, msg)
+				return
+			}
+		}
+	}
+
+	// The items are in the client's encoding, and so must be the position.
+	present.present(svc, msg, lsp.EncodePosition(buffer.Text, params.Position, svc.Buffers.PositionEncoding()), uri, version, items)
+}
+
+// Suggest completes text at position outside an editor session, through
+// the same provider call, filtering and overlap handling as
+// textDocument/completion but without its debounce and skip heuristics.
+func (h *CompletionHandler) Suggest(ctx context.Context, logger *lsp.Logger, uri, languageID, text string, position lsp.Position) ([]lsp.CompletionItem, error) {
+	buffer := &lsp.Buffer{URI: uri, Text: text, LanguageID: languageID}
+	content := util.GetContent(text, position.Line, position.Character)
+
+	hints, flagged, err := h.suggestions(ctx, logger, uri, languageID, buffer, content)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]lsp.CompletionItem, 0, len(hints))
+	for i, hint := range hints {
+		item := h.buildCompletionItem(hint, content, position, i)
+		if reason, ok := flagged[hint]; ok {
+			flagItem(&item, reason)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// suggestions asks the provider to complete content and returns the
+// suggestions worth offering, with the reasons for those the output filter
+// flagged.
+func (h *CompletionHandler) suggestions(ctx context.Context, logger *lsp.Logger, uri, languageID string, buffer *lsp.Buffer, content util.ContentParts) ([]string, map[string]string, error) {
+	contentBefore, contentAfter := util.ShortenLongLines(content.ContentBefore, contentAfterCursor(content), util.ContextLineLimit)
+	contentBefore, contentAfter = h.lowPower.trimContext(contentBefore, contentAfter)
+
+	req := providers.CompletionRequest{
+		ContentBefore: contentBefore,
 		ContentAfter:  contentAfter,
-	}, uri, languageID, h.cfg.NumSuggestions)
+	}
+	if open, close, ok := util.InterpolationAt(content.LastLine, languageID); ok {
+		logger.Log("completing inside a", open+close, "interpolation")
+		req.Interpolation = &providers.Interpolation{Open: open, Close: close}
+	}
 
+	_, numSuggestions := h.settings.get()
+	hints, err := h.registry.Completion(ctx, req, uri, languageID, h.lowPower.numSuggestions(numSuggestions))
 	if err != nil {
-		if ctx.Err() != nil {
-			svc.Logger.Log("completion cancelled:", ctx.Err())
-		} else {
-			svc.Logger.Log("completion error:", err.Error())
+		return nil, nil, err
+	}
+	if req.Interpolation != nil {
+		// The results may be shared with the completion cache.
+		cut := make([]string, len(hints))
+		for i, hint := range hints {
+			cut[i] = util.CutAtInterpolationEnd(hint)
 		}
-		h.sendEmptyCompletion(svc, msg.ID)
-		return
+		hints = cut
 	}
 
+	var idx *symbolIndex
+	if h.cfg.CombinedMode {
+		idx = h.symbols.get(buffer)
+	}
+	word := currentWord(content.LastLine)
+
 	// Filter out empty or invalid completions
 	validHints := make([]string, 0, len(hints))
+	flagged := make(map[string]string)
 	for _, hint := range hints {
 		cleaned := strings.TrimSpace(hint)
-		if cleaned != "" && len(cleaned) >= 2 {
-			validHints = append(validHints, hint)
+		if cleaned == "" || len(cleaned) < 2 {
+			continue
+		}
+		if idx != nil && isTrivialSuggestion(hint, word, idx) {
+			logger.Log("dropping suggestion already available from buffer:", cleaned)
+			continue
 		}
+		if h.cfg.OutputFilter != OutputFilterOff {
+			if reason := contaminationReason(hint, h.cfg.OutputFilterMinLength); reason != "" {
+				logger.Log("suggestion", reason)
+				if h.cfg.OutputFilter == OutputFilterDrop {
+					continue
+				}
+				flagged[hint] = reason
+			}
+		}
+		validHints = append(validHints, hint)
 	}
+	return validHints, flagged, nil
+}
 
-	svc.Logger.Log("completion results:", len(validHints))
+// contentAfterCursor joins the rest of the cursor line and the lines after
+// it.
+func contentAfterCursor(content util.ContentParts) string {
+	contentAfter := content.ContentImmediatelyAfter
+	if content.ContentAfter != "" {
+		if contentAfter != "" {
+			contentAfter += "\n" + content.ContentAfter
+		} else {
+			contentAfter = content.ContentAfter
+		}
+	}
+	return contentAfter
+}
 
-	if len(validHints) == 0 {
-		h.sendEmptyCompletion(svc, msg.ID)
+// flagItem marks item as possible license contamination.
+func flagItem(item *lsp.CompletionItem, reason string) {
+	item.Label = "AI ⚠: " + strings.TrimPrefix(item.Label, "AI: ")
+	item.Detail = "Possible license contamination: suggestion " + reason + "\n\n" + item.Detail
+}
+
+// encodeItem converts the byte-based ranges of item, inserted into text, to
+// encoding. Additional edits apply after the insertion, so they are encoded
+// against the text with it made.
+func encodeItem(item *lsp.CompletionItem, text, encoding string) {
+	if encoding != lsp.PositionEncodingUTF16 {
 		return
 	}
+	if len(item.AdditionalTextEdits) > 0 {
+		at := lsp.OffsetAt(text, item.TextEdit.Range.Start)
+		inserted := text[:at] + item.TextEdit.NewText + text[at:]
+		for i, edit := range item.AdditionalTextEdits {
+			item.AdditionalTextEdits[i].Range = lsp.EncodeRange(inserted, edit.Range, encoding)
+		}
+	}
+	item.TextEdit.Range = lsp.EncodeRange(text, item.TextEdit.Range, encoding)
+}
 
-	items := make([]lsp.CompletionItem, 0, len(validHints))
-	for i, hint := range validHints {
-		item := h.buildCompletionItem(hint, content, params.Position, i)
-		items = append(items, item)
+// suggestionDocs previews the whole of a suggestion as a markdown code
+// block, followed by the provider and model that produced it, when known,
+// and how it changed since the last attempt. Clients that do not render
+// markdown get the same as plain text.
+func suggestionDocs(text, languageID string, served *providers.Served, change string, markdown bool) *lsp.MarkupContent {
+	if !markdown {
+		value := text
+		if served.Provider != "" {
+			value += "\n\n" + served.Provider
+			if served.Model != "" {
+				value += " · " + served.Model
+			}
+		}
+		if change != "" {
+			value += "\n\n" + change
+		}
+		return &lsp.MarkupContent{Kind: lsp.MarkupKindPlainText, Value: value}
 	}
 
-	svc.Send(&lsp.JSONRPCMessage{
-		ID: msg.ID,
-		Result: lsp.CompletionList{
-			IsIncomplete: false,
-			Items:        items,
-		},
-	})
+	// The fence must be longer than any run of backticks in the text.
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+
+	var b strings.Builder
+	b.WriteString(fence + languageID + "\n" + text + "\n" + fence)
+	if served.Provider != "" {
+		b.WriteString("\n\n" + served.Provider)
+		if served.Model != "" {
+			b.WriteString(" · `" + served.Model + "`")
+		}
+	}
+	if change != "" {
+		b.WriteString("\n\n" + strings.ReplaceAll(change, "\n", "  \n"))
+	}
+	return &lsp.MarkupContent{Kind: lsp.MarkupKindMarkdown, Value: b.String()}
+}
+
+// markdownDocs reports whether the client renders markdown documentation.
+// Clients that list no formats are sent plain text, as the protocol
+// expects.
+func markdownDocs(caps lsp.ClientCapabilities) bool {
+	return slices.Contains(caps.TextDocument.Completion.CompletionItem.DocumentationFormat, lsp.MarkupKindMarkdown)
 }
 
+// buildCompletionItem returns the item inserting hint at position, with
+// the edit deleting what it repeats of the text after the cursor.
 func (h *CompletionHandler) buildCompletionItem(hint string, content util.ContentParts, position lsp.Position, index int) lsp.CompletionItem {
+	item := h.insertionItem(hint, content, position, index)
+	item.AdditionalTextEdits = h.overlapEdits(item.TextEdit.NewText, content.ContentImmediatelyAfter, position)
+	return item
+}
+
+// insertionItem returns the item inserting hint at position, without
+// additional edits.
+func (h *CompletionHandler) insertionItem(hint string, content util.ContentParts, position lsp.Position, index int) lsp.CompletionItem {
 	// Trim leading newlines and trailing whitespace, preserve leading spaces
 	hint = strings.TrimLeft(hint, "\n")
 	hint = strings.TrimRight(hint, " \t\n")
@@ -244,44 +617,32 @@ func (h *CompletionHandler) buildCompletionItem(hint string, content util.Conten
 	lastLineTrimmed := strings.TrimSpace(content.LastLine)
 
 	// Check if hint starts with part of the last line (model repeating context)
-	if lastLineTrimmed != "" && strings.HasPrefix(strings.TrimSpace(hint), lastLineTrimmed) {
-		hint = strings.TrimSpace(hint[len(lastLineTrimmed):])
+	if !h.cfg.TrustModel && lastLineTrimmed != "" && strings.HasPrefix(strings.TrimSpace(hint), lastLineTrimmed) {
+		hint = strings.TrimSpace(strings.TrimSpace(hint)[len(lastLineTrimmed):])
 	}
 
-	lines := strings.Split(hint, "\n")
-
-	// Calculate end position
-	endLine := position.Line + len(lines) - 1
-	endChar := len(lines[len(lines)-1])
-	if endLine == position.Line {
-		endChar += position.Character
+	// The model often closes what the code after the cursor already closes.
+	// With overlap deletion off, leave the document alone and drop that
+	// overlap from the inserted text; overlapEdits deletes it otherwise.
+	if !h.cfg.DeleteSuffixOverlap {
+		hint = hint[:len(hint)-findOverlapSuffix(hint, content.ContentImmediatelyAfter)]
 	}
 
+	lines := strings.Split(hint, "\n")
+
 	// Build label (first line, truncated) with AI prefix
 	label := "AI: " + lines[0]
 	if len(label) > 40 {
-		label = label[:40] + "..."
+		label = strings.ToValidUTF8(label[:40], "") + "..."
 	}
 
-	// Handle overlap with content after cursor
-	var additionalEdits []lsp.TextEdit
-	overlapLen := findOverlapSuffix(hint, content.ContentImmediatelyAfter)
-
-	if overlapLen > 0 {
-		additionalEdits = append(additionalEdits, lsp.TextEdit{
-			Range: lsp.Range{
-				Start: lsp.Position{Line: endLine, Character: endChar},
-				End:   lsp.Position{Line: endLine, Character: endChar + overlapLen},
-			},
-			NewText: "",
-		})
-	}
+	sortText, preselect := rankCompletion(h.cfg.CompletionSort, h.cfg.CompletionSortThreshold, hint, index)
 
 	return lsp.CompletionItem{
 		Label:            label,
-		Kind:             1, // Text
+		Kind:             inferCompletionKind(content.LastLine, hint),
 		Detail:           hint,
-		InsertTextFormat: 1, // PlainText
+		InsertTextFormat: lsp.InsertTextFormatPlainText,
 		TextEdit: &lsp.TextEdit{
 			Range: lsp.Range{
 				Start: position,
@@ -289,12 +650,38 @@ func (h *CompletionHandler) buildCompletionItem(hint string, content util.Conten
 			},
 			NewText: hint,
 		},
-		SortText:            "", // Empty string sorts before all other values
-		Preselect:           true, // Preselect all AI completions
-		AdditionalTextEdits: additionalEdits,
+		SortText:  sortText,
+		Preselect: preselect,
 	}
 }
 
+// overlapEdits returns the edit deleting what text, inserted at position,
+// repeats of the text after the cursor, when overlap deletion is on.
+// Helix applies additional edits to the document after inserting the
+// completion, so the range is past the inserted text.
+func (h *CompletionHandler) overlapEdits(text, after string, position lsp.Position) []lsp.TextEdit {
+	if !h.cfg.DeleteSuffixOverlap {
+		return nil
+	}
+	overlapLen := findOverlapSuffix(text, after)
+	if overlapLen == 0 {
+		return nil
+	}
+
+	lines := strings.Split(text, "\n")
+	endLine := position.Line + len(lines) - 1
+	endChar := len(lines[len(lines)-1])
+	if endLine == position.Line {
+		endChar += position.Character
+	}
+	return []lsp.TextEdit{{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: endLine, Character: endChar},
+			End:   lsp.Position{Line: endLine, Character: endChar + overlapLen},
+		},
+	}}
+}
+
 func findOverlapSuffix(hint, suffix string) int {
 	if suffix == "" {
 		return 0
@@ -307,7 +694,7 @@ func findOverlapSuffix(hint, suffix string) int {
 	}
 
 	for i := maxOverlap; i > 0; i-- {
-		if hint[len(hint)-i:] == suffix[:i] {
+		if hint[len(hint)-i:] == suffix[:i] && !closesOwnBracket(hint, len(hint)-i) {
 			return i
 		}
 	}
@@ -315,9 +702,85 @@ func findOverlapSuffix(hint, suffix string) int {
 	return 0
 }
 
-func (h *CompletionHandler) sendEmptyCompletion(svc *lsp.Service, id *int) {
+// closesOwnBracket reports whether a bracket in hint[start:] closes one
+// opened in hint before start. Such an end is the completion's own, as the
+// ")" of "g()", not the one the code after the cursor repeats.
+func closesOwnBracket(hint string, start int) bool {
+	var open []int
+	for i := 0; i < len(hint); i++ {
+		switch hint[i] {
+		case '(', '[', '{':
+			open = append(open, i)
+		case ')', ']', '}':
+			if len(open) == 0 {
+				continue
+			}
+			opened := open[len(open)-1]
+			open = open[:len(open)-1]
+			if i >= start && opened < start {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cancelRequest handles $/cancelRequest for the pending completion: its
+// provider request is aborted and, if the debounce has not fired yet, the
+// editor is answered right away.
+func (h *CompletionHandler) cancelRequest(svc *lsp.Service, id lsp.ID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pendingMsg == nil || *h.pendingMsg.ID != id {
+		return
+	}
+
+	svc.Logger.Log("completion", id, "cancelled by the editor")
+	if h.cancelCurrent != nil {
+		h.cancelCurrent(errRequestCancelled)
+		h.cancelCurrent = nil
+	}
+	if h.timer != nil {
+		if h.timer.Stop() {
+			sendRequestCancelled(svc, h.pendingMsg.ID)
+		}
+		h.timer = nil
+	}
+	h.pendingMsg = nil
+}
+
+// errRequestCancelled is the cancellation cause of completions the editor
+// cancelled, as opposed to ones a newer request replaced.
+var errRequestCancelled = errors.New("request cancelled")
+
+// sendCancelled answers a completion whose context is done: with the
+// RequestCancelled error if the editor cancelled it, and with no items if
+// a newer request replaced it.
+func (h *CompletionHandler) sendCancelled(svc *lsp.Service, ctx context.Context, msg *lsp.JSONRPCMessage) {
+	if errors.Is(context.Cause(ctx), errRequestCancelled) {
+		sendRequestCancelled(svc, msg.ID)
+		return
+	}
+	h.sendEmptyCompletion(svc, msg)
+}
+
+func sendRequestCancelled(svc *lsp.Service, id *lsp.ID) {
+	svc.Send(&lsp.JSONRPCMessage{
+		ID:    id,
+		Error: &lsp.RPCError{Code: lsp.ErrorCodeRequestCancelled, Message: errRequestCancelled.Error()},
+	})
+}
+
+// sendEmptyCompletion answers msg, a completion or inline completion
+// request, with no items, in the list type of its method.
+func (h *CompletionHandler) sendEmptyCompletion(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	if msg.Method == lsp.EventInlineCompletion {
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: lsp.InlineCompletionList{Items: []lsp.InlineCompletionItem{}}})
+		return
+	}
 	svc.Send(&lsp.JSONRPCMessage{
-		ID: id,
+		ID: msg.ID,
 		Result: lsp.CompletionList{
 			IsIncomplete: false,
 			Items:        []lsp.CompletionItem{},
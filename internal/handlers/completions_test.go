@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// helixApply accepts item the way Helix does on validating a completion
+// (helix-term/src/ui/completion.rs): the item's text edit is applied first,
+// then its additional edits are turned into a transaction against the
+// resulting doc.text(), so in the coordinates of the document after the
+// insertion rather than the original one the LSP spec describes.
+func helixApply(text string, item lsp.CompletionItem) string {
+	text = applyTextEdit(text, *item.TextEdit)
+	for _, edit := range item.AdditionalTextEdits {
+		text = applyTextEdit(text, edit)
+	}
+	return text
+}
+
+func applyTextEdit(text string, edit lsp.TextEdit) string {
+	start, end := lsp.OffsetAt(text, edit.Range.Start), lsp.OffsetAt(text, edit.Range.End)
+	return text[:start] + edit.NewText + text[end:]
+}
+
+func TestSuffixOverlap(t *testing.T) {
+	// Each case is the document with the cursor marked by |, the model's
+	// completion, and the document after accepting it in Helix. Deleting
+	// the overlap from the line and cutting it from the completion give
+	// the same document, so the modes differ in what they insert.
+	cases := []struct {
+		name     string
+		document string
+		hint     string
+		want     string
+		// insertDelete and insertTruncate are the text inserted with
+		// overlap deletion on and off.
+		insertDelete   string
+		insertTruncate string
+	}{
+		{
+			name:           "closing paren",
+			document:       "fmt.Println(|)\n",
+			hint:           `"hello")`,
+			want:           "fmt.Println(\"hello\")\n",
+			insertDelete:   `"hello")`,
+			insertTruncate: `"hello"`,
+		},
+		{
+			name:           "no overlap",
+			document:       "x := |\n",
+			hint:           "compute(a, b)",
+			want:           "x := compute(a, b)\n",
+			insertDelete:   "compute(a, b)",
+			insertTruncate: "compute(a, b)",
+		},
+		{
+			name:           "multi-line block",
+			document:       "if err != nil {\n|}\n",
+			hint:           "\treturn err\n}",
+			want:           "if err != nil {\n\treturn err\n}\n",
+			insertDelete:   "\treturn err\n}",
+			insertTruncate: "\treturn err\n",
+		},
+		{
+			name:           "longer overlap",
+			document:       "total := sum(|items))\n",
+			hint:           "prices, items))",
+			want:           "total := sum(prices, items))\n",
+			insertDelete:   "prices, items))",
+			insertTruncate: "prices, ",
+		},
+		{
+			name:           "punctuation without overlap",
+			document:       "func main() {\n\tfmt.Println(|)\n}\n",
+			hint:           "a, b",
+			want:           "func main() {\n\tfmt.Println(a, b)\n}\n",
+			insertDelete:   "a, b",
+			insertTruncate: "a, b",
+		},
+		{
+			// The completion's last ")" closes its own call, not the one
+			// after the cursor.
+			name:           "own closing paren",
+			document:       "fmt.Println(|)\n",
+			hint:           "strings.TrimSpace(s)",
+			want:           "fmt.Println(strings.TrimSpace(s))\n",
+			insertDelete:   "strings.TrimSpace(s)",
+			insertTruncate: "strings.TrimSpace(s)",
+		},
+		{
+			// Only one of the two ")" after the cursor is repeated; "))"
+			// would take the one closing read().
+			name:           "own paren before the overlap",
+			document:       "fmt.Println(strings.TrimSpace(|))\n",
+			hint:           "read())",
+			want:           "fmt.Println(strings.TrimSpace(read()))\n",
+			insertDelete:   "read())",
+			insertTruncate: "read()",
+		},
+	}
+
+	for _, tc := range cases {
+		line, column := cursorOf(tc.document)
+		document := strings.Replace(tc.document, "|", "", 1)
+		content := util.GetContent(document, line, column)
+		position := lsp.Position{Line: line, Character: column}
+
+		for _, mode := range []struct {
+			deleteOverlap bool
+			insert        string
+		}{{true, tc.insertDelete}, {false, tc.insertTruncate}} {
+			cfg := config.DefaultConfig()
+			cfg.DeleteSuffixOverlap = mode.deleteOverlap
+			h := &CompletionHandler{cfg: cfg}
+
+			item := h.buildCompletionItem(tc.hint, content, position, 0)
+			if !mode.deleteOverlap && len(item.AdditionalTextEdits) > 0 {
+				t.Errorf("%s: additional edits with overlap deletion off: %+v", tc.name, item.AdditionalTextEdits)
+			}
+			if item.TextEdit.NewText != mode.insert {
+				t.Errorf("%s (delete=%v): inserts %q, want %q", tc.name, mode.deleteOverlap, item.TextEdit.NewText, mode.insert)
+			}
+			if got := helixApply(document, item); got != tc.want {
+				t.Errorf("%s (delete=%v):\ngot  %q\nwant %q", tc.name, mode.deleteOverlap, got, tc.want)
+			}
+		}
+	}
+}
+
+func cursorOf(document string) (line, column int) {
+	before, _, _ := strings.Cut(document, "|")
+	line = strings.Count(before, "\n")
+	return line, len(before) - (strings.LastIndexByte(before, '\n') + 1)
+}
+
+func FuzzCompletionItem(f *testing.F) {
+	f.Add("fmt.Println()\n", 12, `"hello")`, true)
+	f.Add("if err != nil {\n}\n", 16, "\treturn err\n}", false)
+	f.Add("x := 世界\n", 5, "  x := 世界界", true)
+	f.Add("", 0, "", false)
+
+	f.Fuzz(func(t *testing.T, document string, cursor int, hint string, deleteOverlap bool) {
+		if !utf8.ValidString(document) || !utf8.ValidString(hint) {
+			return
+		}
+		cursor = min(max(cursor, 0), len(document))
+		for cursor > 0 && !utf8.RuneStart(document[cursor%len(document)]) {
+			cursor--
+		}
+		position := lsp.PositionAt(document, cursor)
+		content := util.GetContent(document, position.Line, position.Character)
+
+		cfg := config.DefaultConfig()
+		cfg.DeleteSuffixOverlap = deleteOverlap
+		h := &CompletionHandler{cfg: cfg}
+
+		item := h.buildCompletionItem(hint, content, position, 0)
+		if !utf8.ValidString(item.Label) || !utf8.ValidString(item.TextEdit.NewText) {
+			t.Fatalf("invalid UTF-8 in item %+v", item)
+		}
+
+		accepted := helixApply(document, item)
+		if !strings.HasPrefix(accepted, document[:cursor]) {
+			t.Fatalf("accepting %q changed the text before the cursor: %q", hint, accepted)
+		}
+		if !deleteOverlap && !strings.HasSuffix(accepted, document[cursor:]) {
+			t.Fatalf("accepting %q with overlap deletion off changed the text after the cursor: %q", hint, accepted)
+		}
+	})
+}
+
+func FuzzFindOverlapSuffix(f *testing.F) {
+	f.Add(`"hello")`, ")")
+	f.Add("items))  ", "))\n")
+	f.Add("", "")
+	f.Add("世界", "界世")
+	f.Add("read())", "))")
+
+	f.Fuzz(func(t *testing.T, hint, suffix string) {
+		n := findOverlapSuffix(hint, suffix)
+		trimmed := strings.TrimRight(hint, " \t")
+		if n < 0 || n > len(trimmed) || n > len(suffix) {
+			t.Fatalf("overlap %d out of range for %q, %q", n, hint, suffix)
+		}
+		if !strings.HasSuffix(trimmed, suffix[:n]) {
+			t.Fatalf("overlap %q does not end %q", suffix[:n], trimmed)
+		}
+		if n > 0 && closesOwnBracket(trimmed, len(trimmed)-n) {
+			t.Fatalf("overlap %q closes a bracket of %q", suffix[:n], trimmed)
+		}
+		for longer := n + 1; longer <= min(len(trimmed), len(suffix)); longer++ {
+			if strings.HasSuffix(trimmed, suffix[:longer]) && !closesOwnBracket(trimmed, len(trimmed)-longer) {
+				t.Fatalf("missed the longer overlap %q", suffix[:longer])
+			}
+		}
+	})
+}
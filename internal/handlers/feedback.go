@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/dataset"
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+const (
+	markGoodCommand = "helix-assist.markGood"
+	markBadCommand  = "helix-assist.markBad"
+)
+
+const (
+	// feedbackPrefixBytes and feedbackSuffixBytes bound the context kept
+	// with each marked completion.
+	feedbackPrefixBytes = 8192
+	feedbackSuffixBytes = 4096
+)
+
+// feedback remembers the last completion, accepted or merely offered, so
+// markGood and markBad can add it to the dataset.
+type feedback struct {
+	path string
+
+	mu       sync.Mutex
+	last     events.Event
+	accepted bool
+}
+
+func newFeedback(bus *events.Bus, path string) *feedback {
+	f := &feedback{path: path}
+	bus.Subscribe(f.observe, events.CompletionOffered, events.CompletionAccepted)
+	return f
+}
+
+func (f *feedback) observe(event events.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = event
+	f.accepted = event.Kind == events.CompletionAccepted
+}
+
+// mark appends the last completion to the dataset with label.
+func (f *feedback) mark(label, root string) (dataset.Record, error) {
+	f.mu.Lock()
+	last, accepted := f.last, f.accepted
+	f.mu.Unlock()
+
+	if len(last.Suggestions) == 0 {
+		return dataset.Record{}, fmt.Errorf("no completion to mark yet")
+	}
+
+	prefix := last.ContentBefore
+	suffix := last.ContentAfter
+	record := dataset.Record{
+		Time:       time.Now(),
+		Label:      label,
+		File:       relativePath(root, last.URI),
+		LanguageID: last.LanguageID,
+		Provider:   last.Provider,
+		Model:      last.Model,
+		Prefix:     prefix[max(len(prefix)-feedbackPrefixBytes, 0):],
+		Suffix:     suffix[:min(len(suffix), feedbackSuffixBytes)],
+		Completion: last.Suggestions[0],
+		Accepted:   accepted,
+	}
+	return record, dataset.Append(f.path, record)
+}
+
+// markLast tags the last completion as good or bad in the local dataset.
+func (h *ActionHandler) markLast(svc *lsp.Service, msg *lsp.JSONRPCMessage, label string) {
+	record, err := h.feedback.mark(label, svc.RootPath())
+	if err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+
+	what := "offered"
+	if record.Accepted {
+		what = "accepted"
+	}
+	h.reply(svc, msg, fmt.Sprintf("Marked the last %s completion %s in %s", what, label, h.feedback.path))
+}
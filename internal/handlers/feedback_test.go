@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/events"
+)
+
+func TestFeedbackRecordsServedModel(t *testing.T) {
+	bus := events.NewBus()
+	f := newFeedback(bus, filepath.Join(t.TempDir(), "feedback.jsonl"))
+	accepts := newAcceptanceTracker(bus)
+
+	bus.Publish(events.Event{
+		Kind:          events.CompletionOffered,
+		URI:           "file:///root/main.go",
+		ContentBefore: "x := ",
+		Suggestions:   []string{"1"},
+		Provider:      "ollama",
+		Model:         "qwen2.5-coder",
+	})
+	record, err := f.mark("good", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Provider != "ollama" || record.Model != "qwen2.5-coder" || record.Accepted {
+		t.Errorf("got %s · %s accepted %v, want the offer's ollama · qwen2.5-coder", record.Provider, record.Model, record.Accepted)
+	}
+
+	accepts.changed("file:///root/main.go", "x := 1")
+	record, err = f.mark("bad", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Provider != "ollama" || record.Model != "qwen2.5-coder" || !record.Accepted {
+		t.Errorf("got %s · %s accepted %v, want the accepted offer's ollama · qwen2.5-coder", record.Provider, record.Model, record.Accepted)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// maxHintBytes caps how much hint text is added to a single prompt.
+const maxHintBytes = 8 * 1024
+
+// importRes capture imported module names across common languages.
+var importRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^\s*import\s+(?:[A-Za-z_.]+\s+)?"([^"]+)"`),                         // Go single import
+	regexp.MustCompile(`(?m)^\s*(?:[A-Za-z_.]+\s+)?"([^"]+)"\s*$`),                              // Go import block line
+	regexp.MustCompile(`(?m)^\s*from\s+([A-Za-z_][\w.]*)\s+import\b`),                           // Python from-import
+	regexp.MustCompile(`(?m)^\s*import\s+([A-Za-z_][\w.]*)`),                                    // Python, Java, Kotlin
+	regexp.MustCompile(`(?m)\bfrom\s+['"]([^'"]+)['"]`),                                         // JS/TS import ... from
+	regexp.MustCompile(`(?m)^\s*import\s+['"]([^'"]+)['"]`),                                     // JS/TS side-effect import
+	regexp.MustCompile(`\brequire\(\s*['"]([^'"]+)['"]\s*\)`),                                   // CommonJS
+	regexp.MustCompile(`(?m)^\s*(?:pub\s+)?use\s+([A-Za-z_][\w]*)::`),                           // Rust
+	regexp.MustCompile(`(?m)^\s*(?:extern\s+crate|require|require_relative)\s+['"]?([\w/.-]+)`), // Rust crates, Ruby
+}
+
+// extractImports returns the distinct module names imported by text.
+func extractImports(text string) []string {
+	seen := make(map[string]bool)
+	var imports []string
+	for _, re := range importRes {
+		for _, match := range re.FindAllStringSubmatch(text, -1) {
+			if name := match[1]; !seen[name] {
+				seen[name] = true
+				imports = append(imports, name)
+			}
+		}
+	}
+	return imports
+}
+
+// apiHint is one hints file. Its names come from an optional first line
+// `imports: a, b`, otherwise from the file name without extension.
+type apiHint struct {
+	names []string
+	text  string
+}
+
+func loadAPIHints(dir string) []apiHint {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var hints []apiHint
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		text, _ := util.DecodeText(data)
+		names := []string{strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))}
+		if first, rest, _ := strings.Cut(text, "\n"); strings.HasPrefix(first, "imports:") {
+			names = names[:0]
+			for _, name := range strings.Split(strings.TrimPrefix(first, "imports:"), ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			text = rest
+		}
+
+		hints = append(hints, apiHint{names: names, text: strings.TrimSpace(text)})
+	}
+	return hints
+}
+
+// importMatches reports whether an import refers to name: the same module, a
+// subpackage of it, or a path with name as one of its segments.
+func importMatches(imp, name string) bool {
+	if imp == name || strings.HasPrefix(imp, name+"/") || strings.HasPrefix(imp, name+".") {
+		return true
+	}
+	segments := strings.FieldsFunc(imp, func(r rune) bool { return r == '/' || r == '.' })
+	return slices.Contains(segments, name)
+}
+
+// matchingAPIHints returns the hints in dir whose names match an import in
+// text, up to maxHintBytes in total.
+func matchingAPIHints(dir, text string) []string {
+	hints := loadAPIHints(dir)
+	if len(hints) == 0 {
+		return nil
+	}
+
+	imports := extractImports(text)
+	var matched []string
+	size := 0
+
+	for _, hint := range hints {
+		if hint.text == "" || !hintMatches(hint, imports) {
+			continue
+		}
+		if size+len(hint.text) > maxHintBytes {
+			break
+		}
+		size += len(hint.text)
+		matched = append(matched, hint.text)
+	}
+	return matched
+}
+
+func hintMatches(hint apiHint, imports []string) bool {
+	for _, name := range hint.names {
+		for _, imp := range imports {
+			if importMatches(imp, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
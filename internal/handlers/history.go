@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/events"
+)
+
+// maxHistoryEntries bounds the suggestion history; the oldest position is
+// forgotten first.
+const maxHistoryEntries = 64
+
+// suggestionHistory remembers the suggestions last shown at each cursor
+// position, so a regenerate at the same spot can be compared with what the
+// user saw before.
+type suggestionHistory struct {
+	mu      sync.Mutex
+	entries map[string]historyEntry
+	order   []string
+}
+
+type historyEntry struct {
+	contentBefore string
+	suggestions   []string
+}
+
+func newSuggestionHistory() *suggestionHistory {
+	return &suggestionHistory{entries: make(map[string]historyEntry)}
+}
+
+func historyKey(uri string, line, character int) string {
+	return fmt.Sprintf("%s:%d:%d", uri, line, character)
+}
+
+// previous returns the suggestions last recorded for key, provided the text
+// before the cursor has not changed since.
+func (h *suggestionHistory) previous(key, contentBefore string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry, ok := h.entries[key]
+	if !ok || entry.contentBefore != contentBefore {
+		return nil
+	}
+	return entry.suggestions
+}
+
+func (h *suggestionHistory) record(key, contentBefore string, suggestions []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.entries[key]; !ok {
+		h.order = append(h.order, key)
+		if len(h.order) > maxHistoryEntries {
+			delete(h.entries, h.order[0])
+			h.order = h.order[1:]
+		}
+	}
+	h.entries[key] = historyEntry{contentBefore: contentBefore, suggestions: suggestions}
+}
+
+// observe records the suggestions of a CompletionOffered event.
+func (h *suggestionHistory) observe(event events.Event) {
+	h.record(historyKey(event.URI, event.Position.Line, event.Position.Character), event.ContentBefore, event.Suggestions)
+}
+
+// describeChange summarises how next differs from prev in one or two short
+// lines: the number of lines changed and the first line that differs.
+func describeChange(prev, next string) string {
+	if prev == next {
+		return "Unchanged from previous suggestion"
+	}
+
+	a := strings.Split(prev, "\n")
+	b := strings.Split(next, "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	removed := len(a) - prefix - suffix
+	added := len(b) - prefix - suffix
+
+	summary := fmt.Sprintf("Changed vs previous suggestion: line %d, +%d -%d lines", prefix+1, added, removed)
+	switch {
+	case removed > 0 && added > 0:
+		summary += fmt.Sprintf("\nwas: %s\nnow: %s", strings.TrimSpace(a[prefix]), strings.TrimSpace(b[prefix]))
+	case removed > 0:
+		summary += "\nwas: " + strings.TrimSpace(a[prefix])
+	case added > 0:
+		summary += "\nnow: " + strings.TrimSpace(b[prefix])
+	}
+	return summary
+}
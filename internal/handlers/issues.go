@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+const (
+	// issueTimeout bounds a run of the issue command.
+	issueTimeout = 5 * time.Second
+	// maxIssues caps how many referenced issues are looked up per prompt.
+	maxIssues = 3
+	// maxIssueBytes bounds the description kept per issue.
+	maxIssueBytes = 2000
+)
+
+// issueResolver looks up the issues that code and commit messages refer to,
+// so chat prompts can include what they are about. Lookups are kept for the
+// session, failures included, so each issue is fetched at most once.
+type issueResolver struct {
+	pattern     *regexp.Regexp
+	command     string
+	urlTemplate string
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// newIssueResolver returns nil when no issue pattern is configured.
+func newIssueResolver(cfg *config.Config) *issueResolver {
+	pattern, err := regexp.Compile(cfg.IssuePattern)
+	if cfg.IssuePattern == "" || err != nil {
+		return nil
+	}
+	return &issueResolver{
+		pattern:     pattern,
+		command:     cfg.IssueCommand,
+		urlTemplate: cfg.IssueURL,
+		cache:       make(map[string]string),
+	}
+}
+
+// references returns the distinct issue IDs in texts, in order of first
+// appearance, at most maxIssues of them. An ID is the first group of its
+// match that took part, else the whole match.
+func (r *issueResolver) references(texts ...string) []string {
+	var ids []string
+	for _, text := range texts {
+		for _, match := range r.pattern.FindAllStringSubmatch(text, -1) {
+			id := match[0]
+			if i := slices.IndexFunc(match[1:], func(group string) bool { return group != "" }); i >= 0 {
+				id = match[i+1]
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+			if len(ids) == maxIssues {
+				return ids
+			}
+		}
+	}
+	return ids
+}
+
+// describe returns a description of each issue for a prompt: its ID, link
+// and what the issue command printed for it. Issues with neither a link nor
+// a description are left out.
+func (r *issueResolver) describe(logger *lsp.Logger, dir string, ids []string) []string {
+	var issues []string
+	for _, id := range ids {
+		url := r.url(id)
+		description := r.fetch(logger, dir, id, url)
+		if url == "" && description == "" {
+			continue
+		}
+
+		issue := id
+		if url != "" {
+			issue += " (" + url + ")"
+		}
+		if description != "" {
+			issue += ":\n" + description
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+func (r *issueResolver) url(id string) string {
+	if r.urlTemplate == "" {
+		return ""
+	}
+	return strings.ReplaceAll(r.urlTemplate, "{id}", id)
+}
+
+// fetch runs the issue command for id. The ID is passed in the environment
+// rather than on the command line, since it comes from the document.
+func (r *issueResolver) fetch(logger *lsp.Logger, dir, id, url string) string {
+	if r.command == "" {
+		return ""
+	}
+
+	r.mu.Lock()
+	description, ok := r.cache[id]
+	r.mu.Unlock()
+	if ok {
+		return description
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), issueTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.command)
+	cmd.Env = append(os.Environ(), "HELIX_ASSIST_ISSUE_ID="+id, "HELIX_ASSIST_ISSUE_URL="+url)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		logger.Log("issue command failed for", id+":", err.Error())
+	} else {
+		description = strings.TrimSpace(string(output))
+		if len(description) > maxIssueBytes {
+			description = strings.ToValidUTF8(description[:maxIssueBytes], "") + "…"
+		}
+	}
+
+	r.mu.Lock()
+	r.cache[id] = description
+	r.mu.Unlock()
+	return description
+}
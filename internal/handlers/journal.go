@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// revertLastCommand undoes the most recent edit helix-assist applied in the
+// workspace. It takes no arguments.
+const revertLastCommand = "helix-assist.revertLast"
+
+// minRevertSimilarity is how much of an edited region must still match the
+// applied text for revertLast to find it after further manual changes.
+const minRevertSimilarity = 0.6
+
+// journalEntry is one edit applied by helix-assist. Before and After are the
+// replaced and inserted text; their hashes let the journal be checked
+// against a file without comparing the text.
+type journalEntry struct {
+	ID         int       `json:"id"`
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	URI        string    `json:"uri"`
+	Range      lsp.Range `json:"range"`
+	BeforeHash string    `json:"beforeHash"`
+	AfterHash  string    `json:"afterHash"`
+	Before     string    `json:"before"`
+	After      string    `json:"after"`
+	// Reverts is the ID of the entry this edit undid.
+	Reverts int `json:"reverts,omitempty"`
+}
+
+// journal appends applied edits to a file per workspace, one JSON object
+// per line. The files are kept in the user's config directory rather than
+// the workspace, as they hold the replaced code.
+type journal struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newJournal(dir string) *journal {
+	return &journal{dir: dir}
+}
+
+// journalDir is where workspace journals are kept unless told otherwise.
+func journalDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "helix-assist", "journals")
+}
+
+// path returns the journal file of the workspace at root.
+func (j *journal) path(root string) string {
+	return filepath.Join(j.dir, hashText(root)[:16]+".jsonl")
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// record appends an edit replacing r in the document text with newText.
+// The journal is never read to add to it; the entry's ID is its time, which
+// stays unique across sessions sharing the workspace.
+func (j *journal) record(root, command, uri, text string, r lsp.Range, newText string, reverts int) error {
+	if root == "" {
+		return errors.New("no workspace root")
+	}
+	if j.dir == "" {
+		return errors.New("no journal directory")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	before := text[lsp.OffsetAt(text, r.Start):lsp.OffsetAt(text, r.End)]
+	entry := journalEntry{
+		ID:         int(now.UnixNano()),
+		Time:       now,
+		Command:    command,
+		URI:        uri,
+		Range:      r,
+		BeforeHash: hashText(before),
+		AfterHash:  hashText(newText),
+		Before:     before,
+		After:      newText,
+		Reverts:    reverts,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(j.dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path(root), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// last returns the most recent edit that is neither a revert nor reverted.
+func (j *journal) last(root string) (journalEntry, bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read(root)
+	if err != nil {
+		return journalEntry{}, false, err
+	}
+
+	reverted := map[int]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Reverts != 0 {
+			reverted[entry.Reverts] = true
+			continue
+		}
+		if !reverted[entry.ID] {
+			return entry, true, nil
+		}
+	}
+	return journalEntry{}, false, nil
+}
+
+func (j *journal) read(root string) ([]journalEntry, error) {
+	path := j.path(root)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// locateEdit finds the text an edit inserted in the current document. An
+// exact copy nearest to where it was applied wins; failing that, the run of
+// lines most similar to it, so an edit can be reverted after it was touched
+// up by hand. exact is false for a similarity match.
+func locateEdit(text string, entry journalEntry) (start, end int, exact, ok bool) {
+	origin := lsp.OffsetAt(text, entry.Range.Start)
+	if entry.After == "" {
+		return origin, origin, true, true
+	}
+
+	best := -1
+	for from := 0; ; {
+		i := strings.Index(text[from:], entry.After)
+		if i < 0 {
+			break
+		}
+		i += from
+		if best < 0 || distance(i, origin) < distance(best, origin) {
+			best = i
+		}
+		from = i + 1
+	}
+	if best >= 0 {
+		return best, best + len(entry.After), true, true
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	want := strings.Split(strings.TrimSuffix(entry.After, "\n"), "\n")
+	originLine := entry.Range.Start.Line
+
+	bestScore, bestLine, bestSize := 0.0, 0, 0
+	for size := max(len(want)-2, 1); size <= len(want)+2; size++ {
+		for line := 0; line+size <= len(lines); line++ {
+			score := lineSimilarity(want, lines[line:line+size])
+			if score > bestScore || score == bestScore && distance(line, originLine) < distance(bestLine, originLine) {
+				bestScore, bestLine, bestSize = score, line, size
+			}
+		}
+	}
+	if bestScore < minRevertSimilarity {
+		return 0, 0, false, false
+	}
+
+	start = len(strings.Join(lines[:bestLine], ""))
+	end = start + len(strings.Join(lines[bestLine:bestLine+bestSize], ""))
+	// Keep the line break after the region when the applied text had none.
+	if !strings.HasSuffix(entry.After, "\n") && strings.HasSuffix(text[start:end], "\n") {
+		end--
+	}
+	return start, end, false, true
+}
+
+// lineSimilarity is the share of lines, ignoring indentation, that want and
+// got have in common.
+func lineSimilarity(want, got []string) float64 {
+	counts := map[string]int{}
+	for _, line := range want {
+		counts[strings.TrimSpace(line)]++
+	}
+
+	common := 0
+	for _, line := range got {
+		key := strings.TrimSpace(line)
+		if counts[key] > 0 {
+			counts[key]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(want)+len(got))
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// recordEdit journals an edit applied to text, the document at uri before
+// the edit. Failures are logged; they never undo the edit.
+func (h *ActionHandler) recordEdit(svc *lsp.Service, command, uri, text string, r lsp.Range, newText string) {
+	if err := h.journal.record(svc.RootPath(), command, uri, text, r, newText, 0); err != nil {
+		svc.Logger.Log("journal: could not record edit:", err.Error())
+	}
+}
+
+// revertLast undoes the most recent journaled edit. If the inserted text was
+// changed since, the most similar region is replaced after the user
+// confirms.
+func (h *ActionHandler) revertLast(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	root := svc.RootPath()
+	entry, ok, err := h.journal.last(root)
+	if err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+	if !ok {
+		h.reply(svc, msg, "No helix-assist edits to revert")
+		return
+	}
+
+	buffer, ok := svc.Buffers.Get(entry.URI)
+	if !ok {
+		h.replyError(svc, msg, fmt.Errorf("open %s to revert the last %s edit", relativePath(root, entry.URI), entry.Command))
+		return
+	}
+
+	start, end, exact, ok := locateEdit(buffer.Text, entry)
+	if !ok {
+		h.replyError(svc, msg, fmt.Errorf("the last %s edit in %s has changed too much to revert", entry.Command, relativePath(root, entry.URI)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if !exact {
+		choice, err := svc.ShowMessageRequest(ctx, lsp.MessageTypeWarning,
+			fmt.Sprintf("The last %s edit was changed since. Revert it, losing those changes?", entry.Command), "Revert", "Cancel")
+		if err != nil {
+			svc.Logger.Log("revertLast: showMessageRequest failed:", err.Error())
+		}
+		if choice != "Revert" {
+			h.reply(svc, msg, nil)
+			return
+		}
+	}
+
+	r := lsp.Range{Start: lsp.PositionAt(buffer.Text, start), End: lsp.PositionAt(buffer.Text, end)}
+	if err := applyEdit(ctx, svc, revertLastCommand, entry.URI, buffer.Version, lsp.TextEdit{Range: r, NewText: entry.Before}); err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+
+	if err := h.journal.record(root, revertLastCommand, entry.URI, buffer.Text, r, entry.Before, entry.ID); err != nil {
+		svc.Logger.Log("journal: could not record revert:", err.Error())
+	}
+	h.reply(svc, msg, fmt.Sprintf("Reverted %s edit from %s", entry.Command, entry.Time.Format("15:04:05")))
+}
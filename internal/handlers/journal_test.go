@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+func TestLocateEdit(t *testing.T) {
+	applied := "func add(a, b int) int {\n\treturn a + b\n}\n"
+	cases := []struct {
+		name string
+		// document marks the region locateEdit should find with [ and ].
+		document string
+		after    string
+		line     int
+		exact    bool
+		found    bool
+	}{
+		{"unchanged", "package x\n\n[" + applied + "]", applied, 2, true, true},
+		{"lines added above", "package x\n\nimport \"fmt\"\n\n[" + applied + "]", applied, 2, true, true},
+		{"nearest copy", "[x := 1]\ny := 2\nx := 1\n", "x := 1", 0, true, true},
+		{"nearest later copy", "x := 1\ny := 2\n[x := 1]\n", "x := 1", 2, true, true},
+		{"touched up", "package x\n\n[func add(a, b int) int {\n\t// sum\n\treturn a + b\n}\n]", applied, 2, false, true},
+		{"reindented", "package x\n\n[func add(a, b int) int {\n    return a + b\n}\n]", applied, 2, false, true},
+		{"no trailing newline", "a\n[one\n2\nthree]\nb\n", "one\ntwo\nthree", 1, false, true},
+		{"changed too much", "package x\n\nfunc other() {}\n", applied, 2, false, false},
+		{"deletion", "a\n[]b\n", "", 1, true, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			want := strings.Index(tc.document, "[")
+			wantEnd := strings.Index(tc.document, "]") - 1
+			text := strings.NewReplacer("[", "", "]", "").Replace(tc.document)
+			entry := journalEntry{After: tc.after, Range: lsp.Range{Start: lsp.Position{Line: tc.line}}}
+
+			start, end, exact, ok := locateEdit(text, entry)
+			if ok != tc.found {
+				t.Fatalf("found %v, want %v", ok, tc.found)
+			}
+			if !ok {
+				return
+			}
+			if start != want || end != wantEnd || exact != tc.exact {
+				t.Errorf("got %q (exact %v), want %q (exact %v)", text[start:end], exact, text[want:wantEnd], tc.exact)
+			}
+		})
+	}
+}
+
+func TestJournalOutsideWorkspace(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "journals")
+	j := newJournal(dir)
+
+	text := "a\nb\n"
+	r := lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 1, Character: 1}}
+	if err := j.record(root, "fixComplete", "file:///x.go", text, r, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok, err := j.last(root)
+	if err != nil || !ok || entry.Before != "b" || entry.After != "c" {
+		t.Fatalf("last = %+v, %v, %v", entry, ok, err)
+	}
+	if err := j.record(root, revertLastCommand, "file:///x.go", "a\nc\n", r, "b", entry.ID); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok, _ := j.last(root); ok {
+		t.Errorf("reverted edit %+v still last", entry)
+	}
+
+	if files, _ := os.ReadDir(root); len(files) != 0 {
+		t.Errorf("journal wrote %v into the workspace", files)
+	}
+	info, err := os.Stat(j.path(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("journal mode %v, want 0600", info.Mode().Perm())
+	}
+}
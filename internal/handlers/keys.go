@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// workspaceCommand is run through :lsp-workspace-command rather than
+// offered as a code action.
+type workspaceCommand struct {
+	Name  string
+	Label string
+	// NeedsArgs marks commands that do nothing useful when bound to a key
+	// without arguments.
+	NeedsArgs bool
+}
+
+var workspaceCommands = []workspaceCommand{
+	{Name: usageCommand, Label: "Show token usage"},
+	{Name: lowPowerCommand, Label: "Toggle low-power mode"},
+	{Name: setProviderCommand, Label: "Switch provider"},
+	{Name: setModelCommand, Label: "Switch model", NeedsArgs: true},
+	{Name: listModelsCommand, Label: "List available models"},
+	{Name: exportTranscriptCommand, Label: "Export action transcript"},
+	{Name: importTranscriptCommand, Label: "Continue an exported transcript", NeedsArgs: true},
+	{Name: setTrustCommand, Label: "Show or set workspace trust"},
+	{Name: revertLastCommand, Label: "Revert the last AI edit"},
+	{Name: clearCacheCommand, Label: "Clear cached completions"},
+	{Name: markGoodCommand, Label: "Mark the last completion good"},
+	{Name: markBadCommand, Label: "Mark the last completion bad"},
+}
+
+// DefaultKeyPrefix is the key sequence the generated bindings live under.
+const DefaultKeyPrefix = "space.A"
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// KeyBindings returns a Helix config.toml block binding the code action
+// picker and every argument-free workspace command under prefix, a dotted
+// key sequence such as "space.A". Keys are derived from the command names, so
+// the block follows the server's command list.
+func KeyBindings(prefix string) (string, error) {
+	var table []string
+	for _, key := range strings.Split(prefix, ".") {
+		if key == "" {
+			return "", fmt.Errorf("invalid key prefix %q", prefix)
+		}
+		if !bareKey.MatchString(key) {
+			key = fmt.Sprintf("%q", key)
+		}
+		table = append(table, key)
+	}
+
+	labels := make([]string, len(Commands))
+	for i, cmd := range Commands {
+		labels[i] = strings.TrimPrefix(cmd.Label, "AI: ")
+	}
+
+	var bindings strings.Builder
+	fmt.Fprintf(&bindings, "a = \"code_action\" # %s\n", strings.Join(labels, ", "))
+
+	used := map[rune]bool{'a': true}
+	for _, cmd := range workspaceCommands {
+		if cmd.NeedsArgs {
+			continue
+		}
+		key, ok := commandKey(cmd.Name, used)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&bindings, "%c = \":lsp-workspace-command %s\" # %s\n", key, cmd.Name, cmd.Label)
+	}
+
+	var b strings.Builder
+	b.WriteString("# helix-assist bindings, generated by `helix-assist keys`.\n")
+	b.WriteString("# Merge into ~/.config/helix/config.toml.\n")
+	for _, mode := range []string{"normal", "select"} {
+		fmt.Fprintf(&b, "\n[keys.%s.%s]\n%s", mode, strings.Join(table, "."), bindings.String())
+	}
+	return b.String(), nil
+}
+
+// commandKey picks the first letter of the command name, after the
+// helix-assist prefix, that is not bound yet.
+func commandKey(name string, used map[rune]bool) (rune, bool) {
+	for _, r := range strings.ToLower(strings.TrimPrefix(name, "helix-assist.")) {
+		if r >= 'a' && r <= 'z' && !used[r] {
+			used[r] = true
+			return r, true
+		}
+	}
+	return 0, false
+}
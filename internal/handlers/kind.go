@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+var functionPrefixes = []string{
+	"func ", "def ", "async def ", "fn ", "pub fn ", "async fn ", "pub async fn ",
+	"function ", "async function ", "export function ", "export async function ",
+	"fun ", "sub ", "proc ",
+}
+
+var variablePrefixes = []string{
+	"var ", "let ", "let mut ", "val ", "export let ", "export var ",
+}
+
+var constantPrefixes = []string{
+	"const ", "export const ", "static ", "pub const ", "pub static ", "final ",
+}
+
+var classPrefixes = []string{
+	"class ", "export class ", "interface ", "export interface ", "trait ", "pub trait ", "enum ", "pub enum ",
+}
+
+var structPrefixes = []string{
+	"struct ", "pub struct ",
+}
+
+var keywordStatements = []string{
+	"if ", "for ", "while ", "switch ", "select ", "match ", "return ", "else", "try", "loop ",
+}
+
+// inferCompletionKind guesses the CompletionItemKind of a suggestion from the
+// declaration it completes, so Helix shows a meaningful icon.
+func inferCompletionKind(lastLine, hint string) lsp.CompletionItemKind {
+	firstLine, _, multiline := strings.Cut(hint, "\n")
+	statement := strings.TrimSpace(strings.TrimLeft(lastLine, " \t") + firstLine)
+
+	switch {
+	case isGoMethod(statement):
+		return lsp.CompletionItemKindMethod
+	case hasAnyPrefix(statement, functionPrefixes):
+		return lsp.CompletionItemKindFunction
+	case hasAnyPrefix(statement, structPrefixes) || isGoStructType(statement):
+		return lsp.CompletionItemKindStruct
+	case hasAnyPrefix(statement, classPrefixes):
+		return lsp.CompletionItemKindClass
+	case hasAnyPrefix(statement, constantPrefixes):
+		return lsp.CompletionItemKindConstant
+	case hasAnyPrefix(statement, variablePrefixes) || isShortDeclaration(statement):
+		return lsp.CompletionItemKindVariable
+	case multiline:
+		return lsp.CompletionItemKindSnippet
+	case hasAnyPrefix(statement, keywordStatements):
+		return lsp.CompletionItemKindKeyword
+	}
+
+	return lsp.CompletionItemKindText
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGoMethod matches `func (r *T) Name(...)` receivers.
+func isGoMethod(statement string) bool {
+	return strings.HasPrefix(statement, "func (")
+}
+
+func isGoStructType(statement string) bool {
+	return strings.HasPrefix(statement, "type ") && strings.Contains(statement, " struct")
+}
+
+// isShortDeclaration matches `name := value` and `a, b := value` forms.
+func isShortDeclaration(statement string) bool {
+	lhs, _, ok := strings.Cut(statement, ":=")
+	if !ok {
+		return false
+	}
+	lhs = strings.TrimSpace(lhs)
+	if lhs == "" {
+		return false
+	}
+	for _, r := range lhs {
+		if r != '_' && r != ',' && r != ' ' && !isIdentRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Output filter modes for suggestions that look copied from licensed code.
+const (
+	OutputFilterOff  = "off"
+	OutputFilterFlag = "flag"
+	OutputFilterDrop = "drop"
+)
+
+// licenseTexts are the distinctive passages of common license headers. Model
+// output that reproduces a long enough stretch of one is most likely copied
+// from a licensed file.
+var licenseTexts = map[string]string{
+	"GPL":        "This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version. This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for more details.",
+	"LGPL":       "This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option) any later version.",
+	"AGPL":       "This program is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.",
+	"MIT":        "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:",
+	"Apache-2.0": "Licensed under the Apache License, Version 2.0 (the \"License\"); you may not use this file except in compliance with the License. You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0 Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an \"AS IS\" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.",
+	"BSD":        "Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met: Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.",
+	"MPL-2.0":    "This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0. If a copy of the MPL was not distributed with this file, You can obtain one at http://mozilla.org/MPL/2.0/.",
+}
+
+var normalizedLicenses = func() map[string]string {
+	normalized := make(map[string]string, len(licenseTexts))
+	for name, text := range licenseTexts {
+		normalized[name] = normalizeForMatch(text)
+	}
+	return normalized
+}()
+
+// licenseMarkers are short tags that identify a license on their own.
+var licenseMarkers = []string{"spdx-license-identifier:"}
+
+// contaminationReason returns why text looks like verbatim licensed code, or
+// an empty string. A match needs at least minLength characters (whitespace,
+// comment leaders and case are ignored) in common with a known license
+// header, or a block of that size repeated within the suggestion.
+func contaminationReason(text string, minLength int) string {
+	normalized := normalizeForMatch(text)
+
+	for _, marker := range licenseMarkers {
+		if strings.Contains(normalized, marker) {
+			return "contains a license identifier"
+		}
+	}
+
+	if minLength <= 0 || len(normalized) < minLength {
+		return ""
+	}
+
+	for _, start := range wordStarts(normalized, minLength) {
+		window := normalized[start : start+minLength]
+		for name, license := range normalizedLicenses {
+			if strings.Contains(license, window) {
+				return fmt.Sprintf("reproduces %s license text", name)
+			}
+		}
+		if strings.Contains(normalized[start+minLength:], window) {
+			return fmt.Sprintf("repeats a %d+ character block verbatim", minLength)
+		}
+	}
+
+	return ""
+}
+
+// wordStarts returns the offsets of words in s that leave room for a window
+// of the given length.
+func wordStarts(s string, length int) []int {
+	var starts []int
+	for i := 0; i+length <= len(s); i++ {
+		if i == 0 || s[i-1] == ' ' {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// normalizeForMatch lower-cases text and collapses whitespace and comment
+// leaders, so a header matches regardless of the comment style it is in.
+func normalizeForMatch(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\n', '\r', '*', '#', '/', ';':
+			return true
+		}
+		return false
+	})
+	return strings.Join(fields, " ")
+}
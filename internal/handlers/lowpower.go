@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// lowPowerCommand toggles low-power mode. It takes no arguments.
+const lowPowerCommand = "helix-assist.lowPower"
+
+// LowPowerMode is a runtime switch that trades suggestion quality for fewer,
+// smaller and cheaper provider requests: a longer debounce, one suggestion,
+// a narrower context window and, if configured, a cheaper provider. It
+// spans the sessions of a process, but switching to the cheaper provider
+// leaves each session's own selection in place for when the mode ends.
+type LowPowerMode struct {
+	cfg      *config.Config
+	registry *providers.Registry
+
+	mu      sync.Mutex
+	enabled bool
+}
+
+func NewLowPowerMode(cfg *config.Config, registry *providers.Registry) *LowPowerMode {
+	return &LowPowerMode{cfg: cfg, registry: registry}
+}
+
+func (m *LowPowerMode) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+// Set switches the mode and returns a message describing the result.
+func (m *LowPowerMode) Set(enabled bool) string {
+	m.mu.Lock()
+	m.enabled = enabled
+	m.mu.Unlock()
+
+	message := "Low-power mode off"
+	if enabled {
+		message = "Low-power mode on"
+	}
+	if handler := m.cfg.LowPowerHandler; enabled && handler != "" {
+		if !slices.Contains(m.registry.Names(), handler) {
+			return message + " (provider not found: " + handler + ")"
+		}
+		message += ", using " + handler
+	}
+	return message
+}
+
+// Toggle flips the mode and returns a message describing the result.
+func (m *LowPowerMode) Toggle() string {
+	return m.Set(!m.Enabled())
+}
+
+// handler returns the provider requests go to instead of the selected one,
+// or "" to keep the selection.
+func (m *LowPowerMode) handler() string {
+	handler := m.cfg.LowPowerHandler
+	if handler == "" || !m.Enabled() || !slices.Contains(m.registry.Names(), handler) {
+		return ""
+	}
+	return handler
+}
+
+// debounce returns the completion debounce in milliseconds, given the
+// normal one.
+func (m *LowPowerMode) debounce(normal int) int {
+	if m.Enabled() {
+		return max(normal, m.cfg.LowPowerDebounce)
+	}
+	return normal
+}
+
+func (m *LowPowerMode) numSuggestions(normal int) int {
+	if m.Enabled() {
+		return 1
+	}
+	return normal
+}
+
+// trimContext narrows the completion context to LowPowerContextLines before
+// the cursor and a quarter of that after it.
+func (m *LowPowerMode) trimContext(before, after string) (string, string) {
+	lines := m.cfg.LowPowerContextLines
+	if !m.Enabled() || lines <= 0 {
+		return before, after
+	}
+
+	beforeLines := strings.Split(before, "\n")
+	if len(beforeLines) > lines {
+		beforeLines = beforeLines[len(beforeLines)-lines:]
+	}
+
+	afterLines := strings.Split(after, "\n")
+	if limit := max(lines/4, 1); len(afterLines) > limit {
+		afterLines = afterLines[:limit]
+	}
+
+	return strings.Join(beforeLines, "\n"), strings.Join(afterLines, "\n")
+}
+
+func (h *ActionHandler) toggleLowPower(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	h.reply(svc, msg, h.lowPower.Toggle())
+}
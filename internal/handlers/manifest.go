@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxManifestDependencies caps how many dependencies are put in a prompt.
+const maxManifestDependencies = 60
+
+// manifestParsers maps manifest file names to their parsers, in the order
+// they are reported.
+var manifestParsers = []struct {
+	name  string
+	parse func(data []byte) []string
+}{
+	{"go.mod", parseGoMod},
+	{"package.json", parsePackageJSON},
+	{"Cargo.toml", parseCargoToml},
+	{"pyproject.toml", parsePyproject},
+}
+
+type manifestEntry struct {
+	modTime time.Time
+	deps    []string
+}
+
+// manifestCache remembers parsed manifests until the file changes.
+type manifestCache struct {
+	mu      sync.Mutex
+	entries map[string]manifestEntry
+}
+
+func newManifestCache() *manifestCache {
+	return &manifestCache{entries: make(map[string]manifestEntry)}
+}
+
+// dependencies returns "name version" entries from the manifests nearest to
+// dir, walking up no further than root.
+func (c *manifestCache) dependencies(dir, root string) []string {
+	for {
+		if deps, found := c.dependenciesIn(dir); found {
+			if len(deps) > maxManifestDependencies {
+				deps = deps[:maxManifestDependencies]
+			}
+			return deps
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir || !strings.HasPrefix(parent, root) {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+func (c *manifestCache) dependenciesIn(dir string) ([]string, bool) {
+	var deps []string
+	found := false
+
+	for _, manifest := range manifestParsers {
+		path := filepath.Join(dir, manifest.name)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		c.mu.Lock()
+		entry, ok := c.entries[path]
+		c.mu.Unlock()
+
+		if !ok || !entry.modTime.Equal(info.ModTime()) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			entry = manifestEntry{modTime: info.ModTime(), deps: manifest.parse(data)}
+
+			c.mu.Lock()
+			c.entries[path] = entry
+			c.mu.Unlock()
+		}
+
+		deps = append(deps, entry.deps...)
+	}
+
+	return deps, found
+}
+
+// parseGoMod lists direct requirements; indirect ones are rarely imported.
+func parseGoMod(data []byte) []string {
+	var deps []string
+	inBlock := false
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "// indirect") {
+			continue
+		}
+		line, _, _ = strings.Cut(line, "//")
+
+		switch {
+		case line == "require (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "require "):
+			line = strings.TrimPrefix(line, "require ")
+		case !inBlock:
+			continue
+		}
+
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			deps = append(deps, fields[0]+" "+fields[1])
+		}
+	}
+	return deps
+}
+
+func parsePackageJSON(data []byte) []string {
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil
+	}
+
+	deps := formatDependencyMap(pkg.Dependencies)
+	for _, dep := range formatDependencyMap(pkg.DevDependencies) {
+		deps = append(deps, dep+" (dev)")
+	}
+	return deps
+}
+
+// parseCargoToml reads the dependency tables, accepting both `name = "1.0"`
+// and `name = { version = "1.0", ... }` forms.
+func parseCargoToml(data []byte) []string {
+	var deps []string
+	section := ""
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		if section != "dependencies" && section != "dev-dependencies" && section != "workspace.dependencies" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		version := value
+		if strings.HasPrefix(value, "{") {
+			version = ""
+			if _, rest, ok := strings.Cut(value, "version"); ok {
+				if _, v, ok := strings.Cut(rest, "="); ok {
+					version, _, _ = strings.Cut(strings.TrimSpace(v), ",")
+				}
+			}
+		}
+		version = strings.Trim(strings.TrimSpace(strings.TrimSuffix(version, "}")), `"'`)
+
+		dep := strings.TrimSpace(name + " " + version)
+		if section == "dev-dependencies" {
+			dep += " (dev)"
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// parsePyproject reads PEP 621 `dependencies = [...]` arrays and Poetry
+// dependency tables.
+func parsePyproject(data []byte) []string {
+	var deps []string
+	section := ""
+	inArray := false
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if inArray {
+			for _, item := range strings.Split(strings.TrimSuffix(line, "]"), ",") {
+				if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+					deps = append(deps, item)
+				}
+			}
+			if strings.HasSuffix(line, "]") {
+				inArray = false
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case section == "project" && name == "dependencies":
+			inner := strings.TrimPrefix(value, "[")
+			for _, item := range strings.Split(strings.TrimSuffix(inner, "]"), ",") {
+				if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+					deps = append(deps, item)
+				}
+			}
+			inArray = !strings.HasSuffix(value, "]")
+		case section == "tool.poetry.dependencies" && name != "python":
+			deps = append(deps, name+" "+strings.Trim(value, `"'`))
+		}
+	}
+	return deps
+}
+
+func formatDependencyMap(m map[string]string) []string {
+	deps := make([]string, 0, len(m))
+	for name, version := range m {
+		deps = append(deps, fmt.Sprintf("%s %s", name, version))
+	}
+	slices.Sort(deps)
+	return deps
+}
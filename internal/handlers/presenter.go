@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// presenter delivers the suggestions for a request to the editor.
+type presenter interface {
+	// present answers msg with items, the suggestions for the request made
+	// at position in version of the document, best first. Both are in the
+	// client's position encoding.
+	present(svc *lsp.Service, msg *lsp.JSONRPCMessage, position lsp.Position, uri string, version int, items []lsp.CompletionItem)
+}
+
+// presenterFor returns the presenter the configured mode selects for the
+// client: with auto, inline completions where the client requests them and
+// the completion list otherwise. Modes the client cannot serve fall back to
+// the completion list.
+func presenterFor(mode string, caps lsp.ClientCapabilities) presenter {
+	inline := caps.TextDocument.InlineCompletion != nil
+	switch {
+	case mode == "inline" && inline, mode == "auto" && inline:
+		return inlinePresenter{}
+	case mode == "ghost" && caps.Workspace.ApplyEdit:
+		return ghostPresenter{}
+	}
+	return listPresenter{}
+}
+
+// listPresenter answers textDocument/completion with a completion list.
+type listPresenter struct{}
+
+func (listPresenter) present(svc *lsp.Service, msg *lsp.JSONRPCMessage, position lsp.Position, uri string, version int, items []lsp.CompletionItem) {
+	svc.Send(&lsp.JSONRPCMessage{
+		ID: msg.ID,
+		Result: lsp.CompletionList{
+			IsIncomplete: false,
+			Items:        items,
+		},
+	})
+}
+
+// inlinePresenter answers textDocument/inlineCompletion with items the
+// editor shows in place at the cursor.
+type inlinePresenter struct{}
+
+func (inlinePresenter) present(svc *lsp.Service, msg *lsp.JSONRPCMessage, position lsp.Position, uri string, version int, items []lsp.CompletionItem) {
+	list := lsp.InlineCompletionList{Items: make([]lsp.InlineCompletionItem, 0, len(items))}
+	for _, item := range items {
+		list.Items = append(list.Items, lsp.InlineCompletionItem{
+			InsertText: item.TextEdit.NewText,
+			Range:      replacedRange(item, position, svc.Buffers.PositionEncoding()),
+		})
+	}
+	svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: list})
+}
+
+// ghostPresenter emulates ghost text for editors without inline
+// completions: it answers the completion request with an empty list and
+// inserts the best suggestion into the document with workspace/applyEdit,
+// as a single edit the user keeps or undoes.
+type ghostPresenter struct{}
+
+func (ghostPresenter) present(svc *lsp.Service, msg *lsp.JSONRPCMessage, position lsp.Position, uri string, version int, items []lsp.CompletionItem) {
+	svc.Send(&lsp.JSONRPCMessage{
+		ID:     msg.ID,
+		Result: lsp.CompletionList{Items: []lsp.CompletionItem{}},
+	})
+	if len(items) == 0 {
+		return
+	}
+
+	// The suggestion is for the document as it was when requested, and
+	// the editor may have changed it during the round trip.
+	buffer, ok := svc.Buffers.Get(uri)
+	if !ok || buffer.Version != version {
+		svc.Logger.Log("ghost suggestion dropped: the document changed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	encoding := svc.Buffers.PositionEncoding()
+	replaced := lsp.DecodeRange(buffer.Text, *replacedRange(items[0], position, encoding), encoding)
+	edit := lsp.TextEdit{Range: replaced, NewText: items[0].TextEdit.NewText}
+	if err := applyEdit(ctx, svc, "AI suggestion", uri, version, edit); err != nil {
+		svc.Logger.Log("ghost suggestion not applied:", err.Error())
+	}
+}
+
+// replacedRange returns the range of the document an item replaces when
+// inserted as a single edit: from position over the text after it that
+// the item's additional edits delete. Those edits address the document
+// with the item inserted, so each is mapped back past the inserted text;
+// edits that do not adjoin what is replaced so far are left out. Positions
+// are in encoding.
+func replacedRange(item lsp.CompletionItem, position lsp.Position, encoding string) *lsp.Range {
+	text := item.TextEdit.NewText
+	lines := strings.Count(text, "\n")
+	last := text[strings.LastIndexByte(text, '\n')+1:]
+	inserted := lsp.Position{Line: position.Line + lines, Character: lsp.EncodePosition(last, lsp.Position{Character: len(last)}, encoding).Character}
+	if lines == 0 {
+		inserted.Character += position.Character
+	}
+
+	// before maps a position after the inserted text back to the document
+	// without it.
+	before := func(p lsp.Position) lsp.Position {
+		if p.Line == inserted.Line {
+			return lsp.Position{Line: position.Line, Character: position.Character + p.Character - inserted.Character}
+		}
+		return lsp.Position{Line: p.Line - lines, Character: p.Character}
+	}
+
+	end := position
+	for _, edit := range item.AdditionalTextEdits {
+		if edit.Range.Start.Line < inserted.Line || edit.Range.Start.Line == inserted.Line && edit.Range.Start.Character < inserted.Character {
+			continue
+		}
+		if start := before(edit.Range.Start); start == end {
+			end = before(edit.Range.End)
+		}
+	}
+	return &lsp.Range{Start: position, End: end}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// TestReplacedRangeEncoding checks that the single edit inline and ghost
+// suggestions make, computed from items in the client's encoding, replaces
+// what accepting the item from the list would, past characters that take
+// more UTF-16 units than bytes and fewer.
+func TestReplacedRangeEncoding(t *testing.T) {
+	cases := []struct {
+		name     string
+		document string
+		hint     string
+		want     string
+	}{
+		{"ascii", "fmt.Println(|)\n", `"hi")`, "fmt.Println(\"hi\")\n"},
+		{"accents", "s := \"é\" + f(|)\n", "x)", "s := \"é\" + f(x)\n"},
+		{"astral", "s := \"😀\" + f(|)\n", "x)", "s := \"😀\" + f(x)\n"},
+		{"cjk overlap", "s := f(|世界)\n", "a, 世界)", "s := f(a, 世界)\n"},
+		{"multi-line", "if ok {\n\tf(|é)\n}\n", "a,\n\t\té)", "if ok {\n\tf(a,\n\t\té)\n}\n"},
+	}
+	for _, tc := range cases {
+		for _, encoding := range []string{lsp.PositionEncodingUTF8, lsp.PositionEncodingUTF16} {
+			t.Run(tc.name+" "+encoding, func(t *testing.T) {
+				line, column := cursorOf(tc.document)
+				document := strings.Replace(tc.document, "|", "", 1)
+				position := lsp.Position{Line: line, Character: column}
+
+				h := &CompletionHandler{cfg: config.DefaultConfig()}
+				item := h.buildCompletionItem(tc.hint, util.GetContent(document, line, column), position, 0)
+				encodeItem(&item, document, encoding)
+
+				// The client's view: an encoded range, decoded against the
+				// document as it does.
+				replaced := replacedRange(item, lsp.EncodePosition(document, position, encoding), encoding)
+				decoded := lsp.DecodeRange(document, *replaced, encoding)
+				if got := applyTextEdit(document, lsp.TextEdit{Range: decoded, NewText: item.TextEdit.NewText}); got != tc.want {
+					t.Errorf("got %q, want %q", got, tc.want)
+				}
+				if back := lsp.EncodeRange(document, decoded, encoding); back != *replaced {
+					t.Errorf("range %+v decodes and encodes back to %+v", *replaced, back)
+				}
+			})
+		}
+	}
+}
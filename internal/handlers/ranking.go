@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sort strategies controlling how AI items rank against native LSP results.
+const (
+	SortFirst       = "first"
+	SortLast        = "last"
+	SortInterleaved = "interleaved"
+)
+
+// lastSortPrefix sorts after identifiers, which is what native servers
+// usually put in sortText.
+const lastSortPrefix = "~"
+
+// scoreSuggestion gives a rough 0-1 confidence for a suggestion. Earlier
+// suggestions were sampled at lower temperature, and very short single-line
+// hints rarely beat what the native server offers.
+func scoreSuggestion(hint string, index int) float64 {
+	score := 1.0 - 0.15*float64(index)
+
+	trimmed := strings.TrimSpace(hint)
+	switch {
+	case strings.Contains(trimmed, "\n"):
+		score += 0.1
+	case len(trimmed) < 4:
+		score -= 0.4
+	case len(trimmed) < 10:
+		score -= 0.2
+	}
+
+	return min(max(score, 0), 1)
+}
+
+// rankCompletion returns the sortText and preselect flag for a suggestion
+// according to the configured strategy.
+func rankCompletion(strategy string, threshold float64, hint string, index int) (string, bool) {
+	switch strategy {
+	case SortLast:
+		return fmt.Sprintf("%s%03d", lastSortPrefix, index), false
+	case SortInterleaved:
+		if scoreSuggestion(hint, index) >= threshold {
+			return fmt.Sprintf("%03d", index), index == 0
+		}
+		return fmt.Sprintf("%s%03d", lastSortPrefix, index), false
+	default:
+		return "", true // Empty string sorts before all other values
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// completionItemData is what an item sent without its deferred fields
+// carries until it is resolved.
+type completionItemData struct {
+	Request uint64 `json:"request"`
+	Index   int    `json:"index"`
+}
+
+// deferredItem holds what completionItem/resolve fills in for an item.
+type deferredItem struct {
+	// text is the suggestion before any snippet escaping.
+	text       string
+	languageID string
+	change     string
+}
+
+// deferredOverlap is what the overlap edits of a list's items are computed
+// from on resolve.
+type deferredOverlap struct {
+	// after is the text after the cursor on its line.
+	after    string
+	position lsp.Position
+	// document is the text the list was computed for.
+	document string
+	encoding string
+}
+
+// deferredItems keeps the deferred fields of the items of the last
+// completion list sent; the editor only resolves items it is showing.
+type deferredItems struct {
+	mu      sync.Mutex
+	request uint64
+	served  providers.Served
+	docs    bool
+	// markdown is whether docs are sent as markdown.
+	markdown bool
+	// overlap is set when the overlap edits are deferred.
+	overlap *deferredOverlap
+	items   []deferredItem
+}
+
+// resolveSupport reports which of the properties the client resolves
+// lazily.
+func resolveSupport(caps lsp.ClientCapabilities) (docs, edits bool) {
+	support := caps.TextDocument.Completion.CompletionItem.ResolveSupport
+	if support == nil {
+		return false, false
+	}
+	return slices.Contains(support.Properties, "documentation"), slices.Contains(support.Properties, "additionalTextEdits")
+}
+
+func (d *deferredItems) set(request uint64, served providers.Served, docs, markdown bool, overlap *deferredOverlap, items []deferredItem) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.request, d.served, d.docs, d.markdown, d.overlap, d.items = request, served, docs, markdown, overlap, items
+}
+
+// resolve fills in the deferred fields of item, computing its overlap edits
+// with h. Items from earlier lists are returned as they are.
+func (d *deferredItems) resolve(h *CompletionHandler, item *lsp.CompletionItem, data completionItemData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if data.Request != d.request || data.Index < 0 || data.Index >= len(d.items) {
+		return
+	}
+	deferred := d.items[data.Index]
+	if d.docs {
+		item.Documentation = suggestionDocs(deferred.text, deferred.languageID, &d.served, deferred.change, d.markdown)
+	}
+	if o := d.overlap; o != nil {
+		resolved := lsp.CompletionItem{
+			TextEdit:            &lsp.TextEdit{Range: lsp.Range{Start: o.position, End: o.position}, NewText: deferred.text},
+			AdditionalTextEdits: h.overlapEdits(deferred.text, o.after, o.position),
+		}
+		encodeItem(&resolved, o.document, o.encoding)
+		item.AdditionalTextEdits = resolved.AdditionalTextEdits
+	}
+}
+
+func (h *CompletionHandler) registerResolve(svc *lsp.Service) {
+	svc.On(lsp.EventCompletionResolve, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var item lsp.CompletionItem
+		if err := json.Unmarshal(msg.Params, &item); err != nil {
+			svc.Logger.Log("completionItem/resolve parse error:", err.Error())
+			svc.Send(&lsp.JSONRPCMessage{
+				ID:    msg.ID,
+				Error: &lsp.RPCError{Code: lsp.ErrorCodeInvalidParams, Message: "invalid completion item: " + err.Error()},
+			})
+			return
+		}
+
+		// Items of other servers, or sent whole, have nothing to resolve.
+		var data completionItemData
+		if len(item.Data) > 0 && json.Unmarshal(item.Data, &data) == nil {
+			h.deferred.resolve(h, &item, data)
+		}
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: item})
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+func TestResolveOverlapEdits(t *testing.T) {
+	h := &CompletionHandler{cfg: config.DefaultConfig()}
+	cases := []struct {
+		name     string
+		document string
+		hint     string
+	}{
+		{"closing paren", "fmt.Println(|)\n", `"hello")`},
+		{"no overlap", "x := |\n", "compute(a, b)"},
+		{"astral before the cursor", "s := \"😀\" + f(|)\n", "x)"},
+		{"multi-line", "if ok {\n|}\n", "\treturn\n}"},
+	}
+	for _, tc := range cases {
+		for _, encoding := range []string{lsp.PositionEncodingUTF8, lsp.PositionEncodingUTF16} {
+			t.Run(tc.name+" "+encoding, func(t *testing.T) {
+				line, column := cursorOf(tc.document)
+				document := strings.Replace(tc.document, "|", "", 1)
+				content := util.GetContent(document, line, column)
+				position := lsp.Position{Line: line, Character: column}
+
+				want := h.buildCompletionItem(tc.hint, content, position, 0)
+				encodeItem(&want, document, encoding)
+
+				item := h.insertionItem(tc.hint, content, position, 0)
+				encodeItem(&item, document, encoding)
+				d := &deferredItems{}
+				d.set(1, providers.Served{}, false, false, &deferredOverlap{
+					after:    content.ContentImmediatelyAfter,
+					position: position,
+					document: document,
+					encoding: encoding,
+				}, []deferredItem{{text: item.TextEdit.NewText}})
+
+				d.resolve(h, &item, completionItemData{Request: 1})
+				if !reflect.DeepEqual(item.AdditionalTextEdits, want.AdditionalTextEdits) {
+					t.Errorf("resolved edits %+v, want %+v", item.AdditionalTextEdits, want.AdditionalTextEdits)
+				}
+
+				stale := h.insertionItem(tc.hint, content, position, 0)
+				d.resolve(h, &stale, completionItemData{Request: 2})
+				if stale.AdditionalTextEdits != nil {
+					t.Errorf("item of an earlier list resolved to %+v", stale.AdditionalTextEdits)
+				}
+			})
+		}
+	}
+}
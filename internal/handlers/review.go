@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// Review modes, set by config.Review.
+const (
+	ReviewOff  = "off"
+	ReviewSave = "save"
+	ReviewIdle = "idle"
+)
+
+const (
+	// reviewSource tags review diagnostics, so they are told apart from
+	// those of other servers and replaced independently of action errors.
+	reviewSource = "helix-assist"
+	// maxReviewBytes bounds the files sent for review.
+	maxReviewBytes = 64 * 1024
+	// maxReviewFindings caps the diagnostics published per review.
+	maxReviewFindings = 10
+)
+
+// reviewFinding is one problem the model reported, on a 1-based line.
+type reviewFinding struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Checks that can run on save, named in config.OnSave.
+const (
+	SaveReview     = "review"
+	SaveDocstrings = "docstrings"
+	SaveFix        = "fix"
+)
+
+// fileCheck asks the model about a whole file and gets back findings in
+// the review format. Each publishes under a source of its own, so one
+// check's results replace only its own earlier ones.
+type fileCheck struct {
+	name         string
+	source       string
+	systemPrompt func(languageID string) string
+	// blame adds who last changed the file to the prompt.
+	blame bool
+}
+
+// fileChecks are the checks, the review first.
+var fileChecks = []fileCheck{
+	{name: SaveReview, source: reviewSource, systemPrompt: providers.BuildReviewSystemPrompt, blame: true},
+	{name: SaveDocstrings, source: reviewSource + "/docstrings", systemPrompt: providers.BuildDocstringCheckSystemPrompt},
+	{name: SaveFix, source: reviewSource + "/fix", systemPrompt: providers.BuildFixCheckSystemPrompt},
+}
+
+// reviewRun is a check in progress.
+type reviewRun struct {
+	cancel context.CancelFunc
+}
+
+// reviewer sends files for an AI review, and the other file checks, in the
+// background and publishes the findings as diagnostics. A check runs on a
+// file again only once its text changed, and a new run cancels the one of
+// the same check still running.
+type reviewer struct {
+	cfg      *config.Config
+	registry *providers.Registry
+	lowPower *LowPowerMode
+	trust    *WorkspaceTrust
+
+	mu       sync.Mutex
+	timers   map[string]*time.Timer
+	running  map[string]*reviewRun
+	reviewed map[string]string
+}
+
+func newReviewer(cfg *config.Config, registry *providers.Registry, lowPower *LowPowerMode, trust *WorkspaceTrust) *reviewer {
+	return &reviewer{
+		cfg:      cfg,
+		registry: registry,
+		lowPower: lowPower,
+		trust:    trust,
+		timers:   make(map[string]*time.Timer),
+		running:  make(map[string]*reviewRun),
+		reviewed: make(map[string]string),
+	}
+}
+
+func (r *reviewer) register(svc *lsp.Service) {
+	if checks := r.saveChecks(); len(checks) > 0 {
+		// Editors only send didSave to servers that ask for it.
+		svc.Capabilities.TextDocumentSync.Save = &lsp.SaveOptions{}
+		svc.On(lsp.EventDidSave, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+			var params lsp.DidSaveParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				svc.Logger.Log("didSave parse error:", err.Error())
+				return
+			}
+			for _, check := range checks {
+				go r.check(svc, params.TextDocument.URI, check)
+			}
+		})
+	}
+	if r.cfg.Review == ReviewIdle {
+		svc.On(lsp.EventDidChange, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+			var params lsp.DidChangeParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return
+			}
+			r.schedule(svc, params.TextDocument.URI)
+		})
+	}
+}
+
+// saveChecks returns the checks to run after each save: those of
+// config.OnSave, and the review when config.Review is save.
+func (r *reviewer) saveChecks() []fileCheck {
+	var checks []fileCheck
+	for _, check := range fileChecks {
+		if slices.Contains(r.cfg.OnSave, check.name) || check.name == SaveReview && r.cfg.Review == ReviewSave {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// schedule reviews uri once it has not changed for the idle period.
+func (r *reviewer) schedule(svc *lsp.Service, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if timer := r.timers[uri]; timer != nil {
+		timer.Stop()
+	}
+	r.timers[uri] = time.AfterFunc(time.Duration(r.cfg.ReviewIdle)*time.Millisecond, func() {
+		r.mu.Lock()
+		delete(r.timers, uri)
+		r.mu.Unlock()
+		r.check(svc, uri, fileChecks[0])
+	})
+}
+
+// check runs check on uri and publishes its findings. Runs are tracked per
+// check, so the checks of one save run side by side.
+func (r *reviewer) check(svc *lsp.Service, uri string, check fileCheck) {
+	buffer, ok := svc.Buffers.Get(uri)
+	if !ok || buffer.Binary || strings.TrimSpace(buffer.Text) == "" {
+		return
+	}
+	if r.lowPower.Enabled() {
+		svc.Logger.Log("skipping", check.name, "in low-power mode:", uri)
+		return
+	}
+	if len(buffer.Text) > maxReviewBytes {
+		svc.Logger.Log("skipping", check.name, "of large file:", uri, len(buffer.Text), "bytes")
+		return
+	}
+
+	key := check.name + " " + uri
+	hash := hashText(buffer.Text)
+	ctx, cancel := context.WithTimeout(sessionContext(svc, r.lowPower), time.Duration(r.cfg.ActionTimeout)*time.Millisecond)
+	defer cancel()
+	run := &reviewRun{cancel: cancel}
+
+	r.mu.Lock()
+	if r.reviewed[key] == hash {
+		r.mu.Unlock()
+		return
+	}
+	if previous := r.running[key]; previous != nil {
+		previous.cancel()
+	}
+	r.running[key] = run
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		if r.running[key] == run {
+			delete(r.running, key)
+		}
+		r.mu.Unlock()
+	}()
+
+	svc.Logger.Log("running", check.name, "on", uri)
+	systemPrompt := providers.WithResponseLanguage(check.systemPrompt(buffer.LanguageID), r.cfg.ResponseLanguage)
+	if check.blame && r.cfg.BlameContext && r.trust.Level(svc.RootPath()).AllowsExternalCommands() {
+		systemPrompt = providers.WithBlame(systemPrompt, blameSummary(strings.TrimPrefix(uri, "file://"), 0, strings.Count(strings.TrimSuffix(buffer.Text, "\n"), "\n")))
+	}
+	resp, err := r.registry.Chat(ctx, systemPrompt, providers.BuildReviewUserPrompt(relativePath(svc.RootPath(), uri), numberLines(buffer.Text)))
+	if err != nil {
+		if ctx.Err() == nil {
+			svc.Logger.Log(check.name, "failed:", providers.KindOf(err), err.Error())
+		}
+		return
+	}
+
+	findings, err := parseFindings(resp.Result)
+	if err != nil {
+		svc.Logger.Log(check.name, "result not understood:", err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	r.reviewed[key] = hash
+	r.mu.Unlock()
+
+	svc.Logger.Log(check.name, "findings:", len(findings))
+	svc.PublishDiagnostics(uri, check.source, findingDiagnostics(findings, buffer.Text))
+}
+
+// numberLines prefixes every line with its 1-based number, so findings can
+// point at lines reliably.
+func numberLines(text string) string {
+	lines := strings.Split(text, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, "%4d| %s\n", i+1, line)
+	}
+	return b.String()
+}
+
+// parseFindings reads the JSON array of findings from a review result,
+// tolerating code fences and text around it.
+func parseFindings(result string) ([]reviewFinding, error) {
+	result = stripCodeFence(strings.TrimSpace(result))
+	start, end := strings.Index(result, "["), strings.LastIndex(result, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in %.80q", result)
+	}
+
+	var findings []reviewFinding
+	if err := json.Unmarshal([]byte(result[start:end+1]), &findings); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// findingDiagnostics turns findings into diagnostics spanning their lines,
+// dropping those outside text or without a message.
+func findingDiagnostics(findings []reviewFinding, text string) []lsp.Diagnostic {
+	lines := strings.Split(text, "\n")
+	diagnostics := []lsp.Diagnostic{}
+	for _, finding := range findings {
+		message := strings.TrimSpace(finding.Message)
+		if finding.Line < 1 || finding.Line > len(lines) || message == "" {
+			continue
+		}
+
+		severity := lsp.SeverityHint
+		if strings.EqualFold(finding.Severity, "info") {
+			severity = lsp.SeverityInformation
+		}
+
+		line := finding.Line - 1
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Message:  message,
+			Severity: severity,
+			Range: lsp.Range{
+				Start: lsp.Position{Line: line, Character: len(lines[line]) - len(strings.TrimLeft(lines[line], " \t"))},
+				End:   lsp.Position{Line: line, Character: len(lines[line])},
+			},
+		})
+		if len(diagnostics) == maxReviewFindings {
+			break
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/scaffold"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// newFromTemplateCommand is offered once per template kind found in the
+// workspace and user template directories.
+const newFromTemplateCommand = "newFromTemplate"
+
+// templateDirs returns the template directories to search. Workspaces that
+// are not trusted only get the user's own templates.
+func (h *ActionHandler) templateDirs(svc *lsp.Service) []string {
+	projectDir := h.cfg.TemplatesDir
+	if !h.trust.Level(svc.RootPath()).allowsWorkspaceContent() {
+		projectDir = ""
+	}
+	return scaffold.Dirs(svc.RootPath(), projectDir)
+}
+
+// templateActions returns a code action per available template kind.
+func (h *ActionHandler) templateActions(svc *lsp.Service, r lsp.Range) []lsp.CodeAction {
+	kinds := scaffold.Kinds(h.templateDirs(svc)...)
+	actions := make([]lsp.CodeAction, 0, len(kinds))
+
+	for _, kind := range kinds {
+		title := fmt.Sprintf("AI: New %s from template", kind)
+		actions = append(actions, lsp.CodeAction{
+			Title:       title,
+			Kind:        "source",
+			Diagnostics: []any{},
+			Command: &lsp.Command{
+				Title:   title,
+				Command: newFromTemplateCommand,
+				Arguments: []any{
+					map[string]any{
+						"range": r,
+						"kind":  kind,
+					},
+				},
+			},
+		})
+	}
+	return actions
+}
+
+// newFromTemplate renders a template next to the current file, using the
+// selection as the description of what to build, and writes the files once
+// the user confirms.
+func (h *ActionHandler) newFromTemplate(svc *lsp.Service, uri string, arg lsp.CommandArgument) {
+	tmpl, err := scaffold.Load(arg.Kind, h.templateDirs(svc)...)
+	if err != nil {
+		svc.SendShowMessage(lsp.MessageTypeError, err.Error())
+		return
+	}
+
+	vars := map[string]string{}
+	if description := strings.TrimSpace(util.DedentContent(svc.Buffers.GetContentFromRange(uri, arg.Range))); description != "" {
+		vars["description"] = description
+	}
+
+	ctx, cancel := context.WithTimeout(sessionContext(svc, h.lowPower), time.Duration(h.cfg.BlockTimeout)*time.Millisecond)
+	defer cancel()
+	ctx = providers.WithOverride(ctx, arg.Provider, arg.Model)
+
+	status := "done"
+	progress, ok := util.StartCancellableProgress(svc, "AI: New "+arg.Kind, 0, cancel)
+	if ok {
+		defer func() { progress.Stop(status) }()
+	}
+
+	targetDir := filepath.Dir(strings.TrimPrefix(uri, "file://"))
+	files, err := scaffold.Render(ctx, h.registry, tmpl, vars, targetDir)
+	if err != nil {
+		status = "failed"
+		svc.SendShowMessage(lsp.MessageTypeError, "Template fill-in failed: "+err.Error())
+		return
+	}
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i], _ = filepath.Rel(targetDir, file.Path)
+	}
+
+	confirmCtx, confirmCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer confirmCancel()
+
+	choice, err := svc.ShowMessageRequest(confirmCtx, lsp.MessageTypeInfo,
+		fmt.Sprintf("Create %d file(s): %s?", len(files), strings.Join(names, ", ")), "Create", "Cancel")
+	if err != nil || choice != "Create" {
+		status = "cancelled"
+		return
+	}
+
+	if err := scaffold.Write(files); err != nil {
+		status = "failed"
+		svc.SendShowMessage(lsp.MessageTypeError, "Could not write files: "+err.Error())
+		return
+	}
+
+	showCtx, showCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer showCancel()
+	if err := svc.ShowDocument(showCtx, "file://"+files[0].Path, true); err != nil {
+		svc.SendShowMessage(lsp.MessageTypeInfo, "Created "+strings.Join(names, ", "))
+	}
+}
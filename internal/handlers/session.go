@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// sessionContext is what provider requests for the session of svc derive
+// from: it ends with the session and names its workspace, and in low-power
+// mode it selects the low-power provider over the session's own.
+func sessionContext(svc *lsp.Service, lowPower *LowPowerMode) context.Context {
+	ctx := providers.WithWorkspace(svc.Context(), svc.RootPath())
+	if handler := lowPower.handler(); handler != "" {
+		ctx = providers.WithSelection(ctx, providers.NewSelection(handler))
+	}
+	return ctx
+}
+
+// errNoSelection refuses switching providers in a session whose context
+// carries no selection to switch.
+var errNoSelection = errors.New("this session cannot switch providers")
+
+// sessionSelection returns the provider selection the server gave the
+// session of svc, or nil.
+func sessionSelection(svc *lsp.Service) *providers.Selection {
+	return providers.SelectionOf(svc.Context())
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// liveSettings are the completion settings the editor can change through
+// workspace/didChangeConfiguration, starting from the configured values.
+type liveSettings struct {
+	mu                sync.Mutex
+	debounce          int
+	numSuggestions    int
+	triggerCharacters []string
+}
+
+func newLiveSettings(cfg *config.Config) *liveSettings {
+	return &liveSettings{
+		debounce:          cfg.Debounce,
+		numSuggestions:    cfg.NumSuggestions,
+		triggerCharacters: cfg.TriggerCharacters,
+	}
+}
+
+func (s *liveSettings) get() (debounce, numSuggestions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.debounce, s.numSuggestions
+}
+
+// triggers reports whether typing char should request a completion.
+func (s *liveSettings) triggers(char string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Contains(s.triggerCharacters, char)
+}
+
+// apply changes the settings given and returns a description of each
+// change. The provider is switched first, in the selection ctx carries, so
+// an unknown one changes nothing.
+func (s *liveSettings) apply(ctx context.Context, settings config.Settings, registry *providers.Registry) ([]string, error) {
+	var changes []string
+
+	if settings.Handler != nil {
+		if providers.SelectionOf(ctx) == nil {
+			return nil, errNoSelection
+		}
+		name, model := config.SplitHandler(*settings.Handler)
+		if err := registry.Select(ctx, name, model, ""); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "handler "+*settings.Handler)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings.Debounce != nil && *settings.Debounce != s.debounce {
+		s.debounce = *settings.Debounce
+		changes = append(changes, fmt.Sprintf("debounce %dms", s.debounce))
+	}
+	if settings.NumSuggestions != nil && *settings.NumSuggestions != s.numSuggestions {
+		s.numSuggestions = *settings.NumSuggestions
+		changes = append(changes, fmt.Sprintf("numSuggestions %d", s.numSuggestions))
+	}
+	if settings.TriggerCharacters != nil && !slices.Equal(settings.TriggerCharacters, s.triggerCharacters) {
+		s.triggerCharacters = settings.TriggerCharacters
+		changes = append(changes, fmt.Sprintf("triggerCharacters %q", s.triggerCharacters))
+	}
+	return changes, nil
+}
+
+// settingsSection is the section settings are pulled from with
+// workspace/configuration.
+const settingsSection = "helix-assist"
+
+func (h *CompletionHandler) registerSettings(svc *lsp.Service) {
+	// Settings in the editor's configuration apply from the start, over
+	// those from the environment.
+	svc.On(lsp.EventInitialized, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		h.pullSettings(svc)
+	})
+
+	svc.On(lsp.EventDidChangeConfiguration, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.DidChangeConfigurationParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Log("didChangeConfiguration parse error:", err.Error())
+			return
+		}
+
+		// Clients that expect settings to be pulled send none here.
+		if len(params.Settings) == 0 || string(params.Settings) == "null" {
+			h.pullSettings(svc)
+			return
+		}
+		h.applySettings(svc, params.Settings)
+	})
+}
+
+// pullSettings requests the helix-assist section of the workspace's
+// settings, if the client can answer workspace/configuration.
+func (h *CompletionHandler) pullSettings(svc *lsp.Service) {
+	if !svc.ClientCapabilities().Workspace.Configuration {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := svc.Call(ctx, lsp.EventConfiguration, lsp.ConfigurationParams{
+		Items: []lsp.ConfigurationItem{{ScopeURI: "file://" + svc.RootPath(), Section: settingsSection}},
+	})
+	if err != nil {
+		svc.Logger.Log("workspace/configuration failed:", err.Error())
+		return
+	}
+
+	var sections []json.RawMessage
+	if err := json.Unmarshal(mustMarshal(resp.Result), &sections); err != nil || len(sections) == 0 {
+		svc.Logger.Log("workspace/configuration: unexpected result:", resp.Result)
+		return
+	}
+	h.applySettings(svc, sections[0])
+}
+
+func (h *CompletionHandler) applySettings(svc *lsp.Service, raw json.RawMessage) {
+	settings, err := config.ParseSettings(raw)
+	if err == nil {
+		var changes []string
+		changes, err = h.settings.apply(svc.Context(), settings, h.registry)
+		if len(changes) > 0 {
+			svc.Logger.Log("settings changed:", strings.Join(changes, ", "))
+		}
+	}
+	if err != nil {
+		svc.Logger.Log("settings:", err.Error())
+		svc.SendShowMessage(lsp.MessageTypeWarning, "helix-assist settings ignored: "+err.Error())
+	}
+}
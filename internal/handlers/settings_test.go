@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+type fixedChat struct{ model string }
+
+func (p fixedChat) Completion(ctx context.Context, req providers.CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	return []string{p.model}, nil
+}
+
+func (p fixedChat) Chat(ctx context.Context, systemPrompt, userPrompt string) (*providers.ChatResponse, error) {
+	return &providers.ChatResponse{Result: p.model}, nil
+}
+
+func (p fixedChat) Models() (string, string) {
+	return p.model, p.model
+}
+
+func (p fixedChat) WithModels(model, chatModel string) providers.Provider {
+	return fixedChat{model: model}
+}
+
+func TestApplySettings(t *testing.T) {
+	newRegistry := func() *providers.Registry {
+		r := providers.NewRegistry()
+		r.Register("local", fixedChat{model: "small"})
+		r.Register("remote", fixedChat{model: "large"})
+		r.SetCurrent("local")
+		return r
+	}
+	cfg := config.DefaultConfig()
+
+	tests := []struct {
+		name      string
+		settings  string
+		selection bool
+		changes   []string
+		err       error
+		// provider and model are the selection afterwards.
+		provider, model string
+	}{
+		{"nothing", `{}`, true, nil, nil, "local", "small"},
+		{"unchanged", `{"debounce": 200, "numSuggestions": 1}`, true, []string{"numSuggestions 1"}, nil, "local", "small"},
+		{"completion settings", `{"debounce": 50, "numSuggestions": 3, "triggerCharacters": ["("]}`, true, []string{"debounce 50ms", "numSuggestions 3", `triggerCharacters ["("]`}, nil, "local", "small"},
+		{"handler", `{"handler": "remote:huge", "debounce": 50}`, true, []string{"handler remote:huge", "debounce 50ms"}, nil, "remote", "huge"},
+		{"unknown handler", `{"handler": "missing", "debounce": 50}`, true, nil, errors.New("provider not found: missing"), "local", "small"},
+		{"handler without selection", `{"handler": "remote"}`, false, nil, errNoSelection, "local", "small"},
+		{"other keys", `{"token": "secret", "model": "x"}`, true, nil, nil, "local", "small"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newRegistry()
+			live := newLiveSettings(cfg)
+			live.debounce, live.numSuggestions = 200, 2
+
+			ctx := context.Background()
+			if tt.selection {
+				ctx = providers.WithSelection(ctx, providers.NewSelection(""))
+			}
+			settings, err := config.ParseSettings(json.RawMessage(tt.settings))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changes, err := live.apply(ctx, settings, registry)
+			if (err == nil) != (tt.err == nil) || err != nil && err.Error() != tt.err.Error() {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(changes, tt.changes) {
+				t.Errorf("changes %q, want %q", changes, tt.changes)
+			}
+			if err != nil {
+				if debounce, n := live.get(); debounce != 200 || n != 2 {
+					t.Errorf("failed settings applied: debounce %d, numSuggestions %d", debounce, n)
+				}
+			}
+
+			provider := registry.Selected(ctx)
+			model, _, _ := registry.SelectedModels(ctx, provider)
+			if provider != tt.provider || model != tt.model {
+				t.Errorf("selected %s:%s, want %s:%s", provider, model, tt.provider, tt.model)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// topLevelDeclRe matches lines that start a top-level declaration.
+var topLevelDeclRe = regexp.MustCompile(`^(?:export\s+)?(?:pub(?:\([a-z]+\))?\s+)?(?:async\s+)?(?:func|def|class|fn|type|struct|enum|trait|impl|interface|function|const|var|let|module|object|data class|fun)\b`)
+
+// valueDeclRe matches lines that start a top-level constant or variable.
+var valueDeclRe = regexp.MustCompile(`^(?:export\s+)?(?:pub(?:\([a-z]+\))?\s+)?(?:const|var|let)\b`)
+
+var commentLineRe = regexp.MustCompile(`^\s*(?://|#|/\*|\*|--|;;|"""|''')`)
+
+var codeFenceRe = regexp.MustCompile("(?s)^\\s*```[A-Za-z0-9_+-]*\\n(.*?)\\n?```\\s*$")
+
+// skeletonChunk is either the file header or one declaration together with
+// the comments directly above it. Consecutive constants and variables make
+// up one chunk, as they rarely need more than a value each.
+type skeletonChunk struct {
+	text string
+	decl bool
+}
+
+// splitDeclarations cuts a skeleton file into top-level declarations so each
+// can be generated separately.
+func splitDeclarations(text string) []skeletonChunk {
+	lines := strings.Split(text, "\n")
+	var chunks []skeletonChunk
+	start := 0
+	inDecl, inValues := false, false
+
+	flush := func(end int) {
+		if end > start {
+			chunks = append(chunks, skeletonChunk{text: strings.Join(lines[start:end], "\n"), decl: inDecl})
+		}
+		start = end
+	}
+
+	for i, line := range lines {
+		if !topLevelDeclRe.MatchString(line) {
+			continue
+		}
+		value := valueDeclRe.MatchString(line)
+		if value && inValues {
+			continue
+		}
+
+		// Doc comments belong to the declaration below them.
+		cut := i
+		for cut > start && commentLineRe.MatchString(lines[cut-1]) {
+			cut--
+		}
+
+		flush(cut)
+		inDecl, inValues = true, value
+	}
+	flush(len(lines))
+
+	return chunks
+}
+
+func stripCodeFence(text string) string {
+	if matches := codeFenceRe.FindStringSubmatch(text); len(matches) > 1 {
+		return matches[1]
+	}
+	return text
+}
+
+// previewPath is where generated files are written for review, keeping the
+// extension so the editor picks the right language.
+func previewPath(uri string) string {
+	name := filepath.Base(strings.TrimPrefix(uri, "file://"))
+	ext := filepath.Ext(name)
+	return filepath.Join(previewDir(uri), strings.TrimSuffix(name, ext)+".generated"+ext)
+}
+
+// resultPath is where the result of command on the document at uri is
+// written to be shown.
+func resultPath(uri, command string) string {
+	name := filepath.Base(strings.TrimPrefix(uri, "file://"))
+	return filepath.Join(previewDir(uri), name+"."+command+".md")
+}
+
+// testPath is where tests generated for the document at uri are written,
+// named the way the language's test runners look for test files.
+func testPath(uri, languageID string) string {
+	name := filepath.Base(strings.TrimPrefix(uri, "file://"))
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	switch languageID {
+	case "python":
+		name = "test_" + name
+	case "javascript", "javascriptreact", "typescript", "typescriptreact":
+		name = base + ".test" + ext
+	default:
+		name = base + "_test" + ext
+	}
+	return filepath.Join(previewDir(uri), name)
+}
+
+// previewDir holds the files written for the document at uri. Each
+// document gets its own, so files of the same name in different
+// directories do not overwrite each other's previews.
+func previewDir(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(previewRoot(), hex.EncodeToString(sum[:6]))
+}
+
+// previewRoot is the user's own directory for previews, as they hold
+// workspace code: under the user cache directory, or named for the user
+// in the temp directory.
+func previewRoot() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "helix-assist", "previews")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("helix-assist-%d", os.Getuid()))
+}
+
+// writePreview writes a preview file only the user can read. A preview
+// root that others can reach, or that is not a plain directory, is
+// refused rather than written into.
+func writePreview(path string, data []byte) error {
+	root := previewRoot()
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(root); err != nil {
+		return err
+	} else if !info.IsDir() || info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s must be a directory only you can access", root)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// showResult writes a prose result to a Markdown file and asks the editor to
+// open it, falling back to a message when it cannot.
+func (h *ActionHandler) showResult(svc *lsp.Service, msg *lsp.JSONRPCMessage, command, uri, result string) {
+	label := command
+	for _, cmd := range Commands {
+		if cmd.Key == command {
+			label = strings.TrimPrefix(cmd.Label, "AI: ")
+		}
+	}
+	text := fmt.Sprintf("# %s: %s\n\n%s\n", label, relativePath(svc.RootPath(), uri), strings.TrimSpace(result))
+
+	path := resultPath(uri, command)
+	err := writePreview(path, []byte(text))
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = svc.ShowDocument(ctx, "file://"+path, true)
+	}
+	if err != nil {
+		svc.Logger.Log("showResult: could not open the result:", err.Error())
+		svc.SendShowMessage(lsp.MessageTypeInfo, strings.TrimSpace(result))
+	}
+	h.reply(svc, msg, nil)
+}
+
+// showTests writes generated tests to a test file of their own and asks the
+// editor to open it, leaving the source untouched. When the editor cannot
+// open it, the user is told where it was written.
+func (h *ActionHandler) showTests(svc *lsp.Service, uri, languageID, result string) error {
+	path := testPath(uri, languageID)
+	text := util.TrimBlankLines(stripCodeFence(strings.TrimSpace(result)))
+	if err := writePreview(path, []byte(strings.TrimRight(text, " \t\n")+"\n")); err != nil {
+		return fmt.Errorf("could not write the tests: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.ShowDocument(ctx, "file://"+path, true); err != nil {
+		svc.Logger.Log("showTests: could not open the tests:", err.Error())
+		svc.SendShowMessage(lsp.MessageTypeInfo, "Generated tests written to "+path)
+	}
+	return nil
+}
+
+// generateFromSkeleton implements every declaration of a skeleton file, one
+// provider call per chunk, and opens the result as a preview document.
+// The buffer itself is left untouched.
+func (h *ActionHandler) generateFromSkeleton(svc *lsp.Service, uri string, buffer *lsp.Buffer) {
+	ctx, cancel := context.WithCancel(sessionContext(svc, h.lowPower))
+	defer cancel()
+
+	chunks := splitDeclarations(buffer.Text)
+	total := 0
+	for _, chunk := range chunks {
+		if chunk.decl {
+			total++
+		}
+	}
+
+	if total == 0 {
+		svc.SendShowMessage(lsp.MessageTypeWarning, "No declarations found to generate")
+		return
+	}
+
+	status := "done"
+	progress, ok := util.StartCancellableProgress(svc, "AI: Generate from skeleton", 0, cancel)
+	if ok {
+		defer func() { progress.Stop(status) }()
+	}
+
+	systemPrompt := providers.BuildSkeletonSystemPrompt(buffer.LanguageID)
+	systemPrompt = providers.WithResponseLanguage(systemPrompt, h.cfg.ResponseLanguage)
+	systemPrompt = providers.WithInstructions(systemPrompt, h.instructions(svc.RootPath()))
+
+	var out strings.Builder
+	done := 0
+	failed := 0
+
+	for i, chunk := range chunks {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+
+		if !chunk.decl {
+			out.WriteString(chunk.text)
+			continue
+		}
+
+		signature, _, _ := strings.Cut(strings.TrimSpace(chunk.text), "\n")
+		if ok {
+			progress.Step(done, total, signature)
+		}
+
+		chunkCtx, chunkCancel := context.WithTimeout(ctx, time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
+		resp, err := h.registry.Chat(chunkCtx, systemPrompt, providers.BuildSkeletonUserPrompt(buffer.Text, chunk.text))
+		chunkCancel()
+		done++
+
+		if ctx.Err() != nil {
+			status = "cancelled"
+			svc.Logger.Log("skeleton generation cancelled after", done-1, "of", total)
+			return
+		}
+
+		if err != nil || strings.TrimSpace(resp.Result) == "" {
+			// Keep the skeleton for this declaration so the preview stays
+			// complete; the user can rerun or fill it in by hand.
+			failed++
+			if err != nil {
+				svc.Logger.Log("skeleton chunk failed:", providers.KindOf(err), err.Error())
+			}
+			out.WriteString(chunk.text)
+			continue
+		}
+
+		generated := strings.TrimRight(stripCodeFence(resp.Result), " \t\n")
+		out.WriteString(generated)
+		if strings.HasSuffix(chunk.text, "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	path := previewPath(uri)
+	if err := writePreview(path, []byte(out.String())); err != nil {
+		status = "failed"
+		svc.SendShowMessage(lsp.MessageTypeError, "Could not write preview: "+err.Error())
+		return
+	}
+
+	if failed > 0 {
+		status = fmt.Sprintf("%d of %d declarations failed", failed, total)
+	}
+
+	showCtx, showCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer showCancel()
+	if err := svc.ShowDocument(showCtx, "file://"+path, true); err != nil {
+		svc.Logger.Log("showDocument failed:", err.Error())
+		svc.SendShowMessage(lsp.MessageTypeInfo, "Generated file written to "+path)
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTestPath(t *testing.T) {
+	tests := []struct {
+		uri, languageID, want string
+	}{
+		{"file:///src/parse.go", "go", "parse_test.go"},
+		{"file:///src/parse.py", "python", "test_parse.py"},
+		{"file:///src/parse.ts", "typescript", "parse.test.ts"},
+		{"file:///src/parse.rs", "rust", "parse_test.rs"},
+	}
+	for _, tt := range tests {
+		path := testPath(tt.uri, tt.languageID)
+		if filepath.Base(path) != tt.want || filepath.Dir(path) != previewDir(tt.uri) {
+			t.Errorf("testPath(%s, %s) = %s, want %s in %s", tt.uri, tt.languageID, path, tt.want, previewDir(tt.uri))
+		}
+	}
+}
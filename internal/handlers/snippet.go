@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+var (
+	// emptyCallRe matches a call with no arguments, e.g. foo() or
+	// obj.method(), whose parentheses are where the arguments go.
+	emptyCallRe = regexp.MustCompile(`[\w\]>]\(\)`)
+	// placeholderBodyRe matches a line that only stands in for a body:
+	// a TODO comment, Python's pass or an ellipsis, or todo!().
+	placeholderBodyRe = regexp.MustCompile(`^\s*((?://|#|--|/\*)\s*(?:TODO|FIXME)\b.*|pass|\.\.\.|todo!\(\)|unimplemented!\(\))\s*$`)
+)
+
+// tabstop is a place the cursor visits after a snippet is accepted: an empty
+// position, or text to select for replacing.
+type tabstop struct {
+	start, end int
+}
+
+// toSnippet rewrites a suggestion as a snippet with tabstops at its obvious
+// placeholders: empty argument lists and placeholder bodies such as TODO
+// comments or pass. The snippet expands to exactly the suggestion, so
+// offsets computed from the plain text stay valid. It reports false when
+// the suggestion has no placeholders.
+func toSnippet(text string) (string, bool) {
+	var stops []tabstop
+
+	for _, m := range emptyCallRe.FindAllStringIndex(text, -1) {
+		// Between the parentheses.
+		stops = append(stops, tabstop{m[1] - 1, m[1] - 1})
+	}
+
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		content := strings.TrimRight(line, "\n")
+		if m := placeholderBodyRe.FindStringSubmatchIndex(content); m != nil {
+			stops = append(stops, tabstop{offset + m[2], offset + m[3]})
+		}
+		offset += len(line)
+	}
+
+	if len(stops) == 0 {
+		return "", false
+	}
+	slices.SortStableFunc(stops, func(a, b tabstop) int { return a.start - b.start })
+
+	var b strings.Builder
+	last, n := 0, 0
+	for _, stop := range stops {
+		if stop.start < last {
+			// Overlaps a placeholder already taken, such as a call inside a
+			// TODO comment.
+			continue
+		}
+		n++
+		b.WriteString(escapeSnippet(text[last:stop.start]))
+		if stop.start == stop.end {
+			fmt.Fprintf(&b, "$%d", n)
+		} else {
+			fmt.Fprintf(&b, "${%d:%s}", n, escapeSnippet(text[stop.start:stop.end]))
+		}
+		last = stop.end
+	}
+	b.WriteString(escapeSnippet(text[last:]))
+	return b.String(), true
+}
+
+// escapeSnippet escapes the characters snippet syntax gives a meaning.
+func escapeSnippet(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace(text)
+}
+
+// snippetItem turns item into a snippet completion if its text has
+// placeholders.
+func snippetItem(item *lsp.CompletionItem) {
+	if item.TextEdit == nil {
+		return
+	}
+	if snippet, ok := toSnippet(item.TextEdit.NewText); ok {
+		item.TextEdit.NewText = snippet
+		item.InsertTextFormat = lsp.InsertTextFormatSnippet
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// Runtime switching commands. Arguments are plain strings, as passed by
+// :lsp-workspace-command helix-assist.setModel <model> [chat model].
+const (
+	setProviderCommand = "helix-assist.setProvider"
+	setModelCommand    = "helix-assist.setModel"
+	listModelsCommand  = "helix-assist.listModels"
+)
+
+// setProvider routes the session's requests to the provider named in the
+// first argument, or asks the user to pick one of the registered providers.
+// Other sessions sharing the process keep theirs.
+func (h *ActionHandler) setProvider(svc *lsp.Service, msg *lsp.JSONRPCMessage, args []string) {
+	if sessionSelection(svc) == nil {
+		h.replyError(svc, msg, errNoSelection)
+		return
+	}
+
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		choice, err := svc.ShowMessageRequest(ctx, lsp.MessageTypeInfo, "Switch provider (current: "+h.registry.Selected(svc.Context())+")", h.registry.Available(svc.Context())...)
+		if err != nil {
+			svc.Logger.Log("setProvider: showMessageRequest failed:", err.Error())
+		}
+		if choice == "" {
+			h.reply(svc, msg, nil)
+			return
+		}
+		name = choice
+	}
+
+	if err := h.registry.Select(svc.Context(), name, "", ""); err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+
+	h.reply(svc, msg, "Using "+h.describeProvider(svc.Context(), name)+h.taskRoutes())
+}
+
+// taskRoutes notes the request kinds that keep going to their own provider
+// whatever the current one is.
+func (h *ActionHandler) taskRoutes() string {
+	var routed []string
+	for _, kind := range []string{providers.CallCompletion, providers.CallChat} {
+		if name, model, ok := h.registry.TaskRoute(kind); ok {
+			if model != "" {
+				name += " (" + model + ")"
+			}
+			routed = append(routed, fmt.Sprintf("%s requests stay on %s", kind, name))
+		}
+	}
+	if len(routed) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(routed, ", ") + ")"
+}
+
+// setModel changes the session's completion model of its provider, and the
+// chat model when a second argument is given.
+func (h *ActionHandler) setModel(svc *lsp.Service, msg *lsp.JSONRPCMessage, args []string) {
+	name := h.registry.Selected(svc.Context())
+	if len(args) == 0 {
+		h.replyError(svc, msg, fmt.Errorf("usage: %s <model> [chat model] (current: %s)", setModelCommand, h.describeProvider(svc.Context(), name)))
+		return
+	}
+	if sessionSelection(svc) == nil {
+		h.replyError(svc, msg, errNoSelection)
+		return
+	}
+
+	chatModel := ""
+	if len(args) > 1 {
+		chatModel = args[1]
+	}
+
+	if err := h.registry.Select(svc.Context(), name, args[0], chatModel); err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+
+	h.reply(svc, msg, "Using "+h.describeProvider(svc.Context(), name))
+}
+
+// listModels shows the models the session's provider serves, as candidates
+// for setModel.
+func (h *ActionHandler) listModels(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	ctx, cancel := context.WithTimeout(svc.Context(), time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
+	defer cancel()
+
+	models, err := h.registry.ListModels(ctx)
+	if err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+
+	name := h.registry.Selected(ctx)
+	if len(models) == 0 {
+		h.reply(svc, msg, "No models available from "+name)
+		return
+	}
+
+	message := fmt.Sprintf("Models available from %s:\n%s", h.describeProvider(ctx, name), strings.Join(models, "\n"))
+	svc.Logger.Log(message)
+	svc.SendShowMessage(lsp.MessageTypeInfo, message)
+	if msg.ID != nil {
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: models})
+	}
+}
+
+func (h *ActionHandler) describeProvider(ctx context.Context, name string) string {
+	model, chatModel, err := h.registry.SelectedModels(ctx, name)
+	if err != nil {
+		return name
+	}
+	if model == chatModel {
+		return fmt.Sprintf("%s (%s)", name, model)
+	}
+	return fmt.Sprintf("%s (%s, chat: %s)", name, model, chatModel)
+}
+
+// reply shows message and returns it as the command result.
+func (h *ActionHandler) reply(svc *lsp.Service, msg *lsp.JSONRPCMessage, result any) {
+	if message, ok := result.(string); ok {
+		svc.Logger.Log(message)
+		svc.SendShowMessage(lsp.MessageTypeInfo, message)
+	}
+	if msg.ID != nil {
+		svc.Send(&lsp.JSONRPCMessage{ID: msg.ID, Result: result})
+	}
+}
+
+func (h *ActionHandler) replyError(svc *lsp.Service, msg *lsp.JSONRPCMessage, err error) {
+	svc.Logger.Log("executeCommand failed:", err.Error())
+	svc.SendShowMessage(lsp.MessageTypeError, err.Error())
+	if msg.ID != nil {
+		svc.Send(&lsp.JSONRPCMessage{
+			ID:    msg.ID,
+			Error: &lsp.RPCError{Code: lsp.ErrorCodeRequestFailed, Message: err.Error()},
+		})
+	}
+}
+
+// stringArgs converts command arguments to strings, skipping empty ones.
+func stringArgs(args []any) []string {
+	values := make([]string, 0, len(args))
+	for _, arg := range args {
+		value := strings.TrimSpace(fmt.Sprint(arg))
+		if arg != nil && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+var identifierRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// declarationRe captures names introduced by common declaration forms across
+// the languages Helix users typically pair with helix-assist.
+var declarationRe = regexp.MustCompile(`(?m)(?:\b(?:func|var|const|let|type|def|class|fn|struct|enum|interface|trait|val)\s+(?:\([^)]*\)\s*)?(?:mut\s+)?([A-Za-z_][A-Za-z0-9_]*))|(?:^\s*([A-Za-z_][A-Za-z0-9_]*(?:\s*,\s*[A-Za-z_][A-Za-z0-9_]*)*)\s*:=)`)
+
+// minLocalPrefix is the shortest typed word that is matched against local
+// symbols; shorter prefixes match too much to mean anything.
+const minLocalPrefix = 3
+
+// symbolIndex is a cheap identifier index of one buffer version.
+type symbolIndex struct {
+	words    map[string]int
+	declared map[string]bool
+}
+
+func buildSymbolIndex(text string) *symbolIndex {
+	idx := &symbolIndex{
+		words:    make(map[string]int),
+		declared: make(map[string]bool),
+	}
+
+	for _, ident := range identifierRe.FindAllString(text, -1) {
+		idx.words[ident]++
+	}
+
+	for _, match := range declarationRe.FindAllStringSubmatch(text, -1) {
+		for _, group := range match[1:] {
+			for _, name := range strings.Split(group, ",") {
+				if name = strings.TrimSpace(name); name != "" && name != "_" {
+					idx.declared[name] = true
+				}
+			}
+		}
+	}
+
+	return idx
+}
+
+// has reports whether ident occurs in the buffer.
+func (idx *symbolIndex) has(ident string) bool {
+	return idx.words[ident] > 0
+}
+
+// matchesPrefix reports whether the word being typed is the prefix of any
+// identifier already in the buffer.
+func (idx *symbolIndex) matchesPrefix(word string) bool {
+	if len(word) < minLocalPrefix {
+		return false
+	}
+
+	for ident, count := range idx.words {
+		// The partially typed word itself is in the buffer once.
+		if ident == word && count == 1 {
+			continue
+		}
+		if strings.HasPrefix(ident, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTypingLocal reports whether the word being typed is clearly heading for a
+// name declared in the buffer, which word-based completion already handles.
+func (idx *symbolIndex) isTypingLocal(word string) bool {
+	if len(word) < minLocalPrefix {
+		return false
+	}
+
+	for name := range idx.declared {
+		if len(name) > len(word) && strings.HasPrefix(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// symbolCache keeps one index per open buffer, rebuilt when its version changes.
+type symbolCache struct {
+	mu      sync.Mutex
+	entries map[string]symbolCacheEntry
+}
+
+type symbolCacheEntry struct {
+	version int
+	index   *symbolIndex
+}
+
+func newSymbolCache() *symbolCache {
+	return &symbolCache{entries: make(map[string]symbolCacheEntry)}
+}
+
+func (c *symbolCache) get(buffer *lsp.Buffer) *symbolIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[buffer.URI]; ok && entry.version == buffer.Version {
+		return entry.index
+	}
+
+	idx := buildSymbolIndex(buffer.Text)
+	c.entries[buffer.URI] = symbolCacheEntry{version: buffer.Version, index: idx}
+	return idx
+}
+
+// currentWord returns the identifier characters immediately before the cursor.
+func currentWord(lastLine string) string {
+	i := len(lastLine)
+	for i > 0 && isIdentByte(lastLine[i-1]) {
+		i--
+	}
+	return lastLine[i:]
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+const (
+	exportTranscriptCommand = "helix-assist.exportTranscript"
+	importTranscriptCommand = "helix-assist.importTranscript"
+)
+
+const (
+	// maxTranscriptEntries bounds the in-memory transcript.
+	maxTranscriptEntries = 200
+	// conversationExchanges is how many of the latest exchanges of a
+	// continued conversation are sent along with each action.
+	conversationExchanges = 6
+	// transcriptDir holds exports without an explicit path, relative to the
+	// workspace root.
+	transcriptDir = ".helix-assist/transcripts"
+)
+
+// transcriptEntry is one code action: what was asked and what came back.
+type transcriptEntry struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	File     string    `json:"file,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+}
+
+// transcriptFile is the JSON export format, read back by import.
+type transcriptFile struct {
+	Exported time.Time         `json:"exported"`
+	Entries  []transcriptEntry `json:"entries"`
+}
+
+// transcript records the actions of this session. Once a previous session
+// is imported, the conversation continues: its latest exchanges are sent as
+// context with every following action.
+type transcript struct {
+	mu         sync.Mutex
+	entries    []transcriptEntry
+	continuing bool
+}
+
+func newTranscript() *transcript {
+	return &transcript{}
+}
+
+func (t *transcript) record(entry transcriptEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = append(t.entries, entry)
+	if len(t.entries) > maxTranscriptEntries {
+		t.entries = t.entries[len(t.entries)-maxTranscriptEntries:]
+	}
+}
+
+func (t *transcript) snapshot() []transcriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]transcriptEntry(nil), t.entries...)
+}
+
+// conversation returns the latest exchanges to carry into the next
+// request, or nil when no earlier conversation is being continued.
+func (t *transcript) conversation() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.continuing {
+		return nil
+	}
+
+	recent := t.entries[max(len(t.entries)-conversationExchanges, 0):]
+	exchanges := make([]string, len(recent))
+	for i, entry := range recent {
+		exchanges[i] = fmt.Sprintf("User (%s):\n%s\n\nAssistant:\n%s", entry.Command, entry.Prompt, entry.Response)
+	}
+	return exchanges
+}
+
+// export writes the transcript to path, as JSON when the extension is
+// .json and as markdown otherwise.
+func (t *transcript) export(path string) error {
+	entries := t.snapshot()
+	if len(entries) == 0 {
+		return fmt.Errorf("nothing to export yet")
+	}
+
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		data, err = json.MarshalIndent(transcriptFile{Exported: time.Now(), Entries: entries}, "", "  ")
+		if err != nil {
+			return err
+		}
+	} else {
+		data = []byte(transcriptMarkdown(entries))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// load replaces the transcript with an export, JSON or markdown, and
+// continues that conversation.
+func (t *transcript) load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []transcriptEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var file transcriptFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return 0, fmt.Errorf("%s is not a JSON transcript export: %w", path, err)
+		}
+		entries = file.Entries
+	} else if entries, err = parseTranscriptMarkdown(string(data)); err != nil {
+		return 0, fmt.Errorf("%s is not a markdown transcript export: %w", path, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = entries
+	t.continuing = true
+	return len(entries), nil
+}
+
+func transcriptMarkdown(entries []transcriptEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# helix-assist transcript\n\nExported %s.\n", time.Now().Format("2006-01-02 15:04"))
+
+	for i, entry := range entries {
+		fmt.Fprintf(&b, "\n## %d. %s", i+1, entry.Command)
+		if entry.File != "" {
+			fmt.Fprintf(&b, " in `%s`", entry.File)
+		}
+		fmt.Fprintf(&b, "\n\n_%s, %s_\n", entry.Time.Format("2006-01-02 15:04:05"), cmp.Or(entry.Provider, "unknown provider"))
+		fmt.Fprintf(&b, "\n### Prompt\n\n%s\n%s\n%s\n", fence(entry.Prompt), entry.Prompt, fence(entry.Prompt))
+		fmt.Fprintf(&b, "\n### Response\n\n%s\n%s\n%s\n", fence(entry.Response), entry.Response, fence(entry.Response))
+	}
+	return b.String()
+}
+
+// parseTranscriptMarkdown reads back the entries transcriptMarkdown wrote.
+func parseTranscriptMarkdown(text string) ([]transcriptEntry, error) {
+	lines := strings.Split(text, "\n")
+	var entries []transcriptEntry
+	for i := 0; i < len(lines); {
+		heading, ok := strings.CutPrefix(lines[i], "## ")
+		if !ok {
+			i++
+			continue
+		}
+		_, heading, ok = strings.Cut(heading, ". ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: heading without a number", i+1)
+		}
+
+		var entry transcriptEntry
+		entry.Command = heading
+		if command, file, ok := strings.Cut(heading, " in `"); ok && strings.HasSuffix(file, "`") {
+			entry.Command, entry.File = command, strings.TrimSuffix(file, "`")
+		}
+
+		// The heading is followed by a blank line and the time and provider.
+		if i+2 >= len(lines) {
+			return nil, fmt.Errorf("line %d: %s without its time and provider", i+1, entry.Command)
+		}
+		meta := strings.TrimSuffix(strings.TrimPrefix(lines[i+2], "_"), "_")
+		when, provider, _ := strings.Cut(meta, ", ")
+		stamp, err := time.ParseInLocation("2006-01-02 15:04:05", when, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+3, err)
+		}
+		entry.Time = stamp
+		if provider != "unknown provider" {
+			entry.Provider = provider
+		}
+
+		i += 3
+		if entry.Prompt, i, err = fencedSection(lines, i, "### Prompt"); err != nil {
+			return nil, err
+		}
+		if entry.Response, i, err = fencedSection(lines, i, "### Response"); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entries")
+	}
+	return entries, nil
+}
+
+// fencedSection reads the code block under the next heading, starting at
+// line i, and returns its text and the line after its closing fence.
+func fencedSection(lines []string, i int, heading string) (string, int, error) {
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i+2 >= len(lines) || lines[i] != heading || lines[i+1] != "" || !strings.HasPrefix(lines[i+2], "```") {
+		return "", i, fmt.Errorf("line %d: want %s and a code block", i+1, heading)
+	}
+
+	open := lines[i+2]
+	for end := i + 3; end < len(lines); end++ {
+		if lines[end] == open {
+			return strings.Join(lines[i+3:end], "\n"), end + 1, nil
+		}
+	}
+	return "", i, fmt.Errorf("line %d: unterminated code block", i+3)
+}
+
+// fence returns a code fence longer than any backtick run in text.
+func fence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// exportTranscript writes the session transcript to the given path, or to a
+// timestamped markdown file under the workspace's transcript directory.
+func (h *ActionHandler) exportTranscript(svc *lsp.Service, msg *lsp.JSONRPCMessage, args []string) {
+	path := filepath.Join(svc.RootPath(), transcriptDir, time.Now().Format("2006-01-02-150405")+".md")
+	if len(args) > 0 {
+		path = h.workspacePath(svc, args[0])
+	}
+
+	if err := h.transcript.export(path); err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+	h.reply(svc, msg, "Transcript exported to "+path)
+}
+
+// importTranscript loads an export so following actions continue that
+// conversation.
+func (h *ActionHandler) importTranscript(svc *lsp.Service, msg *lsp.JSONRPCMessage, args []string) {
+	if len(args) == 0 {
+		h.replyError(svc, msg, fmt.Errorf("usage: %s <transcript.md or .json>", importTranscriptCommand))
+		return
+	}
+
+	n, err := h.transcript.load(h.workspacePath(svc, args[0]))
+	if err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+	h.reply(svc, msg, fmt.Sprintf("Imported %d exchanges, continuing the conversation", n))
+}
+
+func (h *ActionHandler) workspacePath(svc *lsp.Service, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(svc.RootPath(), path)
+}
+
+// relativePath shows a document URI relative to the workspace root.
+func relativePath(root, uri string) string {
+	path := strings.TrimPrefix(uri, "file://")
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 4, 10, 11, 12, 0, time.Local)
+	entries := []transcriptEntry{
+		{Time: at, Command: "explainCode", File: "internal/x.go", Provider: "openai", Prompt: "What does\n```go\nx()\n```\ndo?", Response: "It calls x.\n"},
+		{Time: at.Add(time.Minute), Command: "reviewCode", Prompt: "", Response: "## Not a heading\n\n### Prompt\n"},
+		{Time: at.Add(2 * time.Minute), Command: "fixComplete", File: "a b.go", Provider: "ollama", Prompt: "fix\n\n", Response: "````"},
+	}
+
+	for _, name := range []string{"session.md", "session.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			exported := newTranscript()
+			for _, entry := range entries {
+				exported.record(entry)
+			}
+			if err := exported.export(path); err != nil {
+				t.Fatal(err)
+			}
+
+			imported := newTranscript()
+			n, err := imported.load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := imported.snapshot()
+			if n != len(entries) || len(got) != len(entries) {
+				t.Fatalf("imported %d entries, want %d", n, len(entries))
+			}
+			for i := range entries {
+				if !got[i].Time.Equal(entries[i].Time) {
+					t.Errorf("entry %d time %v, want %v", i, got[i].Time, entries[i].Time)
+				}
+				got[i].Time = entries[i].Time
+				if got[i] != entries[i] {
+					t.Errorf("entry %d:\ngot  %+v\nwant %+v", i, got[i], entries[i])
+				}
+			}
+			if len(imported.conversation()) == 0 {
+				t.Error("import does not continue the conversation")
+			}
+		})
+	}
+}
+
+func TestTranscriptLoadRejects(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"notes.md":       "# Notes\n\nNothing exported here.\n",
+		"unclosed.md":    "## 1. explainCode\n\n_2026-03-04 10:11:12, openai_\n\n### Prompt\n\n```\nhi\n",
+		"broken.json":    "{",
+		"no response.md": "## 1. explainCode\n\n_2026-03-04 10:11:12, openai_\n\n### Prompt\n\n```\nhi\n```\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		tr := newTranscript()
+		if _, err := tr.load(path); err == nil {
+			t.Errorf("%s loaded: %v", name, tr.snapshot())
+		}
+		if len(tr.snapshot()) != 0 {
+			t.Errorf("%s replaced the transcript", name)
+		}
+	}
+}
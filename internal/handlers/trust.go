@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// setTrustCommand shows the trust level of the current workspace, or sets it
+// when given one.
+const setTrustCommand = "helix-assist.setTrust"
+
+// TrustLevel is how far a workspace is trusted with helix-assist features.
+type TrustLevel string
+
+const (
+	// TrustTrusted allows everything.
+	TrustTrusted TrustLevel = "trusted"
+	// TrustRestricted keeps cloud providers but ignores content the workspace
+	// supplies itself: project instructions, API hints and templates.
+	TrustRestricted TrustLevel = "restricted"
+	// TrustUntrusted additionally limits requests to self-hosted providers.
+	TrustUntrusted TrustLevel = "untrusted"
+)
+
+func parseTrustLevel(s string) (TrustLevel, error) {
+	switch level := TrustLevel(s); level {
+	case TrustTrusted, TrustRestricted, TrustUntrusted:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown trust level %q (want %s, %s or %s)", s, TrustTrusted, TrustRestricted, TrustUntrusted)
+}
+
+// allowsCloudProviders reports whether requests may leave the user's own
+// infrastructure.
+func (l TrustLevel) allowsCloudProviders() bool {
+	return l != TrustUntrusted
+}
+
+// allowsWorkspaceContent reports whether files from the workspace may shape
+// prompts and generated files.
+func (l TrustLevel) allowsWorkspaceContent() bool {
+	return l == TrustTrusted
+}
+
+// AllowsExternalCommands reports whether helix-assist may run programs on
+// behalf of the workspace.
+func (l TrustLevel) AllowsExternalCommands() bool {
+	return l == TrustTrusted
+}
+
+// WorkspaceTrust holds the trust level of each workspace root. Levels set
+// with the setTrust command are stored in the user config directory, so a
+// workspace keeps its level across sessions; others get the configured
+// default.
+type WorkspaceTrust struct {
+	fallback TrustLevel
+	path     string
+
+	mu     sync.Mutex
+	levels map[string]TrustLevel
+}
+
+func NewWorkspaceTrust(cfg *config.Config) *WorkspaceTrust {
+	t := &WorkspaceTrust{
+		fallback: TrustLevel(cfg.WorkspaceTrust),
+		levels:   map[string]TrustLevel{},
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		t.path = filepath.Join(configDir, "helix-assist", "trust.json")
+		if data, err := os.ReadFile(t.path); err == nil {
+			// A corrupt file falls back to the default for every workspace.
+			_ = json.Unmarshal(data, &t.levels)
+		}
+	}
+	return t
+}
+
+// Level returns the trust level of the workspace at root.
+func (t *WorkspaceTrust) Level(root string) TrustLevel {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if level, ok := t.levels[trustKey(root)]; ok {
+		return level
+	}
+	return t.fallback
+}
+
+// Set stores level for the workspace at root.
+func (t *WorkspaceTrust) Set(root string, level TrustLevel) error {
+	if root == "" {
+		return errors.New("no workspace root to set a trust level for")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.levels[trustKey(root)] = level
+	if t.path == "" {
+		return errors.New("no user config directory; the trust level lasts for this session only")
+	}
+
+	data, err := json.MarshalIndent(t.levels, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0o600)
+}
+
+// PermitProvider refuses cloud providers in workspaces that do not allow
+// them. It is installed as the registry policy.
+func (t *WorkspaceTrust) PermitProvider(root, name string) error {
+	if level := t.Level(root); !level.allowsCloudProviders() && !providers.IsSelfHosted(name) {
+		return &providers.ProviderError{
+			Kind:    providers.ErrorKindRefused,
+			Message: fmt.Sprintf("%s is a cloud provider and this workspace is %s", name, level),
+		}
+	}
+	return nil
+}
+
+func trustKey(root string) string {
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return filepath.Clean(root)
+}
+
+func (h *ActionHandler) setTrust(svc *lsp.Service, msg *lsp.JSONRPCMessage, args []string) {
+	root := svc.RootPath()
+	if len(args) == 0 {
+		h.reply(svc, msg, fmt.Sprintf("Workspace %s is %s", root, h.trust.Level(root)))
+		return
+	}
+
+	level, err := parseTrustLevel(args[0])
+	if err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+	if err := h.trust.Set(root, level); err != nil {
+		h.replyError(svc, msg, err)
+		return
+	}
+	h.reply(svc, msg, fmt.Sprintf("Workspace %s is now %s", root, level))
+}
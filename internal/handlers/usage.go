@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// usageCommand reports token usage and estimated cost. It takes no
+// arguments, so it can be run with :lsp-workspace-command.
+const usageCommand = "helix-assist.usage"
+
+// showUsage reports the usage of the whole process, or for a user of a
+// shared server only their own.
+func (h *ActionHandler) showUsage(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+	if account := providers.AccountOf(svc.Context()); account != nil {
+		h.reply(svc, msg, account.Usage().Summary())
+		return
+	}
+	h.reply(svc, msg, h.registry.Usage().Summary())
+}
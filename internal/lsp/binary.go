@@ -0,0 +1,37 @@
+package lsp
+
+import (
+	"unicode/utf8"
+)
+
+// binarySample is how much of a document is inspected for binary content,
+// the same amount git looks at.
+const binarySample = 8000
+
+// LooksBinary reports whether text appears to be binary rather than source:
+// it contains a NUL byte, or over a tenth of its start is control
+// characters or bytes that are not UTF-8. The editor may have decoded
+// invalid bytes to U+FFFD before sending the document, so those count too.
+func LooksBinary(text string) bool {
+	sample := text[:min(len(text), binarySample)]
+
+	odd, total := 0, 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRuneInString(sample[i:])
+		i += size
+		total++
+
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError:
+			// A rune cut off at the end of the sample is not evidence.
+			if i < len(sample) || size > 1 {
+				odd++
+			}
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\v' && r != 0x1b:
+			odd++
+		}
+	}
+	return total > 0 && odd*10 > total
+}
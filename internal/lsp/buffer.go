@@ -10,12 +10,18 @@ type Buffer struct {
 	Text       string
 	Version    int
 	LanguageID string
+	// Binary is set for documents that do not look like text. They are
+	// ignored by every AI feature.
+	Binary bool
 }
 
 type BufferStore struct {
 	mu         sync.RWMutex
 	buffers    map[string]*Buffer
 	currentURI string
+	onChange   func(uri string, lines int)
+	// encoding is the position encoding agreed with the client.
+	encoding string
 }
 
 func NewBufferStore() *BufferStore {
@@ -60,14 +66,119 @@ func (s *BufferStore) SetCurrentURI(uri string) {
 	s.currentURI = uri
 }
 
-func (s *BufferStore) UpdateText(uri string, version int, text string) {
+// SetPositionEncoding sets the encoding of the positions the client sends
+// and expects.
+func (s *BufferStore) SetPositionEncoding(encoding string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.encoding = encoding
+}
+
+// DecodeRange converts a range from the client to a byte-based range in the
+// document at uri.
+func (s *BufferStore) DecodeRange(uri string, r Range) Range {
+	text, encoding := s.textAndEncoding(uri)
+	return DecodeRange(text, r, encoding)
+}
+
+// DecodePosition is DecodeRange for a position.
+func (s *BufferStore) DecodePosition(uri string, pos Position) Position {
+	text, encoding := s.textAndEncoding(uri)
+	return DecodePosition(text, pos, encoding)
+}
+
+// EncodeRange converts a byte-based range in the document at uri to the
+// client's encoding.
+func (s *BufferStore) EncodeRange(uri string, r Range) Range {
+	text, encoding := s.textAndEncoding(uri)
+	return EncodeRange(text, r, encoding)
+}
+
+// PositionEncoding returns the encoding agreed with the client.
+func (s *BufferStore) PositionEncoding() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.encoding
+}
+
+func (s *BufferStore) textAndEncoding(uri string) (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if buf, ok := s.buffers[uri]; ok {
-		buf.Text = text
-		buf.Version = version
+		return buf.Text, s.encoding
+	}
+	return "", s.encoding
+}
+
+// SetChangeObserver registers fn to be called after every text update with
+// the number of lines that changed.
+func (s *BufferStore) SetChangeObserver(fn func(uri string, lines int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// ApplyChanges applies the edits of a didChange notification in order:
+// ranged edits replace part of the text, others all of it.
+func (s *BufferStore) ApplyChanges(uri string, version int, changes []ContentChange) {
+	s.mu.Lock()
+	lines := 0
+	if buf, ok := s.buffers[uri]; ok {
+		text := buf.Text
+		for _, change := range changes {
+			text = applyChange(text, change, s.encoding)
+		}
+		lines = changedLines(buf.Text, text)
+		// Buffers are shared with handlers still reading the previous
+		// version, so they are replaced rather than changed.
+		s.buffers[uri] = &Buffer{
+			URI:        buf.URI,
+			Text:       text,
+			Version:    version,
+			LanguageID: buf.LanguageID,
+			Binary:     LooksBinary(text),
+		}
 	}
 	s.currentURI = uri
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	if onChange != nil && lines > 0 {
+		onChange(uri, lines)
+	}
+}
+
+func applyChange(text string, change ContentChange, encoding string) string {
+	if change.Range == nil {
+		return change.Text
+	}
+	r := DecodeRange(text, *change.Range, encoding)
+	start := OffsetAt(text, r.Start)
+	end := max(OffsetAt(text, r.End), start)
+	return text[:start] + change.Text + text[end:]
+}
+
+// changedLines counts the lines that differ between two versions of a
+// document once the common leading and trailing lines are removed.
+func changedLines(before, after string) int {
+	if before == after {
+		return 0
+	}
+
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return max(len(a)-prefix-suffix, len(b)-prefix-suffix)
 }
 
 func (s *BufferStore) Delete(uri string) {
@@ -0,0 +1,55 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ID is a JSON-RPC request id, which clients may send as a number or a
+// string. It keeps the encoding the client used, so responses echo it
+// exactly; IDs are equal when their encodings are.
+type ID struct {
+	raw string
+}
+
+// IntID returns the numeric id n.
+func IntID(n int) *ID {
+	return &ID{raw: strconv.Itoa(n)}
+}
+
+// StringID returns the string id s.
+func StringID(s string) *ID {
+	data, _ := json.Marshal(s)
+	return &ID{raw: string(data)}
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id.raw == "" {
+		return []byte("null"), nil
+	}
+	return []byte(id.raw), nil
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("request id must be a number or a string, got %s", data)
+		}
+	}
+	id.raw = string(data)
+	return nil
+}
+
+// String formats the id for logs: numbers as they are, strings quoted.
+func (id ID) String() string {
+	return id.raw
+}
@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// OffsetAt converts a position to a byte offset in text, clamped to the
+// text.
+func OffsetAt(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	lineEnd := len(text)
+	if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+		lineEnd = offset + i
+	}
+	return min(offset+max(pos.Character, 0), lineEnd)
+}
+
+// PositionAt converts a byte offset in text to a position.
+func PositionAt(text string, offset int) Position {
+	before := text[:offset]
+	line := strings.Count(before, "\n")
+	return Position{Line: line, Character: offset - (strings.LastIndexByte(before, '\n') + 1)}
+}
+
+// Position encodings, the units Position.Character is counted in. The
+// server works with byte offsets, UTF-8, throughout; positions exchanged
+// with a client that counts UTF-16 code units are converted with
+// DecodePosition and EncodePosition at the boundary.
+const (
+	PositionEncodingUTF8  = "utf-8"
+	PositionEncodingUTF16 = "utf-16"
+)
+
+// NegotiatePositionEncoding picks UTF-8 when the client offers it, and
+// otherwise UTF-16, which every client supports.
+func NegotiatePositionEncoding(offered []string) string {
+	if slices.Contains(offered, PositionEncodingUTF8) {
+		return PositionEncodingUTF8
+	}
+	return PositionEncodingUTF16
+}
+
+// DecodePosition converts pos, counted in encoding, to a byte-based
+// position in text. Characters past the end of the line are clamped to it.
+func DecodePosition(text string, pos Position, encoding string) Position {
+	if encoding != PositionEncodingUTF16 {
+		return pos
+	}
+	line := lineAt(text, pos.Line)
+	offset, units := 0, 0
+	for offset < len(line) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(line[offset:])
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return Position{Line: pos.Line, Character: offset}
+}
+
+// EncodePosition converts a byte-based position in text to one counted in
+// encoding.
+func EncodePosition(text string, pos Position, encoding string) Position {
+	if encoding != PositionEncodingUTF16 {
+		return pos
+	}
+	line := lineAt(text, pos.Line)
+	units := 0
+	for _, r := range line[:min(max(pos.Character, 0), len(line))] {
+		units += utf16.RuneLen(r)
+	}
+	return Position{Line: pos.Line, Character: units}
+}
+
+func DecodeRange(text string, r Range, encoding string) Range {
+	return Range{Start: DecodePosition(text, r.Start, encoding), End: DecodePosition(text, r.End, encoding)}
+}
+
+func EncodeRange(text string, r Range, encoding string) Range {
+	return Range{Start: EncodePosition(text, r.Start, encoding), End: EncodePosition(text, r.End, encoding)}
+}
+
+// lineAt returns line n of text, or "" past its end.
+func lineAt(text string, n int) string {
+	for ; n > 0; n-- {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			return ""
+		}
+		text = text[i+1:]
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return text
+}
@@ -2,17 +2,25 @@ package lsp
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxLogArg bounds each logged value, so a document of minified code does
+// not write megabytes to the log per message.
+const maxLogArg = 16 * 1024
+
 type Logger struct {
 	mu      sync.Mutex
 	file    *os.File
@@ -72,13 +80,20 @@ func (l *Logger) Log(args ...any) {
 	parts = append(parts, "APP", time.Now().Format(time.RFC3339), "-->")
 
 	for _, arg := range args {
-		parts = append(parts, fmt.Sprintf("%v", arg))
+		text := fmt.Sprintf("%v", arg)
+		if len(text) > maxLogArg {
+			text = fmt.Sprintf("%s… (%d more bytes)", strings.ToValidUTF8(text[:maxLogArg], ""), len(text)-maxLogArg)
+		}
+		parts = append(parts, text)
 	}
 
 	l.file.WriteString(strings.Join(parts, " ") + "\n\n")
 }
 
 func (l *Logger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = false
 	if l.file != nil {
 		l.file.Close()
 	}
@@ -96,29 +111,124 @@ type Service struct {
 	writeMu      sync.Mutex
 	stdin        io.Reader
 	stdout       io.Writer
+
+	nextID    atomic.Int64
+	pendingMu sync.Mutex
+	pending   map[ID]chan *JSONRPCMessage
+
+	cancelMu      sync.Mutex
+	progressAbort map[string]context.CancelFunc
+
+	// rootMu guards what initialize told about the client.
+	rootMu   sync.RWMutex
+	rootPath string
+	client   ClientCapabilities
+
+	diagnosticsMu sync.Mutex
+	diagnostics   map[string]map[string][]Diagnostic
+
+	shutdownOnce  sync.Once
+	shutdownHooks []func()
+	// ctx is the session's context, cancelled on shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// shuttingDown is set by the shutdown request; exit then ends the
+	// process with status 0 rather than 1.
+	shuttingDown atomic.Bool
+	exit         func(code int)
+
+	// trace is the trace level, a Trace* constant.
+	trace atomic.Value
+
+	// authenticate, when set, must accept the initialize request before
+	// the session serves anything else.
+	authenticate  func(ctx context.Context, options json.RawMessage) (context.Context, error)
+	authenticated bool
 }
 
 func NewService(capabilities ServerCapabilities, logger *Logger, version string) *Service {
 	svc := &Service{
-		Buffers:      NewBufferStore(),
-		Capabilities: capabilities,
-		Logger:       logger,
-		Version:      version,
-		handlers:     make(map[string][]EventHandler),
-		stdin:        os.Stdin,
-		stdout:       os.Stdout,
+		Buffers:       NewBufferStore(),
+		Capabilities:  capabilities,
+		Logger:        logger,
+		Version:       version,
+		handlers:      make(map[string][]EventHandler),
+		stdin:         os.Stdin,
+		stdout:        os.Stdout,
+		pending:       make(map[ID]chan *JSONRPCMessage),
+		progressAbort: make(map[string]context.CancelFunc),
+		diagnostics:   make(map[string]map[string][]Diagnostic),
+	}
+	svc.ctx, svc.cancel = context.WithCancel(context.Background())
+	svc.exit = func(code int) {
+		svc.Logger.Close()
+		os.Exit(code)
 	}
 	svc.registerDefaultHandlers()
 	return svc
 }
 
+// SetTransport replaces stdin and stdout as the streams the service reads
+// requests from and writes responses to. It must be called before Start.
+func (s *Service) SetTransport(in io.Reader, out io.Writer) {
+	s.stdin = in
+	s.stdout = out
+}
+
+// SetContext makes the session's context derive from parent, so values it
+// carries reach every request made for the session. It must be called
+// before Start.
+func (s *Service) SetContext(parent context.Context) {
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(parent)
+}
+
+// Context returns the session's context, which requests made on the
+// session's behalf derive from. It is cancelled when the session shuts
+// down, ending whatever the editor left in flight.
+func (s *Service) Context() context.Context {
+	return s.ctx
+}
+
+// SetAuthenticator makes the session serve only editors that fn accepts.
+// fn gets the session's context and the initializationOptions of the
+// initialize request, and returns the context, derived from the one it
+// got, that the session continues with. Until then requests are refused
+// and notifications dropped; a refused initialize ends the session. It
+// must be called before Start.
+func (s *Service) SetAuthenticator(fn func(ctx context.Context, options json.RawMessage) (context.Context, error)) {
+	s.authenticate = fn
+}
+
+// SetExitHandler replaces ending the process as what the exit
+// notification does, for a service sharing its process with others. fn
+// gets the status the process would have exited with.
+func (s *Service) SetExitHandler(fn func(code int)) {
+	s.exit = fn
+}
+
 func (s *Service) registerDefaultHandlers() {
 	s.On(EventInitialize, func(svc *Service, msg *JSONRPCMessage) {
+		var params InitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			svc.rootMu.Lock()
+			if params.RootURI != "" {
+				svc.rootPath = strings.TrimPrefix(params.RootURI, "file://")
+			}
+			svc.client = params.Capabilities
+			svc.rootMu.Unlock()
+			svc.SetTrace(params.Trace)
+		}
+
+		capabilities := svc.Capabilities
+		capabilities.PositionEncoding = NegotiatePositionEncoding(params.Capabilities.General.PositionEncodings)
+		svc.Buffers.SetPositionEncoding(capabilities.PositionEncoding)
+
 		svc.Send(&JSONRPCMessage{
 			JSONRPC: "2.0",
 			ID:      msg.ID,
 			Result: InitializeResult{
-				Capabilities: svc.Capabilities,
+				Capabilities: capabilities,
 			},
 		})
 	})
@@ -128,57 +238,107 @@ func (s *Service) registerDefaultHandlers() {
 		svc.SendShowMessage(MessageTypeInfo, "helix-assist ("+svc.Version+") has started")
 	})
 
-	s.On(EventDidOpen, func(svc *Service, msg *JSONRPCMessage) {
-		var params DidOpenParams
+	s.On(EventShutdown, func(svc *Service, msg *JSONRPCMessage) {
+		svc.Logger.Log("received shutdown request")
+		svc.shuttingDown.Store(true)
+		svc.Shutdown()
+
+		if msg.ID != nil {
+			svc.Send(&JSONRPCMessage{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Result:  map[string]any{}, // Empty map instead of nil so it's included in JSON
+			})
+		}
+	})
+
+	s.On(EventSetTrace, func(svc *Service, msg *JSONRPCMessage) {
+		var params SetTraceParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("didOpen parse error:", err.Error())
+			svc.Logger.Log("setTrace parse error:", err.Error())
 			return
 		}
-
-		svc.Buffers.Set(&Buffer{
-			URI:        params.TextDocument.URI,
-			Text:       params.TextDocument.Text,
-			LanguageID: params.TextDocument.LanguageID,
-			Version:    params.TextDocument.Version,
-		})
-
-		svc.Logger.Log("received didOpen", "language:", params.TextDocument.LanguageID)
+		svc.SetTrace(params.Value)
 	})
 
-	s.On(EventDidChange, func(svc *Service, msg *JSONRPCMessage) {
-		var params DidChangeParams
+	s.On(EventWorkDoneProgressCancel, func(svc *Service, msg *JSONRPCMessage) {
+		var params WorkDoneProgressCancelParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("didChange parse error:", err.Error())
+			svc.Logger.Log("workDoneProgress/cancel parse error:", err.Error())
 			return
 		}
 
-		if len(params.ContentChanges) > 0 {
-			svc.Buffers.UpdateText(
-				params.TextDocument.URI,
-				params.TextDocument.Version,
-				params.ContentChanges[0].Text,
-			)
+		svc.cancelMu.Lock()
+		cancel, ok := svc.progressAbort[params.Token]
+		svc.cancelMu.Unlock()
+
+		if ok {
+			svc.Logger.Log("progress cancelled by client:", params.Token)
+			cancel()
 		}
+	})
 
-		svc.Logger.Log("received didChange", "version:", params.TextDocument.Version, "uri:", params.TextDocument.URI)
+	s.On(EventExit, func(svc *Service, msg *JSONRPCMessage) {
+		code := 0
+		if !svc.shuttingDown.Load() {
+			// The client went away without asking to shut down first.
+			code = 1
+		}
+		svc.Shutdown()
+		svc.Logger.Log("received exit notification, exiting with status", code)
+		svc.exit(code)
 	})
+}
 
-	s.On(EventShutdown, func(svc *Service, msg *JSONRPCMessage) {
-		svc.Logger.Log("received shutdown request")
+// OnShutdown registers fn to run when the server shuts down: on the
+// shutdown request, before it is answered, or on exit or the end of input
+// without one.
+func (s *Service) OnShutdown(fn func()) {
+	s.handlerMu.Lock()
+	defer s.handlerMu.Unlock()
+	s.shutdownHooks = append(s.shutdownHooks, fn)
+}
 
-		if msg.ID != nil {
-			svc.Send(&JSONRPCMessage{
-				JSONRPC: "2.0",
-				ID:      msg.ID,
-				Result:  map[string]any{}, // Empty map instead of nil so it's included in JSON
-			})
+// ShutdownRequested reports whether the client sent the shutdown request.
+func (s *Service) ShutdownRequested() bool {
+	return s.shuttingDown.Load()
+}
+
+// Shutdown cancels the session's context, then runs the functions
+// registered with OnShutdown, in order. Only the first call does either.
+func (s *Service) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		s.cancel()
+
+		s.handlerMu.RLock()
+		hooks := s.shutdownHooks
+		s.handlerMu.RUnlock()
+
+		for _, hook := range hooks {
+			hook()
 		}
 	})
+}
 
-	s.On(EventExit, func(svc *Service, msg *JSONRPCMessage) {
-		svc.Logger.Log("received exit notification")
-		os.Exit(0)
-	})
+// ClientCapabilities returns the capabilities the client announced in
+// initialize.
+func (s *Service) ClientCapabilities() ClientCapabilities {
+	s.rootMu.RLock()
+	defer s.rootMu.RUnlock()
+	return s.client
+}
+
+// RootPath returns the workspace root sent in initialize, or the working
+// directory when the client sent none.
+func (s *Service) RootPath() string {
+	s.rootMu.RLock()
+	root := s.rootPath
+	s.rootMu.RUnlock()
+
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+	return root
 }
 
 func (s *Service) On(method string, handler EventHandler) {
@@ -220,6 +380,75 @@ func (s *Service) Send(msg *JSONRPCMessage) {
 	s.writeMu.Unlock()
 
 	s.Logger.Log("sent:", string(data))
+	s.logTrace("Sending", msg, data)
+}
+
+// Call sends a request to the client and waits for its response.
+func (s *Service) Call(ctx context.Context, method string, params any) (*JSONRPCMessage, error) {
+	id := IntID(int(s.nextID.Add(1)))
+	ch := make(chan *JSONRPCMessage, 1)
+
+	s.pendingMu.Lock()
+	s.pending[*id] = ch
+	s.pendingMu.Unlock()
+
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, *id)
+		s.pendingMu.Unlock()
+	}()
+
+	s.Send(&JSONRPCMessage{
+		ID:     id,
+		Method: method,
+		Params: mustMarshal(params),
+	})
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp, fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve delivers a client response to the Call waiting for it.
+func (s *Service) resolve(msg *JSONRPCMessage) {
+	s.pendingMu.Lock()
+	ch, ok := s.pending[*msg.ID]
+	s.pendingMu.Unlock()
+
+	if !ok {
+		s.Logger.Log("response for unknown request id:", *msg.ID)
+		return
+	}
+	ch <- msg
+}
+
+// DecodeResult unmarshals the result of a client response into v.
+func DecodeResult(msg *JSONRPCMessage, v any) error {
+	data, err := json.Marshal(msg.Result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// OnProgressCancel registers cancel to run when the client cancels the
+// progress identified by token. The returned func unregisters it.
+func (s *Service) OnProgressCancel(token string, cancel context.CancelFunc) func() {
+	s.cancelMu.Lock()
+	s.progressAbort[token] = cancel
+	s.cancelMu.Unlock()
+
+	return func() {
+		s.cancelMu.Lock()
+		delete(s.progressAbort, token)
+		s.cancelMu.Unlock()
+	}
 }
 
 func (s *Service) SendDiagnostics(diagnostics []Diagnostic, timeoutMs int) {
@@ -228,42 +457,68 @@ func (s *Service) SendDiagnostics(diagnostics []Diagnostic, timeoutMs int) {
 		return
 	}
 
+	s.PublishDiagnostics(uri, "helix-gpt", diagnostics)
+
+	if timeoutMs > 0 {
+		go func() {
+			time.Sleep(time.Duration(timeoutMs) * time.Millisecond)
+			s.PublishDiagnostics(uri, "helix-gpt", nil)
+		}()
+	}
+}
+
+// PublishDiagnostics replaces the diagnostics from source for uri. The
+// editor keeps one list per document and server, so the lists of every
+// source are published together and replacing one leaves the others.
+func (s *Service) PublishDiagnostics(uri, source string, diagnostics []Diagnostic) {
 	for i := range diagnostics {
-		diagnostics[i].Source = "helix-gpt"
+		diagnostics[i].Source = source
+		diagnostics[i].Range = s.Buffers.EncodeRange(uri, diagnostics[i].Range)
 	}
 
-	s.Logger.Log("sending diagnostics:", len(diagnostics))
+	// Held while sending, so publishes reach the editor in order.
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+
+	sources := s.diagnostics[uri]
+	if sources == nil {
+		sources = make(map[string][]Diagnostic)
+		s.diagnostics[uri] = sources
+	}
+	if len(diagnostics) > 0 {
+		sources[source] = diagnostics
+	} else {
+		delete(sources, source)
+	}
+
+	all := []Diagnostic{}
+	for _, name := range slices.Sorted(maps.Keys(sources)) {
+		all = append(all, sources[name]...)
+	}
+	if len(sources) == 0 {
+		delete(s.diagnostics, uri)
+	}
+
+	s.Logger.Log("sending diagnostics:", len(diagnostics), "from", source)
 
 	s.Send(&JSONRPCMessage{
 		Method: EventPublishDiagnostics,
 		Params: mustMarshal(PublishDiagnosticsParams{
 			URI:         uri,
-			Diagnostics: diagnostics,
+			Diagnostics: all,
 		}),
 	})
-
-	if timeoutMs > 0 {
-		go func() {
-			time.Sleep(time.Duration(timeoutMs) * time.Millisecond)
-			s.Send(&JSONRPCMessage{
-				Method: EventPublishDiagnostics,
-				Params: mustMarshal(PublishDiagnosticsParams{
-					URI:         uri,
-					Diagnostics: []Diagnostic{},
-				}),
-			})
-		}()
-	}
 }
 
-func (s *Service) SendProgressBegin(token, title string) {
+func (s *Service) SendProgressBegin(token, title string, cancellable bool) {
 	s.Send(&JSONRPCMessage{
 		Method: EventProgress,
 		Params: mustMarshal(ProgressParams{
 			Token: token,
 			Value: WorkDoneProgressBegin{
-				Kind:  "begin",
-				Title: title,
+				Kind:        "begin",
+				Title:       title,
+				Cancellable: cancellable,
 			},
 		}),
 	})
@@ -282,18 +537,75 @@ func (s *Service) SendProgressReport(token, message string) {
 	})
 }
 
-func (s *Service) SendProgressEnd(token string) {
+// SendProgressStep reports progress with a completion percentage.
+func (s *Service) SendProgressStep(token, message string, percentage int) {
+	s.Send(&JSONRPCMessage{
+		Method: EventProgress,
+		Params: mustMarshal(ProgressParams{
+			Token: token,
+			Value: WorkDoneProgressReport{
+				Kind:       "report",
+				Message:    message,
+				Percentage: percentage,
+			},
+		}),
+	})
+}
+
+func (s *Service) SendProgressEnd(token, message string) {
 	s.Send(&JSONRPCMessage{
 		Method: EventProgress,
 		Params: mustMarshal(ProgressParams{
 			Token: token,
 			Value: WorkDoneProgressEnd{
-				Kind: "end",
+				Kind:    "end",
+				Message: message,
 			},
 		}),
 	})
 }
 
+// ShowDocument asks the client to open uri, returning an error when the
+// client does not support window/showDocument or refused.
+func (s *Service) ShowDocument(ctx context.Context, uri string, takeFocus bool) error {
+	resp, err := s.Call(ctx, EventShowDocument, ShowDocumentParams{URI: uri, TakeFocus: takeFocus})
+	if err != nil {
+		return err
+	}
+
+	var result ShowDocumentResult
+	if err := DecodeResult(resp, &result); err != nil {
+		return fmt.Errorf("%s: %w", EventShowDocument, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%s: client could not open %s", EventShowDocument, uri)
+	}
+	return nil
+}
+
+// ShowMessageRequest asks the user to pick one of actions and returns the
+// chosen title, or "" when the message was dismissed.
+func (s *Service) ShowMessageRequest(ctx context.Context, msgType MessageType, message string, actions ...string) (string, error) {
+	items := make([]MessageActionItem, len(actions))
+	for i, action := range actions {
+		items[i] = MessageActionItem{Title: action}
+	}
+
+	resp, err := s.Call(ctx, EventShowMessageRequest, ShowMessageRequestParams{Type: msgType, Message: message, Actions: items})
+	if err != nil {
+		return "", err
+	}
+	if resp.Result == nil {
+		return "", nil
+	}
+
+	var item MessageActionItem
+	if err := DecodeResult(resp, &item); err != nil {
+		return "", fmt.Errorf("%s: %w", EventShowMessageRequest, err)
+	}
+	return item.Title, nil
+}
+
 func (s *Service) SendShowMessage(msgType MessageType, message string) {
 	s.Send(&JSONRPCMessage{
 		Method: EventShowMessage,
@@ -349,11 +661,101 @@ func (s *Service) Start() error {
 		if msg.Method != EventDidChange && msg.Method != EventDidOpen {
 			s.Logger.Log("received:", string(content))
 		}
+		s.logTrace("Received", &msg, content)
+
+		if msg.Method == "" && msg.ID != nil {
+			s.resolve(&msg)
+			continue
+		}
+
+		// After shutdown only exit is served.
+		if s.shuttingDown.Load() && msg.Method != EventExit {
+			if msg.ID != nil {
+				s.Send(&JSONRPCMessage{ID: msg.ID, Error: &RPCError{Code: ErrorCodeInvalidRequest, Message: "server is shutting down"}})
+			}
+			continue
+		}
 
+		if s.authenticate != nil && !s.authenticated {
+			if err := s.authenticateClient(&msg); err != nil {
+				return err
+			}
+			if !s.authenticated {
+				continue
+			}
+		}
+
+		s.syncDocument(&msg)
 		s.emit(msg.Method, &msg)
 	}
 }
 
+// authenticateClient checks the initialize request of a session with an
+// authenticator, before any handler runs, and refuses whatever comes
+// before it. The error ends the session.
+func (s *Service) authenticateClient(msg *JSONRPCMessage) error {
+	if msg.Method != EventInitialize {
+		if msg.ID != nil {
+			s.Send(&JSONRPCMessage{ID: msg.ID, Error: &RPCError{Code: ErrorCodeNotInitialized, Message: "server not initialized"}})
+		}
+		return nil
+	}
+
+	var params InitializeParams
+	json.Unmarshal(msg.Params, &params)
+	ctx, err := s.authenticate(s.ctx, params.InitializationOptions)
+	if err != nil {
+		s.Logger.Log("refused editor:", err.Error())
+		s.Send(&JSONRPCMessage{ID: msg.ID, Error: &RPCError{Code: ErrorCodeInvalidRequest, Message: err.Error()}})
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	s.ctx = ctx
+	s.authenticated = true
+	return nil
+}
+
+// syncDocument updates the buffer store for didOpen and didChange before
+// any handler runs. Handlers run concurrently, but incremental edits only
+// apply in the order they were sent.
+func (s *Service) syncDocument(msg *JSONRPCMessage) {
+	switch msg.Method {
+	case EventDidOpen:
+		var params DidOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.Logger.Log("didOpen parse error:", err.Error())
+			return
+		}
+
+		binary := LooksBinary(params.TextDocument.Text)
+		s.Buffers.Set(&Buffer{
+			URI:        params.TextDocument.URI,
+			Text:       params.TextDocument.Text,
+			LanguageID: params.TextDocument.LanguageID,
+			Version:    params.TextDocument.Version,
+			Binary:     binary,
+		})
+
+		if binary {
+			s.Logger.Log("received didOpen", "language:", params.TextDocument.LanguageID, "- binary content, ignoring", params.TextDocument.URI)
+			return
+		}
+		s.Logger.Log("received didOpen", "language:", params.TextDocument.LanguageID)
+
+	case EventDidChange:
+		var params DidChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.Logger.Log("didChange parse error:", err.Error())
+			return
+		}
+
+		if len(params.ContentChanges) > 0 {
+			s.Buffers.ApplyChanges(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges)
+		}
+
+		s.Logger.Log("received didChange", "version:", params.TextDocument.Version, "uri:", params.TextDocument.URI)
+	}
+}
+
 func mustMarshal(v any) json.RawMessage {
 	data, err := json.Marshal(v)
 	if err != nil {
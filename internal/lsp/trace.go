@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Trace levels, set by initialize and $/setTrace.
+const (
+	TraceOff      = "off"
+	TraceMessages = "messages"
+	TraceVerbose  = "verbose"
+)
+
+type SetTraceParams struct {
+	Value string `json:"value"`
+}
+
+type LogTraceParams struct {
+	Message string `json:"message"`
+	Verbose string `json:"verbose,omitempty"`
+}
+
+// SetTrace changes the trace level. Unknown levels turn tracing off.
+func (s *Service) SetTrace(level string) {
+	if level != TraceMessages && level != TraceVerbose {
+		level = TraceOff
+	}
+	s.trace.Store(level)
+}
+
+// logTrace reports a message sent or received to the client with
+// $/logTrace, when tracing is on. data is the message as sent.
+func (s *Service) logTrace(direction string, msg *JSONRPCMessage, data []byte) {
+	level, _ := s.trace.Load().(string)
+	if level != TraceMessages && level != TraceVerbose || msg.Method == EventLogTrace {
+		return
+	}
+
+	var kind string
+	switch {
+	case msg.Method == "":
+		kind = "response"
+	case msg.ID == nil:
+		kind = "notification"
+	default:
+		kind = "request"
+	}
+
+	var name []string
+	if msg.Method != "" {
+		name = append(name, msg.Method)
+	}
+	if msg.ID != nil {
+		name = append(name, fmt.Sprintf("(%s)", msg.ID))
+	}
+
+	params := LogTraceParams{Message: fmt.Sprintf("%s %s '%s'", direction, kind, strings.Join(name, " - "))}
+	if level == TraceVerbose {
+		params.Verbose = string(data)
+	}
+	s.Send(&JSONRPCMessage{Method: EventLogTrace, Params: mustMarshal(params)})
+}
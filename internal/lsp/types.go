@@ -5,8 +5,14 @@ import "encoding/json"
 const (
 	EventDidOpen            = "textDocument/didOpen"
 	EventDidChange          = "textDocument/didChange"
+	EventDidSave            = "textDocument/didSave"
+	EventWillSaveWaitUntil  = "textDocument/willSaveWaitUntil"
 	EventCompletion         = "textDocument/completion"
+	EventCompletionResolve  = "completionItem/resolve"
+	EventInlineCompletion   = "textDocument/inlineCompletion"
 	EventCodeAction         = "textDocument/codeAction"
+	EventCodeLens           = "textDocument/codeLens"
+	EventCodeLensResolve    = "codeLens/resolve"
 	EventApplyEdit          = "workspace/applyEdit"
 	EventExecuteCommand     = "workspace/executeCommand"
 	EventInitialize         = "initialize"
@@ -15,7 +21,17 @@ const (
 	EventExit               = "exit"
 	EventPublishDiagnostics = "textDocument/publishDiagnostics"
 	EventProgress           = "$/progress"
+	EventCancelRequest      = "$/cancelRequest"
 	EventShowMessage        = "window/showMessage"
+	EventSetTrace           = "$/setTrace"
+	EventLogTrace           = "$/logTrace"
+
+	EventWorkDoneProgressCreate = "window/workDoneProgress/create"
+	EventWorkDoneProgressCancel = "window/workDoneProgress/cancel"
+	EventShowDocument           = "window/showDocument"
+	EventShowMessageRequest     = "window/showMessageRequest"
+	EventDidChangeConfiguration = "workspace/didChangeConfiguration"
+	EventConfiguration          = "workspace/configuration"
 )
 
 type WorkDoneProgressBegin struct {
@@ -37,6 +53,34 @@ type WorkDoneProgressEnd struct {
 	Message string `json:"message,omitempty"`
 }
 
+type WorkDoneProgressCreateParams struct {
+	Token string `json:"token"`
+}
+
+type WorkDoneProgressCancelParams struct {
+	Token string `json:"token"`
+}
+
+type MessageActionItem struct {
+	Title string `json:"title"`
+}
+
+type ShowMessageRequestParams struct {
+	Type    MessageType         `json:"type"`
+	Message string              `json:"message"`
+	Actions []MessageActionItem `json:"actions,omitempty"`
+}
+
+type ShowDocumentParams struct {
+	URI       string `json:"uri"`
+	External  bool   `json:"external,omitempty"`
+	TakeFocus bool   `json:"takeFocus,omitempty"`
+}
+
+type ShowDocumentResult struct {
+	Success bool `json:"success"`
+}
+
 type ProgressParams struct {
 	Token string `json:"token"`
 	Value any    `json:"value"`
@@ -60,6 +104,20 @@ const (
 	SeverityHint        DiagnosticSeverity = 4
 )
 
+type CompletionItemKind int
+
+const (
+	CompletionItemKindText     CompletionItemKind = 1
+	CompletionItemKindMethod   CompletionItemKind = 2
+	CompletionItemKindFunction CompletionItemKind = 3
+	CompletionItemKindVariable CompletionItemKind = 6
+	CompletionItemKindClass    CompletionItemKind = 7
+	CompletionItemKindKeyword  CompletionItemKind = 14
+	CompletionItemKindSnippet  CompletionItemKind = 15
+	CompletionItemKindConstant CompletionItemKind = 21
+	CompletionItemKindStruct   CompletionItemKind = 22
+)
+
 type Position struct {
 	Line      int `json:"line"`
 	Character int `json:"character"`
@@ -79,7 +137,7 @@ type Diagnostic struct {
 
 type JSONRPCMessage struct {
 	JSONRPC string          `json:"jsonrpc"`
-	ID      *int            `json:"id,omitempty"`
+	ID      *ID             `json:"id,omitempty"`
 	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  any             `json:"result,omitempty"`
@@ -91,10 +149,92 @@ type RPCError struct {
 	Message string `json:"message"`
 }
 
+// Error codes defined by JSON-RPC and the LSP specification.
+const (
+	ErrorCodeInvalidRequest   = -32600
+	ErrorCodeNotInitialized   = -32002
+	ErrorCodeMethodNotFound   = -32601
+	ErrorCodeInvalidParams    = -32602
+	ErrorCodeRequestFailed    = -32803
+	ErrorCodeRequestCancelled = -32800
+)
+
+// CancelParams are the params of $/cancelRequest.
+type CancelParams struct {
+	ID ID `json:"id"`
+}
+
 type InitializeParams struct {
-	ProcessID    int    `json:"processId"`
-	RootURI      string `json:"rootUri"`
-	Capabilities any    `json:"capabilities"`
+	ProcessID    int                `json:"processId"`
+	RootURI      string             `json:"rootUri"`
+	Capabilities ClientCapabilities `json:"capabilities"`
+	// Trace is the initial trace level.
+	Trace string `json:"trace,omitempty"`
+	// InitializationOptions is the server's section of the editor's
+	// configuration, Helix's `config` key.
+	InitializationOptions json.RawMessage `json:"initializationOptions,omitempty"`
+}
+
+// ClientCapabilities are the editor features the server relies on; others
+// the client sends are ignored.
+type ClientCapabilities struct {
+	General      GeneralClientCapabilities      `json:"general"`
+	Workspace    WorkspaceClientCapabilities    `json:"workspace"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument"`
+	Window       WindowClientCapabilities       `json:"window"`
+}
+
+type WindowClientCapabilities struct {
+	// WorkDoneProgress is whether the client accepts progress tokens
+	// created with window/workDoneProgress/create.
+	WorkDoneProgress bool `json:"workDoneProgress"`
+}
+
+type GeneralClientCapabilities struct {
+	// PositionEncodings are the encodings the client can count positions
+	// in, preferred first.
+	PositionEncodings []string `json:"positionEncodings"`
+}
+
+type TextDocumentClientCapabilities struct {
+	Completion CompletionClientCapabilities `json:"completion"`
+	// InlineCompletion is set when the client requests inline completions.
+	InlineCompletion *struct{} `json:"inlineCompletion,omitempty"`
+}
+
+type CompletionClientCapabilities struct {
+	CompletionItem struct {
+		// SnippetSupport is whether completion text may be a snippet.
+		SnippetSupport bool `json:"snippetSupport"`
+		// DocumentationFormat lists the MarkupContent kinds the client
+		// renders, preferred first.
+		DocumentationFormat []string `json:"documentationFormat"`
+		// ResolveSupport lists the properties the client can fill in
+		// later with completionItem/resolve.
+		ResolveSupport *struct {
+			Properties []string `json:"properties"`
+		} `json:"resolveSupport,omitempty"`
+	} `json:"completionItem"`
+}
+
+type WorkspaceClientCapabilities struct {
+	// Configuration is whether the client answers workspace/configuration.
+	Configuration bool `json:"configuration"`
+	// ApplyEdit is whether the client answers workspace/applyEdit.
+	ApplyEdit     bool `json:"applyEdit"`
+	WorkspaceEdit struct {
+		// DocumentChanges is whether edits may be versioned.
+		DocumentChanges bool `json:"documentChanges"`
+	} `json:"workspaceEdit"`
+}
+
+type ConfigurationParams struct {
+	Items []ConfigurationItem `json:"items"`
+}
+
+type ConfigurationItem struct {
+	ScopeURI string `json:"scopeUri,omitempty"`
+	Section  string `json:"section,omitempty"`
 }
 
 type TextDocumentIdentifier struct {
@@ -122,8 +262,48 @@ type DidOpenParams struct {
 	TextDocument TextDocumentItem `json:"textDocument"`
 }
 
+// Text document sync kinds, advertised as TextDocumentSyncOptions.Change.
+const (
+	TextDocumentSyncFull        = 1
+	TextDocumentSyncIncremental = 2
+)
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool `json:"openClose"`
+	Change    int  `json:"change"`
+	// Save, when set, asks for didSave notifications.
+	Save *SaveOptions `json:"save,omitempty"`
+	// WillSaveWaitUntil asks for willSaveWaitUntil requests, whose edits
+	// the editor applies before writing the file.
+	WillSaveWaitUntil bool `json:"willSaveWaitUntil,omitempty"`
+}
+
+type SaveOptions struct {
+	IncludeText bool `json:"includeText,omitempty"`
+}
+
+// Reasons a document is saved, as sent with willSaveWaitUntil.
+const (
+	SaveReasonManual     = 1
+	SaveReasonAfterDelay = 2
+	SaveReasonFocusOut   = 3
+)
+
+type WillSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Reason       int                    `json:"reason"`
+}
+
+type DidSaveParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Text         *string                `json:"text,omitempty"`
+}
+
+// ContentChange is one edit of a didChange notification. Without a Range,
+// Text is the whole new document.
 type ContentChange struct {
-	Text string `json:"text"`
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
 }
 
 type DidChangeParams struct {
@@ -134,18 +314,56 @@ type DidChangeParams struct {
 type CompletionParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 	Position     Position               `json:"position"`
+	Context      *CompletionContext     `json:"context,omitempty"`
 }
 
+// Completion trigger kinds.
+const (
+	CompletionTriggerInvoked       = 1
+	CompletionTriggerCharacter     = 2
+	CompletionTriggerForIncomplete = 3
+)
+
+// CompletionContext tells how a completion was requested.
+type CompletionContext struct {
+	TriggerKind      int    `json:"triggerKind"`
+	TriggerCharacter string `json:"triggerCharacter,omitempty"`
+}
+
+type DidChangeConfigurationParams struct {
+	Settings json.RawMessage `json:"settings"`
+}
+
+// Completion text formats.
+const (
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+)
+
 type CompletionItem struct {
-	Label               string     `json:"label"`
-	Kind                int        `json:"kind,omitempty"`
-	Detail              string     `json:"detail,omitempty"`
-	InsertText          string     `json:"insertText,omitempty"`
-	InsertTextFormat    int        `json:"insertTextFormat,omitempty"`
-	TextEdit            *TextEdit  `json:"textEdit,omitempty"`
-	SortText            string     `json:"sortText,omitempty"`
-	Preselect           bool       `json:"preselect,omitempty"`
-	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+	Label               string             `json:"label"`
+	Kind                CompletionItemKind `json:"kind,omitempty"`
+	Detail              string             `json:"detail,omitempty"`
+	Documentation       *MarkupContent     `json:"documentation,omitempty"`
+	InsertText          string             `json:"insertText,omitempty"`
+	InsertTextFormat    int                `json:"insertTextFormat,omitempty"`
+	TextEdit            *TextEdit          `json:"textEdit,omitempty"`
+	SortText            string             `json:"sortText,omitempty"`
+	Preselect           bool               `json:"preselect,omitempty"`
+	AdditionalTextEdits []TextEdit         `json:"additionalTextEdits,omitempty"`
+	Data                json.RawMessage    `json:"data,omitempty"`
+}
+
+// Kinds of MarkupContent.
+const (
+	MarkupKindPlainText = "plaintext"
+	MarkupKindMarkdown  = "markdown"
+)
+
+// MarkupContent is documentation text, either "plaintext" or "markdown".
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
 }
 
 type CompletionList struct {
@@ -153,6 +371,22 @@ type CompletionList struct {
 	Items        []CompletionItem `json:"items"`
 }
 
+type InlineCompletionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// InlineCompletionItem is text shown in place at the cursor, replacing
+// Range when set.
+type InlineCompletionItem struct {
+	InsertText string `json:"insertText"`
+	Range      *Range `json:"range,omitempty"`
+}
+
+type InlineCompletionList struct {
+	Items []InlineCompletionItem `json:"items"`
+}
+
 type TextEdit struct {
 	Range   Range  `json:"range"`
 	NewText string `json:"newText"`
@@ -181,6 +415,18 @@ type CodeAction struct {
 	Command     *Command `json:"command,omitempty"`
 }
 
+type CodeLensParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// CodeLens is a command shown above a range. Lenses are sent without their
+// command, carrying Data instead, and resolved when they come into view.
+type CodeLens struct {
+	Range   Range           `json:"range"`
+	Command *Command        `json:"command,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
 type ExecuteCommandParams struct {
 	Command   string `json:"command"`
 	Arguments []any  `json:"arguments"`
@@ -189,10 +435,37 @@ type ExecuteCommandParams struct {
 type CommandArgument struct {
 	Range       Range    `json:"range"`
 	Diagnostics []string `json:"diagnostics,omitempty"`
+	Kind        string   `json:"kind,omitempty"`
+	// Provider and Model optionally route this one command to another
+	// registered provider or model.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// URI is the document to run on, for commands not invoked from the
+	// current document such as code lenses.
+	URI string `json:"uri,omitempty"`
 }
 
+// WorkspaceEdit changes documents either by URI alone, in Changes, or, in
+// DocumentChanges, only if each document is still at the version given.
 type WorkspaceEdit struct {
-	Changes map[string][]TextEdit `json:"changes"`
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []TextDocumentEdit    `json:"documentChanges,omitempty"`
+}
+
+// Edits returns the edits to the document at uri, in either form.
+func (e WorkspaceEdit) Edits(uri string) []TextEdit {
+	edits := e.Changes[uri]
+	for _, change := range e.DocumentChanges {
+		if change.TextDocument.URI == uri {
+			edits = append(edits, change.Edits...)
+		}
+	}
+	return edits
+}
+
+type TextDocumentEdit struct {
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                      `json:"edits"`
 }
 
 type ApplyWorkspaceEditParams struct {
@@ -200,6 +473,11 @@ type ApplyWorkspaceEditParams struct {
 	Edit  WorkspaceEdit `json:"edit"`
 }
 
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
 type PublishDiagnosticsParams struct {
 	URI         string       `json:"uri"`
 	Diagnostics []Diagnostic `json:"diagnostics"`
@@ -211,14 +489,22 @@ type ShowMessageParams struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync       int                    `json:"textDocumentSync"`
-	CompletionProvider     *CompletionOptions     `json:"completionProvider,omitempty"`
-	CodeActionProvider     bool                   `json:"codeActionProvider,omitempty"`
-	ExecuteCommandProvider *ExecuteCommandOptions `json:"executeCommandProvider,omitempty"`
+	PositionEncoding         string                  `json:"positionEncoding,omitempty"`
+	TextDocumentSync         TextDocumentSyncOptions `json:"textDocumentSync"`
+	CompletionProvider       *CompletionOptions      `json:"completionProvider,omitempty"`
+	InlineCompletionProvider bool                    `json:"inlineCompletionProvider,omitempty"`
+	CodeActionProvider       bool                    `json:"codeActionProvider,omitempty"`
+	CodeLensProvider         *CodeLensOptions        `json:"codeLensProvider,omitempty"`
+	ExecuteCommandProvider   *ExecuteCommandOptions  `json:"executeCommandProvider,omitempty"`
 }
 
 type CompletionOptions struct {
 	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+	ResolveProvider   bool     `json:"resolveProvider,omitempty"`
+}
+
+type CodeLensOptions struct {
+	ResolveProvider bool `json:"resolveProvider,omitempty"`
 }
 
 type ExecuteCommandOptions struct {
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+type accountKey struct{}
+
+// Account is a user of a shared server. Requests made for the user go to
+// the providers built with their own credentials in place of the shared
+// providers of the same name, and their usage is counted for them as well
+// as in the registry's total.
+type Account struct {
+	Name      string
+	providers map[string]Provider
+	usage     *UsageTracker
+}
+
+// NewAccount returns the account of the named user with their providers.
+func NewAccount(name string, providers map[string]Provider) *Account {
+	return &Account{Name: name, providers: providers, usage: newUsageTracker()}
+}
+
+// WithAccount returns a context whose requests are made for account.
+func WithAccount(ctx context.Context, account *Account) context.Context {
+	return context.WithValue(ctx, accountKey{}, account)
+}
+
+// AccountOf returns the account ctx carries, or nil.
+func AccountOf(ctx context.Context) *Account {
+	account, _ := ctx.Value(accountKey{}).(*Account)
+	return account
+}
+
+// Usage returns the token usage of the account's requests.
+func (a *Account) Usage() *UsageTracker {
+	return a.usage
+}
+
+// owns reports whether the account has a provider of its own by name.
+func (a *Account) owns(name string) bool {
+	if a == nil {
+		return false
+	}
+	_, ok := a.providers[name]
+	return ok
+}
+
+// lookup returns the named provider for requests made with ctx: the
+// account's own if it has one, else the registry's.
+func (r *Registry) lookup(ctx context.Context, name string) (Provider, bool) {
+	if account := AccountOf(ctx); account != nil {
+		if provider, ok := account.providers[name]; ok {
+			return provider, true
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Available returns the names of the providers requests made with ctx can
+// select, in sorted order.
+func (r *Registry) Available(ctx context.Context) []string {
+	names := r.Names()
+	if account := AccountOf(ctx); account != nil {
+		for name := range maps.Keys(account.providers) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+	}
+	return names
+}
@@ -0,0 +1,21 @@
+package providers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAccountUsage(t *testing.T) {
+	r := NewRegistry()
+	alice := NewAccount("alice", nil)
+
+	recordTokens(r.scoped(WithAccount(context.Background(), alice), "openai"), "gpt-4o", tokenUsage{Prompt: 100, Completion: 10})
+	recordTokens(r.scoped(context.Background(), "openai"), "gpt-4o", tokenUsage{Prompt: 50, Completion: 5})
+
+	if got := r.Usage().Snapshot(); len(got) != 1 || got[0].Requests != 2 || got[0].PromptTokens != 150 {
+		t.Errorf("registry usage %+v, want both requests", got)
+	}
+	if got := alice.Usage().Snapshot(); len(got) != 1 || got[0].Requests != 1 || got[0].PromptTokens != 100 {
+		t.Errorf("alice's usage %+v, want only her request", got)
+	}
+}
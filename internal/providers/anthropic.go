@@ -39,26 +39,31 @@ func NewAnthropicProvider(apiKey, model, chatModel, endpoint string, timeoutMs i
 }
 
 type anthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
 }
 
 type anthropicCacheControl struct {
 	Type string `json:"type"`
 }
 
-type anthropicSystemContent struct {
+// ephemeralCache marks the end of a prompt prefix that Anthropic caches for
+// a few minutes, so later requests sharing the prefix skip reprocessing it.
+var ephemeralCache = &anthropicCacheControl{Type: "ephemeral"}
+
+type anthropicContentBlock struct {
 	Type         string                 `json:"type"`
 	Text         string                 `json:"text"`
 	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 }
 
 type anthropicRequest struct {
-	Model       string                   `json:"model"`
-	MaxTokens   int                      `json:"max_tokens"`
-	System      []anthropicSystemContent `json:"system,omitempty"`
-	Messages    []anthropicMessage       `json:"messages"`
-	Temperature float64                  `json:"temperature,omitempty"`
+	Model       string                  `json:"model"`
+	MaxTokens   int                     `json:"max_tokens"`
+	System      []anthropicContentBlock `json:"system,omitempty"`
+	Messages    []anthropicMessage      `json:"messages"`
+	Temperature float64                 `json:"temperature,omitempty"`
+	Stream      bool                    `json:"stream,omitempty"`
 }
 
 type anthropicResponse struct {
@@ -66,11 +71,65 @@ type anthropicResponse struct {
 		Type string `json:"type"`
 		Text string `json:"text"`
 	} `json:"content"`
+	Usage struct {
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+const (
+	// anthropicCacheChunkLines aligns the cached part of the file to
+	// multiples of this many lines, so it stays identical while the cursor
+	// moves within the chunk.
+	anthropicCacheChunkLines = 64
+	// anthropicMinCacheChars approximates the 1024-token minimum below which
+	// Anthropic ignores a cache breakpoint.
+	anthropicMinCacheChars = 4096
+)
+
+// splitCacheableContext splits the text before the cursor into a stable
+// prefix, ending on a chunk boundary at least one chunk above the cursor,
+// and the rest. The prefix is empty when it would be too short to cache.
+func splitCacheableContext(contentBefore string) (stable, recent string) {
+	lines := strings.SplitAfter(contentBefore, "\n")
+	cut := (len(lines)/anthropicCacheChunkLines - 1) * anthropicCacheChunkLines
+	if cut <= 0 {
+		return "", contentBefore
+	}
+
+	stable = strings.Join(lines[:cut], "")
+	if len(stable) < anthropicMinCacheChars {
+		return "", contentBefore
+	}
+	return stable, contentBefore[len(stable):]
+}
+
+// completionMessage builds the user turn of a completion request. The file
+// far above the cursor rarely changes between keystrokes, so it goes in its
+// own cached block ahead of the part that does.
+func completionMessage(filepath string, req CompletionRequest) anthropicMessage {
+	userPrompt := completionUserPrompt(filepath, req)
+
+	stable, _ := splitCacheableContext(req.ContentBefore)
+	start := strings.Index(userPrompt, req.ContentBefore)
+	if stable == "" || start < 0 {
+		return anthropicMessage{Role: "user", Content: textBlocks(userPrompt)}
+	}
+
+	end := start + len(stable)
+	return anthropicMessage{Role: "user", Content: []anthropicContentBlock{
+		{Type: "text", Text: userPrompt[:end], CacheControl: ephemeralCache},
+		{Type: "text", Text: userPrompt[end:]},
+	}}
+}
+
+func textBlocks(text string) []anthropicContentBlock {
+	return []anthropicContentBlock{{Type: "text", Text: text}}
 }
 
 func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
 	systemPrompt := BuildCompletionSystemPrompt(languageID)
-	userPrompt := BuildCompletionUserPrompt(filepath, req.ContentBefore, req.ContentAfter)
+	message := completionMessage(filepath, req)
 
 	temperature := 0.0
 
@@ -81,21 +140,7 @@ func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionReques
 	results := make([]string, 0, numSuggestions)
 
 	for i := 0; i < numSuggestions; i++ {
-		apiReq := anthropicRequest{
-			Model:     p.model,
-			MaxTokens: 256,
-			System: []anthropicSystemContent{
-				{
-					Type:         "text",
-					Text:         systemPrompt,
-					CacheControl: &anthropicCacheControl{Type: "ephemeral"},
-				},
-			},
-			Temperature: temperature,
-			Messages: []anthropicMessage{
-				{Role: "user", Content: userPrompt},
-			},
-		}
+		apiReq := p.completionRequest(systemPrompt, message, temperature)
 
 		resp, err := p.doRequest(ctx, "/v1/messages", apiReq)
 
@@ -114,6 +159,7 @@ func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionReques
 			}
 			return nil, fmt.Errorf("parse response: %w", err)
 		}
+		p.logCache(apiResp)
 
 		for _, content := range apiResp.Content {
 			if content.Type == "text" && content.Text != "" {
@@ -125,21 +171,48 @@ func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionReques
 	return util.UniqueStrings(results), nil
 }
 
-func (p *AnthropicProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
-	apiReq := anthropicRequest{
+func (p *AnthropicProvider) completionRequest(systemPrompt string, message anthropicMessage, temperature float64) anthropicRequest {
+	return anthropicRequest{
+		Model:     p.model,
+		MaxTokens: 256,
+		System: []anthropicContentBlock{
+			{
+				Type:         "text",
+				Text:         systemPrompt,
+				CacheControl: ephemeralCache,
+			},
+		},
+		Temperature: temperature,
+		Messages:    []anthropicMessage{message},
+	}
+}
+
+func (p *AnthropicProvider) chatRequest(systemPrompt, userPrompt string) anthropicRequest {
+	return anthropicRequest{
 		Model:     p.chatModel,
 		MaxTokens: 8192,
-		System: []anthropicSystemContent{
+		System: []anthropicContentBlock{
 			{
-				Type: "text",
-				Text: systemPrompt,
+				Type:         "text",
+				Text:         systemPrompt,
+				CacheControl: ephemeralCache,
 			},
 		},
 		Temperature: 0.1,
 		Messages: []anthropicMessage{
-			{Role: "user", Content: userPrompt},
+			{Role: "user", Content: textBlocks(userPrompt)},
 		},
 	}
+}
+
+func (p *AnthropicProvider) logCache(resp anthropicResponse) {
+	if resp.Usage.CacheCreationInputTokens > 0 || resp.Usage.CacheReadInputTokens > 0 {
+		p.logger.Log(fmt.Sprintf("Anthropic prompt cache: %d tokens read, %d written", resp.Usage.CacheReadInputTokens, resp.Usage.CacheCreationInputTokens))
+	}
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := p.chatRequest(systemPrompt, userPrompt)
 
 	jsonReq, _ := json.MarshalIndent(apiReq, "", "  ")
 	p.logger.Log("DEBUG [Anthropic Chat]: Request:", string(jsonReq))
@@ -155,6 +228,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, systemPrompt, userPrompt s
 	if err := json.Unmarshal(resp, &apiResp); err != nil {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
+	p.logCache(apiResp)
 
 	if len(apiResp.Content) == 0 {
 		return nil, fmt.Errorf("no completion found")
@@ -178,6 +252,12 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, endpoint string, body
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
+	return withRetry(ctx, func() ([]byte, error) {
+		return p.send(ctx, endpoint, jsonBody)
+	})
+}
+
+func (p *AnthropicProvider) send(ctx context.Context, endpoint string, jsonBody []byte) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
@@ -191,9 +271,9 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, endpoint string, body
 	req.Header.Set("x-api-key", p.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, newRequestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -203,8 +283,126 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, endpoint string, body
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, newResponseError(resp, respBody)
 	}
 
 	return respBody, nil
 }
+
+// Health checks that the API is reachable.
+func (p *AnthropicProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/v1/models", map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
+	})
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens              int `json:"input_tokens"`
+			CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *AnthropicProvider) ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	text, err := p.stream(ctx, p.chatRequest(systemPrompt, userPrompt), onDelta)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return nil, fmt.Errorf("no completion found")
+	}
+	return &ChatResponse{Result: text}, nil
+}
+
+func (p *AnthropicProvider) CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	systemPrompt := BuildCompletionSystemPrompt(languageID)
+	message := completionMessage(filepath, req)
+	return p.stream(ctx, p.completionRequest(systemPrompt, message, 0), onDelta)
+}
+
+// stream sends apiReq to the Messages API with server-sent events and
+// forwards the text deltas. Input tokens arrive with message_start and
+// output tokens with message_delta.
+func (p *AnthropicProvider) stream(ctx context.Context, apiReq anthropicRequest, onDelta StreamFunc) (string, error) {
+	apiReq.Stream = true
+	jsonBody, err := json.Marshal(apiReq)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := openStream(ctx, p.endpoint+"/v1/messages", map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
+	}, jsonBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var model string
+	var inputTokens, cacheRead, cacheWrite, outputTokens int
+
+	err = readSSE(ctx, resp.Body, func(data []byte) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("parse stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			model = event.Message.Model
+			usage := event.Message.Usage
+			inputTokens, cacheRead, cacheWrite = usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				text.WriteString(event.Delta.Text)
+				return onDelta(event.Delta.Text)
+			}
+		case "message_delta":
+			outputTokens = event.Usage.OutputTokens
+		case "error":
+			return &ProviderError{Kind: ErrorKindServer, Message: event.Error.Type + ": " + event.Error.Message}
+		}
+		return nil
+	})
+
+	recordTokens(ctx, model, anthropicTokens(inputTokens, cacheRead, cacheWrite, outputTokens))
+	return text.String(), err
+}
+
+func (p *AnthropicProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *AnthropicProvider) WithModels(model, chatModel string) Provider {
+	return NewAnthropicProvider(p.apiKey, model, chatModel, p.endpoint, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /v1/models endpoint.
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/v1/models", map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
+	}, healthTimeout)
+}
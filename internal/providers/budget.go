@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// minTokenBudget keeps budgets large enough to finish a short statement.
+	minTokenBudget = 16
+	// budgetSafety leaves headroom for network and response handling.
+	budgetSafety = 0.8
+	// throughputSmoothing weights the latest observation in the moving average.
+	throughputSmoothing = 0.3
+)
+
+// throughputMeter tracks a provider's generation speed so the number of
+// tokens requested can be sized to the time left before the deadline.
+type throughputMeter struct {
+	mu           sync.Mutex
+	tokensPerSec float64
+	overhead     time.Duration
+}
+
+// observe records a generation of tokens that took duration, plus any fixed
+// cost (model load, prompt processing) paid before the first token.
+func (m *throughputMeter) observe(tokens int, duration, overhead time.Duration) {
+	if tokens <= 0 || duration <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tps := float64(tokens) / duration.Seconds()
+	if m.tokensPerSec == 0 {
+		m.tokensPerSec = tps
+		m.overhead = overhead
+		return
+	}
+
+	m.tokensPerSec += throughputSmoothing * (tps - m.tokensPerSec)
+	m.overhead += time.Duration(throughputSmoothing * float64(overhead-m.overhead))
+}
+
+// budget returns how many tokens can be generated before ctx's deadline,
+// capped at maxTokens. Without a deadline or any observations yet it
+// returns maxTokens.
+func (m *throughputMeter) budget(ctx context.Context, maxTokens int) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return maxTokens
+	}
+
+	m.mu.Lock()
+	tps, overhead := m.tokensPerSec, m.overhead
+	m.mu.Unlock()
+
+	if tps == 0 {
+		return maxTokens
+	}
+
+	remaining := time.Until(deadline) - overhead
+	tokens := int(remaining.Seconds() * tps * budgetSafety)
+
+	return min(max(tokens, minTokenBudget), maxTokens)
+}
@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cachePrefixBytes and cacheSuffixBytes are how much of the text around
+	// the cursor identifies a cached completion. Edits further away do not
+	// invalidate it.
+	cachePrefixBytes = 2048
+	cacheSuffixBytes = 512
+)
+
+// completionCache is an LRU cache of completion results, so backspacing
+// and retyping the same code is answered without another request.
+type completionCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedCompletion struct {
+	key     string
+	results []string
+	stored  time.Time
+}
+
+// SetCompletionCache keeps up to size completion results for ttl each. A
+// size below 1 disables the cache.
+func (r *Registry) SetCompletionCache(size int, ttl time.Duration) {
+	var cache *completionCache
+	if size > 0 {
+		cache = &completionCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = cache
+}
+
+// ClearCompletionCache drops every cached completion and returns how many
+// there were.
+func (r *Registry) ClearCompletionCache() int {
+	r.mu.RLock()
+	cache := r.cache
+	r.mu.RUnlock()
+
+	if cache == nil {
+		return 0
+	}
+	return cache.clear()
+}
+
+func (r *Registry) completionCache() *completionCache {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cache
+}
+
+// cacheKey identifies a completion by the provider and model serving it and
+// the normalized code around the cursor.
+func cacheKey(name string, provider Provider, call *Call) string {
+	model := ""
+	if switcher, ok := provider.(ModelSwitcher); ok {
+		model, _ = switcher.Models()
+	}
+
+	before := call.Request.ContentBefore
+	before = before[max(len(before)-cachePrefixBytes, 0):]
+	after := call.Request.ContentAfter
+	after = after[:min(len(after), cacheSuffixBytes)]
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%d\x00", name, model, call.Filepath, call.LanguageID, call.NumSuggestions)
+	h.Write([]byte(normalizeCacheText(before)))
+	h.Write([]byte{0})
+	h.Write([]byte(normalizeCacheText(after)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeCacheText drops carriage returns and trailing spaces on each
+// line, which do not change what a model should suggest.
+func normalizeCacheText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines[:len(lines)-1] {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *completionCache) get(key string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedCompletion)
+	if c.ttl > 0 && time.Since(entry.stored) > c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.results, true
+}
+
+func (c *completionCache) put(key string, results []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cachedCompletion{key: key, results: results, stored: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cachedCompletion{key: key, results: results, stored: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedCompletion).key)
+	}
+}
+
+func (c *completionCache) clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.order.Len()
+	c.order.Init()
+	clear(c.entries)
+	return n
+}
@@ -0,0 +1,173 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops requests to a provider that keeps failing in ways
+// that suggest it is down, so the editor does not wait for a timeout on
+// every keystroke. After cooldown one request is let through to test it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     circuitState
+	openedAt  time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: max(threshold, 1), cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent now. In the half-open state
+// only one request at a time is let through.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// tripsCircuit reports whether err indicates the provider is unreachable or
+// broken, as opposed to a problem with this particular request.
+func tripsCircuit(err error) bool {
+	return IsKind(err, ErrorKindNetwork, ErrorKindTimeout, ErrorKindServer)
+}
+
+// observe records a result and returns the state before and after it.
+// Errors that say nothing about the provider's health leave it unchanged.
+func (b *circuitBreaker) observe(err error, now time.Time) (from, to circuitState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+	b.probing = false
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.state = circuitClosed
+	case tripsCircuit(err):
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= b.threshold {
+			b.state = circuitOpen
+			b.openedAt = now
+		}
+	}
+
+	return from, b.state
+}
+
+// release gives back a half-open probe slot that allow handed out for a
+// request never sent, leaving the state as it was.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) current() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// SetCircuitBreaker enables a breaker per registered provider that opens
+// after threshold consecutive connection, timeout or server errors and stays
+// open for cooldown.
+func (r *Registry) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.breakers = make(map[string]*circuitBreaker, len(r.providers))
+	for name := range r.providers {
+		r.breakers[name] = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+func (r *Registry) breaker(name string) *circuitBreaker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.breakers[name]
+}
+
+// available reports whether the named provider's circuit lets a request
+// through. Without a breaker every provider is available.
+func (r *Registry) available(name string) bool {
+	b := r.breaker(name)
+	return b == nil || b.allow(time.Now())
+}
+
+// recordHealth feeds a request or probe result into the named provider's
+// breaker, logging state transitions.
+func (r *Registry) recordHealth(name string, err error) {
+	b := r.breaker(name)
+	if b == nil {
+		return
+	}
+
+	from, to := b.observe(err, time.Now())
+	if from == to {
+		return
+	}
+
+	r.log("circuit for", name, from.String(), "->", to.String())
+	switch {
+	case to == circuitOpen && from == circuitClosed:
+		r.notifyUser(fmt.Sprintf("%s looks unavailable, pausing requests for %s", name, b.cooldown))
+	case to == circuitClosed:
+		r.notifyUser(fmt.Sprintf("%s is reachable again", name))
+	}
+}
+
+// releaseProbe frees the probe slot taken for the named provider when a
+// request was answered without reaching it, as on a cache hit. A cached
+// result says nothing about the provider's health.
+func (r *Registry) releaseProbe(name string) {
+	if b := r.breaker(name); b != nil {
+		b.release()
+	}
+}
+
+func circuitOpenError(name string) error {
+	return &ProviderError{Kind: ErrorKindNetwork, Message: fmt.Sprintf("%s is unavailable (circuit open)", name)}
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// concurrencyLimits bounds the requests in flight per provider, so parallel
+// suggestions plus actions cannot overwhelm a single-GPU server. Requests
+// over the limit queue for up to wait and are then shed.
+type concurrencyLimits struct {
+	mu     sync.RWMutex
+	slots  map[string]chan struct{}
+	wait   time.Duration
+	logger *lsp.Logger
+}
+
+var limits = &concurrencyLimits{}
+
+// SetConcurrencyLimits sets the maximum number of concurrent requests per
+// provider name. Providers without an entry, or with a limit below 1, are
+// unlimited. A request waits at most queueTimeout for a free slot.
+func SetConcurrencyLimits(perProvider map[string]int, queueTimeout time.Duration, logger *lsp.Logger) {
+	slots := make(map[string]chan struct{}, len(perProvider))
+	for name, n := range perProvider {
+		if n > 0 {
+			slots[name] = make(chan struct{}, n)
+		}
+	}
+
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	limits.slots = slots
+	limits.wait = queueTimeout
+	limits.logger = logger
+}
+
+// acquire takes a slot for provider, returning the function that frees it.
+func (l *concurrencyLimits) acquire(ctx context.Context, provider string) (func(), error) {
+	l.mu.RLock()
+	slots, wait, logger := l.slots[provider], l.wait, l.logger
+	l.mu.RUnlock()
+
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		reason := fmt.Sprintf("%s is busy: %d requests in flight, none finished within %s", provider, cap(slots), wait)
+		if logger != nil {
+			logger.Log("Shedding request:", reason)
+		}
+		return nil, &ProviderError{Kind: ErrorKindOverloaded, Message: reason}
+	}
+}
+
+// limitedTransport holds a provider slot from sending a request until its
+// response body is closed, which covers streamed responses. Requests made
+// outside a provider call, such as health probes, are not limited.
+type limitedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope, ok := req.Context().Value(usageScopeKey{}).(usageScope)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	release, err := limits.acquire(req.Context(), scope.provider)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: sync.OnceFunc(release)}
+	return resp, nil
+}
+
+func (t *limitedTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
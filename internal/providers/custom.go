@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// CustomOptions configures a gateway that is OpenAI-compatible but needs
+// its own auth scheme, headers or request fields.
+type CustomOptions struct {
+	// AuthHeader and AuthValue are sent verbatim, e.g. "api-key" and the key,
+	// or "Authorization" and "Bearer <token>".
+	AuthHeader string
+	AuthValue  string
+	// Headers are extra static headers sent with every request.
+	Headers map[string]string
+	// BodyOverrides is merged over every request body. Nested objects merge
+	// recursively and null values remove the field.
+	BodyOverrides map[string]any
+	// ChatPath is appended to the endpoint for chat requests.
+	ChatPath string
+	// CompletionPath, when set, sends completions as FIM prompts to a
+	// /completions-style endpoint instead of prompting through chat.
+	CompletionPath string
+}
+
+type CustomProvider struct {
+	model     string
+	chatModel string
+	endpoint  string
+	options   CustomOptions
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+func NewCustomProvider(model, chatModel, endpoint string, options CustomOptions, timeoutMs int, logger *lsp.Logger) *CustomProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	if options.ChatPath == "" {
+		options.ChatPath = "/chat/completions"
+	}
+	return &CustomProvider{
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		options:   options,
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *CustomProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if p.options.CompletionPath == "" {
+		return chatPromptedCompletion(ctx, p.chatRequest, p.model, req, filepath, languageID, numSuggestions)
+	}
+
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+
+	apiReq := completionsRequest{
+		Model:       p.model,
+		Prompt:      before,
+		Suffix:      after,
+		MaxTokens:   128,
+		Temperature: 0.2,
+		N:           numSuggestions,
+		Stop:        req.stopSequences(fimStopSequences),
+	}
+
+	resp, err := p.doRequest(ctx, p.options.CompletionPath, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseCompletions(resp)
+	if err != nil {
+		return nil, err
+	}
+	return util.UniqueStrings(results), nil
+}
+
+func (p *CustomProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: p.chatModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:   4096,
+		Temperature: 0.1,
+	}
+
+	resp, err := p.chatRequest(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log("DEBUG [Custom Chat]: Raw response:", string(resp))
+	return parseChatCompletion(resp)
+}
+
+// chatRequest routes chat calls to the configured chat path.
+func (p *CustomProvider) chatRequest(ctx context.Context, _ string, body any) ([]byte, error) {
+	return p.doRequest(ctx, p.options.ChatPath, body)
+}
+
+func (p *CustomProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	headers := make(map[string]string, len(p.options.Headers)+1)
+	for key, value := range p.options.Headers {
+		headers[key] = value
+	}
+	if p.options.AuthHeader != "" && p.options.AuthValue != "" {
+		headers[p.options.AuthHeader] = p.options.AuthValue
+	}
+
+	merged, err := applyBodyOverrides(body, p.options.BodyOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	return postJSON(ctx, p.endpoint+endpoint, headers, p.timeout, merged)
+}
+
+// applyBodyOverrides merges overrides over the JSON form of body.
+func applyBodyOverrides(body any, overrides map[string]any) (any, error) {
+	if len(overrides) == 0 {
+		return body, nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	var base map[string]any
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	mergeJSONObjects(base, overrides)
+	return base, nil
+}
+
+func mergeJSONObjects(dst, src map[string]any) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+
+		srcObj, srcIsObj := value.(map[string]any)
+		dstObj, dstIsObj := dst[key].(map[string]any)
+		if srcIsObj && dstIsObj {
+			mergeJSONObjects(dstObj, srcObj)
+			continue
+		}
+
+		dst[key] = value
+	}
+}
+
+func (p *CustomProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *CustomProvider) WithModels(model, chatModel string) Provider {
+	return NewCustomProvider(model, chatModel, p.endpoint, p.options, int(p.timeout.Milliseconds()), p.logger)
+}
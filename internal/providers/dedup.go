@@ -0,0 +1,46 @@
+package providers
+
+// DedupStrictness controls how eagerly completions are trimmed where they
+// repeat the code after the cursor.
+type DedupStrictness string
+
+const (
+	// DedupOff keeps completions as the model returned them.
+	DedupOff DedupStrictness = "off"
+	// DedupConservative only trims long completions and short, exact
+	// overlaps, at the risk of leaving some repetition in.
+	DedupConservative DedupStrictness = "conservative"
+	// DedupAggressive also trims short completions and longer overlaps, at
+	// the risk of cutting code that only looks like the suffix.
+	DedupAggressive DedupStrictness = "aggressive"
+)
+
+// dedupPolicy holds the thresholds behind a strictness level.
+type dedupPolicy struct {
+	// trailingLines is the longest run of final completion lines compared
+	// with the first lines after the cursor.
+	trailingLines int
+	// minFunctionLines is the shortest completion searched for a function
+	// that is already defined after the cursor.
+	minFunctionLines int
+	// secondHalfOnly limits that search to the second half of the
+	// completion, where repeated functions usually start.
+	secondHalfOnly bool
+	// suffixLines is how many lines after the cursor are searched for a
+	// matching function signature.
+	suffixLines int
+	// minKept is the share of the completion that must survive removing a
+	// duplicated function; below it the completion is kept whole.
+	minKept float64
+}
+
+func (s DedupStrictness) policy() (dedupPolicy, bool) {
+	switch s {
+	case DedupOff:
+		return dedupPolicy{}, false
+	case DedupAggressive:
+		return dedupPolicy{trailingLines: 8, minFunctionLines: 4, suffixLines: 30}, true
+	default:
+		return dedupPolicy{trailingLines: 3, minFunctionLines: 15, secondHalfOnly: true, suffixLines: 10, minKept: 1.0 / 3}, true
+	}
+}
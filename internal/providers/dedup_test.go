@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// TestDedupCorpus runs the suffix deduplication passes over
+// testdata/dedup. Each case directory holds the text before and after the
+// cursor and the model output; want.txt is the expected result at every
+// strictness but off, and want-<strictness>.txt overrides it for one level.
+// Without either, the output is expected unchanged. A file's final newline
+// is not part of its text.
+func TestDedupCorpus(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "dedup", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no cases in testdata/dedup")
+	}
+
+	p := &OllamaProvider{logger: lsp.NewLogger("")}
+
+	for _, dir := range dirs {
+		after := readCase(t, dir, "after.txt")
+		output := readCase(t, dir, "output.txt")
+		// before.txt documents the prefix; the passes only look at the suffix.
+		readCase(t, dir, "before.txt")
+
+		for _, level := range []DedupStrictness{DedupOff, DedupConservative, DedupAggressive} {
+			t.Run(filepath.Base(dir)+"/"+string(level), func(t *testing.T) {
+				want := output
+				if level != DedupOff {
+					if text, ok := readOptional(t, dir, "want-"+string(level)+".txt"); ok {
+						want = text
+					} else if text, ok := readOptional(t, dir, "want.txt"); ok {
+						want = text
+					}
+				}
+
+				got := output
+				if policy, ok := level.policy(); ok {
+					got = p.removeAfterDuplicates(got, after, policy)
+					got = p.removeAfterFunctionDuplicates(got, after, policy)
+				}
+				if got != want {
+					t.Errorf("got:\n%s\n\nwant:\n%s", got, want)
+				}
+			})
+		}
+	}
+}
+
+func readCase(t *testing.T, dir, name string) string {
+	t.Helper()
+	text, ok := readOptional(t, dir, name)
+	if !ok {
+		t.Fatalf("%s: missing %s", dir, name)
+	}
+	return text
+}
+
+func readOptional(t *testing.T, dir, name string) (string, bool) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(string(data), "\n"), true
+}
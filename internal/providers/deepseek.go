@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+type DeepSeekProvider struct {
+	apiKey    string
+	model     string
+	chatModel string
+	endpoint  string
+	useFIM    bool
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+// NewDeepSeekProvider creates a provider for the DeepSeek API. When useFIM is
+// set, completions go through the beta /completions endpoint with the code
+// after the cursor as suffix; otherwise they are prompted through chat.
+func NewDeepSeekProvider(apiKey, model, chatModel, endpoint string, useFIM bool, timeoutMs int, logger *lsp.Logger) *DeepSeekProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &DeepSeekProvider{
+		apiKey:    apiKey,
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		useFIM:    useFIM,
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *DeepSeekProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if !p.useFIM {
+		return chatPromptedCompletion(ctx, p.doRequest, p.model, req, filepath, languageID, numSuggestions)
+	}
+
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+
+	temperature := 0.0
+	if numSuggestions > 1 {
+		temperature = 0.4
+	}
+
+	results := make([]string, 0, numSuggestions)
+
+	// The FIM endpoint does not support n > 1, so suggestions are requested
+	// one at a time.
+	for i := 0; i < numSuggestions; i++ {
+		apiReq := completionsRequest{
+			Model:       p.model,
+			Prompt:      before,
+			Suffix:      after,
+			MaxTokens:   128,
+			Temperature: temperature,
+			Stop:        req.stopSequences(fimStopSequences),
+		}
+
+		resp, err := p.doRequest(ctx, "/beta/completions", apiReq)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		texts, err := parseCompletions(resp)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+		results = append(results, texts...)
+	}
+
+	p.logger.Log(fmt.Sprintf("DeepSeek FIM returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *DeepSeekProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: p.chatModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:   8192,
+		Temperature: 0.1,
+	}
+
+	resp, err := p.doRequest(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log("DEBUG [DeepSeek Chat]: Raw response:", string(resp))
+	return parseChatCompletion(resp)
+}
+
+func (p *DeepSeekProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	return postJSON(ctx, p.endpoint+endpoint, headers, p.timeout, body)
+}
+
+// Health checks that the API is reachable.
+func (p *DeepSeekProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey})
+}
+
+func (p *DeepSeekProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *DeepSeekProvider) WithModels(model, chatModel string) Provider {
+	return NewDeepSeekProvider(p.apiKey, model, chatModel, p.endpoint, p.useFIM, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /models endpoint.
+func (p *DeepSeekProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey}, healthTimeout)
+}
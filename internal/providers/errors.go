@@ -0,0 +1,162 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrorKind categorises provider failures so callers can react to them
+// without matching on error text.
+type ErrorKind string
+
+const (
+	ErrorKindUnknown       ErrorKind = "unknown"
+	ErrorKindAuth          ErrorKind = "auth"
+	ErrorKindQuota         ErrorKind = "quota"
+	ErrorKindTimeout       ErrorKind = "timeout"
+	ErrorKindContextLength ErrorKind = "context-too-long"
+	ErrorKindModelNotFound ErrorKind = "model-not-found"
+	ErrorKindNetwork       ErrorKind = "network"
+	ErrorKindServer        ErrorKind = "server"
+	ErrorKindCancelled     ErrorKind = "cancelled"
+	// ErrorKindOverloaded marks requests shed locally because the provider
+	// already had as many requests in flight as allowed.
+	ErrorKindOverloaded ErrorKind = "overloaded"
+	// ErrorKindRefused marks requests the registry policy did not allow,
+	// such as a cloud provider in an untrusted workspace.
+	ErrorKindRefused ErrorKind = "refused"
+)
+
+type ProviderError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	Err        error
+	// RetryAfter is the delay the server asked for before the next attempt.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the category of err, or ErrorKindUnknown when err did not
+// originate from a provider request.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.Kind
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	}
+
+	return ErrorKindUnknown
+}
+
+// IsKind reports whether err belongs to any of the given categories.
+func IsKind(err error, kinds ...ErrorKind) bool {
+	kind := KindOf(err)
+	for _, k := range kinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// newStatusError classifies a non-200 API response.
+func newStatusError(status int, body []byte) *ProviderError {
+	msg := string(body)
+	lower := strings.ToLower(msg)
+	kind := ErrorKindUnknown
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrorKindAuth
+	case status == http.StatusTooManyRequests || status == http.StatusPaymentRequired:
+		kind = ErrorKindQuota
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		kind = ErrorKindTimeout
+	case isContextLengthMessage(lower):
+		kind = ErrorKindContextLength
+	case status == http.StatusNotFound && strings.Contains(lower, "model"):
+		kind = ErrorKindModelNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		kind = ErrorKindContextLength
+	case status >= 500:
+		kind = ErrorKindServer
+	}
+
+	// Some gateways report exhausted credit as a 400 or 403 with a body hint.
+	if strings.Contains(lower, "insufficient_quota") || strings.Contains(lower, "credit balance") {
+		kind = ErrorKindQuota
+	}
+
+	return &ProviderError{Kind: kind, StatusCode: status, Message: msg}
+}
+
+func isContextLengthMessage(lower string) bool {
+	for _, marker := range []string{
+		"context_length_exceeded",
+		"maximum context length",
+		"context length",
+		"prompt is too long",
+		"too many tokens",
+	} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequestError classifies a transport-level failure, preferring the
+// context error when the request was cancelled or timed out.
+func newRequestError(ctx context.Context, err error) *ProviderError {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr
+	}
+
+	kind := ErrorKindNetwork
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		kind = ErrorKindCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = ErrorKindTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		kind = ErrorKindTimeout
+	}
+
+	return &ProviderError{Kind: kind, Message: "request failed", Err: err}
+}
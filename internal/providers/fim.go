@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"slices"
+	"strings"
+)
+
+var fimStopSequences = []string{"\n\n\n", "<|fim", "<|end", "<|file", "```"}
+
+// fimTemplate describes how a model family marks up a fill-in-the-middle
+// prompt and which tokens end its output.
+type fimTemplate struct {
+	name   string
+	prefix string
+	suffix string
+	middle string
+	stop   []string
+	// suffixFirst puts the suffix before the prefix, as Codestral expects.
+	suffixFirst bool
+	// spm sends the prefix and suffix markers, the suffix, then the middle
+	// marker and the prefix, the SPM layout of the FIM paper that
+	// StarCoder-style models are trained on.
+	spm bool
+}
+
+var qwenFIM = fimTemplate{
+	name:   "qwen",
+	prefix: "<|fim_prefix|>",
+	suffix: "<|fim_suffix|>",
+	middle: "<|fim_middle|>",
+	stop:   []string{"<|endoftext|>", "<|fim_pad|>", "<|file_sep|>", "<|im_end|>"},
+}
+
+var deepseekFIM = fimTemplate{
+	name:   "deepseek",
+	prefix: "<｜fim▁begin｜>",
+	suffix: "<｜fim▁hole｜>",
+	middle: "<｜fim▁end｜>",
+	stop:   []string{"<｜end▁of▁sentence｜>", "<|EOT|>"},
+}
+
+var starcoderFIM = fimTemplate{
+	name:   "starcoder",
+	prefix: "<fim_prefix>",
+	suffix: "<fim_suffix>",
+	middle: "<fim_middle>",
+	stop:   []string{"<|endoftext|>", "<file_sep>", "<fim_prefix>", "<fim_suffix>", "<fim_middle>"},
+}
+
+// CodeLlama's tokens are separated from the text by a space, except before
+// the suffix.
+var codellamaFIM = fimTemplate{
+	name:   "codellama",
+	prefix: "<PRE> ",
+	suffix: " <SUF>",
+	middle: " <MID>",
+	stop:   []string{"<EOT>", "</s>", "<PRE>", "<SUF>", "<MID>"},
+}
+
+var codegemmaFIM = fimTemplate{
+	name:   "codegemma",
+	prefix: "<|fim_prefix|>",
+	suffix: "<|fim_suffix|>",
+	middle: "<|fim_middle|>",
+	stop:   []string{"<|file_separator|>", "<end_of_turn>", "<eos>"},
+}
+
+var codestralFIM = fimTemplate{
+	name:        "codestral",
+	prefix:      "[PREFIX]",
+	suffix:      "[SUFFIX]",
+	stop:        []string{"</s>", "[PREFIX]", "[SUFFIX]", "[MIDDLE]"},
+	suffixFirst: true,
+}
+
+// fimFamilies maps markers found in model names to their template, checked
+// in order so that e.g. deepseek-coder is not taken for another family.
+type fimFamily struct {
+	markers  []string
+	template fimTemplate
+}
+
+var fimFamilies = []fimFamily{
+	{[]string{"deepseek"}, deepseekFIM},
+	{[]string{"starcoder"}, starcoderFIM},
+	{[]string{"codellama", "code-llama", "code_llama"}, codellamaFIM},
+	{[]string{"codegemma"}, codegemmaFIM},
+	{[]string{"codestral"}, codestralFIM},
+	{[]string{"qwen"}, qwenFIM},
+}
+
+// fimTemplateFor picks the template matching a model name, preferring user
+// templates, and falls back to the Qwen format.
+func fimTemplateFor(model string) fimTemplate {
+	lower := strings.ToLower(model)
+	for _, family := range slices.Concat(userFIMFamilies(), fimFamilies) {
+		for _, marker := range family.markers {
+			if strings.Contains(lower, marker) {
+				return family.template
+			}
+		}
+	}
+	return qwenFIM
+}
+
+func (t fimTemplate) build(before, after string) string {
+	if t.spm {
+		return t.prefix + t.suffix + after + t.middle + before
+	}
+	if t.suffixFirst {
+		return t.suffix + after + t.prefix + before + t.middle
+	}
+	return t.prefix + before + t.suffix + after + t.middle
+}
+
+// stopSequences returns the generic FIM stops plus the family's own.
+func (t fimTemplate) stopSequences() []string {
+	return append(slices.Clone(fimStopSequences), t.stop...)
+}
+
+// limitFIMContext trims the content around the cursor to the window sent to
+// fill-in-the-middle models, as configured with SetContextWindow.
+func limitFIMContext(contentBefore, contentAfter string) (string, string) {
+	return contextWindow().fit(contentBefore, contentAfter)
+}
+
+// leakedFIMTokens start special tokens of any supported family; output is
+// cut at the first one.
+var leakedFIMTokens = []string{
+	"<|", "<｜", "<FILL>", "<CURSOR>", "</s>", "<s>",
+	"<fim_", "<file_sep>", "<EOT>", "<PRE>", "<SUF>", "<MID>",
+	"<end_of_turn>", "<eos>", "[PREFIX]", "[SUFFIX]", "[MIDDLE]",
+}
+
+// leakedTokens returns leakedFIMTokens plus the markers and stop tokens of
+// the user templates, which the built-in list cannot know.
+func leakedTokens() []string {
+	tokens := slices.Clone(leakedFIMTokens)
+	for _, family := range userFIMFamilies() {
+		t := family.template
+		for _, token := range append([]string{t.prefix, t.suffix, t.middle}, t.stop...) {
+			if token != "" && !slices.Contains(tokens, token) {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// trimFIMOutput strips leaked special tokens and surrounding blank space
+// from raw fill-in-the-middle output.
+func trimFIMOutput(text string) string {
+	for _, token := range leakedTokens() {
+		if idx := strings.Index(text, token); idx != -1 {
+			text = text[:idx]
+		}
+	}
+
+	text = strings.TrimLeft(text, "\n")
+	text = strings.TrimRight(text, " \t\n")
+
+	if len(strings.TrimSpace(text)) < 2 {
+		return ""
+	}
+	return text
+}
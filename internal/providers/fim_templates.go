@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FIMTemplate is a user-defined fill-in-the-middle prompt format, for models
+// the built-in families do not cover.
+type FIMTemplate struct {
+	// Name identifies the template in logs; it defaults to the first match.
+	Name string `json:"name"`
+	// Match lists substrings of model names, compared case-insensitively,
+	// that select this template.
+	Match  []string `json:"match"`
+	Prefix string   `json:"prefix"`
+	Suffix string   `json:"suffix"`
+	Middle string   `json:"middle"`
+	// Order is "psm" (prefix, suffix, middle; the default) or "spm", which
+	// sends the prefix and suffix markers, the suffix, then the middle marker
+	// and the prefix.
+	Order string `json:"order"`
+	// Stop lists tokens that end the model's output, in addition to the
+	// generic FIM stops. They are also cut from output they leak into.
+	Stop []string `json:"stop"`
+}
+
+var userFIM struct {
+	mu       sync.RWMutex
+	families []fimFamily
+}
+
+// LoadFIMTemplates reads user templates from value, either a JSON array of
+// FIMTemplate or the path of a file holding one. They are checked before the
+// built-in families, in order. An empty value clears them.
+func LoadFIMTemplates(value string) error {
+	var families []fimFamily
+	if value = strings.TrimSpace(value); value != "" {
+		data := []byte(value)
+		if !strings.HasPrefix(value, "[") {
+			var err error
+			if data, err = os.ReadFile(value); err != nil {
+				return fmt.Errorf("read FIM templates: %w", err)
+			}
+		}
+
+		var templates []FIMTemplate
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return fmt.Errorf("FIM templates must be a JSON array: %w", err)
+		}
+		for i, t := range templates {
+			family, err := t.family()
+			if err != nil {
+				return fmt.Errorf("FIM template %d: %w", i+1, err)
+			}
+			families = append(families, family)
+		}
+	}
+
+	userFIM.mu.Lock()
+	defer userFIM.mu.Unlock()
+	userFIM.families = families
+	return nil
+}
+
+func (t FIMTemplate) family() (fimFamily, error) {
+	var markers []string
+	for _, m := range t.Match {
+		if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+			markers = append(markers, m)
+		}
+	}
+	if len(markers) == 0 {
+		return fimFamily{}, errors.New("match must name at least one model")
+	}
+	if t.Prefix == "" || t.Suffix == "" {
+		return fimFamily{}, fmt.Errorf("%s: prefix and suffix tokens are required", markers[0])
+	}
+
+	var spm bool
+	switch strings.ToLower(t.Order) {
+	case "", "psm":
+	case "spm":
+		if t.Middle == "" {
+			return fimFamily{}, fmt.Errorf("%s: spm order needs a middle token", markers[0])
+		}
+		spm = true
+	default:
+		return fimFamily{}, fmt.Errorf("%s: order must be psm or spm, got %q", markers[0], t.Order)
+	}
+
+	name := t.Name
+	if name == "" {
+		name = markers[0]
+	}
+	return fimFamily{markers: markers, template: fimTemplate{
+		name:   name,
+		prefix: t.Prefix,
+		suffix: t.Suffix,
+		middle: t.Middle,
+		stop:   t.Stop,
+		spm:    spm,
+	}}, nil
+}
+
+func userFIMFamilies() []fimFamily {
+	userFIM.mu.RLock()
+	defer userFIM.mu.RUnlock()
+	return userFIM.families
+}
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzFIMPrompt(f *testing.F) {
+	f.Add("package main\n\nfunc main() {\n\tfmt.Pr", "\n}\n", "qwen2.5-coder", 64)
+	f.Add(strings.Repeat("x", 10000), strings.Repeat("y\n", 5000), "deepseek-coder", 128)
+	f.Add("func (", ")]}}", "codellama", 1024)
+	f.Add("世界 ✓ ", "", "starcoder2", 200)
+	f.Add("", "", "", 0)
+
+	f.Fuzz(func(t *testing.T, before, after, model string, tokens int) {
+		if !utf8.ValidString(before) || !utf8.ValidString(after) {
+			return
+		}
+		w := ContextWindow{Tokens: 64 + abs(tokens)%4096, PrefixShare: 0.7, SuffixShare: 0.2, SkeletonShare: 0.1}
+		fitBefore, fitAfter := w.fit(before, after)
+
+		if !utf8.ValidString(fitBefore) || !utf8.ValidString(fitAfter) {
+			t.Fatalf("fitting produced invalid UTF-8: %q, %q", fitBefore, fitAfter)
+		}
+		// Whatever is cut, the text next to the cursor stays.
+		if lines := strings.Split(fitBefore, "\n"); !strings.HasSuffix(before, lines[len(lines)-1]) {
+			t.Fatalf("prefix %q does not end the text before the cursor", lines[len(lines)-1])
+		}
+		if first, _, _ := strings.Cut(fitAfter, "\n"); !strings.HasPrefix(after, first) {
+			t.Fatalf("suffix %q does not start the text after the cursor", first)
+		}
+
+		tmpl := fimTemplateFor(model)
+		prompt := tmpl.build(fitBefore, fitAfter)
+		if !strings.HasSuffix(prompt, tmpl.middle) || !strings.Contains(prompt, tmpl.prefix) || !strings.Contains(prompt, tmpl.suffix) {
+			t.Fatalf("prompt %q is missing markers of %+v", prompt, tmpl)
+		}
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestUserFIMTemplates(t *testing.T) {
+	err := LoadFIMTemplates(`[
+		{"match": ["mycoder"], "prefix": "<PRE>", "suffix": "<SUF>", "middle": "<MID>", "order": "spm", "stop": ["<|stop|>", "@@END@@"]},
+		{"match": ["acme"], "prefix": "{{P}}", "suffix": "{{S}}", "middle": "{{M}}"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { LoadFIMTemplates("") })
+
+	if got, want := fimTemplateFor("mycoder-7b").build("before", "after"), "<PRE><SUF>after<MID>before"; got != want {
+		t.Errorf("spm prompt %q, want %q", got, want)
+	}
+	if got, want := fimTemplateFor("acme-code").build("before", "after"), "{{P}}before{{S}}after{{M}}"; got != want {
+		t.Errorf("psm prompt %q, want %q", got, want)
+	}
+	if got, want := fimTemplateFor("codestral").build("before", "after"), "[SUFFIX]after[PREFIX]before"; got != want {
+		t.Errorf("codestral prompt %q, want %q", got, want)
+	}
+
+	for _, output := range []string{"return x@@END@@junk", "return x{{M}}more", "return x\n<|stop|>"} {
+		if got := trimFIMOutput(output); got != "return x" {
+			t.Errorf("trimFIMOutput(%q) = %q, want %q", output, got, "return x")
+		}
+	}
+
+	if err := LoadFIMTemplates(`[{"match": ["x"], "prefix": "<P>", "suffix": "<S>", "order": "spm"}]`); err == nil {
+		t.Error("spm template without a middle token accepted")
+	}
+}
@@ -0,0 +1,239 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcpScope          = "https://www.googleapis.com/auth/cloud-platform"
+	gcpTokenURL       = "https://oauth2.googleapis.com/token"
+	gcpMetadataURL    = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpTokenLeeway    = time.Minute
+	gcpJWTLifetimeSec = 3600
+)
+
+// gcpCredentials covers the two ADC file types: service_account keys and the
+// authorized_user file written by `gcloud auth application-default login`.
+type gcpCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type gcpTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// gcpTokenSource issues and caches OAuth access tokens using Application
+// Default Credentials: an explicit credentials file, GOOGLE_APPLICATION_CREDENTIALS,
+// the gcloud ADC file, or the GCE/GKE metadata server, in that order.
+type gcpTokenSource struct {
+	credentialsPath string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newGCPTokenSource(credentialsPath string) *gcpTokenSource {
+	return &gcpTokenSource{credentialsPath: credentialsPath}
+}
+
+func (s *gcpTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(gcpTokenLeeway).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	resp, err := s.fetch(ctx)
+	if err != nil {
+		return "", &ProviderError{Kind: ErrorKindAuth, Message: "google auth: " + err.Error(), Err: err}
+	}
+
+	s.token = resp.AccessToken
+	s.expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+func (s *gcpTokenSource) fetch(ctx context.Context) (*gcpTokenResponse, error) {
+	path := s.credentialsFile()
+	if path == "" {
+		return fetchMetadataToken(ctx)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+
+	var creds gcpCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("parse credentials %s: %w", path, err)
+	}
+
+	switch creds.Type {
+	case "service_account":
+		assertion, err := signServiceAccountJWT(&creds, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		tokenURL := creds.TokenURI
+		if tokenURL == "" {
+			tokenURL = gcpTokenURL
+		}
+		return postTokenForm(ctx, tokenURL, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+	case "authorized_user":
+		return postTokenForm(ctx, gcpTokenURL, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		})
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %q in %s", creds.Type, path)
+	}
+}
+
+// credentialsFile resolves the ADC file, or "" to use the metadata server.
+func (s *gcpTokenSource) credentialsFile() string {
+	if s.credentialsPath != "" {
+		return s.credentialsPath
+	}
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return path
+	}
+
+	var dir string
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(os.Getenv("APPDATA"), "gcloud")
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".config", "gcloud")
+	}
+
+	path := filepath.Join(dir, "application_default_credentials.json")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return ""
+}
+
+func signServiceAccountJWT(creds *gcpCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service account private key is not RSA")
+	}
+
+	aud := creds.TokenURI
+	if aud == "" {
+		aud = gcpTokenURL
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   creds.ClientEmail,
+		"scope": gcpScope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Unix() + gcpJWTLifetimeSec,
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+func postTokenForm(ctx context.Context, tokenURL string, form url.Values) (*gcpTokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doTokenRequest(req)
+}
+
+func fetchMetadataToken(ctx context.Context) (*gcpTokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", gcpMetadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := doTokenRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("no credentials file found and metadata server unavailable: %w", err)
+	}
+	return resp, nil
+}
+
+func doTokenRequest(req *http.Request) (*gcpTokenResponse, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	var token gcpTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed (status %d): %s %s", resp.StatusCode, token.Error, token.Description)
+	}
+	return &token, nil
+}
@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// GGUFOptions configures in-process inference.
+type GGUFOptions struct {
+	// ContextSize is the token window allocated for each request.
+	ContextSize int
+	// Threads used for generation. Zero lets llama.cpp decide.
+	Threads int
+	// GPULayers offloaded to the GPU when llama.cpp was built with GPU support.
+	GPULayers int
+}
+
+// ggufEngine is the llama.cpp binding, only available in builds with the
+// `llama` tag.
+type ggufEngine interface {
+	generate(ctx context.Context, prompt string, maxTokens int, temperature float32, stop []string) (string, error)
+	chatPrompt(systemPrompt, userPrompt string) (string, error)
+}
+
+// GGUFProvider runs a GGUF model in-process, so completions work without any
+// external service. The model is loaded on first use to keep startup fast.
+type GGUFProvider struct {
+	modelPath string
+	options   GGUFOptions
+	template  fimTemplate
+	logger    *lsp.Logger
+
+	once    sync.Once
+	engine  ggufEngine
+	loadErr error
+	// mu serialises generation; a llama.cpp context is not safe for
+	// concurrent use.
+	mu sync.Mutex
+}
+
+func NewGGUFProvider(modelPath string, options GGUFOptions, logger *lsp.Logger) *GGUFProvider {
+	if options.ContextSize <= 0 {
+		options.ContextSize = 4096
+	}
+	return &GGUFProvider{
+		modelPath: modelPath,
+		options:   options,
+		template:  fimTemplateFor(filepath.Base(modelPath)),
+		logger:    logger,
+	}
+}
+
+func (p *GGUFProvider) load() (ggufEngine, error) {
+	p.once.Do(func() {
+		p.logger.Log("Loading GGUF model:", p.modelPath)
+		p.engine, p.loadErr = loadGGUFEngine(p.modelPath, p.options)
+		if p.loadErr != nil {
+			p.loadErr = &ProviderError{Kind: ErrorKindModelNotFound, Message: p.loadErr.Error(), Err: p.loadErr}
+		}
+	})
+	return p.engine, p.loadErr
+}
+
+func (p *GGUFProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	engine, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+	prompt := p.template.build(before, after)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make([]string, 0, numSuggestions)
+	for i := 0; i < numSuggestions; i++ {
+		// Later suggestions sample at a higher temperature so they differ.
+		temperature := float32(0.1) + 0.3*float32(i)
+
+		text, err := engine.generate(ctx, prompt, 128, temperature, req.stopSequences(p.template.stopSequences()))
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		if text = trimFIMOutput(text); text != "" {
+			results = append(results, text)
+		}
+	}
+
+	p.logger.Log(fmt.Sprintf("GGUF returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *GGUFProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	engine, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := engine.chatPrompt(systemPrompt, userPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	text, err := engine.generate(ctx, prompt, 2048, 0.1, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("no response from model")
+	}
+	return &ChatResponse{Result: text}, nil
+}
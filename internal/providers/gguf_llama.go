@@ -0,0 +1,223 @@
+//go:build llama
+
+package providers
+
+/*
+#cgo LDFLAGS: -lllama -lggml -lstdc++ -lm
+#include <stdlib.h>
+#include <llama.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// GGUFAvailable reports whether this binary was built with llama.cpp support.
+const GGUFAvailable = true
+
+var llamaBackendOnce sync.Once
+
+type llamaEngine struct {
+	model   *C.struct_llama_model
+	vocab   *C.struct_llama_vocab
+	options GGUFOptions
+}
+
+func loadGGUFEngine(modelPath string, options GGUFOptions) (ggufEngine, error) {
+	llamaBackendOnce.Do(func() { C.llama_backend_init() })
+
+	path := C.CString(modelPath)
+	defer C.free(unsafe.Pointer(path))
+
+	params := C.llama_model_default_params()
+	params.n_gpu_layers = C.int32_t(options.GPULayers)
+
+	model := C.llama_model_load_from_file(path, params)
+	if model == nil {
+		return nil, fmt.Errorf("failed to load GGUF model %s", modelPath)
+	}
+
+	engine := &llamaEngine{
+		model:   model,
+		vocab:   C.llama_model_get_vocab(model),
+		options: options,
+	}
+	runtime.SetFinalizer(engine, func(e *llamaEngine) { C.llama_model_free(e.model) })
+	return engine, nil
+}
+
+// newContext creates a fresh context per request, which is cheaper to reason
+// about than clearing the KV cache across llama.cpp versions.
+func (e *llamaEngine) newContext() (*C.struct_llama_context, error) {
+	params := C.llama_context_default_params()
+	params.n_ctx = C.uint32_t(e.options.ContextSize)
+	params.n_batch = C.uint32_t(e.options.ContextSize)
+	if e.options.Threads > 0 {
+		params.n_threads = C.int32_t(e.options.Threads)
+		params.n_threads_batch = C.int32_t(e.options.Threads)
+	}
+
+	lctx := C.llama_init_from_model(e.model, params)
+	if lctx == nil {
+		return nil, errors.New("failed to create llama context")
+	}
+	return lctx, nil
+}
+
+func (e *llamaEngine) tokenize(text string) ([]C.llama_token, error) {
+	ctext := C.CString(text)
+	defer C.free(unsafe.Pointer(ctext))
+
+	// A negative result is the required token count.
+	n := -C.llama_tokenize(e.vocab, ctext, C.int32_t(len(text)), nil, 0, true, true)
+	if n <= 0 {
+		return nil, errors.New("failed to tokenize prompt")
+	}
+
+	tokens := make([]C.llama_token, n)
+	if C.llama_tokenize(e.vocab, ctext, C.int32_t(len(text)), &tokens[0], n, true, true) < 0 {
+		return nil, errors.New("failed to tokenize prompt")
+	}
+	return tokens, nil
+}
+
+func (e *llamaEngine) piece(token C.llama_token) string {
+	var buf [256]C.char
+	n := C.llama_token_to_piece(e.vocab, token, &buf[0], C.int32_t(len(buf)), 0, false)
+	if n <= 0 {
+		return ""
+	}
+	return C.GoStringN(&buf[0], n)
+}
+
+func (e *llamaEngine) newSampler(temperature float32) *C.struct_llama_sampler {
+	chain := C.llama_sampler_chain_init(C.llama_sampler_chain_default_params())
+	if temperature <= 0 {
+		C.llama_sampler_chain_add(chain, C.llama_sampler_init_greedy())
+		return chain
+	}
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_top_k(40))
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_temp(C.float(temperature)))
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_dist(C.LLAMA_DEFAULT_SEED))
+	return chain
+}
+
+// decode evaluates tokens, copying them to C memory because the batch keeps
+// a pointer to them.
+func decode(lctx *C.struct_llama_context, tokens []C.llama_token) error {
+	size := C.size_t(len(tokens)) * C.size_t(unsafe.Sizeof(C.llama_token(0)))
+	buf := (*C.llama_token)(C.malloc(size))
+	defer C.free(unsafe.Pointer(buf))
+	copy(unsafe.Slice(buf, len(tokens)), tokens)
+
+	if C.llama_decode(lctx, C.llama_batch_get_one(buf, C.int32_t(len(tokens)))) != 0 {
+		return errors.New("llama_decode failed")
+	}
+	return nil
+}
+
+func (e *llamaEngine) generate(ctx context.Context, prompt string, maxTokens int, temperature float32, stop []string) (string, error) {
+	tokens, err := e.tokenize(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if len(tokens)+maxTokens > e.options.ContextSize {
+		return "", &ProviderError{
+			Kind:    ErrorKindContextLength,
+			Message: fmt.Sprintf("prompt is %d tokens, context size is %d", len(tokens), e.options.ContextSize),
+		}
+	}
+
+	lctx, err := e.newContext()
+	if err != nil {
+		return "", err
+	}
+	defer C.llama_free(lctx)
+
+	sampler := e.newSampler(temperature)
+	defer C.llama_sampler_free(sampler)
+
+	if err := decode(lctx, tokens); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for i := 0; i < maxTokens; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", newRequestError(ctx, err)
+		}
+
+		token := C.llama_sampler_sample(sampler, lctx, -1)
+		if C.llama_vocab_is_eog(e.vocab, token) {
+			break
+		}
+
+		out.WriteString(e.piece(token))
+		if text, ok := cutAtStop(out.String(), stop); ok {
+			return text, nil
+		}
+
+		if err := decode(lctx, []C.llama_token{token}); err != nil {
+			return "", err
+		}
+	}
+
+	return out.String(), nil
+}
+
+func (e *llamaEngine) chatPrompt(systemPrompt, userPrompt string) (string, error) {
+	tmpl := C.llama_model_chat_template(e.model, nil)
+	if tmpl == nil {
+		return systemPrompt + "\n\n" + userPrompt + "\n\n", nil
+	}
+
+	roles := []*C.char{C.CString("system"), C.CString("user")}
+	contents := []*C.char{C.CString(systemPrompt), C.CString(userPrompt)}
+	defer func() {
+		for _, s := range append(roles, contents...) {
+			C.free(unsafe.Pointer(s))
+		}
+	}()
+
+	msgs := (*C.struct_llama_chat_message)(C.malloc(C.size_t(len(roles)) * C.size_t(unsafe.Sizeof(C.struct_llama_chat_message{}))))
+	defer C.free(unsafe.Pointer(msgs))
+	slots := unsafe.Slice(msgs, len(roles))
+	for i := range slots {
+		slots[i] = C.struct_llama_chat_message{role: roles[i], content: contents[i]}
+	}
+
+	size := len(systemPrompt) + len(userPrompt) + 1024
+	for {
+		buf := (*C.char)(C.malloc(C.size_t(size)))
+		n := C.llama_chat_apply_template(tmpl, msgs, C.size_t(len(roles)), true, buf, C.int32_t(size))
+		if n < 0 {
+			C.free(unsafe.Pointer(buf))
+			return "", errors.New("failed to apply chat template")
+		}
+		if int(n) <= size {
+			result := C.GoStringN(buf, n)
+			C.free(unsafe.Pointer(buf))
+			return result, nil
+		}
+		C.free(unsafe.Pointer(buf))
+		size = int(n)
+	}
+}
+
+// cutAtStop truncates text at the first stop sequence, if any.
+func cutAtStop(text string, stop []string) (string, bool) {
+	for _, s := range stop {
+		if i := strings.Index(text, s); i >= 0 {
+			return text[:i], true
+		}
+	}
+	return text, false
+}
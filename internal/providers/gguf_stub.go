@@ -0,0 +1,12 @@
+//go:build !llama
+
+package providers
+
+import "errors"
+
+// GGUFAvailable reports whether this binary was built with llama.cpp support.
+const GGUFAvailable = false
+
+func loadGGUFEngine(modelPath string, options GGUFOptions) (ggufEngine, error) {
+	return nil, errors.New("in-process GGUF inference requires a build with -tags llama (see `make build-gguf`)")
+}
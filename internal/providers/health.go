@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HealthChecker is implemented by providers that can cheaply check that
+// their endpoint is reachable, without generating anything.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+const healthTimeout = 5 * time.Second
+
+// probeEndpoint sends a GET to url. Any response below 500 counts as
+// healthy: a 401 or 404 still proves the server is up.
+func probeEndpoint(ctx context.Context, url string, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return newRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		body, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// StartHealthChecks probes the providers requests are routed to each
+// interval, if they are HealthCheckers, and feeds the results into the
+// circuit breakers, so a provider that went down
+// is skipped before a request has to time out, and one that came back is
+// used again without waiting for the cooldown. It stops when ctx is done.
+func (r *Registry) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.checkHealth(ctx)
+			}
+		}
+	}()
+}
+
+func (r *Registry) checkHealth(ctx context.Context) {
+	// Probing while idle would keep connections alive that were just
+	// released.
+	if r.idle.isReleased() {
+		return
+	}
+
+	// Only what requests go to without a session choosing otherwise is
+	// probed; the others may never be used, and need not be reachable.
+	r.mu.RLock()
+	routed := []string{r.current, r.fallback, r.rival}
+	for _, task := range r.tasks {
+		routed = append(routed, task.provider)
+	}
+	checkers := make(map[string]HealthChecker)
+	for _, name := range routed {
+		if checker, ok := r.providers[name].(HealthChecker); ok {
+			checkers[name] = checker
+		}
+	}
+	r.mu.RUnlock()
+
+	for name, checker := range checkers {
+		// Probes only speak for the endpoint, so they may close an open
+		// circuit or count towards opening one, like real requests.
+		r.recordHealth(name, checker.Health(ctx))
+	}
+}
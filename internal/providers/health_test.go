@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// probed is a provider that records its health probes and releases.
+type probed struct {
+	name string
+	log  *probeLog
+}
+
+type probeLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *probeLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *probeLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := l.events
+	l.events = nil
+	slices.Sort(events)
+	return events
+}
+
+func (p probed) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	return []string{"x"}, nil
+}
+
+func (p probed) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	return &ChatResponse{Result: "x"}, nil
+}
+
+func (p probed) Health(ctx context.Context) error {
+	p.log.add("health " + p.name)
+	return nil
+}
+
+func (p probed) Release(ctx context.Context) error {
+	p.log.add("release " + p.name)
+	return nil
+}
+
+func newProbedRegistry(log *probeLog, names ...string) *Registry {
+	r := NewRegistry()
+	for _, name := range names {
+		r.Register(name, probed{name: name, log: log})
+	}
+	return r
+}
+
+func TestHealthChecksRoutedProviders(t *testing.T) {
+	log := &probeLog{}
+	r := newProbedRegistry(log, "current", "fallback", "chat", "unused")
+	r.SetCurrent("current")
+	r.SetFallback("fallback", 3, time.Minute)
+	r.SetTaskRoute(CallChat, "chat", "")
+	r.SetCircuitBreaker(3, time.Minute)
+
+	r.checkHealth(context.Background())
+	if got, want := log.take(), []string{"health chat", "health current", "health fallback"}; !slices.Equal(got, want) {
+		t.Errorf("probed %v, want %v", got, want)
+	}
+}
+
+func TestCacheHitKeepsHalfOpenProbe(t *testing.T) {
+	r := newProbedRegistry(&probeLog{}, "current")
+	r.SetCurrent("current")
+	r.SetCompletionCache(10, time.Minute)
+	r.SetCircuitBreaker(1, 0)
+	ctx := context.Background()
+	req := CompletionRequest{ContentBefore: "x"}
+
+	if _, err := r.Completion(ctx, req, "a.go", "go", 1); err != nil {
+		t.Fatal(err)
+	}
+	r.recordHealth("current", &ProviderError{Kind: ErrorKindNetwork, Message: "down"})
+
+	// Each hit takes the half-open probe slot and must give it back.
+	for i := range 3 {
+		if _, err := r.Completion(ctx, req, "a.go", "go", 1); err != nil {
+			t.Fatalf("cache hit %d: %v", i+1, err)
+		}
+	}
+	if state := r.breaker("current").current(); state != circuitHalfOpen {
+		t.Errorf("circuit %s after cache hits, want half-open", state)
+	}
+
+	if _, err := r.Completion(ctx, CompletionRequest{ContentBefore: "y"}, "a.go", "go", 1); err != nil {
+		t.Fatalf("probe after cache hits: %v", err)
+	}
+	if state := r.breaker("current").current(); state != circuitClosed {
+		t.Errorf("circuit %s after a successful probe, want closed", state)
+	}
+}
@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Releaser is implemented by providers that hold resources worth giving back
+// while the editor sits idle, such as a model kept loaded by a local server.
+// The next request must work without any explicit re-initialisation.
+type Releaser interface {
+	Release(ctx context.Context) error
+}
+
+const releaseTimeout = 10 * time.Second
+
+type idleTracker struct {
+	mu       sync.Mutex
+	lastUsed time.Time
+	released bool
+	// used holds the providers requests went to since the last release.
+	used map[usedProvider]bool
+	// onRelease runs after each release.
+	onRelease func()
+}
+
+// usedProvider names a provider of the registry or, when account is set,
+// one the account owns.
+type usedProvider struct {
+	account *Account
+	name    string
+}
+
+// use records a request to the named provider for account, which may be
+// nil.
+func (t *idleTracker) use(account *Account, name string) {
+	if !account.owns(name) {
+		account = nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.used == nil {
+		t.used = make(map[usedProvider]bool)
+	}
+	t.used[usedProvider{account, name}] = true
+}
+
+// takeUsed returns the providers used since it was last called.
+func (t *idleTracker) takeUsed() map[usedProvider]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	used := t.used
+	t.used = nil
+	return used
+}
+
+// touch marks a request and reports whether resources had been released.
+func (t *idleTracker) touch(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	wasReleased := t.released
+	t.lastUsed = now
+	t.released = false
+	return wasReleased
+}
+
+// expire reports whether the tracker just crossed the idle threshold, so
+// resources are released once per idle period.
+func (t *idleTracker) expire(now time.Time, idle time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.released || now.Sub(t.lastUsed) < idle {
+		return false
+	}
+	t.released = true
+	return true
+}
+
+func (t *idleTracker) isReleased() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.released
+}
+
+// touch records provider use. The first request after an idle release
+// warms the completion model up again, as WarmUp does at startup, while
+// connections come back on their own with the requests themselves.
+func (r *Registry) touch(ctx context.Context) {
+	if r.idle.touch(time.Now()) {
+		r.log("Resuming after idle, re-warming providers")
+		r.WarmUp(context.WithoutCancel(ctx))
+	}
+}
+
+// StartIdleRelease releases provider resources once no request was made for
+// idle: pooled HTTP connections are closed, cached completions dropped and
+// each Releaser that requests went to since the last release, including
+// those of accounts, is asked to free what it holds. onRelease, when not
+// nil, runs after each release, to save what should survive the machine
+// sleeping or being shut down while idle. Health checks pause until the
+// next request. It stops when ctx is done.
+func (r *Registry) StartIdleRelease(ctx context.Context, idle time.Duration, onRelease func()) {
+	r.idle.mu.Lock()
+	r.idle.onRelease = onRelease
+	r.idle.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(min(idle/4, 30*time.Second))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if r.idle.expire(now, idle) {
+					r.release(ctx)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Registry) release(ctx context.Context) {
+	r.log("Idle, releasing provider resources")
+
+	// Releasing a provider nothing used would wake it, such as a local
+	// server asked to unload a model it never loaded.
+	used := r.idle.takeUsed()
+	r.mu.RLock()
+	releasers := make(map[usedProvider]Releaser)
+	for p := range used {
+		provider := r.providers[p.name]
+		if p.account != nil {
+			provider = p.account.providers[p.name]
+		}
+		if releaser, ok := provider.(Releaser); ok {
+			releasers[p] = releaser
+		}
+	}
+	r.mu.RUnlock()
+
+	for p, releaser := range releasers {
+		ctx, cancel := context.WithTimeout(ctx, releaseTimeout)
+		if err := releaser.Release(ctx); err != nil {
+			if p.account != nil {
+				r.log("Release failed for", p.name, "of", p.account.Name, "error:", err.Error())
+			} else {
+				r.log("Release failed for", p.name, "error:", err.Error())
+			}
+		}
+		cancel()
+	}
+
+	if n := r.ClearCompletionCache(); n > 0 {
+		r.log("Dropped", n, "cached completions")
+	}
+	httpClient.CloseIdleConnections()
+
+	r.idle.mu.Lock()
+	onRelease := r.idle.onRelease
+	r.idle.mu.Unlock()
+	if onRelease != nil {
+		onRelease()
+	}
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIdleReleaseUsedProviders(t *testing.T) {
+	log := &probeLog{}
+	r := newProbedRegistry(log, "current", "unused")
+	r.SetCurrent("current")
+	r.SetCompletionCache(10, time.Minute)
+	ctx := context.Background()
+
+	if _, err := r.Completion(ctx, CompletionRequest{ContentBefore: "x"}, "a.go", "go", 1); err != nil {
+		t.Fatal(err)
+	}
+	r.release(ctx)
+	if got, want := log.take(), []string{"release current"}; !slices.Equal(got, want) {
+		t.Errorf("released %v, want %v", got, want)
+	}
+	if n := r.ClearCompletionCache(); n != 0 {
+		t.Errorf("%d completions still cached after release", n)
+	}
+
+	// Nothing was used since.
+	r.release(ctx)
+	if got := log.take(); len(got) != 0 {
+		t.Errorf("released %v again without a request", got)
+	}
+}
+
+func TestIdleReleaseAccountProviders(t *testing.T) {
+	log := &probeLog{}
+	r := newProbedRegistry(log, "current", "shared")
+	r.SetCurrent("current")
+	saved := 0
+	r.idle.onRelease = func() { saved++ }
+	alice := NewAccount("alice", map[string]Provider{"current": probed{name: "alice current", log: log}})
+	ctx := WithAccount(context.Background(), alice)
+
+	if _, err := r.Completion(ctx, CompletionRequest{ContentBefore: "x"}, "a.go", "go", 1); err != nil {
+		t.Fatal(err)
+	}
+	r.SetCurrent("shared")
+	if _, err := r.Completion(ctx, CompletionRequest{ContentBefore: "x"}, "a.go", "go", 1); err != nil {
+		t.Fatal(err)
+	}
+	r.release(context.Background())
+	if got, want := log.take(), []string{"release alice current", "release shared"}; !slices.Equal(got, want) {
+		t.Errorf("released %v, want %v", got, want)
+	}
+	if saved != 1 {
+		t.Errorf("onRelease ran %d times, want 1", saved)
+	}
+}
@@ -0,0 +1,109 @@
+package providers
+
+import "context"
+
+// Call kinds passed to middleware.
+const (
+	CallCompletion = "completion"
+	CallChat       = "chat"
+)
+
+// Call describes a request passing through the registry. Middleware may
+// rewrite the request fields before the provider sees them.
+type Call struct {
+	Kind string
+	// Provider is the name of the provider that handled the call. It is set
+	// by the time AfterResponse runs, unless the call was answered early.
+	Provider string
+	// Model is the model the provider served the call with, when it has
+	// switchable models.
+	Model string
+	// Stream is set for ChatStream and CompletionStream calls.
+	Stream bool
+	// Structured is set for ChatStructured calls.
+	Structured bool
+
+	// Completion calls.
+	Request        CompletionRequest
+	Filepath       string
+	LanguageID     string
+	NumSuggestions int
+
+	// Chat calls.
+	SystemPrompt string
+	UserPrompt   string
+}
+
+// servedBy records that the named provider handles the call.
+func (c *Call) servedBy(name string, provider Provider) {
+	c.Provider, c.Model = name, ""
+	if switcher, ok := provider.(ModelSwitcher); ok {
+		model, chatModel := switcher.Models()
+		c.Model = model
+		if c.Kind == CallChat {
+			c.Model = chatModel
+		}
+	}
+}
+
+// Result is the outcome of a call: Completions for completion calls, Chat
+// for chat calls.
+type Result struct {
+	Completions []string
+	Chat        *ChatResponse
+}
+
+// Middleware layers cross-cutting behaviour such as logging, redaction,
+// caching or metrics over every provider. Register it with Registry.Use.
+type Middleware interface {
+	// BeforeRequest runs before the provider is called, in registration
+	// order. It may rewrite call, answer it by returning a non-nil result
+	// (a cache hit, say), or abort it by returning an error.
+	BeforeRequest(ctx context.Context, call *Call) (*Result, error)
+	// AfterResponse runs once a result or error is available, in reverse
+	// order, for every middleware whose BeforeRequest ran, including one
+	// that answered or aborted the call. It may rewrite result and returns
+	// the error to pass on, normally err itself.
+	AfterResponse(ctx context.Context, call *Call, result *Result, err error) error
+}
+
+// Use appends middleware to the chain run around every Completion, Chat and
+// streaming call. Streamed deltas are not intercepted; AfterResponse sees
+// the complete result.
+func (r *Registry) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// intercept runs call through the middleware chain around send.
+func (r *Registry) intercept(ctx context.Context, call *Call, send func(context.Context, *Call) (*Result, error)) (*Result, error) {
+	ctx, done, err := r.life.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	r.mu.RLock()
+	chain := r.middleware
+	r.mu.RUnlock()
+
+	for i, m := range chain {
+		result, err := m.BeforeRequest(ctx, call)
+		if err != nil || result != nil {
+			return unwind(ctx, chain[:i+1], call, result, err)
+		}
+	}
+
+	result, err := send(ctx, call)
+	stripResult(result)
+	r.recordServed(ctx, call)
+	return unwind(ctx, chain, call, result, err)
+}
+
+func unwind(ctx context.Context, chain []Middleware, call *Call, result *Result, err error) (*Result, error) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		err = chain[i].AfterResponse(ctx, call, result, err)
+	}
+	return result, err
+}
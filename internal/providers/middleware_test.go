@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recorder is middleware that logs its hooks and can answer, abort or
+// rewrite calls.
+type recorder struct {
+	name   string
+	log    *[]string
+	answer *Result
+	abort  error
+	// rewrite replaces the error AfterResponse passes on, when set.
+	rewrite error
+}
+
+func (m recorder) BeforeRequest(ctx context.Context, call *Call) (*Result, error) {
+	*m.log = append(*m.log, "before "+m.name)
+	return m.answer, m.abort
+}
+
+func (m recorder) AfterResponse(ctx context.Context, call *Call, result *Result, err error) error {
+	*m.log = append(*m.log, "after "+m.name)
+	if m.rewrite != nil {
+		return m.rewrite
+	}
+	return err
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	errAbort := errors.New("aborted")
+	errRewritten := errors.New("rewritten")
+	cached := &Result{Completions: []string{"cached"}}
+	tests := []struct {
+		name  string
+		chain func(log *[]string) []Middleware
+		want  []string
+		err   error
+		sent  bool
+	}{
+		{"order", func(log *[]string) []Middleware {
+			return []Middleware{recorder{name: "a", log: log}, recorder{name: "b", log: log}}
+		}, []string{"before a", "before b", "after b", "after a"}, nil, true},
+		{"answered", func(log *[]string) []Middleware {
+			return []Middleware{recorder{name: "a", log: log}, recorder{name: "cache", log: log, answer: cached}, recorder{name: "c", log: log}}
+		}, []string{"before a", "before cache", "after cache", "after a"}, nil, false},
+		{"aborted", func(log *[]string) []Middleware {
+			return []Middleware{recorder{name: "a", log: log, abort: errAbort}, recorder{name: "b", log: log}}
+		}, []string{"before a", "after a"}, errAbort, false},
+		{"error rewritten", func(log *[]string) []Middleware {
+			return []Middleware{recorder{name: "a", log: log}, recorder{name: "b", log: log, rewrite: errRewritten}}
+		}, []string{"before a", "before b", "after b", "after a"}, errRewritten, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log []string
+			r := newProbedRegistry(&probeLog{}, "current")
+			r.SetCurrent("current")
+			r.Use(tt.chain(&log)...)
+
+			results, err := r.Completion(context.Background(), CompletionRequest{ContentBefore: "x"}, "a.go", "go", 1)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(log, tt.want) {
+				t.Errorf("ran %v, want %v", log, tt.want)
+			}
+			if tt.err == nil {
+				want := "cached"
+				if tt.sent {
+					want = "x"
+				}
+				if !slices.Equal(results, []string{want}) {
+					t.Errorf("results %v, want [%s]", results, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ModelSwitcher is implemented by providers whose models can be changed at
+// runtime. WithModels returns a new provider with the same endpoint and
+// credentials, leaving the receiver untouched for requests in flight.
+type ModelSwitcher interface {
+	Models() (model, chatModel string)
+	WithModels(model, chatModel string) Provider
+}
+
+// Names returns the registered provider names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Models returns the completion and chat models of the named provider.
+func (r *Registry) Models(name string) (string, string, error) {
+	r.mu.RLock()
+	provider, ok := r.providers[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return "", "", fmt.Errorf("provider not found: %s", name)
+	}
+
+	switcher, ok := provider.(ModelSwitcher)
+	if !ok {
+		return "", "", fmt.Errorf("provider %s does not have switchable models", name)
+	}
+
+	model, chatModel := switcher.Models()
+	return model, chatModel, nil
+}
+
+// SetModels replaces the models of the named provider. An empty chatModel
+// keeps the current chat model.
+func (r *Registry) SetModels(name, model, chatModel string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider, ok := r.providers[name]
+	if !ok {
+		return fmt.Errorf("provider not found: %s", name)
+	}
+
+	switcher, ok := provider.(ModelSwitcher)
+	if !ok {
+		return fmt.Errorf("provider %s does not have switchable models", name)
+	}
+
+	if chatModel == "" {
+		_, chatModel = switcher.Models()
+	}
+
+	r.providers[name] = switcher.WithModels(model, chatModel)
+	return nil
+}
+
+// ModelLister is implemented by providers that can report the models their
+// endpoint serves.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ListModels returns the models available from the provider ctx selected,
+// by default the current one.
+func (r *Registry) ListModels(ctx context.Context) ([]string, error) {
+	provider, name, err := r.selected(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := provider.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot list its models", name)
+	}
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(models)
+	return models, nil
+}
+
+// listIDs fetches an OpenAI-style `{"data": [{"id": ...}]}` model list,
+// which Anthropic's /v1/models also follows.
+func listIDs(ctx context.Context, url string, headers map[string]string, timeout time.Duration) ([]string, error) {
+	resp, err := requestJSON(ctx, "GET", url, headers, timeout, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &list); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, model := range list.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
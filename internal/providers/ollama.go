@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,21 +27,39 @@ type OllamaProvider struct {
 	model      string
 	chatModel  string
 	endpoint   string
+	keepAlive  any
+	dedup      DedupStrictness
+	trustModel bool
+	autoPull   bool
+	pulls      *ollamaPulls
 	timeout    time.Duration
 	logger     *lsp.Logger
 	httpClient *http.Client
+	throughput throughputMeter
 }
 
-func NewOllamaProvider(model, chatModel, endpoint string, timeoutMs int, logger *lsp.Logger) *OllamaProvider {
+// NewOllamaProvider creates an Ollama provider. keepAlive is how long the
+// daemon keeps the models loaded after a request, as a duration such as
+// "30m", a number of seconds, or "-1" for ever; empty uses the daemon's
+// default. dedup sets how completions repeating the code after the cursor
+// are trimmed. trustModel skips all cleaning but stripping special tokens,
+// for FIM-native models that do not produce chat artifacts. autoPull
+// downloads models the daemon does not have yet.
+func NewOllamaProvider(model, chatModel, endpoint, keepAlive string, dedup DedupStrictness, trustModel, autoPull bool, timeoutMs int, logger *lsp.Logger) *OllamaProvider {
 	if chatModel == "" {
 		chatModel = model
 	}
 	return &OllamaProvider{
-		model:     model,
-		chatModel: chatModel,
-		endpoint:  strings.TrimSuffix(endpoint, "/"),
-		timeout:   time.Duration(timeoutMs) * time.Millisecond,
-		logger:    logger,
+		model:      model,
+		chatModel:  chatModel,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		keepAlive:  ollamaKeepAlive(keepAlive),
+		dedup:      dedup,
+		trustModel: trustModel,
+		autoPull:   autoPull,
+		pulls:      &ollamaPulls{active: map[string]bool{}},
+		timeout:    time.Duration(timeoutMs) * time.Millisecond,
+		logger:     logger,
 		httpClient: &http.Client{
 			Timeout: time.Duration(timeoutMs) * time.Millisecond,
 		},
@@ -54,18 +73,38 @@ type ollamaGenerateRequest struct {
 	Stream  bool           `json:"stream"`
 	Raw     bool           `json:"raw,omitempty"`
 	Options map[string]any `json:"options,omitempty"`
+	// KeepAlive is a duration string or seconds; 0 unloads the model.
+	KeepAlive any `json:"keep_alive,omitempty"`
 }
 
 type ollamaGenerateResponse struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
+	Response           string `json:"response"`
+	Done               bool   `json:"done"`
+	LoadDuration       int64  `json:"load_duration"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration"`
+	EvalCount          int    `json:"eval_count"`
+	EvalDuration       int64  `json:"eval_duration"`
 }
 
 type ollamaChatRequest struct {
-	Model    string         `json:"model"`
-	Messages []ollamaMsg    `json:"messages"`
-	Stream   bool           `json:"stream"`
-	Options  map[string]any `json:"options,omitempty"`
+	Model     string         `json:"model"`
+	Messages  []ollamaMsg    `json:"messages"`
+	Stream    bool           `json:"stream"`
+	Options   map[string]any `json:"options,omitempty"`
+	KeepAlive any            `json:"keep_alive,omitempty"`
+	Format    any            `json:"format,omitempty"`
+}
+
+// ollamaKeepAlive converts a keep-alive setting to the form the API takes:
+// bare numbers are seconds and must be sent as numbers.
+func ollamaKeepAlive(value string) any {
+	if value == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds
+	}
+	return value
 }
 
 type ollamaMsg struct {
@@ -79,33 +118,27 @@ type ollamaChatResponse struct {
 }
 
 func (p *OllamaProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
-	// Limit context to last 30 lines (increased from 20)
-	beforeLines := strings.Split(req.ContentBefore, "\n")
-	if len(beforeLines) > 30 {
-		beforeLines = beforeLines[len(beforeLines)-30:]
-	}
-	before := strings.Join(beforeLines, "\n")
-
-	// Limit after context to 15 lines (increased from 5 to show more existing code)
-	// This helps the model avoid regenerating code that already exists
-	afterLines := strings.Split(req.ContentAfter, "\n")
-	if len(afterLines) > 15 {
-		afterLines = afterLines[:15]
-	}
-	after := strings.Join(afterLines, "\n")
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
 
 	p.logger.Log("Ollama FIM before:", before[maxInt(0, len(before)-200):])
 	p.logger.Log("Ollama FIM after:", after[:minInt(100, len(after))])
 
-	// Build FIM prompt using Qwen-style tokens
-	// Format: <|fim_prefix|>{before}<|fim_suffix|>{after}<|fim_middle|>
-	fimPrompt := fmt.Sprintf("<|fim_prefix|>%s<|fim_suffix|>%s<|fim_middle|>", before, after)
+	template := fimTemplateFor(p.model)
+	fimPrompt := template.build(before, after)
+	p.logger.Log("Ollama FIM template:", template.name)
 
 	// Ensure at least 1 suggestion
 	if numSuggestions < 1 {
 		numSuggestions = 1
 	}
 
+	// Size generation to the time left so slow models return something
+	// before the deadline instead of being cancelled mid-generation.
+	numPredict := p.throughput.budget(ctx, 128)
+	if numPredict < 128 {
+		p.logger.Log("Ollama num_predict reduced to", numPredict, "for remaining timeout")
+	}
+
 	// Generate multiple suggestions in parallel
 	type completionResult struct {
 		index      int
@@ -121,29 +154,11 @@ func (p *OllamaProvider) Completion(ctx context.Context, req CompletionRequest,
 		go func(idx int) {
 			defer wg.Done()
 
-			// Increase temperature for subsequent suggestions to get diversity
-			// First: 0.2, Second: 0.4, Third: 0.6, etc.
-			temperature := 0.2 + (float64(idx) * 0.2)
-			if temperature > 0.9 {
-				temperature = 0.9
-			}
-
-			apiReq := ollamaGenerateRequest{
-				Model:  p.model,
-				Prompt: fimPrompt,
-				Stream: false,
-				Raw:    true,
-				Options: map[string]any{
-					"temperature": temperature,
-					"top_p":       0.9,
-					"num_predict": 128,
-					"stop":        []string{"\n\n\n", "<|fim", "<|end", "<|file", "```", "\nfunc ", "\n//"},
-					"seed":        idx, // Different seed for each suggestion
-				},
-			}
+			apiReq := p.fimRequest(req, template, fimPrompt, idx, numPredict)
 
 			resp, err := p.doRequest(ctx, "/api/generate", apiReq)
 			if err != nil {
+				err = p.pullIfMissing(err, p.model)
 				p.logger.Log("Ollama request failed for suggestion", idx+1, ":", err)
 				resultChan <- completionResult{idx, "", err}
 				return
@@ -156,6 +171,12 @@ func (p *OllamaProvider) Completion(ctx context.Context, req CompletionRequest,
 				return
 			}
 
+			p.throughput.observe(
+				apiResp.EvalCount,
+				time.Duration(apiResp.EvalDuration),
+				time.Duration(apiResp.LoadDuration+apiResp.PromptEvalDuration),
+			)
+
 			if apiResp.Response == "" {
 				p.logger.Log("Ollama returned empty response for suggestion", idx+1)
 				resultChan <- completionResult{idx, "", fmt.Errorf("empty response")}
@@ -239,12 +260,17 @@ func (p *OllamaProvider) isBlockContext(before string) bool {
 }
 
 func (p *OllamaProvider) cleanCompletion(response, before, after string) string {
+	response = stripReasoning(response)
 	if response == "" {
 		return ""
 	}
 
 	p.logger.Log("cleanCompletion input:", response[:minInt(300, len(response))])
 
+	if p.trustModel {
+		return trimFIMOutput(response)
+	}
+
 	// Remove markdown code blocks
 	codeBlockRe := regexp.MustCompile("(?s)```[a-z]*\\n?(.*?)```")
 	if matches := codeBlockRe.FindStringSubmatch(response); len(matches) > 1 {
@@ -255,7 +281,7 @@ func (p *OllamaProvider) cleanCompletion(response, before, after string) string
 	response = strings.Trim(response, "`")
 
 	// Remove model-specific tokens
-	for _, token := range []string{"<|", "<FILL>", "<CURSOR>", "</s>", "<s>"} {
+	for _, token := range leakedTokens() {
 		if idx := strings.Index(response, token); idx != -1 {
 			response = response[:idx]
 		}
@@ -275,7 +301,7 @@ func (p *OllamaProvider) cleanCompletion(response, before, after string) string
 	lower := strings.ToLower(strings.TrimSpace(response))
 	for _, prefix := range prefixes {
 		if strings.HasPrefix(lower, prefix) {
-			response = strings.TrimSpace(response[len(prefix):])
+			response = strings.TrimSpace(strings.TrimSpace(response)[len(prefix):])
 			lower = strings.ToLower(strings.TrimSpace(response))
 		}
 	}
@@ -300,8 +326,10 @@ func (p *OllamaProvider) cleanCompletion(response, before, after string) string
 	// Truncate at overlap with 'after' content
 	if after != "" {
 		response = p.truncateAtAfterOverlap(response, after)
-		response = p.removeAfterDuplicates(response, after)
-		response = p.removeAfterFunctionDuplicates(response, after)
+		if policy, ok := p.dedup.policy(); ok {
+			response = p.removeAfterDuplicates(response, after, policy)
+			response = p.removeAfterFunctionDuplicates(response, after, policy)
+		}
 	}
 
 	// For simple statements (no block opening), limit completion more aggressively
@@ -409,7 +437,7 @@ func (p *OllamaProvider) truncateAtAfterOverlap(response, after string) string {
 }
 
 // removeAfterDuplicates removes content from completion that duplicates the start of 'after'
-func (p *OllamaProvider) removeAfterDuplicates(response, after string) string {
+func (p *OllamaProvider) removeAfterDuplicates(response, after string, policy dedupPolicy) string {
 	afterLines := strings.Split(after, "\n")
 	respLines := strings.Split(response, "\n")
 
@@ -418,7 +446,7 @@ func (p *OllamaProvider) removeAfterDuplicates(response, after string) string {
 	validLines := respLines
 
 	// Check if the last few lines of response match the first few lines of after
-	for i := minInt(3, len(respLines)); i > 0; i-- {
+	for i := minInt(policy.trailingLines, len(respLines)); i > 0; i-- {
 		respEnd := respLines[len(respLines)-i:]
 		if len(afterLines) < i {
 			continue
@@ -460,7 +488,7 @@ func (p *OllamaProvider) removeAfterDuplicates(response, after string) string {
 }
 
 // removeAfterFunctionDuplicates removes entire function definitions from response if they appear in 'after'
-func (p *OllamaProvider) removeAfterFunctionDuplicates(response, after string) string {
+func (p *OllamaProvider) removeAfterFunctionDuplicates(response, after string, policy dedupPolicy) string {
 	if response == "" || after == "" {
 		return response
 	}
@@ -468,29 +496,33 @@ func (p *OllamaProvider) removeAfterFunctionDuplicates(response, after string) s
 	respLines := strings.Split(response, "\n")
 	afterLines := strings.Split(after, "\n")
 
-	// Only apply this cleanup if response is suspiciously long (>15 lines)
+	// Only apply this cleanup if response is suspiciously long
 	// This prevents removing valid short completions
-	if len(respLines) < 15 {
+	if len(respLines) < policy.minFunctionLines {
 		return response
 	}
 
 	// Look for function definitions that appear in both response and after
-	// Only remove if they're in the SECOND HALF of the response (likely duplicates)
-	startCheckFrom := len(respLines) / 2
+	// Conservatively, only remove if they're in the SECOND HALF of the response (likely duplicates)
+	// The first line never counts: the completion may start the function itself
+	startCheckFrom := 1
+	if policy.secondHalfOnly {
+		startCheckFrom = len(respLines) / 2
+	}
 
 	for i := startCheckFrom; i < len(respLines); i++ {
 		line := strings.TrimSpace(respLines[i])
 		// Check if this line starts a function definition
 		if strings.HasPrefix(line, "func ") || strings.HasPrefix(line, "func(") {
-			// Check if this exact function signature appears in first 10 lines of after
-			for j := 0; j < minInt(10, len(afterLines)); j++ {
+			// Check if this exact function signature appears in the first lines of after
+			for j := 0; j < minInt(policy.suffixLines, len(afterLines)); j++ {
 				afterLine := strings.TrimSpace(afterLines[j])
 				if line == afterLine {
 					// Found matching function in after context - likely a duplicate
 					p.logger.Log("Removing duplicate function from completion:", line)
 					result := strings.TrimRight(strings.Join(respLines[:i], "\n"), " \t\n")
-					// Safety: don't remove more than 70% of response
-					if len(result) > len(response)/3 {
+					// Safety: don't remove too much of the response
+					if result != "" && float64(len(result)) > float64(len(response))*policy.minKept {
 						return result
 					}
 					p.logger.Log("Skipping removal - would remove too much content")
@@ -502,8 +534,40 @@ func (p *OllamaProvider) removeAfterFunctionDuplicates(response, after string) s
 	return response
 }
 
-func (p *OllamaProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
-	apiReq := ollamaChatRequest{
+// fimRequest builds the generate request for suggestion idx.
+func (p *OllamaProvider) fimRequest(req CompletionRequest, template fimTemplate, fimPrompt string, idx, numPredict int) ollamaGenerateRequest {
+	// Increase temperature for subsequent suggestions to get diversity
+	// First: 0.2, Second: 0.4, Third: 0.6, etc.
+	temperature := 0.2 + (float64(idx) * 0.2)
+	if temperature > 0.9 {
+		temperature = 0.9
+	}
+
+	// The extra stops cut multi-line output at likely declaration
+	// boundaries; a trusted model gets only its own end tokens.
+	stop := req.stopSequences(template.stopSequences())
+	if !p.trustModel {
+		stop = append(stop, "\nfunc ", "\n//")
+	}
+
+	return ollamaGenerateRequest{
+		Model:     p.model,
+		Prompt:    fimPrompt,
+		Stream:    false,
+		Raw:       true,
+		KeepAlive: p.keepAlive,
+		Options: map[string]any{
+			"temperature": temperature,
+			"top_p":       0.9,
+			"num_predict": numPredict,
+			"stop":        stop,
+			"seed":        idx, // Different seed for each suggestion
+		},
+	}
+}
+
+func (p *OllamaProvider) chatRequest(systemPrompt, userPrompt string) ollamaChatRequest {
+	return ollamaChatRequest{
 		Model: p.chatModel,
 		Messages: []ollamaMsg{
 			{Role: "system", Content: systemPrompt},
@@ -514,11 +578,16 @@ func (p *OllamaProvider) Chat(ctx context.Context, systemPrompt, userPrompt stri
 			"temperature": 0.1,
 			"num_predict": 2048,
 		},
+		KeepAlive: p.keepAlive,
 	}
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := p.chatRequest(systemPrompt, userPrompt)
 
 	resp, err := p.doRequest(ctx, "/api/chat", apiReq)
 	if err != nil {
-		return nil, err
+		return nil, p.pullIfMissing(err, p.chatModel)
 	}
 
 	var apiResp ollamaChatResponse
@@ -534,7 +603,37 @@ func (p *OllamaProvider) Chat(ctx context.Context, systemPrompt, userPrompt stri
 	return &ChatResponse{Result: result}, nil
 }
 
+// ChatStructured passes the action result schema as Ollama's format, which
+// constrains sampling to it.
+func (p *OllamaProvider) ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := p.chatRequest(structuredSystemPrompt(systemPrompt), userPrompt)
+	apiReq.Format = actionResultSchema
+
+	resp, err := p.doRequest(ctx, "/api/chat", apiReq)
+	if err != nil {
+		return nil, p.pullIfMissing(err, p.chatModel)
+	}
+
+	var apiResp ollamaChatResponse
+	if err := json.Unmarshal(resp, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	if apiResp.Message == nil || apiResp.Message.Content == "" {
+		return nil, fmt.Errorf("no response from model")
+	}
+
+	result := structuredResponse(apiResp.Message.Content)
+	if !result.Structured {
+		result.Result = p.cleanChatResponse(result.Result)
+	}
+	return result, nil
+}
+
 func (p *OllamaProvider) cleanChatResponse(response string) string {
+	// Reasoning may hold code blocks of its own.
+	response = stripReasoning(response)
+
 	// Remove markdown code blocks
 	codeBlockRe := regexp.MustCompile("(?s)```[a-z]*\\n?(.*?)```")
 	if matches := codeBlockRe.FindStringSubmatch(response); len(matches) > 1 {
@@ -549,6 +648,12 @@ func (p *OllamaProvider) doRequest(ctx context.Context, endpoint string, body an
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
+	return withRetry(ctx, func() ([]byte, error) {
+		return p.send(ctx, endpoint, jsonBody)
+	})
+}
+
+func (p *OllamaProvider) send(ctx context.Context, endpoint string, jsonBody []byte) ([]byte, error) {
 	url := p.endpoint + endpoint
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
 	if err != nil {
@@ -557,14 +662,10 @@ func (p *OllamaProvider) doRequest(ctx context.Context, endpoint string, body an
 
 	req.Header.Set("Content-Type", "application/json")
 
-	// Use a client without timeout since we rely on context for cancellation
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// The shared client has no timeout since we rely on context for cancellation
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, newRequestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -581,14 +682,167 @@ func (p *OllamaProvider) doRequest(ctx context.Context, endpoint string, body an
 
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, newRequestError(ctx, ctx.Err())
 	case r := <-done:
 		if r.err != nil {
 			return nil, fmt.Errorf("read response: %w", r.err)
 		}
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(r.data))
+			return nil, newResponseError(resp, r.data)
 		}
 		return r.data, nil
 	}
 }
+
+// Health checks that the Ollama daemon is running.
+func (p *OllamaProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/api/tags", nil)
+}
+
+// Release asks the daemon to unload the completion and chat models. Ollama
+// loads them again on the next request.
+func (p *OllamaProvider) Release(ctx context.Context) error {
+	models := []string{p.model}
+	if p.chatModel != p.model {
+		models = append(models, p.chatModel)
+	}
+
+	for _, model := range models {
+		if _, err := p.doRequest(ctx, "/api/generate", ollamaGenerateRequest{Model: model, KeepAlive: 0}); err != nil {
+			return err
+		}
+		p.logger.Log("Ollama unloaded model", model)
+	}
+	return nil
+}
+
+// WarmUp loads the completion model. A generate request without a prompt
+// only loads the model and returns once it is ready. With auto-pull, a
+// missing model is pulled first, in the background.
+func (p *OllamaProvider) WarmUp(ctx context.Context) error {
+	if p.autoPull {
+		present, err := p.show(ctx, p.model)
+		if err != nil {
+			return err
+		}
+		if !present {
+			p.startPull(p.model)
+			return nil
+		}
+	}
+
+	_, err := p.doRequest(ctx, "/api/generate", ollamaGenerateRequest{Model: p.model, KeepAlive: p.keepAlive})
+	return err
+}
+
+// ollamaStreamChunk is one line of a streamed /api/generate or /api/chat
+// response.
+type ollamaStreamChunk struct {
+	Response string     `json:"response"`
+	Message  *ollamaMsg `json:"message"`
+	Done     bool       `json:"done"`
+	Error    string     `json:"error"`
+}
+
+func (p *OllamaProvider) ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	apiReq := p.chatRequest(systemPrompt, userPrompt)
+	apiReq.Stream = true
+
+	text, err := p.stream(ctx, "/api/chat", apiReq, onDelta)
+	if err != nil {
+		return nil, p.pullIfMissing(err, p.chatModel)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("no response from model")
+	}
+	return &ChatResponse{Result: p.cleanChatResponse(text)}, nil
+}
+
+func (p *OllamaProvider) CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+
+	template := fimTemplateFor(p.model)
+	apiReq := p.fimRequest(req, template, template.build(before, after), 0, p.throughput.budget(ctx, 128))
+	apiReq.Stream = true
+
+	text, err := p.stream(ctx, "/api/generate", apiReq, onDelta)
+	if err != nil {
+		return "", p.pullIfMissing(err, p.model)
+	}
+	return p.cleanCompletion(text, req.ContentBefore, req.ContentAfter), nil
+}
+
+// stream posts a streaming request and forwards the text of every NDJSON
+// chunk. The final chunk carries the token counts.
+func (p *OllamaProvider) stream(ctx context.Context, endpoint string, body any, onDelta StreamFunc) (string, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	resp, err := openStream(ctx, p.endpoint+endpoint, nil, jsonBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readNDJSON(ctx, resp.Body, func(line []byte) error {
+		var chunk ollamaStreamChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("parse stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return &ProviderError{Kind: ErrorKindServer, Message: chunk.Error}
+		}
+
+		delta := chunk.Response
+		if chunk.Message != nil {
+			delta = chunk.Message.Content
+		}
+		if chunk.Done {
+			recordUsage(ctx, line)
+		}
+		if delta == "" {
+			return nil
+		}
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+
+	return text.String(), err
+}
+
+func (p *OllamaProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *OllamaProvider) WithModels(model, chatModel string) Provider {
+	provider := NewOllamaProvider(model, chatModel, p.endpoint, "", p.dedup, p.trustModel, p.autoPull, int(p.timeout.Milliseconds()), p.logger)
+	provider.keepAlive = p.keepAlive
+	provider.pulls = p.pulls
+	return provider
+}
+
+// ListModels returns the locally pulled models from /api/tags.
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := requestJSON(ctx, "GET", p.endpoint+"/api/tags", nil, healthTimeout, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(resp, &tags); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	models := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
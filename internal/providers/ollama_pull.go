@@ -0,0 +1,164 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Notifying is implemented by providers that report long-running work of
+// their own to the user, such as downloading a model. The registry passes
+// its notifier on.
+type Notifying interface {
+	SetNotifier(notify func(message string))
+}
+
+const (
+	// pullTimeout bounds a model download.
+	pullTimeout = 2 * time.Hour
+	// pullReportInterval is the least time between progress messages.
+	pullReportInterval = 5 * time.Second
+)
+
+// ollamaPulls tracks model downloads so each model is pulled once, however
+// many requests find it missing. It is shared by the copies WithModels makes.
+type ollamaPulls struct {
+	mu     sync.Mutex
+	active map[string]bool
+	notify func(message string)
+}
+
+type ollamaPullProgress struct {
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// SetNotifier sets the callback that reports pull progress.
+func (p *OllamaProvider) SetNotifier(notify func(message string)) {
+	p.pulls.mu.Lock()
+	defer p.pulls.mu.Unlock()
+	p.pulls.notify = notify
+}
+
+func (p *OllamaProvider) notifyUser(message string) {
+	p.pulls.mu.Lock()
+	notify := p.pulls.notify
+	p.pulls.mu.Unlock()
+
+	p.logger.Log(message)
+	if notify != nil {
+		notify(message)
+	}
+}
+
+// pullIfMissing starts pulling model when err says it is not present and
+// auto-pull is on, returning an error that says so in place of the API's.
+func (p *OllamaProvider) pullIfMissing(err error, model string) error {
+	if !p.autoPull || KindOf(err) != ErrorKindModelNotFound {
+		return err
+	}
+	p.startPull(model)
+	return &ProviderError{Kind: ErrorKindModelNotFound, Message: fmt.Sprintf("Ollama model %s is not pulled yet, pulling it now", model), Err: err}
+}
+
+// show reports whether model is present, using /api/show.
+func (p *OllamaProvider) show(ctx context.Context, model string) (bool, error) {
+	_, err := p.doRequest(ctx, "/api/show", map[string]string{"model": model})
+	if KindOf(err) == ErrorKindModelNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *OllamaProvider) startPull(model string) {
+	p.pulls.mu.Lock()
+	if p.pulls.active[model] {
+		p.pulls.mu.Unlock()
+		return
+	}
+	p.pulls.active[model] = true
+	p.pulls.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.pulls.mu.Lock()
+			delete(p.pulls.active, model)
+			p.pulls.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+		defer cancel()
+
+		p.notifyUser(fmt.Sprintf("Ollama model %s not found, pulling it", model))
+		if err := p.pull(ctx, model); err != nil {
+			p.notifyUser(fmt.Sprintf("Pulling Ollama model %s failed: %s", model, err))
+			return
+		}
+
+		// Load the new model so the next request does not wait for it.
+		if _, err := p.doRequest(ctx, "/api/generate", ollamaGenerateRequest{Model: model, KeepAlive: p.keepAlive}); err != nil {
+			p.logger.Log("Ollama could not load pulled model", model, "error:", err.Error())
+		}
+		p.notifyUser(fmt.Sprintf("Pulled Ollama model %s, ready", model))
+	}()
+}
+
+// pull downloads model, reporting progress at most every
+// pullReportInterval.
+func (p *OllamaProvider) pull(ctx context.Context, model string) error {
+	body, err := json.Marshal(map[string]any{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+
+	resp, err := openStream(ctx, p.endpoint+"/api/pull", nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var lastReport time.Time
+	success := false
+	err = readNDJSON(ctx, resp.Body, func(line []byte) error {
+		var progress ollamaPullProgress
+		if err := json.Unmarshal(line, &progress); err != nil {
+			return fmt.Errorf("parse pull progress: %w", err)
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+		if progress.Status == "success" {
+			success = true
+			return nil
+		}
+
+		if progress.Total > 0 && time.Since(lastReport) >= pullReportInterval {
+			lastReport = time.Now()
+			p.notifyUser(fmt.Sprintf("Pulling Ollama model %s: %d%% of %s", model, progress.Completed*100/progress.Total, formatBytes(progress.Total)))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !success {
+		return errors.New("pull ended before it completed")
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.0f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+}
@@ -0,0 +1,31 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+func FuzzCleanCompletion(f *testing.F) {
+	f.Add("```go\nfor i := 0; i < n; i++ {\n```", "\tfor ", "\n}", false)
+	f.Add("Here's the completion: x := 1", "x := ", "", false)
+	f.Add("<think>hmm</think>foo()<|endoftext|>", "", ")", true)
+	f.Add("İstanbul", "\t", "", false)
+	f.Add("}}}}", "{{{{", "}}}}", false)
+
+	f.Fuzz(func(t *testing.T, response, before, after string, trustModel bool) {
+		p := &OllamaProvider{logger: lsp.NewLogger(""), dedup: DedupConservative, trustModel: trustModel}
+		cleaned := p.cleanCompletion(response, before, after)
+
+		if utf8.ValidString(response) && !utf8.ValidString(cleaned) {
+			t.Fatalf("cleaning %q produced invalid UTF-8: %q", response, cleaned)
+		}
+		for _, token := range leakedFIMTokens {
+			if strings.Contains(cleaned, token) {
+				t.Fatalf("cleaning %q kept %s: %q", response, token, cleaned)
+			}
+		}
+	})
+}
@@ -30,6 +30,7 @@ type OpenAIProvider struct {
 	model     string
 	chatModel string
 	endpoint  string
+	useFIM    bool
 	timeout   time.Duration
 	logger    *lsp.Logger
 }
@@ -38,7 +39,12 @@ func isReasoningModel(model string) bool {
 	return reasoningModels[model]
 }
 
-func NewOpenAIProvider(apiKey, model, chatModel, endpoint string, timeoutMs int, logger *lsp.Logger) *OpenAIProvider {
+// NewOpenAIProvider creates a provider for the OpenAI API. When useFIM is
+// set, completions go through the legacy /completions endpoint with the code
+// after the cursor as suffix, which suits gpt-3.5-turbo-instruct and
+// OpenAI-compatible coder servers; otherwise they are prompted through the
+// Responses API.
+func NewOpenAIProvider(apiKey, model, chatModel, endpoint string, useFIM bool, timeoutMs int, logger *lsp.Logger) *OpenAIProvider {
 	if chatModel == "" {
 		chatModel = model
 	}
@@ -47,6 +53,7 @@ func NewOpenAIProvider(apiKey, model, chatModel, endpoint string, timeoutMs int,
 		model:     model,
 		chatModel: chatModel,
 		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		useFIM:    useFIM,
 		timeout:   time.Duration(timeoutMs) * time.Millisecond,
 		logger:    logger,
 	}
@@ -65,6 +72,18 @@ type responsesRequest struct {
 	MaxToolCalls int                    `json:"max_tool_calls,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 	Reasoning    *reasoningConfig       `json:"reasoning,omitempty"`
+	Stream       bool                   `json:"stream,omitempty"`
+	Text         *responsesText         `json:"text,omitempty"`
+}
+
+// responsesText sets the output format of a /responses request.
+type responsesText struct {
+	Format struct {
+		Type   string         `json:"type"`
+		Name   string         `json:"name"`
+		Schema map[string]any `json:"schema"`
+		Strict bool           `json:"strict"`
+	} `json:"format"`
 }
 
 type responsesResponse struct {
@@ -79,30 +98,17 @@ type responsesResponse struct {
 }
 
 func (p *OpenAIProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if p.useFIM {
+		return p.fimCompletion(ctx, req, numSuggestions)
+	}
+
 	instructions := BuildCompletionSystemPrompt(languageID)
-	userPrompt := BuildCompletionUserPrompt(filepath, req.ContentBefore, req.ContentAfter)
+	userPrompt := completionUserPrompt(filepath, req)
 
 	results := make([]string, 0, numSuggestions)
 
 	for i := 0; i < numSuggestions; i++ {
-		respReq := responsesRequest{
-			Model:        p.model,
-			Instructions: instructions,
-			Input:        userPrompt,
-			Store:        false,
-			ServiceTier:  "priority",
-			MaxToolCalls: 0,
-			Metadata: map[string]interface{}{
-				"language": languageID,
-				"filepath": filepath,
-			},
-		}
-
-		if isReasoningModel(p.model) {
-			respReq.Reasoning = &reasoningConfig{
-				Effort: "minimal",
-			}
-		}
+		respReq := p.completionRequest(instructions, userPrompt, filepath, languageID)
 
 		resp, err := p.doRequest(ctx, "/responses", respReq)
 		if err != nil {
@@ -134,7 +140,63 @@ func (p *OpenAIProvider) Completion(ctx context.Context, req CompletionRequest,
 	return util.UniqueStrings(results), nil
 }
 
-func (p *OpenAIProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+// fimCompletion requests all suggestions in one /completions call with n.
+func (p *OpenAIProvider) fimCompletion(ctx context.Context, req CompletionRequest, numSuggestions int) ([]string, error) {
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+
+	temperature := 0.0
+	if numSuggestions > 1 {
+		temperature = 0.4
+	}
+
+	apiReq := completionsRequest{
+		Model:       p.model,
+		Prompt:      before,
+		Suffix:      after,
+		MaxTokens:   128,
+		Temperature: temperature,
+		N:           max(numSuggestions, 1),
+		Stop:        req.stopSequences(fimStopSequences),
+	}
+
+	resp, err := p.doRequest(ctx, "/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseCompletions(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log(fmt.Sprintf("OpenAI FIM returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *OpenAIProvider) completionRequest(instructions, userPrompt, filepath, languageID string) responsesRequest {
+	respReq := responsesRequest{
+		Model:        p.model,
+		Instructions: instructions,
+		Input:        userPrompt,
+		Store:        false,
+		ServiceTier:  "priority",
+		MaxToolCalls: 0,
+		Metadata: map[string]interface{}{
+			"language": languageID,
+			"filepath": filepath,
+		},
+	}
+
+	if isReasoningModel(p.model) {
+		respReq.Reasoning = &reasoningConfig{
+			Effort: "minimal",
+		}
+	}
+
+	return respReq
+}
+
+func (p *OpenAIProvider) chatRequest(systemPrompt, userPrompt string) responsesRequest {
 	respReq := responsesRequest{
 		Model:        p.chatModel,
 		Instructions: systemPrompt,
@@ -150,6 +212,31 @@ func (p *OpenAIProvider) Chat(ctx context.Context, systemPrompt, userPrompt stri
 		}
 	}
 
+	return respReq
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	return p.chat(ctx, p.chatRequest(systemPrompt, userPrompt))
+}
+
+// ChatStructured holds the model to the action result schema.
+func (p *OpenAIProvider) ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	respReq := p.chatRequest(structuredSystemPrompt(systemPrompt), userPrompt)
+	respReq.Text = &responsesText{}
+	respReq.Text.Format.Type = "json_schema"
+	respReq.Text.Format.Name = actionResultSchemaName
+	respReq.Text.Format.Schema = actionResultSchema
+	respReq.Text.Format.Strict = true
+
+	resp, err := p.chat(ctx, respReq)
+	if err != nil {
+		return nil, err
+	}
+	return structuredResponse(resp.Result), nil
+}
+
+func (p *OpenAIProvider) chat(ctx context.Context, respReq responsesRequest) (*ChatResponse, error) {
+
 	jsonReq, _ := json.MarshalIndent(respReq, "", "  ")
 	p.logger.Log("DEBUG [OpenAI Chat]: Request:", string(jsonReq))
 	resp, err := p.doRequest(ctx, "/responses", respReq)
@@ -194,6 +281,12 @@ func (p *OpenAIProvider) doRequest(ctx context.Context, endpoint string, body an
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
+	return withRetry(ctx, func() ([]byte, error) {
+		return p.send(ctx, endpoint, jsonBody)
+	})
+}
+
+func (p *OpenAIProvider) send(ctx context.Context, endpoint string, jsonBody []byte) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
@@ -206,9 +299,9 @@ func (p *OpenAIProvider) doRequest(ctx context.Context, endpoint string, body an
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+p.apiKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, newRequestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -218,8 +311,97 @@ func (p *OpenAIProvider) doRequest(ctx context.Context, endpoint string, body an
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, newResponseError(resp, respBody)
 	}
 
 	return respBody, nil
 }
+
+// Health checks that the API is reachable.
+func (p *OpenAIProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey})
+}
+
+type openAIStreamEvent struct {
+	Type     string          `json:"type"`
+	Delta    string          `json:"delta"`
+	Response json.RawMessage `json:"response"`
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	text, err := p.stream(ctx, p.chatRequest(systemPrompt, userPrompt), onDelta)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return nil, fmt.Errorf("no completion found")
+	}
+	return &ChatResponse{Result: text}, nil
+}
+
+func (p *OpenAIProvider) CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	if p.useFIM {
+		results, err := p.fimCompletion(ctx, req, 1)
+		if err != nil || len(results) == 0 {
+			return "", err
+		}
+		return results[0], onDelta(results[0])
+	}
+
+	instructions := BuildCompletionSystemPrompt(languageID)
+	userPrompt := completionUserPrompt(filepath, req)
+	return p.stream(ctx, p.completionRequest(instructions, userPrompt, filepath, languageID), onDelta)
+}
+
+// stream sends respReq to the Responses API with server-sent events and
+// forwards the output text deltas.
+func (p *OpenAIProvider) stream(ctx context.Context, respReq responsesRequest, onDelta StreamFunc) (string, error) {
+	respReq.Stream = true
+	jsonBody, err := json.Marshal(respReq)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := openStream(ctx, p.endpoint+"/responses", map[string]string{"Authorization": "Bearer " + p.apiKey}, jsonBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(ctx, resp.Body, func(data []byte) error {
+		var event openAIStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("parse stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "response.output_text.delta":
+			text.WriteString(event.Delta)
+			return onDelta(event.Delta)
+		case "response.completed":
+			recordUsage(ctx, event.Response)
+		case "response.failed", "error":
+			return &ProviderError{Kind: ErrorKindServer, Message: string(data)}
+		}
+		return nil
+	})
+
+	return text.String(), err
+}
+
+func (p *OpenAIProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *OpenAIProvider) WithModels(model, chatModel string) Provider {
+	return NewOpenAIProvider(p.apiKey, model, chatModel, p.endpoint, p.useFIM, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /models endpoint.
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey}, healthTimeout)
+}
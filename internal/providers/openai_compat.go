@@ -0,0 +1,214 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// Wire types shared by providers that speak the OpenAI-compatible
+// /completions and /chat/completions APIs.
+
+type completionsRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	Suffix      string   `json:"suffix,omitempty"`
+	Echo        bool     `json:"echo"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature float64  `json:"temperature"`
+	N           int      `json:"n,omitempty"`
+	BestOf      int      `json:"best_of,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type completionsResponse struct {
+	Choices []struct {
+		Text string `json:"text"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+type chatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model          string                  `json:"model,omitempty"`
+	Messages       []chatCompletionMessage `json:"messages"`
+	MaxTokens      int                     `json:"max_tokens,omitempty"`
+	Temperature    float64                 `json:"temperature"`
+	Stop           []string                `json:"stop,omitempty"`
+	ResponseFormat *responseFormat         `json:"response_format,omitempty"`
+}
+
+// responseFormat constrains chat output to a JSON schema.
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string         `json:"name"`
+		Schema map[string]any `json:"schema"`
+		Strict bool           `json:"strict"`
+	} `json:"json_schema"`
+}
+
+func jsonSchemaFormat() *responseFormat {
+	format := &responseFormat{Type: "json_schema"}
+	format.JSONSchema.Name = actionResultSchemaName
+	format.JSONSchema.Schema = actionResultSchema
+	format.JSONSchema.Strict = true
+	return format
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatCompletionMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// parseChatCompletion extracts the first message from an OpenAI-style
+// /chat/completions response.
+func parseChatCompletion(data []byte) (*ChatResponse, error) {
+	var apiResp chatCompletionResponse
+	if err := json.Unmarshal(data, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	if len(apiResp.Choices) == 0 || apiResp.Choices[0].Message.Content == "" {
+		return nil, fmt.Errorf("no completion found")
+	}
+
+	return &ChatResponse{Result: apiResp.Choices[0].Message.Content}, nil
+}
+
+// parseCompletions returns the trimmed, non-empty choices from an
+// OpenAI-style /completions response.
+func parseCompletions(data []byte) ([]string, error) {
+	var apiResp completionsResponse
+	if err := json.Unmarshal(data, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	results := make([]string, 0, len(apiResp.Choices))
+	for _, choice := range apiResp.Choices {
+		if text := trimFIMOutput(choice.Text); text != "" {
+			results = append(results, text)
+		}
+	}
+	return results, nil
+}
+
+type requestFunc func(ctx context.Context, endpoint string, body any) ([]byte, error)
+
+// chatPromptedCompletion produces completions from a /chat/completions API
+// using the completion prompts, for providers without a FIM endpoint.
+func chatPromptedCompletion(ctx context.Context, do requestFunc, model string, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	systemPrompt := BuildCompletionSystemPrompt(languageID)
+	userPrompt := completionUserPrompt(filepath, req)
+
+	temperature := 0.0
+	if numSuggestions > 1 {
+		temperature = 0.4
+	}
+
+	results := make([]string, 0, numSuggestions)
+
+	for i := 0; i < numSuggestions; i++ {
+		apiReq := chatCompletionRequest{
+			Model: model,
+			Messages: []chatCompletionMessage{
+				{Role: "system", Content: systemPrompt},
+				{Role: "user", Content: userPrompt},
+			},
+			MaxTokens:   256,
+			Temperature: temperature,
+		}
+
+		resp, err := do(ctx, "/chat/completions", apiReq)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		chatResp, err := parseChatCompletion(resp)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+		results = append(results, chatResp.Result)
+	}
+
+	return util.UniqueStrings(results), nil
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, timeout time.Duration, body any) ([]byte, error) {
+	return requestJSON(ctx, "POST", url, headers, timeout, body)
+}
+
+// requestJSON sends body (if not nil) as JSON and returns the response body,
+// classifying non-2xx statuses and transport failures. Transient failures are
+// retried according to the shared retry policy.
+func requestJSON(ctx context.Context, method, url string, headers map[string]string, timeout time.Duration, body any) ([]byte, error) {
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		if jsonBody, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+	}
+
+	return withRetry(ctx, func() ([]byte, error) {
+		return sendJSON(ctx, method, url, headers, timeout, jsonBody)
+	})
+}
+
+func sendJSON(ctx context.Context, method, url string, headers map[string]string, timeout time.Duration, jsonBody []byte) ([]byte, error) {
+	var reader io.Reader
+	if jsonBody != nil {
+		reader = bytes.NewReader(jsonBody)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, newRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newResponseError(resp, respBody)
+	}
+
+	return respBody, nil
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+)
+
+type overrideKey struct{}
+
+type override struct {
+	provider string
+	model    string
+}
+
+// WithOverride routes requests made with ctx to the named provider and, if
+// model is set, to that model for both completions and chat. Empty values
+// keep the current choice. Overridden requests bypass the quota fallback,
+// since the caller asked for a specific backend.
+func WithOverride(ctx context.Context, provider, model string) context.Context {
+	if provider == "" && model == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, overrideKey{}, override{provider: provider, model: model})
+}
+
+// routeOverride resolves the override in ctx, if any.
+func (r *Registry) routeOverride(ctx context.Context) (Provider, string, bool, error) {
+	o, ok := ctx.Value(overrideKey{}).(override)
+	if !ok {
+		return nil, "", false, nil
+	}
+	if o.provider == "" {
+		o.provider = r.Selected(ctx)
+	}
+	return r.resolve(ctx, o)
+}
+
+// resolve looks up the provider named by o for requests made with ctx,
+// switched to o's model if set.
+func (r *Registry) resolve(ctx context.Context, o override) (Provider, string, bool, error) {
+	name := o.provider
+	provider, found := r.lookup(ctx, name)
+
+	if !found {
+		return nil, name, true, fmt.Errorf("provider not found: %s", name)
+	}
+
+	if o.model != "" {
+		switcher, ok := provider.(ModelSwitcher)
+		if !ok {
+			return nil, name, true, fmt.Errorf("provider %s does not have switchable models", name)
+		}
+		provider = switcher.WithModels(o.model, o.model)
+	}
+
+	return provider, name, true, nil
+}
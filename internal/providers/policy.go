@@ -0,0 +1,39 @@
+package providers
+
+import "context"
+
+// selfHosted are the handlers that run on the user's own machine or
+// infrastructure rather than a third-party cloud.
+var selfHosted = map[string]bool{
+	"ollama": true,
+	"gguf":   true,
+	"vllm":   true,
+	"tabby":  true,
+}
+
+// IsSelfHosted reports whether the named provider is served by the user's
+// own infrastructure.
+func IsSelfHosted(name string) bool {
+	return selfHosted[name]
+}
+
+// SetPolicy installs a check run before any request is routed to a
+// provider, including fallback and race providers. A non-nil error refuses
+// the request. permit gets the request context, which may name the
+// workspace the request is for (see WithWorkspace).
+func (r *Registry) SetPolicy(permit func(ctx context.Context, name string) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = permit
+}
+
+func (r *Registry) permit(ctx context.Context, name string) error {
+	r.mu.RLock()
+	policy := r.policy
+	r.mu.RUnlock()
+
+	if policy == nil {
+		return nil
+	}
+	return policy(ctx, name)
+}
@@ -1,6 +1,9 @@
 package providers
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func BuildCompletionSystemPrompt(languageID string) string {
 	return fmt.Sprintf(`You are a %s code completion assistant. Complete the code at the cursor position.
@@ -40,6 +43,16 @@ Code after cursor (DO NOT duplicate or close delimiters that already exist here)
 Complete the code at the <CURSOR> position. The completion must fit seamlessly between the before and after sections.`, filepath, contentBefore, contentAfter)
 }
 
+// completionUserPrompt is BuildCompletionUserPrompt for req, noting the
+// interpolation the cursor is in.
+func completionUserPrompt(filepath string, req CompletionRequest) string {
+	prompt := BuildCompletionUserPrompt(filepath, req.ContentBefore, req.ContentAfter)
+	if in := req.Interpolation; in != nil {
+		prompt += fmt.Sprintf("\n\nThe <CURSOR> is inside a %s...%s string interpolation. Complete only its expression, on the same line, ending with the closing %s unless the code after the cursor starts with it. Do not start a new statement.", in.Open, in.Close, in.Close)
+	}
+	return prompt
+}
+
 func BuildFixCompleteSystemPrompt(languageID string) string {
 	return fmt.Sprintf(`You are a %s code assistant. Your task is to fix errors and complete unfinished code.
 
@@ -81,6 +94,126 @@ IMPORTANT: Every original line must appear EXACTLY as-is — do not modify, comp
 %s`, content)
 }
 
+func BuildExplainSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You explain %s code to a developer reading it for the first time.
+
+Rules:
+- Answer in Markdown, starting with one sentence on what the code does
+- Then walk through how it works, step by step, referring to names in the code
+- Point out anything surprising: side effects, error handling, edge cases
+- Quote code only in short inline spans or fenced blocks; do not repeat the whole selection
+- Be concrete and brief`, languageID)
+}
+
+func BuildExplainUserPrompt(content string) string {
+	return fmt.Sprintf("Explain the code below:\n%s", content)
+}
+
+func BuildSummarizeSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You summarize %s code.
+
+Rules:
+- Answer in Markdown: a one-line summary, then at most five bullet points
+- Cover what the code is for, its inputs and outputs, and what it depends on
+- Do not explain line by line and do not repeat the code`, languageID)
+}
+
+func BuildSummarizeUserPrompt(content string) string {
+	return fmt.Sprintf("Summarize the code below:\n%s", content)
+}
+
+func BuildReviewSelectionSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code reviewer. Review the selection and report real problems: bugs, unhandled errors, race conditions, security issues, and misleading names or comments.
+
+Rules:
+- Answer in Markdown: one bullet per finding, most important first, each naming the code it is about and suggesting a fix
+- Do not comment on style or formatting
+- Say so in one sentence when there is nothing worth reporting`, languageID)
+}
+
+func BuildReviewSelectionUserPrompt(content string) string {
+	return fmt.Sprintf("Review the code below:\n%s", content)
+}
+
+func BuildDocumentSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You write documentation comments for %s code. You NEVER change code.
+
+Rules:
+- Return the code with a documentation comment added directly above each function, method or type that lacks one
+- Return every original line EXACTLY as given, including existing comments
+- Follow the documentation conventions of %s (e.g. the comment starts with the name in Go, docstrings in Python)
+- Describe what the code does and returns, not how; keep it short
+- No markdown, no code fences — raw code only`, languageID, languageID)
+}
+
+func BuildDocumentUserPrompt(content string) string {
+	return fmt.Sprintf("Add documentation comments to the code below:\n%s", content)
+}
+
+func BuildGenerateTestsSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s testing assistant. Your task is to write unit tests for the given code.
+
+Rules:
+- Output ONLY the test code — no markdown, no explanations, no code fences
+- Write a complete test file of its own, with the package or module declaration and the imports it needs
+- Do NOT repeat the code under test
+- Use the standard testing framework and idioms of %s
+- Cover the normal case, edge cases and error paths
+- Prefer table-driven or parameterised tests where they fit`, languageID, languageID)
+}
+
+func BuildGenerateTestsUserPrompt(content string) string {
+	return fmt.Sprintf("Write unit tests for:\n%s", content)
+}
+
+func BuildReviewSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code reviewer. Review the file and report only real problems: bugs, unhandled errors, race conditions, security issues, and misleading names or comments.
+
+Rules:
+- Answer with a JSON array only — no markdown, no code fences, no text around it
+- Each finding is an object: {"line": <line number as shown>, "severity": "info" or "hint", "message": "<one sentence>"}
+- Use "info" for likely bugs and "hint" for suggestions
+- Report at most 10 findings, the most important first
+- Answer [] when there is nothing worth reporting — do not comment on style or formatting`, languageID)
+}
+
+func BuildReviewUserPrompt(filepath, numberedContent string) string {
+	return fmt.Sprintf("File: %s\n\n%s", filepath, numberedContent)
+}
+
+func BuildDocstringCheckSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s documentation reviewer. Check the doc comments of the file: report exported or public declarations without one, and doc comments that no longer match the code they describe.
+
+Rules:
+- Answer with a JSON array only — no markdown, no code fences, no text around it
+- Each finding is an object: {"line": <line number of the declaration as shown>, "severity": "info" or "hint", "message": "<one sentence>"}
+- Use "info" for doc comments that contradict the code and "hint" for missing ones
+- Report at most 10 findings, the most important first
+- Answer [] when the documentation is fine — do not comment on wording or style`, languageID)
+}
+
+func BuildFixCheckSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code assistant. List what fixing errors and completing unfinished code in the file would change, without changing it.
+
+Rules:
+- Answer with a JSON array only — no markdown, no code fences, no text around it
+- Each finding is an object: {"line": <line number as shown>, "severity": "info" or "hint", "message": "<one sentence saying what the fix would change>"}
+- Use "info" for errors that stop the code from compiling or running and "hint" for unfinished code
+- Report at most 10 findings, the most important first
+- Answer [] when there is nothing to fix or complete — do not suggest refactors`, languageID)
+}
+
+func BuildSaveCleanupSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code assistant. The file is about to be saved. Propose only trivial, certain fixes: remove unused imports and correct obvious typos in identifiers, strings and comments.
+
+Rules:
+- Answer with a JSON array only — no markdown, no code fences, no text around it
+- Each fix is an object: {"line": <line number as shown>, "old": "<exact text on that line>", "new": "<replacement text>"}
+- To remove a whole line, such as an unused import, set "old" to the whole line and "new" to ""
+- At most one fix per line, and never change behaviour, formatting or naming style
+- Answer [] when nothing is certainly wrong`, languageID)
+}
+
 func BuildCodeFromCommentSystemPrompt(languageID string) string {
 	return fmt.Sprintf(`You are a %s code generation assistant. Your task is to generate code based on the comment description in the selection.
 
@@ -96,6 +229,89 @@ func BuildCodeFromCommentUserPrompt(content string) string {
 	return fmt.Sprintf("Generate code from the comment description:\n%s", content)
 }
 
+func BuildCompleteBlockSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code completion assistant. Continue the code from the cursor until the enclosing block is complete.
+
+Rules:
+- Output ONLY the code to insert at the cursor — no markdown, no explanations, no code fences
+- Continue exactly from the cursor: do not repeat any code before it
+- Keep writing until the innermost block containing the cursor is syntactically closed, including its closing delimiter
+- Stop right after that block is closed; do not start another function or block
+- Do NOT duplicate code that already exists after the cursor
+- Match the indentation of the surrounding code`, languageID)
+}
+
+func BuildCompleteBlockUserPrompt(filepath, contentBefore, contentAfter string) string {
+	return fmt.Sprintf(`File: %s
+
+Code before cursor:
+%s<CURSOR>
+
+Code after cursor:
+%s
+
+Continue from <CURSOR> until the enclosing block is closed.`, filepath, contentBefore, contentAfter)
+}
+
+func BuildSkeletonSystemPrompt(languageID string) string {
+	return fmt.Sprintf(`You are a %s code generation assistant. You implement one declaration of a skeleton file at a time, or one group of consecutive constants and variables.
+
+Rules:
+- Output ONLY the given declaration or group, fully implemented — no markdown, no explanations, no code fences
+- Keep the signature, name and doc comments exactly as given
+- Replace TODO comments and empty or placeholder bodies with a working implementation
+- Use only types, functions and imports that exist in the skeleton or the standard library
+- Do NOT output any other declaration from the file
+- If the declaration needs no implementation (e.g. a type or constant), return it unchanged`, languageID)
+}
+
+func BuildSkeletonUserPrompt(skeleton, declaration string) string {
+	return fmt.Sprintf(`Whole file, for context:
+%s
+
+Implement this declaration:
+%s`, skeleton, declaration)
+}
+
+func BuildScaffoldVariablesSystemPrompt() string {
+	return `You choose values for the placeholders of a new-file template.
+
+Rules:
+- Output ONLY a JSON object mapping each requested placeholder name to a string value — no markdown, no explanations
+- Follow the naming conventions visible in the target directory (e.g. the package name of neighbouring files)
+- Use identifiers and file names valid for the language the template is written in`
+}
+
+func BuildScaffoldVariablesUserPrompt(kind, targetDir string, existing, templatePaths []string, known string, missing []string) string {
+	return fmt.Sprintf(`Template kind: %s
+Template files: %s
+Target directory: %s
+Existing files in target directory: %s
+
+Known values:
+%s
+Placeholders to fill: %s`, kind, joinStrings(templatePaths, ", "), targetDir, joinStrings(existing, ", "), known, joinStrings(missing, ", "))
+}
+
+func BuildScaffoldFillSystemPrompt() string {
+	return `You complete new source files generated from a template.
+
+Rules:
+- Output ONLY the complete file — no markdown, no explanations, no code fences
+- Replace every {{ai: ...}} marker with code implementing what the marker describes
+- Keep all other text of the file exactly as given
+- Use the provided values (names, descriptions) to guide the implementation`
+}
+
+func BuildScaffoldFillUserPrompt(path, content, values string) string {
+	return fmt.Sprintf(`File: %s
+
+Values:
+%s
+Template:
+%s`, path, values, content)
+}
+
 func joinStrings(items []string, sep string) string {
 	result := ""
 	for i, item := range items {
@@ -106,3 +322,67 @@ func joinStrings(items []string, sep string) string {
 	}
 	return result
 }
+
+// WithResponseLanguage asks for comments and explanations in a natural
+// language other than English. Code and identifiers are left alone.
+func WithResponseLanguage(systemPrompt, language string) string {
+	language = strings.TrimSpace(language)
+	if language == "" || strings.EqualFold(language, "english") {
+		return systemPrompt
+	}
+	return systemPrompt + fmt.Sprintf("\n\nWrite all comments, docstrings and explanations in %s. Keep code, identifiers and string literals unchanged.", language)
+}
+
+// WithInstructions appends user or project instructions to a system prompt.
+func WithInstructions(systemPrompt, instructions string) string {
+	instructions = strings.TrimSpace(instructions)
+	if instructions == "" {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nAdditional instructions:\n" + instructions
+}
+
+// WithConversation adds the latest exchanges of an earlier conversation that
+// is being continued.
+func WithConversation(systemPrompt string, exchanges []string) string {
+	if len(exchanges) == 0 {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nEarlier in this conversation (for context only, answer the new request):\n\n" + joinStrings(exchanges, "\n\n---\n\n")
+}
+
+// WithDependencies lists the project's dependencies in a system prompt so
+// generated code sticks to libraries, and versions, the project has.
+func WithDependencies(systemPrompt string, deps []string) string {
+	if len(deps) == 0 {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nProject dependencies (use only these third-party libraries, at these versions):\n- " + joinStrings(deps, "\n- ")
+}
+
+// WithBlame adds who last changed the code and why, from git blame, so
+// explanations can draw on the commit messages behind it.
+func WithBlame(systemPrompt, blame string) string {
+	if blame == "" {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nHistory of the code (git blame: last commit per line range, with its message):\n" + blame
+}
+
+// WithIssues adds the issues the code or its history refers to, so the
+// model knows the intent behind it.
+func WithIssues(systemPrompt string, issues []string) string {
+	if len(issues) == 0 {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nReferenced issues:\n\n" + joinStrings(issues, "\n\n")
+}
+
+// WithAPIHints adds reference notes for libraries the file imports, so the
+// model uses their real API rather than guessing method names.
+func WithAPIHints(systemPrompt string, hints []string) string {
+	if len(hints) == 0 {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nAPI reference for libraries used in this file (prefer these over guessed APIs):\n\n" + joinStrings(hints, "\n\n---\n\n")
+}
@@ -3,16 +3,44 @@ package providers
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
 )
 
 type CompletionRequest struct {
 	ContentBefore string
 	ContentAfter  string
+	// Interpolation, when set, is the string interpolation the cursor is
+	// in, such as ${...} in a template literal: the completion should finish
+	// its expression and end with it.
+	Interpolation *Interpolation
+}
+
+// Interpolation is the pair of delimiters around an interpolation.
+type Interpolation struct {
+	Open, Close string
+}
+
+// stopSequences returns stop with the sequences that end a completion of
+// req: an interpolation ends on its line.
+func (req CompletionRequest) stopSequences(stop []string) []string {
+	if req.Interpolation == nil {
+		return stop
+	}
+	return append(slices.Clone(stop), "\n")
 }
 
 type ChatResponse struct {
 	Result string
+	// Explanation and Confidence come with structured results, which have
+	// Structured set; Result is then the replacement text as the model
+	// produced it, with nothing to clean up.
+	Explanation string
+	Confidence  float64
+	Structured  bool
 }
 
 type Provider interface {
@@ -21,14 +49,30 @@ type Provider interface {
 }
 
 type Registry struct {
-	mu        sync.RWMutex
-	providers map[string]Provider
-	current   string
+	mu         sync.RWMutex
+	providers  map[string]Provider
+	current    string
+	fallback   string
+	rival      string
+	quota      *quotaGuard
+	breakers   map[string]*circuitBreaker
+	idle       *idleTracker
+	usage      *UsageTracker
+	middleware []Middleware
+	policy     func(ctx context.Context, name string) error
+	tasks      map[string]override
+	cache      *completionCache
+	logger     *lsp.Logger
+	notify     func(message string)
+	life       *lifetime
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
 		providers: make(map[string]Provider),
+		idle:      &idleTracker{lastUsed: time.Now()},
+		usage:     newUsageTracker(),
+		life:      newLifetime(),
 	}
 }
 
@@ -36,6 +80,9 @@ func (r *Registry) Register(name string, provider Provider) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.providers[name] = provider
+	if notifying, ok := provider.(Notifying); ok && r.notify != nil {
+		notifying.SetNotifier(r.notify)
+	}
 }
 
 func (r *Registry) SetCurrent(name string) error {
@@ -53,6 +100,68 @@ func (r *Registry) SetCurrent(name string) error {
 	return nil
 }
 
+// Current returns the name of the provider requests are routed to.
+func (r *Registry) Current() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// SetFallback configures the provider used while the current provider keeps
+// failing with quota errors. The current provider is re-probed every
+// probeInterval until it succeeds again.
+func (r *Registry) SetFallback(name string, threshold int, probeInterval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("fallback provider not found: %s", name)
+	}
+
+	r.fallback = name
+	r.quota = newQuotaGuard(threshold, probeInterval)
+	return nil
+}
+
+func (r *Registry) SetLogger(logger *lsp.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+// SetNotifier sets the callback used to tell the user about routing changes
+// and passes it on to every Notifying provider.
+func (r *Registry) SetNotifier(notify func(message string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notify = notify
+	for _, provider := range r.providers {
+		if notifying, ok := provider.(Notifying); ok {
+			notifying.SetNotifier(notify)
+		}
+	}
+}
+
+func (r *Registry) log(args ...any) {
+	r.mu.RLock()
+	logger := r.logger
+	r.mu.RUnlock()
+
+	if logger != nil {
+		logger.Log(args...)
+	}
+}
+
+func (r *Registry) notifyUser(message string) {
+	r.mu.RLock()
+	notify := r.notify
+	r.mu.RUnlock()
+
+	if notify != nil {
+		notify(message)
+	}
+}
+
 func (r *Registry) Get() (Provider, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -69,18 +178,204 @@ func (r *Registry) Get() (Provider, error) {
 	return provider, nil
 }
 
+func (r *Registry) getFallback(ctx context.Context) (Provider, bool) {
+	r.mu.RLock()
+	name, configured := r.fallback, r.fallback != "" && r.quota != nil
+	r.mu.RUnlock()
+
+	if !configured {
+		return nil, false
+	}
+	return r.lookup(ctx, name)
+}
+
+func (r *Registry) fallbackName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fallback
+}
+
+// routeFallback returns the fallback a failed request is retried on, once
+// the policy permits it.
+func (r *Registry) routeFallback(ctx context.Context) (Provider, string, error) {
+	fallback, _ := r.getFallback(ctx)
+	name := r.fallbackName()
+	if err := r.permit(ctx, name); err != nil {
+		return nil, name, err
+	}
+	return fallback, name, nil
+}
+
+// scoped attributes the token usage of requests made with ctx to name, and
+// marks name used, so idle release gives back what it holds.
+func (r *Registry) scoped(ctx context.Context, name string) context.Context {
+	r.idle.use(AccountOf(ctx), name)
+	trackers := []*UsageTracker{r.usage}
+	if account := AccountOf(ctx); account != nil {
+		trackers = append(trackers, account.usage)
+	}
+	return withUsageScope(ctx, trackers, name)
+}
+
+// route picks the provider for the next request, returning its name and
+// whether the result should be fed back into the quota guard. A provider
+// whose circuit is open is skipped in favour of the fallback, unless ctx
+// carries an override or kind has a task route. The policy is checked on the
+// final choice.
+func (r *Registry) route(ctx context.Context, kind string) (Provider, string, bool, error) {
+	provider, name, primary, err := r.pick(ctx, kind)
+	if err != nil {
+		return nil, name, false, err
+	}
+	if err := r.permit(ctx, name); err != nil {
+		return nil, name, false, err
+	}
+	return provider, name, primary, nil
+}
+
+func (r *Registry) pick(ctx context.Context, kind string) (Provider, string, bool, error) {
+	if provider, name, ok, err := r.routeOverride(ctx); ok {
+		return provider, name, false, err
+	}
+	if provider, name, ok, err := r.routeTask(ctx, kind); ok {
+		return provider, name, false, err
+	}
+
+	provider, current, err := r.selected(ctx)
+	if err != nil {
+		return nil, current, false, err
+	}
+
+	// The quota guard watches the registry's current provider, not those
+	// a session selected instead or a user's own.
+	r.mu.RLock()
+	primary, fallbackName := current == r.current && !AccountOf(ctx).owns(current), r.fallback
+	r.mu.RUnlock()
+
+	if fallback, ok := r.getFallback(ctx); ok && primary && r.quota.useFallback(time.Now()) {
+		return fallback, fallbackName, false, nil
+	}
+
+	if !r.available(current) {
+		if fallback, ok := r.getFallback(ctx); ok && r.available(fallbackName) {
+			return fallback, fallbackName, false, nil
+		}
+		return nil, current, false, circuitOpenError(current)
+	}
+
+	return provider, current, primary, nil
+}
+
+// observe updates quota state after a request to the current provider and
+// reports whether the request should be retried on the fallback.
+func (r *Registry) observe(err error) bool {
+	r.mu.RLock()
+	configured := r.fallback != "" && r.quota != nil
+	r.mu.RUnlock()
+	if !configured {
+		return false
+	}
+
+	tripped, recovered := r.quota.observe(err, time.Now())
+
+	r.mu.RLock()
+	current, fallback, interval := r.current, r.fallback, r.quota.probeInterval
+	r.mu.RUnlock()
+
+	if tripped {
+		r.log("quota exhausted on", current, "- switching to", fallback)
+		r.notifyUser(fmt.Sprintf("%s quota exhausted, using %s (retrying %s every %s)", current, fallback, current, interval))
+	}
+
+	if recovered {
+		r.log("quota recovered on", current)
+		r.notifyUser(fmt.Sprintf("%s is available again", current))
+	}
+
+	return err != nil && IsKind(err, ErrorKindQuota) && r.quota.useFallback(time.Now())
+}
+
 func (r *Registry) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
-	provider, err := r.Get()
+	call := &Call{Kind: CallCompletion, Request: req, Filepath: filepath, LanguageID: languageID, NumSuggestions: numSuggestions}
+	result, err := r.intercept(ctx, call, r.complete)
+	if result == nil {
+		return nil, err
+	}
+	return result.Completions, err
+}
+
+func (r *Registry) complete(ctx context.Context, call *Call) (*Result, error) {
+	r.touch(ctx)
+
+	provider, name, primary, err := r.route(ctx, call.Kind)
 	if err != nil {
 		return nil, err
 	}
-	return provider.Completion(ctx, req, filepath, languageID, numSuggestions)
+	call.servedBy(name, provider)
+
+	cache, key := r.completionCache(), ""
+	if cache != nil {
+		key = cacheKey(name, provider, call)
+		if results, ok := cache.get(key); ok {
+			r.log("completion cache hit for", name)
+			r.releaseProbe(name)
+			return &Result{Completions: results}, nil
+		}
+	}
+
+	outcome := r.completeRacing(r.scoped(ctx, name), provider, call.Request, call.Filepath, call.LanguageID, call.NumSuggestions)
+	r.recordHealth(name, outcome.primaryErr)
+	if outcome.rivalWon {
+		rival, rivalName, _ := r.getRival(ctx)
+		call.servedBy(rivalName, rival)
+	}
+
+	if primary && r.observe(outcome.primaryErr) && outcome.err != nil {
+		fallback, name, err := r.routeFallback(ctx)
+		call.Provider = name
+		if err != nil {
+			return nil, err
+		}
+		call.servedBy(name, fallback)
+		results, err := fallback.Completion(r.scoped(ctx, call.Provider), call.Request, call.Filepath, call.LanguageID, call.NumSuggestions)
+		return &Result{Completions: results}, err
+	}
+
+	if cache != nil && outcome.err == nil && len(outcome.results) > 0 {
+		cache.put(key, outcome.results)
+	}
+	return &Result{Completions: outcome.results}, outcome.err
 }
 
 func (r *Registry) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
-	provider, err := r.Get()
+	call := &Call{Kind: CallChat, SystemPrompt: systemPrompt, UserPrompt: userPrompt}
+	result, err := r.intercept(ctx, call, r.chat)
+	if result == nil {
+		return nil, err
+	}
+	return result.Chat, err
+}
+
+func (r *Registry) chat(ctx context.Context, call *Call) (*Result, error) {
+	r.touch(ctx)
+
+	provider, name, primary, err := r.route(ctx, call.Kind)
 	if err != nil {
 		return nil, err
 	}
-	return provider.Chat(ctx, systemPrompt, userPrompt)
+	call.servedBy(name, provider)
+
+	resp, err := provider.Chat(r.scoped(ctx, name), call.SystemPrompt, call.UserPrompt)
+	r.recordHealth(name, err)
+
+	if primary && r.observe(err) {
+		var fallback Provider
+		if fallback, call.Provider, err = r.routeFallback(ctx); err != nil {
+			return nil, err
+		}
+		call.servedBy(call.Provider, fallback)
+		resp, err = fallback.Chat(r.scoped(ctx, call.Provider), call.SystemPrompt, call.UserPrompt)
+	}
+
+	return &Result{Chat: resp}, err
 }
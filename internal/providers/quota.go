@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// quotaGuard tracks sustained quota errors from the current provider and
+// decides when requests should be routed to the fallback instead.
+type quotaGuard struct {
+	mu            sync.Mutex
+	threshold     int
+	probeInterval time.Duration
+	failures      int
+	degraded      bool
+	nextProbe     time.Time
+}
+
+func newQuotaGuard(threshold int, probeInterval time.Duration) *quotaGuard {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &quotaGuard{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+	}
+}
+
+// useFallback reports whether the next request should skip the current
+// provider. Once the probe interval has elapsed a single request is let
+// through to check whether the quota has recovered.
+func (g *quotaGuard) useFallback(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.degraded {
+		return false
+	}
+
+	if now.Before(g.nextProbe) {
+		return true
+	}
+
+	// Push the next probe out so concurrent requests keep using the
+	// fallback while this one probes.
+	g.nextProbe = now.Add(g.probeInterval)
+	return false
+}
+
+// observe records the outcome of a request to the current provider and
+// returns the resulting state transition, if any.
+func (g *quotaGuard) observe(err error, now time.Time) (tripped, recovered bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err == nil {
+		recovered = g.degraded
+		g.failures = 0
+		g.degraded = false
+		return false, recovered
+	}
+
+	if !IsKind(err, ErrorKindQuota) {
+		return false, false
+	}
+
+	g.failures++
+
+	if g.degraded {
+		g.nextProbe = now.Add(g.probeInterval)
+		return false, false
+	}
+
+	if g.failures >= g.threshold {
+		g.degraded = true
+		g.nextProbe = now.Add(g.probeInterval)
+		return true, false
+	}
+
+	return false, false
+}
@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetRival configures a provider raced against the current one for
+// completions. The first non-empty result wins and the slower request is
+// cancelled.
+func (r *Registry) SetRival(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("race provider not found: %s", name)
+	}
+
+	r.rival = name
+	return nil
+}
+
+func (r *Registry) getRival(ctx context.Context) (Provider, string, bool) {
+	r.mu.RLock()
+	name := r.rival
+	r.mu.RUnlock()
+
+	if name == "" {
+		return nil, "", false
+	}
+
+	provider, ok := r.lookup(ctx, name)
+	return provider, name, ok
+}
+
+// raceOutcome is the winning result of a race. primaryErr is the routed
+// provider's own error, which feeds the quota guard even when the rival won.
+type raceOutcome struct {
+	results    []string
+	err        error
+	primaryErr error
+	// rivalWon is set when the results came from the rival.
+	rivalWon bool
+}
+
+type raceEntry struct {
+	primary bool
+	results []string
+	err     error
+	elapsed time.Duration
+}
+
+// completeRacing runs the completion on provider, racing it against the
+// rival when one is configured.
+func (r *Registry) completeRacing(ctx context.Context, provider Provider, req CompletionRequest, filepath, languageID string, numSuggestions int) raceOutcome {
+	rival, rivalName, ok := r.getRival(ctx)
+	if !ok || rival == provider || !r.available(rivalName) || r.permit(ctx, rivalName) != nil {
+		results, err := provider.Completion(ctx, req, filepath, languageID, numSuggestions)
+		return raceOutcome{results: results, err: err, primaryErr: err}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	entries := make(chan raceEntry, 2)
+	run := func(p Provider, primary bool) {
+		ctx := ctx
+		if !primary {
+			ctx = r.scoped(ctx, rivalName)
+		}
+		results, err := p.Completion(ctx, req, filepath, languageID, numSuggestions)
+		entries <- raceEntry{primary: primary, results: results, err: err, elapsed: time.Since(start)}
+	}
+	go run(provider, true)
+	go run(rival, false)
+
+	var primaryEntry, rivalEntry *raceEntry
+	for i := 0; i < 2; i++ {
+		entry := <-entries
+		if entry.primary {
+			primaryEntry = &entry
+		} else {
+			rivalEntry = &entry
+		}
+
+		if entry.err == nil && len(entry.results) > 0 {
+			winner := "current provider"
+			if !entry.primary {
+				winner = rivalName
+			}
+			r.log("race won by", winner, "in", entry.elapsed)
+			cancel()
+			if !entry.primary {
+				r.recordHealth(rivalName, nil)
+			}
+
+			outcome := raceOutcome{results: entry.results, rivalWon: !entry.primary}
+			if !entry.primary {
+				// A still-running current provider is cancelled, which the
+				// quota guard ignores; one that already failed is reported.
+				outcome.primaryErr = context.Canceled
+				if primaryEntry != nil {
+					outcome.primaryErr = primaryEntry.err
+				}
+			}
+			return outcome
+		}
+	}
+
+	r.recordHealth(rivalName, rivalEntry.err)
+
+	// Neither produced anything: report the current provider's result so
+	// fallback and error handling behave as without racing.
+	if rivalEntry.err != nil {
+		r.log("race provider", rivalName, "failed:", rivalEntry.err.Error())
+	}
+	return raceOutcome{results: primaryEntry.results, err: primaryEntry.err, primaryErr: primaryEntry.err}
+}
@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultReasoningTags are the tags reasoning models such as DeepSeek-R1 and
+// QwQ wrap their thinking in.
+var DefaultReasoningTags = []string{"think"}
+
+var reasoning = struct {
+	mu   sync.RWMutex
+	tags []string
+}{tags: DefaultReasoningTags}
+
+// SetReasoningTags sets the names of the tags whose blocks are stripped from
+// completions and chat results, so reasoning is never inserted as code.
+// No tags disables stripping.
+func SetReasoningTags(tags []string) {
+	reasoning.mu.Lock()
+	defer reasoning.mu.Unlock()
+	reasoning.tags = tags
+}
+
+func reasoningTags() []string {
+	reasoning.mu.RLock()
+	defer reasoning.mu.RUnlock()
+	return reasoning.tags
+}
+
+// stripReasoning removes reasoning blocks from text. A closing tag without
+// an opening one ends reasoning the chat template opened for the model, so
+// everything before it goes; an opening tag that is never closed means the
+// output stopped mid-thought, and everything after it goes.
+func stripReasoning(text string) string {
+	for _, tag := range reasoningTags() {
+		open, closing := "<"+tag+">", "</"+tag+">"
+		if !strings.Contains(text, open) && !strings.Contains(text, closing) {
+			continue
+		}
+
+		if end := strings.Index(text, closing); end >= 0 && !strings.Contains(text[:end], open) {
+			text = strings.TrimLeft(text[end+len(closing):], " \t\r\n")
+		}
+		for {
+			start := strings.Index(text, open)
+			if start < 0 {
+				break
+			}
+			end := strings.Index(text[start:], closing)
+			if end < 0 {
+				text = text[:start]
+				break
+			}
+			text = text[:start] + strings.TrimLeft(text[start+end+len(closing):], " \t\r\n")
+		}
+	}
+	return text
+}
+
+// stripResult removes reasoning from every text of result.
+func stripResult(result *Result) {
+	if result == nil {
+		return
+	}
+	for i, completion := range result.Completions {
+		result.Completions[i] = stripReasoning(completion)
+	}
+	if result.Chat != nil {
+		result.Chat.Result = stripReasoning(result.Chat.Result)
+	}
+}
+
+// reasoningFilter holds back streamed reasoning blocks, so previews show
+// only the answer. Reasoning without an opening tag is only removed from
+// the final result.
+type reasoningFilter struct {
+	onDelta StreamFunc
+	tags    []string
+	pending string
+	// closing is the tag that ends the block being skipped, if any.
+	closing string
+}
+
+func newReasoningFilter(onDelta StreamFunc) StreamFunc {
+	tags := reasoningTags()
+	if len(tags) == 0 {
+		return onDelta
+	}
+	f := &reasoningFilter{onDelta: onDelta, tags: tags}
+	return f.write
+}
+
+func (f *reasoningFilter) write(delta string) error {
+	f.pending += delta
+	for {
+		if f.closing != "" {
+			end := strings.Index(f.pending, f.closing)
+			if end < 0 {
+				// Keep only what could be the start of the closing tag.
+				f.pending = f.pending[len(f.pending)-partialSuffix(f.pending, []string{f.closing}):]
+				return nil
+			}
+			f.pending = strings.TrimLeft(f.pending[end+len(f.closing):], " \t\r\n")
+			f.closing = ""
+			continue
+		}
+
+		start, tag := -1, ""
+		for _, t := range f.tags {
+			if i := strings.Index(f.pending, "<"+t+">"); i >= 0 && (start < 0 || i < start) {
+				start, tag = i, t
+			}
+		}
+		if start >= 0 {
+			if err := f.emit(f.pending[:start]); err != nil {
+				return err
+			}
+			f.pending = f.pending[start+len(tag)+2:]
+			f.closing = "</" + tag + ">"
+			continue
+		}
+
+		opens := make([]string, len(f.tags))
+		for i, t := range f.tags {
+			opens[i] = "<" + t + ">"
+		}
+		held := partialSuffix(f.pending, opens)
+		if err := f.emit(f.pending[:len(f.pending)-held]); err != nil {
+			return err
+		}
+		f.pending = f.pending[len(f.pending)-held:]
+		return nil
+	}
+}
+
+func (f *reasoningFilter) emit(text string) error {
+	if text == "" {
+		return nil
+	}
+	return f.onDelta(text)
+}
+
+// partialSuffix is the length of the longest end of text that begins one of
+// tags.
+func partialSuffix(text string, tags []string) int {
+	longest := 0
+	for _, tag := range tags {
+		for n := min(len(tag)-1, len(text)); n > longest; n-- {
+			if strings.HasPrefix(tag, text[len(text)-n:]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,235 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+const (
+	// replicateWaitSeconds asks the API to hold the create call open until
+	// the prediction finishes, which saves polling round trips for short
+	// generations.
+	replicateWaitSeconds = 10
+	replicatePollMin     = 250 * time.Millisecond
+	replicatePollMax     = 2 * time.Second
+)
+
+type replicateRequest struct {
+	Version string         `json:"version,omitempty"`
+	Input   map[string]any `json:"input"`
+}
+
+type replicatePrediction struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Output any    `json:"output"`
+	Error  any    `json:"error"`
+	URLs   struct {
+		Get    string `json:"get"`
+		Cancel string `json:"cancel"`
+	} `json:"urls"`
+}
+
+func (p *replicatePrediction) done() bool {
+	switch p.Status {
+	case "succeeded", "failed", "canceled":
+		return true
+	}
+	return false
+}
+
+// text joins the output, which language models return as a list of tokens.
+func (p *replicatePrediction) text() string {
+	switch out := p.Output.(type) {
+	case string:
+		return out
+	case []any:
+		var b strings.Builder
+		for _, item := range out {
+			if s, ok := item.(string); ok {
+				b.WriteString(s)
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// ReplicateProvider runs language models through Replicate's predictions
+// API. Models are named `owner/name`, or `owner/name:version` to pin a
+// version.
+type ReplicateProvider struct {
+	apiKey    string
+	model     string
+	chatModel string
+	endpoint  string
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+func NewReplicateProvider(apiKey, model, chatModel, endpoint string, timeoutMs int, logger *lsp.Logger) *ReplicateProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &ReplicateProvider{
+		apiKey:    apiKey,
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *ReplicateProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	temperature := 0.01 // Several Replicate models reject exactly zero.
+	if numSuggestions > 1 {
+		temperature = 0.4
+	}
+
+	input := map[string]any{
+		"system_prompt": BuildCompletionSystemPrompt(languageID),
+		"prompt":        completionUserPrompt(filepath, req),
+		"max_tokens":    256,
+		"temperature":   temperature,
+	}
+
+	results := make([]string, 0, numSuggestions)
+	for i := 0; i < numSuggestions; i++ {
+		text, err := p.predict(ctx, p.model, input)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			results = append(results, text)
+		}
+	}
+
+	p.logger.Log(fmt.Sprintf("Replicate returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *ReplicateProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	input := map[string]any{
+		"system_prompt": systemPrompt,
+		"prompt":        userPrompt,
+		"max_tokens":    4096,
+		"temperature":   0.1,
+	}
+
+	text, err := p.predict(ctx, p.chatModel, input)
+	if err != nil {
+		return nil, err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("no response from model")
+	}
+	return &ChatResponse{Result: text}, nil
+}
+
+// predict creates a prediction and polls it until it finishes, the request
+// timeout expires or ctx is cancelled, in which case the prediction is
+// cancelled server-side so it stops billing.
+func (p *ReplicateProvider) predict(ctx context.Context, model string, input map[string]any) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	url := p.endpoint + "/predictions"
+	body := replicateRequest{Input: input}
+	if _, version, ok := strings.Cut(model, ":"); ok {
+		body.Version = version
+	} else {
+		url = p.endpoint + "/models/" + model + "/predictions"
+	}
+
+	headers := p.headers()
+	headers["Prefer"] = fmt.Sprintf("wait=%d", replicateWaitSeconds)
+
+	resp, err := requestJSON(ctx, "POST", url, headers, p.timeout, body)
+	if err != nil {
+		return "", err
+	}
+
+	prediction, err := parseReplicatePrediction(resp)
+	if err != nil {
+		return "", err
+	}
+
+	// Poll responses do not always repeat the URLs, so keep the originals.
+	urls := prediction.URLs
+
+	interval := replicatePollMin
+	for !prediction.done() {
+		select {
+		case <-ctx.Done():
+			p.cancelPrediction(prediction)
+			return "", newRequestError(ctx, ctx.Err())
+		case <-time.After(interval):
+		}
+		interval = min(interval*2, replicatePollMax)
+
+		resp, err := requestJSON(ctx, "GET", urls.Get, p.headers(), p.timeout, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				p.cancelPrediction(prediction)
+			}
+			return "", err
+		}
+		if prediction, err = parseReplicatePrediction(resp); err != nil {
+			return "", err
+		}
+		prediction.URLs = urls
+	}
+
+	if prediction.Status != "succeeded" {
+		return "", &ProviderError{Kind: ErrorKindServer, Message: fmt.Sprintf("prediction %s %s: %v", prediction.ID, prediction.Status, prediction.Error)}
+	}
+	return prediction.text(), nil
+}
+
+func (p *ReplicateProvider) cancelPrediction(prediction *replicatePrediction) {
+	if prediction.URLs.Cancel == "" {
+		return
+	}
+	// The request context is already done, so cancel on a fresh one.
+	go func() {
+		if _, err := requestJSON(context.Background(), "POST", prediction.URLs.Cancel, p.headers(), 5*time.Second, nil); err != nil {
+			p.logger.Log("Replicate cancel failed:", err.Error())
+		}
+	}()
+}
+
+func (p *ReplicateProvider) headers() map[string]string {
+	return map[string]string{"Authorization": "Bearer " + p.apiKey}
+}
+
+func parseReplicatePrediction(data []byte) (*replicatePrediction, error) {
+	var prediction replicatePrediction
+	if err := json.Unmarshal(data, &prediction); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return &prediction, nil
+}
+
+func (p *ReplicateProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *ReplicateProvider) WithModels(model, chatModel string) Provider {
+	return NewReplicateProvider(p.apiKey, model, chatModel, p.endpoint, int(p.timeout.Milliseconds()), p.logger)
+}
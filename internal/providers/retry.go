@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+// maxRetryDelay caps both the computed backoff and a server's Retry-After.
+const maxRetryDelay = 5 * time.Second
+
+// retryPolicy is shared by every provider's request path so that transient
+// failures are retried the same way regardless of the backend.
+type retryPolicy struct {
+	mu          sync.RWMutex
+	maxAttempts int
+	baseDelay   time.Duration
+	logger      *lsp.Logger
+}
+
+var retries = &retryPolicy{maxAttempts: 1, baseDelay: 250 * time.Millisecond}
+
+// SetRetryPolicy configures how often transient request failures (429 rate
+// limits, 5xx responses, dropped connections) are attempted in total, and the
+// initial backoff which doubles after every attempt. maxAttempts of 1
+// disables retrying.
+func SetRetryPolicy(maxAttempts int, baseDelay time.Duration, logger *lsp.Logger) {
+	retries.mu.Lock()
+	defer retries.mu.Unlock()
+	retries.maxAttempts = max(maxAttempts, 1)
+	retries.baseDelay = baseDelay
+	retries.logger = logger
+}
+
+func (r *retryPolicy) settings() (int, time.Duration, *lsp.Logger) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.maxAttempts, r.baseDelay, r.logger
+}
+
+// withRetry runs send until it succeeds, fails permanently, runs out of
+// attempts or ctx is done. The last error is returned unchanged so callers
+// still see the provider's classification. Usage reported in a successful
+// response is recorded against the provider in ctx.
+func withRetry(ctx context.Context, send func() ([]byte, error)) ([]byte, error) {
+	resp, err := retry(ctx, send)
+	if err == nil {
+		recordUsage(ctx, resp)
+	}
+	return resp, err
+}
+
+func retry[T any](ctx context.Context, send func() (T, error)) (T, error) {
+	maxAttempts, baseDelay, logger := retries.settings()
+	var zero T
+
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if err == nil || attempt >= maxAttempts || !isRetryable(err) {
+			return resp, err
+		}
+
+		delay := backoffDelay(baseDelay, attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return zero, err
+		}
+
+		if logger != nil {
+			logger.Log("Retrying request after", delay.Round(time.Millisecond), "attempt", attempt, "of", maxAttempts, "error:", err.Error())
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable reports whether err is likely to succeed if sent again. Quota
+// errors only qualify when they are rate limits rather than exhausted credit.
+func isRetryable(err error) bool {
+	var perr *ProviderError
+	if !errors.As(err, &perr) {
+		return false
+	}
+
+	switch perr.Kind {
+	case ErrorKindServer, ErrorKindNetwork:
+		return true
+	case ErrorKindQuota:
+		return perr.StatusCode == http.StatusTooManyRequests && !strings.Contains(strings.ToLower(perr.Message), "insufficient_quota")
+	}
+	return false
+}
+
+// backoffDelay returns a fully jittered exponential delay, or the server's
+// Retry-After when it asked for one.
+func backoffDelay(base time.Duration, attempt int, err error) time.Duration {
+	var perr *ProviderError
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		return min(perr.RetryAfter, maxRetryDelay)
+	}
+
+	ceiling := min(base<<(attempt-1), maxRetryDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
+
+// newResponseError classifies a non-2xx response and records its
+// Retry-After header for the retry layer.
+func newResponseError(resp *http.Response, body []byte) *ProviderError {
+	perr := newStatusError(resp.StatusCode, body)
+	perr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return perr
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
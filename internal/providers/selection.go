@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type selectionKey struct{}
+
+// Selection is the provider and models one editor session chose, so
+// sessions sharing a registry do not switch each other's. Requests whose
+// context carries a selection are routed as if its provider were the
+// current one; empty fields keep the registry's choice.
+type Selection struct {
+	mu        sync.RWMutex
+	provider  string
+	model     string
+	chatModel string
+}
+
+// NewSelection returns a selection of the named provider with its own
+// models, or of the registry's current provider when name is empty.
+func NewSelection(name string) *Selection {
+	return &Selection{provider: name}
+}
+
+// WithSelection returns a context whose requests follow sel.
+func WithSelection(ctx context.Context, sel *Selection) context.Context {
+	return context.WithValue(ctx, selectionKey{}, sel)
+}
+
+// SelectionOf returns the selection ctx carries, or nil.
+func SelectionOf(ctx context.Context) *Selection {
+	sel, _ := ctx.Value(selectionKey{}).(*Selection)
+	return sel
+}
+
+func (s *Selection) get() (provider, model, chatModel string) {
+	if s == nil {
+		return "", "", ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.provider, s.model, s.chatModel
+}
+
+// Select switches the selection ctx carries to the named provider. A model
+// replaces the provider's models, and an empty chatModel keeps the chat
+// model: the one the selection chose for the provider before, else the
+// provider's own.
+func (r *Registry) Select(ctx context.Context, name, model, chatModel string) error {
+	sel := SelectionOf(ctx)
+	if sel == nil {
+		return fmt.Errorf("no provider selection to switch")
+	}
+	provider, ok := r.lookup(ctx, name)
+	if !ok {
+		return fmt.Errorf("provider not found: %s", name)
+	}
+	switcher, ok := provider.(ModelSwitcher)
+	if model != "" && !ok {
+		return fmt.Errorf("provider %s does not have switchable models", name)
+	}
+
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+	if model != "" && chatModel == "" && sel.provider == name {
+		chatModel = sel.chatModel
+	}
+	if model != "" && chatModel == "" {
+		_, chatModel = switcher.Models()
+	}
+	sel.provider, sel.model, sel.chatModel = name, model, chatModel
+	return nil
+}
+
+// Selected returns the name of the provider requests made with ctx go to
+// when nothing else routes them.
+func (r *Registry) Selected(ctx context.Context) string {
+	if name, _, _ := SelectionOf(ctx).get(); name != "" {
+		return name
+	}
+	return r.Current()
+}
+
+// SelectedModels returns the completion and chat models requests made with
+// ctx use on the named provider.
+func (r *Registry) SelectedModels(ctx context.Context, name string) (string, string, error) {
+	if provider, model, chatModel := SelectionOf(ctx).get(); provider == name && model != "" {
+		return model, chatModel, nil
+	}
+	provider, ok := r.lookup(ctx, name)
+	if !ok {
+		return "", "", fmt.Errorf("provider not found: %s", name)
+	}
+	switcher, ok := provider.(ModelSwitcher)
+	if !ok {
+		return "", "", fmt.Errorf("provider %s does not have switchable models", name)
+	}
+	model, chatModel := switcher.Models()
+	return model, chatModel, nil
+}
+
+// selected returns the provider requests made with ctx go to when nothing
+// else routes them, switched to the models ctx selected.
+func (r *Registry) selected(ctx context.Context) (Provider, string, error) {
+	name, model, chatModel := SelectionOf(ctx).get()
+	if name == "" {
+		name = r.Current()
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("no provider configured")
+	}
+
+	provider, ok := r.lookup(ctx, name)
+	if !ok {
+		return nil, name, fmt.Errorf("provider not found: %s", name)
+	}
+
+	if model != "" {
+		if switcher, ok := provider.(ModelSwitcher); ok {
+			provider = switcher.WithModels(model, chatModel)
+		}
+	}
+	return provider, name, nil
+}
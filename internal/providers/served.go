@@ -0,0 +1,29 @@
+package providers
+
+import "context"
+
+type servedKey struct{}
+
+// Served records which provider and model answered a request.
+type Served struct {
+	Provider string
+	Model    string
+}
+
+// WithServed returns a context whose requests record the provider and
+// model that answered them in the returned Served. Requests middleware
+// answered without a provider leave it empty.
+func WithServed(ctx context.Context) (context.Context, *Served) {
+	served := &Served{}
+	return context.WithValue(ctx, servedKey{}, served), served
+}
+
+// recordServed fills in the Served of ctx, if any, once call is answered.
+func (r *Registry) recordServed(ctx context.Context, call *Call) {
+	served, ok := ctx.Value(servedKey{}).(*Served)
+	if !ok || call.Provider == "" {
+		return
+	}
+
+	served.Provider, served.Model = call.Provider, call.Model
+}
@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"context"
+	"testing"
+)
+
+// switchable is a provider with switchable models.
+type switchable struct {
+	probed
+	model, chatModel string
+}
+
+func (s switchable) Models() (string, string) {
+	return s.model, s.chatModel
+}
+
+func (s switchable) WithModels(model, chatModel string) Provider {
+	s.model, s.chatModel = model, chatModel
+	return s
+}
+
+func TestServedModel(t *testing.T) {
+	r := NewRegistry()
+	r.Register("local", switchable{probed: probed{log: &probeLog{}}, model: "small", chatModel: "large"})
+	r.SetCurrent("local")
+	if err := r.SetTaskRoute(CallCompletion, "local", "fim"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, served := WithServed(context.Background())
+	if _, err := r.Completion(ctx, CompletionRequest{ContentBefore: "x"}, "a.go", "go", 1); err != nil {
+		t.Fatal(err)
+	}
+	if *served != (Served{Provider: "local", Model: "fim"}) {
+		t.Errorf("completion served by %+v, want the task route's model", *served)
+	}
+
+	ctx, served = WithServed(WithOverride(context.Background(), "", "override"))
+	if _, err := r.Chat(ctx, "", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if *served != (Served{Provider: "local", Model: "override"}) {
+		t.Errorf("chat served by %+v, want the override's model", *served)
+	}
+}
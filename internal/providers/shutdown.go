@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ErrShutdown fails provider requests cut short by, or made after,
+// Registry.Shutdown. It is a cancellation.
+var ErrShutdown = fmt.Errorf("server is shutting down: %w", context.Canceled)
+
+// lifetime tracks the provider requests in flight so they can all be
+// cancelled when the server shuts down.
+type lifetime struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu orders track against Shutdown, so no request joins inflight once
+	// Shutdown waits on it.
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+func newLifetime() *lifetime {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifetime{ctx: ctx, cancel: cancel}
+}
+
+// track returns ctx cancelled with ErrShutdown on shutdown, and a func to
+// call once the request is done. It fails once shutdown has begun.
+func (l *lifetime) track(ctx context.Context) (context.Context, func(), error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, nil, ErrShutdown
+	}
+	l.inflight.Add(1)
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(l.ctx, func() { cancel(ErrShutdown) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		l.inflight.Done()
+	}, nil
+}
+
+// Shutdown cancels every provider request in flight, fails those made
+// after it, and waits until the cancelled requests have returned or ctx is
+// done.
+func (r *Registry) Shutdown(ctx context.Context) {
+	r.life.mu.Lock()
+	r.life.closed = true
+	r.life.mu.Unlock()
+	r.life.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.life.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForTrackedRequests(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var refused, cancelled int
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, done, err := r.life.track(context.Background())
+			if err != nil {
+				mu.Lock()
+				refused++
+				mu.Unlock()
+				return
+			}
+			defer done()
+			<-ctx.Done()
+			if errors.Is(context.Cause(ctx), ErrShutdown) {
+				mu.Lock()
+				cancelled++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.Shutdown(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("Shutdown did not return before its deadline")
+	}
+	wg.Wait()
+	if refused+cancelled != 50 {
+		t.Errorf("%d refused and %d cancelled, want all 50 either", refused, cancelled)
+	}
+	if _, _, err := r.life.track(context.Background()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("track after Shutdown: %v, want ErrShutdown", err)
+	}
+}
+
+func TestUsageAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "usage.jsonl")
+	tracker := newUsageTracker()
+	if err := tracker.Append(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("empty usage written: %v", err)
+	}
+
+	tracker.record("openai", "gpt-4o-mini", tokenUsage{Prompt: 1000, Completion: 200})
+	tracker.record("ollama", "qwen2.5-coder", tokenUsage{Prompt: 50, Completion: 10})
+	if err := tracker.Append(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Usage already written is not written again.
+	if err := tracker.Append(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	tracker.record("openai", "gpt-4o-mini", tokenUsage{Prompt: 1000, Completion: 200})
+	if err := tracker.Append(path, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2:\n%s", len(lines), data)
+	}
+	var record struct {
+		User    string `json:"user"`
+		Entries []struct {
+			Provider     string  `json:"provider"`
+			PromptTokens int     `json:"promptTokens"`
+			Cost         float64 `json:"cost"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.User != "alice" || len(record.Entries) != 1 || record.Entries[0].Provider != "openai" || record.Entries[0].PromptTokens != 1000 || record.Entries[0].Cost == 0 {
+		t.Errorf("unexpected record %s", lines[1])
+	}
+}
@@ -0,0 +1,263 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamFunc receives generated text as it arrives. Returning an error stops
+// the stream; the error is returned from the streaming call.
+type StreamFunc func(delta string) error
+
+// StreamingProvider is implemented by providers that can deliver output
+// incrementally. The returned result is the complete, cleaned output, the
+// same as the non-streaming call would have produced.
+type StreamingProvider interface {
+	ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error)
+	CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error)
+}
+
+type streamRestartKey struct{}
+
+// WithStreamRestart returns a context whose streams call restart when a
+// fallback provider takes over a stream that already delivered text, before
+// the fallback's own text arrives, so the consumer can drop what it shows
+// and take the fallback's output from the start. Without it, the part of
+// the fallback's output that repeats the delivered text is left out.
+func WithStreamRestart(ctx context.Context, restart func()) context.Context {
+	return context.WithValue(ctx, streamRestartKey{}, restart)
+}
+
+// deliveredStream records the text a stream delivered, so a fallback
+// taking over does not deliver it again.
+type deliveredStream struct {
+	onDelta StreamFunc
+	text    strings.Builder
+}
+
+func (d *deliveredStream) deliver(delta string) error {
+	d.text.WriteString(delta)
+	return d.onDelta(delta)
+}
+
+// takeOver returns the StreamFunc of the fallback provider's stream.
+func (d *deliveredStream) takeOver(ctx context.Context) StreamFunc {
+	sent := d.text.String()
+	if sent == "" {
+		return d.onDelta
+	}
+	if restart, ok := ctx.Value(streamRestartKey{}).(func()); ok {
+		restart()
+		return d.onDelta
+	}
+
+	// Skip the fallback's text while it repeats what was sent. Once it goes
+	// past or differs, the rest is delivered: what was sent cannot be taken
+	// back.
+	matched, diverged := 0, false
+	return func(delta string) error {
+		if !diverged {
+			i := 0
+			for i < len(delta) && matched < len(sent) && delta[i] == sent[matched] {
+				i++
+				matched++
+			}
+			if i == len(delta) {
+				return nil
+			}
+			delta, diverged = delta[i:], true
+		}
+		return d.onDelta(delta)
+	}
+}
+
+// maxStreamLine bounds a single SSE or NDJSON line.
+const maxStreamLine = 1 << 20
+
+// openStream posts jsonBody and returns the response once the server has
+// accepted the request. Failures before the first byte of the body are
+// retried like regular requests; the caller must close the body.
+func openStream(ctx context.Context, url string, headers map[string]string, jsonBody []byte) (*http.Response, error) {
+	return retry(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, newRequestError(ctx, err)
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return nil, newResponseError(resp, body)
+		}
+
+		return resp, nil
+	})
+}
+
+// readSSE calls onData with the payload of every server-sent event `data:`
+// line until the body ends or the OpenAI-style [DONE] sentinel arrives.
+func readSSE(ctx context.Context, body io.Reader, onData func(data []byte) error) error {
+	return scanLines(ctx, body, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			return nil
+		}
+		if bytes.Equal(data, []byte("[DONE]")) {
+			return io.EOF
+		}
+		return onData(data)
+	})
+}
+
+// readNDJSON calls onLine with every non-empty line of a newline-delimited
+// JSON body.
+func readNDJSON(ctx context.Context, body io.Reader, onLine func(line []byte) error) error {
+	return scanLines(ctx, body, func(line []byte) error {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+		return onLine(line)
+	})
+}
+
+func scanLines(ctx context.Context, body io.Reader, onLine func(line []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+
+	for scanner.Scan() {
+		if err := onLine(scanner.Bytes()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return newRequestError(ctx, err)
+	}
+	return nil
+}
+
+// streamChat streams from provider when it supports it, and otherwise
+// delivers the whole result as a single delta.
+func streamChat(ctx context.Context, provider Provider, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	if streamer, ok := provider.(StreamingProvider); ok {
+		return streamer.ChatStream(ctx, systemPrompt, userPrompt, onDelta)
+	}
+
+	resp, err := provider.Chat(ctx, systemPrompt, userPrompt)
+	if err != nil {
+		return nil, err
+	}
+	if err := onDelta(resp.Result); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func streamCompletion(ctx context.Context, provider Provider, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	if streamer, ok := provider.(StreamingProvider); ok {
+		return streamer.CompletionStream(ctx, req, filepath, languageID, onDelta)
+	}
+
+	results, err := provider.Completion(ctx, req, filepath, languageID, 1)
+	if err != nil || len(results) == 0 {
+		return "", err
+	}
+	if err := onDelta(results[0]); err != nil {
+		return "", err
+	}
+	return results[0], nil
+}
+
+// ChatStream is Chat with incremental output. Providers without streaming
+// support deliver their result as one delta.
+func (r *Registry) ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	call := &Call{Kind: CallChat, Stream: true, SystemPrompt: systemPrompt, UserPrompt: userPrompt}
+	delivered := &deliveredStream{onDelta: onDelta}
+	result, err := r.intercept(ctx, call, func(ctx context.Context, call *Call) (*Result, error) {
+		r.touch(ctx)
+
+		provider, name, primary, err := r.route(ctx, call.Kind)
+		if err != nil {
+			return nil, err
+		}
+		call.servedBy(name, provider)
+
+		resp, err := streamChat(r.scoped(ctx, name), provider, call.SystemPrompt, call.UserPrompt, newReasoningFilter(delivered.deliver))
+		r.recordHealth(name, err)
+
+		if primary && r.observe(err) {
+			var fallback Provider
+			if fallback, call.Provider, err = r.routeFallback(ctx); err != nil {
+				return nil, err
+			}
+			call.servedBy(call.Provider, fallback)
+			resp, err = streamChat(r.scoped(ctx, call.Provider), fallback, call.SystemPrompt, call.UserPrompt, newReasoningFilter(delivered.takeOver(ctx)))
+		}
+
+		return &Result{Chat: resp}, err
+	})
+	if result == nil {
+		return nil, err
+	}
+	return result.Chat, err
+}
+
+// CompletionStream produces a single completion with incremental output.
+// It does not race against the rival provider, since only one stream can
+// be shown.
+func (r *Registry) CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	call := &Call{Kind: CallCompletion, Stream: true, Request: req, Filepath: filepath, LanguageID: languageID, NumSuggestions: 1}
+	delivered := &deliveredStream{onDelta: onDelta}
+	result, err := r.intercept(ctx, call, func(ctx context.Context, call *Call) (*Result, error) {
+		r.touch(ctx)
+
+		provider, name, primary, err := r.route(ctx, call.Kind)
+		if err != nil {
+			return nil, err
+		}
+		call.servedBy(name, provider)
+
+		text, err := streamCompletion(r.scoped(ctx, name), provider, call.Request, call.Filepath, call.LanguageID, newReasoningFilter(delivered.deliver))
+		r.recordHealth(name, err)
+
+		if primary && r.observe(err) {
+			var fallback Provider
+			if fallback, call.Provider, err = r.routeFallback(ctx); err != nil {
+				return nil, err
+			}
+			call.servedBy(call.Provider, fallback)
+			text, err = streamCompletion(r.scoped(ctx, call.Provider), fallback, call.Request, call.Filepath, call.LanguageID, newReasoningFilter(delivered.takeOver(ctx)))
+		}
+
+		if text == "" {
+			return &Result{}, err
+		}
+		return &Result{Completions: []string{text}}, err
+	})
+	if result == nil || len(result.Completions) == 0 {
+		return "", err
+	}
+	return result.Completions[0], err
+}
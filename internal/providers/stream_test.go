@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamer streams its deltas, then fails with err if set.
+type streamer struct {
+	probed
+	deltas []string
+	err    error
+}
+
+func (s streamer) ChatStream(ctx context.Context, systemPrompt, userPrompt string, onDelta StreamFunc) (*ChatResponse, error) {
+	text, err := s.CompletionStream(ctx, CompletionRequest{}, "", "", onDelta)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatResponse{Result: text}, nil
+}
+
+func (s streamer) CompletionStream(ctx context.Context, req CompletionRequest, filepath, languageID string, onDelta StreamFunc) (string, error) {
+	for _, delta := range s.deltas {
+		if err := onDelta(delta); err != nil {
+			return "", err
+		}
+	}
+	if s.err != nil {
+		return "", s.err
+	}
+	return strings.Join(s.deltas, ""), nil
+}
+
+func TestStreamFallbackTakeOver(t *testing.T) {
+	quota := &ProviderError{Kind: ErrorKindQuota, Message: "quota exceeded"}
+	tests := []struct {
+		name     string
+		primary  []string
+		fallback []string
+		restart  bool
+		want     string
+	}{
+		{"same start", []string{"func ", "add("}, []string{"func add(a, ", "b int)"}, false, "func add(a, b int)"},
+		{"shorter than sent", []string{"func add(a"}, []string{"func", " add(a", ", b int)"}, false, "func add(a, b int)"},
+		{"different start", []string{"func sum("}, []string{"func add(a, b int)"}, false, "func sum(add(a, b int)"},
+		{"nothing sent", nil, []string{"func add(a, b int)"}, false, "func add(a, b int)"},
+		{"restart", []string{"func sum("}, []string{"func add(a, b int)"}, true, "func add(a, b int)"},
+	}
+	for _, tt := range tests {
+		for _, chat := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s chat=%v", tt.name, chat), func(t *testing.T) {
+				r := NewRegistry()
+				r.Register("primary", streamer{deltas: tt.primary, err: quota})
+				r.Register("fallback", streamer{deltas: tt.fallback})
+				r.SetCurrent("primary")
+				if err := r.SetFallback("fallback", 1, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+
+				var shown strings.Builder
+				ctx := context.Background()
+				if tt.restart {
+					ctx = WithStreamRestart(ctx, shown.Reset)
+				}
+				onDelta := func(delta string) error {
+					shown.WriteString(delta)
+					return nil
+				}
+
+				var result string
+				var err error
+				if chat {
+					var resp *ChatResponse
+					if resp, err = r.ChatStream(ctx, "", "", onDelta); resp != nil {
+						result = resp.Result
+					}
+				} else {
+					result, err = r.CompletionStream(ctx, CompletionRequest{ContentBefore: "x"}, "a.go", "go", onDelta)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result != strings.Join(tt.fallback, "") {
+					t.Errorf("result %q, want the fallback's %q", result, strings.Join(tt.fallback, ""))
+				}
+				if shown.String() != tt.want {
+					t.Errorf("streamed %q, want %q", shown.String(), tt.want)
+				}
+			})
+		}
+	}
+}
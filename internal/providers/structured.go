@@ -0,0 +1,163 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StructuredChatter is implemented by providers whose API can hold the
+// model to a JSON schema. ChatStructured answers a code action with the
+// replacement text, an explanation and a confidence instead of free text
+// that has to be cleaned of markdown fences and commentary.
+type StructuredChatter interface {
+	ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error)
+}
+
+// actionResultSchemaName names actionResultSchema in requests.
+const actionResultSchemaName = "action_result"
+
+// actionResultSchema is the JSON schema of a structured action result.
+var actionResultSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"replacement": map[string]any{
+			"type":        "string",
+			"description": "The code that replaces the selection, exactly as it should appear in the file, without markdown fences",
+		},
+		"explanation": map[string]any{
+			"type":        "string",
+			"description": "One or two sentences on what was changed and why",
+		},
+		"confidence": map[string]any{
+			"type":        "number",
+			"description": "How confident you are that the replacement is correct, from 0 to 1",
+		},
+	},
+	"required":             []string{"replacement", "explanation", "confidence"},
+	"additionalProperties": false,
+}
+
+// structuredSystemPrompt asks for the JSON result on top of the action's
+// own instructions, which describe what goes into the replacement.
+func structuredSystemPrompt(systemPrompt string) string {
+	return systemPrompt + `
+
+Respond with a JSON object with these fields:
+- "replacement": the code to insert, following the rules above; it is inserted verbatim, so no markdown fences
+- "explanation": one or two sentences on what you changed and why
+- "confidence": a number from 0 to 1 for how sure you are the replacement is correct`
+}
+
+type actionResult struct {
+	Replacement *string `json:"replacement"`
+	Explanation string  `json:"explanation"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// parseStructuredResult decodes a structured action result. Some servers
+// wrap even schema-constrained output in a code fence, which is removed
+// first.
+func parseStructuredResult(text string) (*ChatResponse, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[strings.IndexByte(text+"\n", '\n'):], "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+
+	var result actionResult
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("structured result: %w", err)
+	}
+	if result.Replacement == nil {
+		return nil, fmt.Errorf("structured result has no replacement")
+	}
+	return &ChatResponse{
+		Result:      *result.Replacement,
+		Explanation: strings.TrimSpace(result.Explanation),
+		Confidence:  min(max(result.Confidence, 0), 1),
+		Structured:  true,
+	}, nil
+}
+
+// structuredResponse parses text as a structured result, or passes it on
+// as a plain response for the usual cleanup when the model ignored the
+// schema.
+func structuredResponse(text string) *ChatResponse {
+	text = stripReasoning(text)
+	if resp, err := parseStructuredResult(text); err == nil {
+		return resp
+	}
+	return &ChatResponse{Result: text}
+}
+
+// structuredChatCompletion is ChatStructured for OpenAI-compatible
+// /chat/completions APIs that accept a json_schema response format.
+func structuredChatCompletion(ctx context.Context, do requestFunc, model, systemPrompt, userPrompt string, maxTokens int) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: model,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: structuredSystemPrompt(systemPrompt)},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:      maxTokens,
+		Temperature:    0.1,
+		ResponseFormat: jsonSchemaFormat(),
+	}
+
+	resp, err := do(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	chatResp, err := parseChatCompletion(resp)
+	if err != nil {
+		return nil, err
+	}
+	return structuredResponse(chatResp.Result), nil
+}
+
+// chatStructured asks provider for a structured result, falling back to a
+// plain chat when it cannot give one.
+func chatStructured(ctx context.Context, provider Provider, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	if structured, ok := provider.(StructuredChatter); ok {
+		return structured.ChatStructured(ctx, systemPrompt, userPrompt)
+	}
+	return provider.Chat(ctx, systemPrompt, userPrompt)
+}
+
+// ChatStructured is Chat for code actions: providers implementing
+// StructuredChatter return the replacement with an explanation and a
+// confidence, others a plain response with Structured unset, which the
+// caller cleans up as before.
+func (r *Registry) ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	call := &Call{Kind: CallChat, Structured: true, SystemPrompt: systemPrompt, UserPrompt: userPrompt}
+	result, err := r.intercept(ctx, call, func(ctx context.Context, call *Call) (*Result, error) {
+		r.touch(ctx)
+
+		provider, name, primary, err := r.route(ctx, call.Kind)
+		if err != nil {
+			return nil, err
+		}
+		call.servedBy(name, provider)
+
+		resp, err := chatStructured(r.scoped(ctx, name), provider, call.SystemPrompt, call.UserPrompt)
+		r.recordHealth(name, err)
+
+		if primary && r.observe(err) {
+			var fallback Provider
+			if fallback, call.Provider, err = r.routeFallback(ctx); err != nil {
+				return nil, err
+			}
+			call.servedBy(call.Provider, fallback)
+			resp, err = chatStructured(r.scoped(ctx, call.Provider), fallback, call.SystemPrompt, call.UserPrompt)
+		}
+
+		return &Result{Chat: resp}, err
+	})
+	if result == nil {
+		return nil, err
+	}
+	return result.Chat, err
+}
@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// TabbyProvider talks to a self-hosted Tabby server. Tabby picks the model
+// server-side, so only the endpoint and token are configurable.
+type TabbyProvider struct {
+	apiKey   string
+	endpoint string
+	timeout  time.Duration
+	logger   *lsp.Logger
+}
+
+func NewTabbyProvider(apiKey, endpoint string, timeoutMs int, logger *lsp.Logger) *TabbyProvider {
+	return &TabbyProvider{
+		apiKey:   apiKey,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		timeout:  time.Duration(timeoutMs) * time.Millisecond,
+		logger:   logger,
+	}
+}
+
+type tabbySegments struct {
+	Prefix   string `json:"prefix"`
+	Suffix   string `json:"suffix,omitempty"`
+	Filepath string `json:"filepath,omitempty"`
+}
+
+type tabbyCompletionRequest struct {
+	Language    string        `json:"language"`
+	Segments    tabbySegments `json:"segments"`
+	Temperature float64       `json:"temperature,omitempty"`
+	Seed        int           `json:"seed,omitempty"`
+}
+
+type tabbyCompletionResponse struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Index int    `json:"index"`
+		Text  string `json:"text"`
+	} `json:"choices"`
+}
+
+func (p *TabbyProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	results := make([]string, 0, numSuggestions)
+
+	for i := 0; i < numSuggestions; i++ {
+		apiReq := tabbyCompletionRequest{
+			Language: languageID,
+			Segments: tabbySegments{
+				Prefix:   req.ContentBefore,
+				Suffix:   req.ContentAfter,
+				Filepath: strings.TrimPrefix(filepath, "file://"),
+			},
+			Seed: i,
+		}
+
+		// Tabby samples greedily by default; only add randomness for
+		// alternative suggestions.
+		if i > 0 {
+			apiReq.Temperature = 0.2 + float64(i)*0.2
+		}
+
+		resp, err := p.doRequest(ctx, "/v1/completions", apiReq)
+		if err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		var apiResp tabbyCompletionResponse
+		if err := json.Unmarshal(resp, &apiResp); err != nil {
+			if len(results) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("parse response: %w", err)
+		}
+
+		for _, choice := range apiResp.Choices {
+			if text := trimFIMOutput(choice.Text); text != "" {
+				results = append(results, text)
+			}
+		}
+	}
+
+	p.logger.Log(fmt.Sprintf("Tabby returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+// Chat uses Tabby's OpenAI-compatible chat endpoint, which requires a chat
+// model to be configured on the server.
+func (p *TabbyProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		Temperature: 0.1,
+	}
+
+	resp, err := p.doRequest(ctx, "/v1/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChatCompletion(resp)
+}
+
+func (p *TabbyProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	return postJSON(ctx, p.endpoint+endpoint, headers, p.timeout, body)
+}
+
+// Health checks the server's health endpoint.
+func (p *TabbyProvider) Health(ctx context.Context) error {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	return probeEndpoint(ctx, p.endpoint+"/v1/health", headers)
+}
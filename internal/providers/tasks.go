@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetTaskRoute sends every call of kind, CallCompletion or CallChat, to the
+// named provider and, if model is set, to that model, instead of the current
+// provider. This lets completions run on a local FIM model while actions go
+// to a larger cloud model. Like overrides, task routes bypass the quota
+// fallback; an override on the request context still takes precedence.
+func (r *Registry) SetTaskRoute(kind, name, model string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider, ok := r.providers[name]
+	if !ok {
+		return fmt.Errorf("%s provider not found: %s", kind, name)
+	}
+	if _, ok := provider.(ModelSwitcher); model != "" && !ok {
+		return fmt.Errorf("provider %s does not have switchable models", name)
+	}
+
+	if r.tasks == nil {
+		r.tasks = map[string]override{}
+	}
+	r.tasks[kind] = override{provider: name, model: model}
+	return nil
+}
+
+// TaskRoute returns the provider and model configured for kind, if any.
+func (r *Registry) TaskRoute(kind string) (string, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	o, ok := r.tasks[kind]
+	return o.provider, o.model, ok
+}
+
+// routeTask resolves the task route for kind, if any.
+func (r *Registry) routeTask(ctx context.Context, kind string) (Provider, string, bool, error) {
+	r.mu.RLock()
+	o, ok := r.tasks[kind]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, "", false, nil
+	}
+	return r.resolve(ctx, o)
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+type TogetherProvider struct {
+	apiKey    string
+	model     string
+	chatModel string
+	endpoint  string
+	useFIM    bool
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+// NewTogetherProvider creates a provider for Together AI. When useFIM is set,
+// completions send a raw FIM prompt in the model family's token format to
+// /completions; otherwise they are prompted through chat.
+func NewTogetherProvider(apiKey, model, chatModel, endpoint string, useFIM bool, timeoutMs int, logger *lsp.Logger) *TogetherProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &TogetherProvider{
+		apiKey:    apiKey,
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		useFIM:    useFIM,
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *TogetherProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if !p.useFIM {
+		return chatPromptedCompletion(ctx, p.doRequest, p.model, req, filepath, languageID, numSuggestions)
+	}
+
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+	template := fimTemplateFor(p.model)
+
+	temperature := 0.2
+	if numSuggestions > 1 {
+		temperature = 0.6
+	}
+
+	apiReq := completionsRequest{
+		Model:       p.model,
+		Prompt:      template.build(before, after),
+		MaxTokens:   128,
+		Temperature: temperature,
+		N:           numSuggestions,
+		Stop:        req.stopSequences(template.stopSequences()),
+	}
+
+	resp, err := p.doRequest(ctx, "/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseCompletions(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log(fmt.Sprintf("Together FIM (%s) returned %d completions", template.name, len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *TogetherProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: p.chatModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:   4096,
+		Temperature: 0.1,
+		Stop:        []string{"<|im_end|>", "<|EOT|>", "<｜end▁of▁sentence｜>"},
+	}
+
+	resp, err := p.doRequest(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log("DEBUG [Together Chat]: Raw response:", string(resp))
+	return parseChatCompletion(resp)
+}
+
+func (p *TogetherProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	return postJSON(ctx, p.endpoint+endpoint, headers, p.timeout, body)
+}
+
+// Health checks that the API is reachable.
+func (p *TogetherProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey})
+}
+
+func (p *TogetherProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *TogetherProvider) WithModels(model, chatModel string) Provider {
+	return NewTogetherProvider(p.apiKey, model, chatModel, p.endpoint, p.useFIM, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /models endpoint.
+func (p *TogetherProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey}, healthTimeout)
+}
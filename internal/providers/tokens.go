@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// estimateTokens approximates how many tokens a BPE tokenizer of the
+// tiktoken kind splits text into, without shipping a vocabulary: words cost
+// about one token per six letters, numbers one per three digits, each
+// symbol one, and a run of whitespace one, except the single space such
+// tokenizers fold into the following word. It is meant for sizing prompts,
+// where being off by a tenth is fine and overflowing a small model by a
+// factor of two, as counting by lines or bytes can, is not.
+func estimateTokens(text string) int {
+	tokens := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		j := i + size
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || r == '_'):
+			for j < len(text) && isWordByte(text[j]) {
+				j++
+			}
+			tokens += (j - i + 5) / 6
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+				j++
+			}
+			tokens += (j - i + 2) / 3
+		case r == ' ' && j < len(text) && isWordByte(text[j]):
+			// Folded into the word that follows.
+		case unicode.IsSpace(r):
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t' || text[j] == '\n' || text[j] == '\r') {
+				j++
+			}
+			tokens++
+		default:
+			tokens++
+		}
+		i = j
+	}
+	return tokens
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// tokenTail returns the longest end of text estimated at no more than
+// budget tokens, starting on a rune boundary.
+func tokenTail(text string, budget int) string {
+	lo, hi := 0, len(text)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if estimateTokens(text[mid:]) <= budget {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	for lo < len(text) && !utf8.RuneStart(text[lo]) {
+		lo++
+	}
+	return text[lo:]
+}
+
+// tokenHead returns the longest start of text estimated at no more than
+// budget tokens, ending on a rune boundary.
+func tokenHead(text string, budget int) string {
+	lo, hi := 0, len(text)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(text[:mid]) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	for lo > 0 && lo < len(text) && !utf8.RuneStart(text[lo]) {
+		lo--
+	}
+	return text[:lo]
+}
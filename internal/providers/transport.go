@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// httpClient is shared by every provider so that transport settings and
+// concurrency limits apply to all of them. Timeouts come from the request
+// contexts.
+var httpClient = &http.Client{Transport: &limitedTransport{base: http.DefaultTransport}}
+
+// TLSOptions configures the TLS side of provider connections, for
+// self-hosted servers behind an internal CA or requiring client
+// certificates. Zero values keep Go's defaults.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and its key.
+	CertFile string
+	KeyFile  string
+}
+
+// ConfigureTLS applies opts to the client used for all provider requests.
+// It must be called before the first request.
+func ConfigureTLS(opts TLSOptions) error {
+	if opts == (TLSOptions{}) {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient.Transport = &limitedTransport{base: transport}
+	return nil
+}
@@ -0,0 +1,355 @@
+package providers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// modelPrice is the list price in USD per million tokens. Prompt cache
+// reads and writes cost the input price where no price of their own is
+// listed.
+type modelPrice struct {
+	input      float64
+	output     float64
+	cacheRead  float64
+	cacheWrite float64
+}
+
+// modelPrices holds list prices for hosted models, matched by the longest
+// prefix of the model name the API reports. Local models have no entry and
+// are counted without cost.
+var modelPrices = map[string]modelPrice{
+	"gpt-5":                           {1.25, 10, 0.125, 0},
+	"gpt-5-mini":                      {0.25, 2, 0.025, 0},
+	"gpt-4.1":                         {2, 8, 0.5, 0},
+	"gpt-4.1-mini":                    {0.4, 1.6, 0.1, 0},
+	"gpt-4.1-nano":                    {0.1, 0.4, 0.025, 0},
+	"gpt-4o":                          {2.5, 10, 1.25, 0},
+	"gpt-4o-mini":                     {0.15, 0.6, 0.075, 0},
+	"gpt-3.5-turbo":                   {0.5, 1.5, 0, 0},
+	"gpt-3.5-turbo-instruct":          {1.5, 2, 0, 0},
+	"claude-opus-4":                   {15, 75, 1.5, 18.75},
+	"claude-sonnet-4":                 {3, 15, 0.3, 3.75},
+	"claude-3-7-sonnet":               {3, 15, 0.3, 3.75},
+	"claude-3-5-sonnet":               {3, 15, 0.3, 3.75},
+	"claude-haiku-4-5":                {1, 5, 0.1, 1.25},
+	"claude-3-5-haiku":                {0.8, 4, 0.08, 1},
+	"deepseek-chat":                   {0.27, 1.1, 0.07, 0},
+	"deepseek-coder":                  {0.27, 1.1, 0.07, 0},
+	"deepseek-reasoner":               {0.55, 2.19, 0.14, 0},
+	"grok-4":                          {3, 15, 0.75, 0},
+	"grok-3":                          {3, 15, 0.75, 0},
+	"grok-3-mini":                     {0.3, 0.5, 0.075, 0},
+	"grok-code-fast-1":                {0.2, 1.5, 0.02, 0},
+	"gemini-2.5-pro":                  {1.25, 10, 0.31, 0},
+	"gemini-2.5-flash":                {0.3, 2.5, 0.075, 0},
+	"Qwen/Qwen2.5-Coder-32B-Instruct": {0.8, 0.8, 0, 0},
+}
+
+func priceFor(model string) (modelPrice, bool) {
+	best := ""
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
+
+// UsageEntry accumulates the token usage of one model on one provider.
+type UsageEntry struct {
+	Provider         string
+	Model            string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	// CacheReadTokens and CacheWriteTokens are the prompt tokens read from
+	// and written to the provider's prompt cache.
+	CacheReadTokens  int
+	CacheWriteTokens int
+	// Cost is the estimated cost in USD, zero when the model has no known
+	// price.
+	Cost   float64
+	Priced bool
+}
+
+// UsageTracker accumulates token counts and estimated costs for the
+// lifetime of the process.
+type UsageTracker struct {
+	mu      sync.Mutex
+	since   time.Time
+	entries map[[2]string]*UsageEntry
+	// appended holds the totals as of appendedAt, when Append last wrote
+	// them, so the next record covers only what came after.
+	appendMu   sync.Mutex
+	appended   map[[2]string]UsageEntry
+	appendedAt time.Time
+}
+
+func newUsageTracker() *UsageTracker {
+	now := time.Now()
+	return &UsageTracker{since: now, entries: make(map[[2]string]*UsageEntry), appendedAt: now}
+}
+
+// tokenUsage is the token count of one response. Prompt counts every input
+// token, cached or not; CacheRead and CacheWrite are the parts of it read
+// from and written to the provider's prompt cache.
+type tokenUsage struct {
+	Prompt, Completion    int
+	CacheRead, CacheWrite int
+}
+
+func (t *UsageTracker) record(provider, model string, usage tokenUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := [2]string{provider, model}
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &UsageEntry{Provider: provider, Model: model}
+		t.entries[key] = entry
+	}
+
+	entry.Requests++
+	entry.PromptTokens += usage.Prompt
+	entry.CompletionTokens += usage.Completion
+	entry.CacheReadTokens += usage.CacheRead
+	entry.CacheWriteTokens += usage.CacheWrite
+
+	if price, ok := priceFor(model); ok {
+		uncached := usage.Prompt - usage.CacheRead - usage.CacheWrite
+		entry.Priced = true
+		entry.Cost += (float64(uncached)*price.input +
+			float64(usage.CacheRead)*cmp.Or(price.cacheRead, price.input) +
+			float64(usage.CacheWrite)*cmp.Or(price.cacheWrite, price.input) +
+			float64(usage.Completion)*price.output) / 1e6
+	}
+}
+
+// Snapshot returns the accumulated usage ordered by provider and model.
+func (t *UsageTracker) Snapshot() []UsageEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := make([]UsageEntry, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, *entry)
+	}
+	slices.SortFunc(entries, func(a, b UsageEntry) int {
+		return cmp.Or(cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.Model, b.Model))
+	})
+	return entries
+}
+
+// Summary formats the usage as one line per provider and model plus a
+// total.
+func (t *UsageTracker) Summary() string {
+	entries := t.Snapshot()
+	if len(entries) == 0 {
+		return "No token usage recorded since " + t.since.Format("15:04")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Token usage since %s:", t.since.Format("2006-01-02 15:04"))
+
+	var total float64
+	for _, e := range entries {
+		cost := "no price"
+		if e.Priced {
+			cost = fmt.Sprintf("$%.4f", e.Cost)
+		}
+		cached := ""
+		if e.CacheReadTokens > 0 || e.CacheWriteTokens > 0 {
+			cached = fmt.Sprintf(" (%d cache read, %d cache write)", e.CacheReadTokens, e.CacheWriteTokens)
+		}
+		fmt.Fprintf(&b, "\n%s %s: %d requests, %d in%s / %d out tokens, %s", e.Provider, e.Model, e.Requests, e.PromptTokens, cached, e.CompletionTokens, cost)
+		total += e.Cost
+	}
+	fmt.Fprintf(&b, "\nEstimated total: $%.4f", total)
+	return b.String()
+}
+
+// minus returns the usage of e beyond prev, an earlier total of the same
+// provider and model.
+func (e UsageEntry) minus(prev UsageEntry) UsageEntry {
+	e.Requests -= prev.Requests
+	e.PromptTokens -= prev.PromptTokens
+	e.CompletionTokens -= prev.CompletionTokens
+	e.CacheReadTokens -= prev.CacheReadTokens
+	e.CacheWriteTokens -= prev.CacheWriteTokens
+	e.Cost -= prev.Cost
+	return e
+}
+
+// Append adds the usage since the previous Append, or since startup, to
+// the JSONL file at path as one record of that period, attributed to user
+// when not empty. Nothing is written when no usage was recorded meanwhile.
+func (t *UsageTracker) Append(path, user string) error {
+	type entryJSON struct {
+		Provider         string  `json:"provider"`
+		Model            string  `json:"model"`
+		Requests         int     `json:"requests"`
+		PromptTokens     int     `json:"promptTokens"`
+		CompletionTokens int     `json:"completionTokens"`
+		CacheReadTokens  int     `json:"cacheReadTokens,omitempty"`
+		CacheWriteTokens int     `json:"cacheWriteTokens,omitempty"`
+		Cost             float64 `json:"cost,omitempty"`
+		Priced           bool    `json:"priced"`
+	}
+	type recordJSON struct {
+		Since   time.Time   `json:"since"`
+		Until   time.Time   `json:"until"`
+		User    string      `json:"user,omitempty"`
+		Entries []entryJSON `json:"entries"`
+	}
+
+	t.appendMu.Lock()
+	defer t.appendMu.Unlock()
+
+	record := recordJSON{Since: t.appendedAt, Until: time.Now(), User: user}
+	totals := make(map[[2]string]UsageEntry)
+	for _, e := range t.Snapshot() {
+		key := [2]string{e.Provider, e.Model}
+		totals[key] = e
+		if e = e.minus(t.appended[key]); e.Requests > 0 {
+			record.Entries = append(record.Entries, entryJSON(e))
+		}
+	}
+	if len(record.Entries) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	t.appended, t.appendedAt = totals, record.Until
+	return nil
+}
+
+type usageScopeKey struct{}
+
+type usageScope struct {
+	trackers []*UsageTracker
+	provider string
+}
+
+// withUsageScope attributes usage parsed from responses made with ctx to
+// the named provider, in each of trackers.
+func withUsageScope(ctx context.Context, trackers []*UsageTracker, provider string) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, usageScope{trackers: trackers, provider: provider})
+}
+
+// usageEnvelope covers the usage fields of the response formats spoken by
+// the providers: OpenAI-style, Anthropic, Ollama and Gemini. Anthropic
+// counts cached prompt tokens apart from input_tokens; the others include
+// them in the prompt count.
+type usageEnvelope struct {
+	Model        string `json:"model"`
+	ModelVersion string `json:"modelVersion"`
+	Usage        *struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+		// PromptCacheHitTokens is DeepSeek's count of cached tokens.
+		PromptCacheHitTokens     int `json:"prompt_cache_hit_tokens"`
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// recordUsage parses the usage reported in a successful response body and
+// adds it to the tracker in ctx, if any.
+func recordUsage(ctx context.Context, body []byte) {
+	if ctx.Value(usageScopeKey{}) == nil {
+		return
+	}
+
+	var env usageEnvelope
+	if json.Unmarshal(body, &env) != nil {
+		return
+	}
+
+	usage := tokenUsage{Prompt: env.PromptEvalCount, Completion: env.EvalCount}
+	switch u := env.Usage; {
+	case u != nil:
+		usage = anthropicTokens(u.InputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens, u.OutputTokens)
+		usage.Prompt += u.PromptTokens
+		usage.Completion += u.CompletionTokens
+		usage.CacheRead += u.PromptCacheHitTokens
+		if u.PromptTokensDetails != nil {
+			usage.CacheRead += u.PromptTokensDetails.CachedTokens
+		}
+	case env.UsageMetadata != nil:
+		usage = tokenUsage{
+			Prompt:     env.UsageMetadata.PromptTokenCount,
+			Completion: env.UsageMetadata.CandidatesTokenCount,
+			CacheRead:  env.UsageMetadata.CachedContentTokenCount,
+		}
+	}
+	recordTokens(ctx, cmp.Or(env.Model, env.ModelVersion), usage)
+}
+
+// anthropicTokens returns the usage Anthropic reports, whose input tokens
+// leave out those read from and written to the prompt cache.
+func anthropicTokens(input, cacheRead, cacheWrite, output int) tokenUsage {
+	return tokenUsage{
+		Prompt:     input + cacheRead + cacheWrite,
+		Completion: output,
+		CacheRead:  cacheRead,
+		CacheWrite: cacheWrite,
+	}
+}
+
+// recordTokens adds usage counted by a caller, such as a stream that
+// reports tokens across several events, to the tracker in ctx.
+func recordTokens(ctx context.Context, model string, usage tokenUsage) {
+	scope, ok := ctx.Value(usageScopeKey{}).(usageScope)
+	if !ok || usage.Prompt == 0 && usage.Completion == 0 {
+		return
+	}
+	for _, tracker := range scope.trackers {
+		tracker.record(scope.provider, cmp.Or(model, "unknown"), usage)
+	}
+}
+
+// Usage returns the token usage accumulated across all providers.
+func (r *Registry) Usage() *UsageTracker {
+	return r.usage
+}
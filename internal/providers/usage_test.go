@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestRecordUsageCachedTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want UsageEntry
+	}{
+		{
+			"anthropic",
+			`{"model": "claude-sonnet-4-20250514", "usage": {"input_tokens": 100, "cache_creation_input_tokens": 2000, "cache_read_input_tokens": 8000, "output_tokens": 50}}`,
+			// 100 × $3 + 8000 × $0.30 + 2000 × $3.75 + 50 × $15 per million.
+			UsageEntry{PromptTokens: 10100, CompletionTokens: 50, CacheReadTokens: 8000, CacheWriteTokens: 2000, Cost: 0.01095},
+		},
+		{
+			"openai",
+			`{"model": "gpt-4o-mini", "usage": {"prompt_tokens": 10000, "completion_tokens": 100, "prompt_tokens_details": {"cached_tokens": 8000}}}`,
+			// 2000 × $0.15 + 8000 × $0.075 + 100 × $0.60 per million.
+			UsageEntry{PromptTokens: 10000, CompletionTokens: 100, CacheReadTokens: 8000, Cost: 0.00096},
+		},
+		{
+			"deepseek",
+			`{"model": "deepseek-chat", "usage": {"prompt_tokens": 1000, "completion_tokens": 100, "prompt_cache_hit_tokens": 600}}`,
+			// 400 × $0.27 + 600 × $0.07 + 100 × $1.10 per million.
+			UsageEntry{PromptTokens: 1000, CompletionTokens: 100, CacheReadTokens: 600, Cost: 0.00026},
+		},
+		{
+			"gemini",
+			`{"modelVersion": "gemini-2.5-flash", "usageMetadata": {"promptTokenCount": 1000, "candidatesTokenCount": 10, "cachedContentTokenCount": 1000}}`,
+			// 1000 × $0.075 + 10 × $2.50 per million.
+			UsageEntry{PromptTokens: 1000, CompletionTokens: 10, CacheReadTokens: 1000, Cost: 0.0001},
+		},
+		{
+			"uncached",
+			`{"model": "gpt-4o", "usage": {"prompt_tokens": 1000, "completion_tokens": 100}}`,
+			UsageEntry{PromptTokens: 1000, CompletionTokens: 100, Cost: 0.0035},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newUsageTracker()
+			recordUsage(withUsageScope(context.Background(), []*UsageTracker{tracker}, tt.name), []byte(tt.body))
+
+			entries := tracker.Snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			got := entries[0]
+			if got.PromptTokens != tt.want.PromptTokens || got.CompletionTokens != tt.want.CompletionTokens ||
+				got.CacheReadTokens != tt.want.CacheReadTokens || got.CacheWriteTokens != tt.want.CacheWriteTokens {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !got.Priced || math.Abs(got.Cost-tt.want.Cost) > 1e-9 {
+				t.Errorf("cost $%.6f, want $%.6f", got.Cost, tt.want.Cost)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var promptVariableRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// ExpandPromptVariables replaces {name} placeholders in prompt text with
+// values resolved now, relative to the workspace root. Unknown names are
+// left untouched so literal braces in instructions survive.
+//
+// Supported: {git_branch}, {os}, {arch}, {date}, {time}, {project_name},
+// {workspace}.
+func ExpandPromptVariables(text, root string) string {
+	if !strings.Contains(text, "{") {
+		return text
+	}
+
+	return promptVariableRe.ReplaceAllStringFunc(text, func(match string) string {
+		if value, ok := resolvePromptVariable(match[1:len(match)-1], root); ok {
+			return value
+		}
+		return match
+	})
+}
+
+func resolvePromptVariable(name, root string) (string, bool) {
+	switch name {
+	case "git_branch":
+		return gitBranch(root), true
+	case "os":
+		return runtime.GOOS, true
+	case "arch":
+		return runtime.GOARCH, true
+	case "date":
+		return time.Now().Format("2006-01-02"), true
+	case "time":
+		return time.Now().Format("15:04"), true
+	case "project_name":
+		return filepath.Base(root), true
+	case "workspace":
+		return root, true
+	}
+	return "", false
+}
+
+// gitBranch reads the current branch from .git/HEAD without shelling out.
+// A detached HEAD yields the short commit hash.
+func gitBranch(root string) string {
+	gitDir := findGitDir(root)
+	if gitDir == "" {
+		return "unknown"
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "unknown"
+	}
+
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 7 {
+		return head[:7]
+	}
+	return head
+}
+
+// findGitDir walks up from dir to the repository's git directory, following
+// the `gitdir:` indirection used by worktrees and submodules.
+func findGitDir(dir string) string {
+	for dir != "" {
+		path := filepath.Join(dir, ".git")
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				return path
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return ""
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return ""
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return gitDir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+	return ""
+}
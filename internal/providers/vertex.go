@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+type vertexPart struct {
+	Text string `json:"text"`
+}
+
+type vertexContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []vertexPart `json:"parts"`
+}
+
+type vertexGenerationConfig struct {
+	Temperature     float64 `json:"temperature"`
+	MaxOutputTokens int     `json:"maxOutputTokens"`
+	CandidateCount  int     `json:"candidateCount,omitempty"`
+}
+
+type vertexRequest struct {
+	Contents          []vertexContent        `json:"contents"`
+	SystemInstruction *vertexContent         `json:"systemInstruction,omitempty"`
+	GenerationConfig  vertexGenerationConfig `json:"generationConfig"`
+}
+
+type vertexResponse struct {
+	Candidates []struct {
+		Content vertexContent `json:"content"`
+	} `json:"candidates"`
+}
+
+// VertexProvider calls Gemini models through Vertex AI, authenticating with
+// Application Default Credentials instead of an API key.
+type VertexProvider struct {
+	project   string
+	location  string
+	model     string
+	chatModel string
+	tokens    *gcpTokenSource
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+func NewVertexProvider(project, location, model, chatModel, credentialsPath string, timeoutMs int, logger *lsp.Logger) *VertexProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &VertexProvider{
+		project:   project,
+		location:  location,
+		model:     model,
+		chatModel: chatModel,
+		tokens:    newGCPTokenSource(credentialsPath),
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *VertexProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	temperature := 0.0
+	if numSuggestions > 1 {
+		temperature = 0.4
+	}
+
+	apiReq := vertexRequest{
+		Contents: []vertexContent{{
+			Role:  "user",
+			Parts: []vertexPart{{Text: completionUserPrompt(filepath, req)}},
+		}},
+		SystemInstruction: &vertexContent{Parts: []vertexPart{{Text: BuildCompletionSystemPrompt(languageID)}}},
+		GenerationConfig: vertexGenerationConfig{
+			Temperature:     temperature,
+			MaxOutputTokens: 256,
+			CandidateCount:  numSuggestions,
+		},
+	}
+
+	resp, err := p.doRequest(ctx, p.model, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseVertexResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log(fmt.Sprintf("Vertex returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *VertexProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := vertexRequest{
+		Contents: []vertexContent{{
+			Role:  "user",
+			Parts: []vertexPart{{Text: userPrompt}},
+		}},
+		SystemInstruction: &vertexContent{Parts: []vertexPart{{Text: systemPrompt}}},
+		GenerationConfig: vertexGenerationConfig{
+			Temperature:     0.1,
+			MaxOutputTokens: 8192,
+		},
+	}
+
+	resp, err := p.doRequest(ctx, p.chatModel, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log("DEBUG [Vertex Chat]: Raw response:", string(resp))
+
+	results, err := parseVertexResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no response from model")
+	}
+	return &ChatResponse{Result: results[0]}, nil
+}
+
+// endpoint builds the generateContent URL. The "global" location has no
+// regional host prefix.
+func (p *VertexProvider) endpoint(model string) string {
+	host := p.location + "-aiplatform.googleapis.com"
+	if p.location == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
+		host, p.project, p.location, model)
+}
+
+func (p *VertexProvider) doRequest(ctx context.Context, model string, body any) ([]byte, error) {
+	token, err := p.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"Authorization":       "Bearer " + token,
+		"x-goog-user-project": p.project,
+	}
+	return postJSON(ctx, p.endpoint(model), headers, p.timeout, body)
+}
+
+func parseVertexResponse(data []byte) ([]string, error) {
+	var apiResp vertexResponse
+	if err := json.Unmarshal(data, &apiResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	results := make([]string, 0, len(apiResp.Candidates))
+	for _, candidate := range apiResp.Candidates {
+		var text strings.Builder
+		for _, part := range candidate.Content.Parts {
+			text.WriteString(part.Text)
+		}
+		if result := strings.TrimSpace(text.String()); result != "" {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (p *VertexProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+// WithModels shares the token source, so switching models does not
+// re-authenticate.
+func (p *VertexProvider) WithModels(model, chatModel string) Provider {
+	clone := *p
+	clone.model, clone.chatModel = model, chatModel
+	return &clone
+}
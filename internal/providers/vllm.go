@@ -0,0 +1,160 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// VLLMOptions holds the sampling parameters specific to vLLM's
+// OpenAI-compatible server.
+type VLLMOptions struct {
+	// UseSuffix sends the text after the cursor as `suffix`, which requires
+	// the served model to support fill-in-the-middle.
+	UseSuffix bool
+	// BestOf generates this many candidates server-side and returns the best
+	// ones. Zero leaves the server default.
+	BestOf int
+	// TopK limits sampling to the k most likely tokens. Zero leaves the
+	// server default.
+	TopK int
+}
+
+type VLLMProvider struct {
+	apiKey     string
+	model      string
+	chatModel  string
+	endpoint   string
+	timeout    time.Duration
+	options    VLLMOptions
+	logger     *lsp.Logger
+	throughput throughputMeter
+}
+
+func NewVLLMProvider(apiKey, model, chatModel, endpoint string, options VLLMOptions, timeoutMs int, logger *lsp.Logger) *VLLMProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &VLLMProvider{
+		apiKey:    apiKey,
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		options:   options,
+		logger:    logger,
+	}
+}
+
+func (p *VLLMProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	before, after := limitFIMContext(req.ContentBefore, req.ContentAfter)
+
+	if numSuggestions < 1 {
+		numSuggestions = 1
+	}
+
+	temperature := 0.2
+	if numSuggestions > 1 {
+		temperature = 0.6
+	}
+
+	apiReq := completionsRequest{
+		Model:       p.model,
+		Prompt:      before,
+		Echo:        false,
+		MaxTokens:   p.throughput.budget(ctx, 128),
+		Temperature: temperature,
+		N:           numSuggestions,
+		TopK:        p.options.TopK,
+		Stop:        req.stopSequences(fimStopSequences),
+	}
+
+	if p.options.UseSuffix {
+		apiReq.Suffix = after
+	}
+
+	// best_of must be at least n, otherwise vLLM rejects the request.
+	if p.options.BestOf > 0 {
+		apiReq.BestOf = max(p.options.BestOf, numSuggestions)
+	}
+
+	start := time.Now()
+	resp, err := p.doRequest(ctx, "/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseCompletions(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// vLLM generates the n choices in parallel, so wall time is roughly the
+	// time of one choice. No prompt-processing split is reported.
+	var usage completionsResponse
+	if json.Unmarshal(resp, &usage) == nil {
+		p.throughput.observe(usage.Usage.CompletionTokens/numSuggestions, time.Since(start), 0)
+	}
+
+	p.logger.Log(fmt.Sprintf("vLLM returned %d completions", len(results)))
+	return util.UniqueStrings(results), nil
+}
+
+func (p *VLLMProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: p.chatModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:   2048,
+		Temperature: 0.1,
+	}
+
+	resp, err := p.doRequest(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChatCompletion(resp)
+}
+
+// ChatStructured uses vLLM's guided decoding through response_format.
+func (p *VLLMProvider) ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	return structuredChatCompletion(ctx, p.doRequest, p.chatModel, systemPrompt, userPrompt, 2048)
+}
+
+func (p *VLLMProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	return postJSON(ctx, p.endpoint+endpoint, p.authHeaders(), p.timeout, body)
+}
+
+func (p *VLLMProvider) authHeaders() map[string]string {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	return headers
+}
+
+// Health checks that the server is reachable.
+func (p *VLLMProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/models", p.authHeaders())
+}
+
+func (p *VLLMProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *VLLMProvider) WithModels(model, chatModel string) Provider {
+	return NewVLLMProvider(p.apiKey, model, chatModel, p.endpoint, p.options, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /models endpoint.
+func (p *VLLMProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/models", p.authHeaders(), healthTimeout)
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"time"
+)
+
+// Warmer is implemented by providers that load a model on first use, so the
+// load can happen before the first completion rather than during it.
+type Warmer interface {
+	WarmUp(ctx context.Context) error
+}
+
+// warmUpTimeout bounds a warm-up; loading a large model from disk can take
+// well over a minute.
+const warmUpTimeout = 3 * time.Minute
+
+// WarmUp loads, in the background, the models completions and routed
+// chats go to on providers that are Warmers: the completion route's or the
+// selected one, and the chat route's when one is set.
+func (r *Registry) WarmUp(ctx context.Context) {
+	completion, completionName, routed, err := r.routeTask(ctx, CallCompletion)
+	if !routed {
+		completion, completionName, err = r.selected(ctx)
+	}
+	if err == nil {
+		r.warmUp(ctx, completionName, completion)
+	}
+
+	chat, name, routed, err := r.routeTask(ctx, CallChat)
+	if !routed || err != nil {
+		return
+	}
+	// Without a model the route chats with the provider's chat model,
+	// which WarmUp would not load.
+	if switcher, ok := chat.(ModelSwitcher); ok {
+		_, chatModel := switcher.Models()
+		chat = switcher.WithModels(chatModel, chatModel)
+	}
+	if name != completionName || !sameModel(chat, completion) {
+		r.warmUp(ctx, name, chat)
+	}
+}
+
+// sameModel reports whether a and b, of the same name, complete with the
+// same model, so warming up both would load it twice.
+func sameModel(a, b Provider) bool {
+	sa, ok := a.(ModelSwitcher)
+	sb, ok2 := b.(ModelSwitcher)
+	if !ok || !ok2 {
+		return a == b
+	}
+	ma, _ := sa.Models()
+	mb, _ := sb.Models()
+	return ma == mb
+}
+
+func (r *Registry) warmUp(ctx context.Context, name string, provider Provider) {
+	warmer, ok := provider.(Warmer)
+	if !ok || r.permit(ctx, name) != nil {
+		return
+	}
+	r.idle.use(AccountOf(ctx), name)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+		defer cancel()
+
+		start := time.Now()
+		if err := warmer.WarmUp(ctx); err != nil {
+			r.log("Warm-up failed for", name, "error:", err.Error())
+			return
+		}
+		r.log("Warmed up", name, "in", time.Since(start).Round(time.Millisecond).String())
+	}()
+}
@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// warmable is a provider with switchable models that records the models
+// it warms up.
+type warmable struct {
+	name, model, chatModel string
+	log                    *probeLog
+}
+
+func (p warmable) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	return []string{"x"}, nil
+}
+
+func (p warmable) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	return &ChatResponse{Result: "x"}, nil
+}
+
+func (p warmable) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p warmable) WithModels(model, chatModel string) Provider {
+	p.model, p.chatModel = model, chatModel
+	return p
+}
+
+func (p warmable) WarmUp(ctx context.Context) error {
+	p.log.add(p.name + " " + p.model)
+	return nil
+}
+
+func TestWarmUpRoutedModels(t *testing.T) {
+	tests := []struct {
+		name       string
+		completion [2]string
+		chat       [2]string
+		want       []string
+	}{
+		{"selected only", [2]string{}, [2]string{}, []string{"local coder"}},
+		{"completion route model", [2]string{"local", "tiny"}, [2]string{}, []string{"local tiny"}},
+		{"chat route", [2]string{}, [2]string{"remote", ""}, []string{"local coder", "remote big"}},
+		{"chat route model", [2]string{"remote", ""}, [2]string{"local", "coder"}, []string{"local coder", "remote small"}},
+		{"same model once", [2]string{}, [2]string{"local", "coder"}, []string{"local coder"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &probeLog{}
+			r := NewRegistry()
+			r.Register("local", warmable{name: "local", model: "coder", chatModel: "instruct", log: log})
+			r.Register("remote", warmable{name: "remote", model: "small", chatModel: "big", log: log})
+			r.SetCurrent("local")
+			if tt.completion[0] != "" {
+				r.SetTaskRoute(CallCompletion, tt.completion[0], tt.completion[1])
+			}
+			if tt.chat[0] != "" {
+				r.SetTaskRoute(CallChat, tt.chat[0], tt.chat[1])
+			}
+
+			r.WarmUp(context.Background())
+			var got []string
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && len(got) < len(tt.want); {
+				got = append(got, log.take()...)
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(10 * time.Millisecond)
+			got = append(got, log.take()...)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("warmed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"strings"
+	"sync"
+)
+
+// ContextWindow sizes the code around the cursor sent with completions.
+type ContextWindow struct {
+	// Tokens is the budget for the whole context, as estimated by
+	// estimateTokens. Files that fit are sent whole.
+	Tokens int
+	// PrefixShare, SuffixShare and SkeletonShare split the budget of larger
+	// files between the code right before the cursor, the code right after
+	// it, and an outline of the declarations outside those two windows.
+	// Whatever one part does not use goes to the prefix.
+	PrefixShare   float64
+	SuffixShare   float64
+	SkeletonShare float64
+}
+
+// DefaultContextWindow is used until SetContextWindow is called.
+var DefaultContextWindow = ContextWindow{Tokens: 1024, PrefixShare: 0.7, SuffixShare: 0.2, SkeletonShare: 0.1}
+
+var window = struct {
+	mu sync.RWMutex
+	ContextWindow
+}{ContextWindow: DefaultContextWindow}
+
+// SetContextWindow configures how much code around the cursor completions
+// send.
+func SetContextWindow(w ContextWindow) {
+	window.mu.Lock()
+	defer window.mu.Unlock()
+	window.ContextWindow = w
+}
+
+func contextWindow() ContextWindow {
+	window.mu.RLock()
+	defer window.mu.RUnlock()
+	return window.ContextWindow
+}
+
+// fit cuts the text before and after the cursor to the window. Whole lines
+// are kept, except that a cursor line too long for its share is cut to it,
+// so one minified line cannot overflow a small model. The outline of the
+// omitted head of the file is prepended to the prefix and that of the
+// omitted tail appended to the suffix, so the model still sees what is
+// declared there.
+func (w ContextWindow) fit(before, after string) (string, string) {
+	if w.Tokens <= 0 || estimateTokens(before)+estimateTokens(after) <= w.Tokens {
+		return before, after
+	}
+
+	suffixBudget := int(float64(w.Tokens) * w.SuffixShare)
+	skeletonBudget := int(float64(w.Tokens) * w.SkeletonShare)
+
+	afterLines := strings.SplitAfter(after, "\n")
+	if estimateTokens(afterLines[0]) > suffixBudget {
+		afterLines[0] = tokenHead(afterLines[0], suffixBudget)
+		afterLines = afterLines[:1]
+	}
+	suffixEnd, suffixUsed := headLines(afterLines, suffixBudget)
+
+	prefixBudget := int(float64(w.Tokens)*w.PrefixShare) + suffixBudget - suffixUsed
+	beforeLines := strings.SplitAfter(before, "\n")
+	if last := len(beforeLines) - 1; estimateTokens(beforeLines[last]) > prefixBudget {
+		beforeLines = []string{tokenTail(beforeLines[last], prefixBudget)}
+	}
+	prefixStart := tailLines(beforeLines, prefixBudget)
+
+	head, headUsed := outline(beforeLines[:prefixStart], skeletonBudget)
+	tail, tailUsed := outline(afterLines[suffixEnd:], skeletonBudget-headUsed)
+
+	// Budget left over by a short outline buys more prefix lines.
+	if spare := skeletonBudget - headUsed - tailUsed; spare > 0 {
+		prefixStart = tailLines(beforeLines, prefixBudget+spare)
+		head, _ = outline(beforeLines[:prefixStart], skeletonBudget-tailUsed)
+	}
+
+	before = head + strings.Join(beforeLines[prefixStart:], "")
+	after = strings.Join(afterLines[:suffixEnd], "") + tail
+	return before, after
+}
+
+// tailLines returns the index of the first of the last lines that fit in
+// budget tokens, keeping at least the last line.
+func tailLines(lines []string, budget int) int {
+	start, used := len(lines)-1, estimateTokens(lines[len(lines)-1])
+	for start > 0 {
+		cost := estimateTokens(lines[start-1])
+		if used+cost > budget {
+			break
+		}
+		start--
+		used += cost
+	}
+	return start
+}
+
+// headLines returns how many of the first lines fit in budget tokens,
+// keeping at least the first line, and the tokens they use.
+func headLines(lines []string, budget int) (int, int) {
+	end, used := 1, estimateTokens(lines[0])
+	for end < len(lines) {
+		cost := estimateTokens(lines[end])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		end++
+	}
+	return end, used
+}
+
+// outline keeps the unindented declaration lines of lines, such as function
+// signatures and type definitions, up to budget tokens. It returns them
+// with the tokens they use.
+func outline(lines []string, budget int) (string, int) {
+	var b strings.Builder
+	used := 0
+	for _, line := range lines {
+		if !isOutlineLine(line) {
+			continue
+		}
+		cost := estimateTokens(line)
+		if used+cost > budget {
+			break
+		}
+		b.WriteString(line)
+		used += cost
+	}
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	return b.String(), used
+}
+
+func isOutlineLine(line string) bool {
+	if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '\n' || line[0] == '\r' {
+		return false
+	}
+	for _, prefix := range []string{"}", ")", "]", "//", "/*", "*", "#", "--"} {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,19 @@
+package providers
+
+import "context"
+
+type workspaceKey struct{}
+
+// WithWorkspace returns a context whose requests are made for the
+// workspace at root, for a policy that depends on the workspace when one
+// registry serves several.
+func WithWorkspace(ctx context.Context, root string) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, root)
+}
+
+// Workspace returns the root of the workspace ctx makes requests for, or
+// "" when none was set.
+func Workspace(ctx context.Context) string {
+	root, _ := ctx.Value(workspaceKey{}).(string)
+	return root
+}
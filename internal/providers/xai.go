@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+type XAIProvider struct {
+	apiKey    string
+	model     string
+	chatModel string
+	endpoint  string
+	timeout   time.Duration
+	logger    *lsp.Logger
+}
+
+func NewXAIProvider(apiKey, model, chatModel, endpoint string, timeoutMs int, logger *lsp.Logger) *XAIProvider {
+	if chatModel == "" {
+		chatModel = model
+	}
+	return &XAIProvider{
+		apiKey:    apiKey,
+		model:     model,
+		chatModel: chatModel,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+func (p *XAIProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	return chatPromptedCompletion(ctx, p.doRequest, p.model, req, filepath, languageID, numSuggestions)
+}
+
+func (p *XAIProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	apiReq := chatCompletionRequest{
+		Model: p.chatModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		MaxTokens:   8192,
+		Temperature: 0.1,
+	}
+
+	resp, err := p.doRequest(ctx, "/chat/completions", apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Log("DEBUG [xAI Chat]: Raw response:", string(resp))
+	return parseChatCompletion(resp)
+}
+
+func (p *XAIProvider) ChatStructured(ctx context.Context, systemPrompt, userPrompt string) (*ChatResponse, error) {
+	return structuredChatCompletion(ctx, p.doRequest, p.chatModel, systemPrompt, userPrompt, 8192)
+}
+
+func (p *XAIProvider) doRequest(ctx context.Context, endpoint string, body any) ([]byte, error) {
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	return postJSON(ctx, p.endpoint+endpoint, headers, p.timeout, body)
+}
+
+// Health checks that the API is reachable.
+func (p *XAIProvider) Health(ctx context.Context) error {
+	return probeEndpoint(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey})
+}
+
+func (p *XAIProvider) Models() (string, string) {
+	return p.model, p.chatModel
+}
+
+func (p *XAIProvider) WithModels(model, chatModel string) Provider {
+	return NewXAIProvider(p.apiKey, model, chatModel, p.endpoint, int(p.timeout.Milliseconds()), p.logger)
+}
+
+// ListModels queries the /models endpoint.
+func (p *XAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	return listIDs(ctx, p.endpoint+"/models", map[string]string{"Authorization": "Bearer " + p.apiKey}, healthTimeout)
+}
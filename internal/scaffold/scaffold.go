@@ -0,0 +1,260 @@
+// Package scaffold creates new files from user-defined templates, letting the
+// model fill in the parts the templates leave open.
+//
+// A template kind is a directory of files. Paths and contents may contain
+// {{variable}} placeholders, filled from values given by the user or, when
+// missing, proposed by the model, and {{ai: description}} markers that the
+// model replaces with code.
+package scaffold
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+var (
+	variableRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	aiMarkerRe = regexp.MustCompile(`\{\{\s*ai:`)
+	jsonFence  = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+)
+
+// Chatter is the part of the provider registry scaffolding needs.
+type Chatter interface {
+	Chat(ctx context.Context, systemPrompt, userPrompt string) (*providers.ChatResponse, error)
+}
+
+type File struct {
+	Path    string
+	Content string
+}
+
+type Template struct {
+	Kind  string
+	Files []File
+}
+
+// Kinds lists the template kinds available in dirs.
+func Kinds(dirs ...string) []string {
+	var kinds []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !slices.Contains(kinds, entry.Name()) {
+				kinds = append(kinds, entry.Name())
+			}
+		}
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// Load reads the template for kind from the first of dirs that has it. A
+// kind is the name of a directory in dirs, never a path.
+func Load(kind string, dirs ...string) (*Template, error) {
+	if kind == "." || kind != filepath.Base(kind) || !filepath.IsLocal(kind) {
+		return nil, fmt.Errorf("invalid template kind %q", kind)
+	}
+	for _, dir := range dirs {
+		root := filepath.Join(dir, kind)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			continue
+		}
+
+		tmpl := &Template{Kind: kind}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			tmpl.Files = append(tmpl.Files, File{Path: rel, Content: string(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read template %s: %w", kind, err)
+		}
+		return tmpl, nil
+	}
+
+	return nil, fmt.Errorf("template not found: %s", kind)
+}
+
+// Variables returns the distinct {{variable}} names used by the template.
+func (t *Template) Variables() []string {
+	var names []string
+	for _, file := range t.Files {
+		for _, text := range []string{file.Path, file.Content} {
+			for _, match := range variableRe.FindAllStringSubmatch(text, -1) {
+				if !slices.Contains(names, match[1]) {
+					names = append(names, match[1])
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Render fills in the template for targetDir. Variables missing from vars
+// are proposed by the model in one request, then every file with
+// {{ai: ...}} markers is completed in its own request. A file whose path,
+// once filled in, is absolute or leaves targetDir fails the render.
+func Render(ctx context.Context, chat Chatter, t *Template, vars map[string]string, targetDir string) ([]File, error) {
+	values := make(map[string]string, len(vars))
+	for name, value := range vars {
+		values[name] = value
+	}
+
+	var missing []string
+	for _, name := range t.Variables() {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		proposed, err := proposeVariables(ctx, chat, t, values, missing, targetDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range missing {
+			if proposed[name] == "" {
+				return nil, fmt.Errorf("model did not provide a value for %q; pass %s=...", name, name)
+			}
+			values[name] = proposed[name]
+		}
+	}
+
+	files := make([]File, 0, len(t.Files))
+	for _, file := range t.Files {
+		path := substitute(file.Path, values)
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("template path %q resolves to %q, outside %s", file.Path, path, targetDir)
+		}
+		files = append(files, File{
+			Path:    filepath.Join(targetDir, path),
+			Content: substitute(file.Content, values),
+		})
+	}
+
+	for i, file := range files {
+		if !aiMarkerRe.MatchString(file.Content) {
+			continue
+		}
+
+		resp, err := chat.Chat(ctx, providers.BuildScaffoldFillSystemPrompt(), providers.BuildScaffoldFillUserPrompt(file.Path, file.Content, describe(values)))
+		if err != nil {
+			return nil, fmt.Errorf("fill %s: %w", file.Path, err)
+		}
+		files[i].Content = strings.TrimRight(stripFence(resp.Result), "\n") + "\n"
+	}
+
+	return files, nil
+}
+
+// Write creates the files, refusing to overwrite any that already exist.
+func Write(files []File) error {
+	for _, file := range files {
+		if _, err := os.Stat(file.Path); err == nil {
+			return fmt.Errorf("%s already exists", file.Path)
+		}
+	}
+
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file.Path, []byte(file.Content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func proposeVariables(ctx context.Context, chat Chatter, t *Template, values map[string]string, missing []string, targetDir string) (map[string]string, error) {
+	var existing []string
+	if entries, err := os.ReadDir(targetDir); err == nil {
+		for _, entry := range entries {
+			existing = append(existing, entry.Name())
+		}
+	}
+
+	var paths []string
+	for _, file := range t.Files {
+		paths = append(paths, file.Path)
+	}
+
+	resp, err := chat.Chat(ctx, providers.BuildScaffoldVariablesSystemPrompt(),
+		providers.BuildScaffoldVariablesUserPrompt(t.Kind, targetDir, existing, paths, describe(values), missing))
+	if err != nil {
+		return nil, fmt.Errorf("propose variables: %w", err)
+	}
+
+	var proposed map[string]string
+	if err := json.Unmarshal([]byte(stripFence(resp.Result)), &proposed); err != nil {
+		return nil, errors.New("model returned invalid variable values; pass them explicitly as name=value")
+	}
+	return proposed, nil
+}
+
+func substitute(text string, values map[string]string) string {
+	return variableRe.ReplaceAllStringFunc(text, func(match string) string {
+		name := variableRe.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+func describe(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, values[name])
+	}
+	return b.String()
+}
+
+func stripFence(text string) string {
+	if matches := jsonFence.FindStringSubmatch(text); len(matches) > 1 {
+		return strings.TrimSpace(matches[1])
+	}
+	return strings.TrimSpace(text)
+}
+
+// Dirs returns the template directories searched for a workspace: the
+// project's own, then the user's under the config directory.
+func Dirs(root, projectDir string) []string {
+	var dirs []string
+	if projectDir != "" {
+		if !filepath.IsAbs(projectDir) {
+			projectDir = filepath.Join(root, projectDir)
+		}
+		dirs = append(dirs, projectDir)
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "helix-assist", "templates"))
+	}
+	return dirs
+}
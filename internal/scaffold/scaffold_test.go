@@ -0,0 +1,72 @@
+package scaffold_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/scaffold"
+)
+
+type chatter string
+
+func (c chatter) Chat(ctx context.Context, systemPrompt, userPrompt string) (*providers.ChatResponse, error) {
+	return &providers.ChatResponse{Result: string(c)}, nil
+}
+
+func TestRenderKeepsFilesInTarget(t *testing.T) {
+	target := t.TempDir()
+	tmpl := &scaffold.Template{Kind: "handler", Files: []scaffold.File{{Path: "{{name}}.go", Content: "package {{name}}\n"}}}
+
+	tests := []struct {
+		name     string
+		proposed string
+		want     string
+	}{
+		{"plain", `{"name": "users"}`, filepath.Join(target, "users.go")},
+		{"subdirectory", `{"name": "api/users"}`, filepath.Join(target, "api", "users.go")},
+		{"parent", `{"name": "../users"}`, ""},
+		{"nested parent", `{"name": "api/../../users"}`, ""},
+		{"absolute", `{"name": "/etc/users"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := scaffold.Render(context.Background(), chatter(tt.proposed), tmpl, nil, target)
+			if tt.want == "" {
+				if err == nil || !strings.Contains(err.Error(), "outside") {
+					t.Fatalf("got files %v and error %v, want a path outside the target refused", files, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Path != tt.want {
+				t.Errorf("got %v, want %s", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRefusesPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "templates", "handler"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "handler", "x.go"), []byte("package x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates := filepath.Join(dir, "templates")
+
+	if _, err := scaffold.Load("handler", templates); err != nil {
+		t.Fatalf("Load(handler): %v", err)
+	}
+	for _, kind := range []string{"", ".", "..", "../templates/handler", "handler/../handler", "/etc"} {
+		if _, err := scaffold.Load(kind, templates); err == nil || !strings.Contains(err.Error(), "invalid template kind") {
+			t.Errorf("Load(%q) = %v, want an invalid kind", kind, err)
+		}
+	}
+}
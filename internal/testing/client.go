@@ -0,0 +1,378 @@
+package testing
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/events"
+	"github.com/leona/helix-assist/internal/handlers"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// MockProviderName is the name the mock provider is registered under.
+const MockProviderName = "mock"
+
+// Client drives a complete Service in-process, the way Helix does over
+// stdio, so handler behaviour can be tested end to end. Requests the server
+// sends are answered like an editor would: workspace edits are applied and
+// recorded, message requests are answered by Choose, configuration requests
+// by Settings, and everything else gets an empty result.
+type Client struct {
+	Service  *lsp.Service
+	Registry *providers.Registry
+	// Choose picks the action to answer a window/showMessageRequest with;
+	// "" dismisses it. Without Choose every message is dismissed.
+	Choose func(message string, actions []string) string
+	// Settings answers workspace/configuration for every requested
+	// section. Set before Initialize, it also announces that the client
+	// supports configuration requests.
+	Settings any
+	// StringIDs sends request ids as strings rather than numbers, as some
+	// clients and proxies do.
+	StringIDs bool
+	// InitializationOptions is sent in initialize.
+	InitializationOptions any
+
+	in      *io.PipeWriter
+	out     *io.PipeReader
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+	done    chan error
+
+	mu            sync.Mutex
+	pending       map[lsp.ID]chan *lsp.JSONRPCMessage
+	notifications []*lsp.JSONRPCMessage
+	edits         chan lsp.ApplyWorkspaceEditParams
+}
+
+// NewClient starts a Service wired like the server binary, with provider as
+// its only provider. A nil cfg is the default configuration without
+// debouncing.
+func NewClient(cfg *config.Config, provider providers.Provider) *Client {
+	return NewClientWith(cfg, provider, nil)
+}
+
+// NewClientWith is NewClient with setup run on the Service before it
+// starts, such as to set an authenticator.
+func NewClientWith(cfg *config.Config, provider providers.Provider, setup func(svc *lsp.Service)) *Client {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+		cfg.Debounce = 0
+	}
+
+	registry := providers.NewRegistry()
+	registry.Register(MockProviderName, provider)
+	registry.SetCurrent(MockProviderName)
+
+	capabilities := lsp.ServerCapabilities{
+		TextDocumentSync:       lsp.TextDocumentSyncOptions{OpenClose: true, Change: lsp.TextDocumentSyncIncremental},
+		CompletionProvider:     &lsp.CompletionOptions{TriggerCharacters: cfg.TriggerCharacters, ResolveProvider: true},
+		CodeActionProvider:     true,
+		CodeLensProvider:       &lsp.CodeLensOptions{ResolveProvider: true},
+		ExecuteCommandProvider: &lsp.ExecuteCommandOptions{Commands: handlers.CommandKeys()},
+	}
+	svc := lsp.NewService(capabilities, lsp.NewLogger(""), "test")
+
+	bus := events.NewBus()
+	svc.SetContext(events.WithBus(providers.WithSelection(context.Background(), providers.NewSelection("")), bus))
+	registry.Use(events.ProviderErrors(bus))
+	trust := handlers.NewWorkspaceTrust(cfg)
+	registry.SetPolicy(func(ctx context.Context, name string) error {
+		return trust.PermitProvider(cmp.Or(providers.Workspace(ctx), svc.RootPath()), name)
+	})
+	lowPower := handlers.NewLowPowerMode(cfg, registry)
+	handlers.NewCompletionHandler(cfg, registry, lowPower, bus).Register(svc)
+	handlers.NewActionHandler(cfg, registry, lowPower, trust, bus).Register(svc)
+
+	if setup != nil {
+		setup(svc)
+	}
+
+	serverIn, in := io.Pipe()
+	out, serverOut := io.Pipe()
+	svc.SetTransport(serverIn, serverOut)
+
+	c := &Client{
+		Service:  svc,
+		Registry: registry,
+		in:       in,
+		out:      out,
+		done:     make(chan error, 1),
+		pending:  make(map[lsp.ID]chan *lsp.JSONRPCMessage),
+		edits:    make(chan lsp.ApplyWorkspaceEditParams, 16),
+	}
+
+	go func() {
+		err := svc.Start()
+		serverOut.Close()
+		c.done <- err
+	}()
+	go c.read()
+	return c
+}
+
+// Close ends the session and returns the error the service stopped with.
+func (c *Client) Close() error {
+	c.writeMu.Lock()
+	c.in.Close()
+	c.writeMu.Unlock()
+	return <-c.done
+}
+
+// Request sends a request and waits for its response. A response carrying
+// an error is returned along with that error.
+func (c *Client) Request(ctx context.Context, method string, params any) (*lsp.JSONRPCMessage, error) {
+	n := int(c.nextID.Add(1))
+	id := lsp.IntID(n)
+	if c.StringIDs {
+		id = lsp.StringID(fmt.Sprintf("req-%d", n))
+	}
+	ch := make(chan *lsp.JSONRPCMessage, 1)
+
+	c.mu.Lock()
+	c.pending[*id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, *id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(&lsp.JSONRPCMessage{ID: id, Method: method, Params: mustMarshal(params)}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp, fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(method string, params any) error {
+	return c.send(&lsp.JSONRPCMessage{Method: method, Params: mustMarshal(params)})
+}
+
+// Initialize opens the session with root as the workspace.
+func (c *Client) Initialize(ctx context.Context, root string) error {
+	params := lsp.InitializeParams{RootURI: "file://" + root}
+	if c.InitializationOptions != nil {
+		params.InitializationOptions = mustMarshal(c.InitializationOptions)
+	}
+	params.Capabilities.Workspace.Configuration = c.Settings != nil
+	params.Capabilities.General.PositionEncodings = []string{lsp.PositionEncodingUTF8, lsp.PositionEncodingUTF16}
+	params.Capabilities.Workspace.ApplyEdit = true
+	params.Capabilities.Workspace.WorkspaceEdit.DocumentChanges = true
+	params.Capabilities.Window.WorkDoneProgress = true
+	params.Capabilities.TextDocument.Completion.CompletionItem.DocumentationFormat = []string{lsp.MarkupKindMarkdown}
+	if _, err := c.Request(ctx, lsp.EventInitialize, params); err != nil {
+		return err
+	}
+	return c.Notify(lsp.EventInitialized, struct{}{})
+}
+
+// Open opens a document at version 1.
+func (c *Client) Open(uri, languageID, text string) error {
+	return c.Notify(lsp.EventDidOpen, lsp.DidOpenParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: languageID, Version: 1, Text: text},
+	})
+}
+
+// Change sends edits to an open document.
+func (c *Client) Change(uri string, version int, changes ...lsp.ContentChange) error {
+	return c.Notify(lsp.EventDidChange, lsp.DidChangeParams{
+		TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: version},
+		ContentChanges: changes,
+	})
+}
+
+// Complete requests completions at pos.
+func (c *Client) Complete(ctx context.Context, uri string, pos lsp.Position) (lsp.CompletionList, error) {
+	var list lsp.CompletionList
+	resp, err := c.Request(ctx, lsp.EventCompletion, lsp.CompletionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     pos,
+	})
+	if err != nil {
+		return list, err
+	}
+	err = lsp.DecodeResult(resp, &list)
+	return list, err
+}
+
+// CodeActions requests the code actions for r.
+func (c *Client) CodeActions(ctx context.Context, uri string, r lsp.Range) ([]lsp.CodeAction, error) {
+	var actions []lsp.CodeAction
+	resp, err := c.Request(ctx, lsp.EventCodeAction, lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        r,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = lsp.DecodeResult(resp, &actions)
+	return actions, err
+}
+
+// ExecuteCommand runs command with args and waits for its response.
+func (c *Client) ExecuteCommand(ctx context.Context, command string, args ...any) (*lsp.JSONRPCMessage, error) {
+	if args == nil {
+		args = []any{}
+	}
+	return c.Request(ctx, lsp.EventExecuteCommand, lsp.ExecuteCommandParams{Command: command, Arguments: args})
+}
+
+// WaitEdit returns the next workspace edit the server applied.
+func (c *Client) WaitEdit(ctx context.Context) (lsp.ApplyWorkspaceEditParams, error) {
+	select {
+	case edit := <-c.edits:
+		return edit, nil
+	case <-ctx.Done():
+		return lsp.ApplyWorkspaceEditParams{}, ctx.Err()
+	}
+}
+
+// Notifications returns the notifications received so far for method.
+func (c *Client) Notifications(method string) []*lsp.JSONRPCMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var found []*lsp.JSONRPCMessage
+	for _, msg := range c.notifications {
+		if msg.Method == method {
+			found = append(found, msg)
+		}
+	}
+	return found
+}
+
+func (c *Client) send(msg *lsp.JSONRPCMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.in.Write(data)
+	return err
+}
+
+// read dispatches server messages until the service closes its output.
+func (c *Client) read() {
+	reader := bufio.NewReader(c.out)
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case msg.Method == "":
+			if msg.ID == nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[*msg.ID]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		case msg.ID != nil:
+			go c.answer(msg)
+		default:
+			c.mu.Lock()
+			c.notifications = append(c.notifications, msg)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// answer replies to a request from the server.
+func (c *Client) answer(msg *lsp.JSONRPCMessage) {
+	var result any
+	switch msg.Method {
+	case lsp.EventApplyEdit:
+		var params lsp.ApplyWorkspaceEditParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			c.edits <- params
+		}
+		result = lsp.ApplyWorkspaceEditResult{Applied: true}
+	case lsp.EventShowMessageRequest:
+		var params lsp.ShowMessageRequestParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil && c.Choose != nil {
+			actions := make([]string, len(params.Actions))
+			for i, action := range params.Actions {
+				actions[i] = action.Title
+			}
+			if choice := c.Choose(params.Message, actions); choice != "" {
+				result = lsp.MessageActionItem{Title: choice}
+			}
+		}
+	case lsp.EventConfiguration:
+		var params lsp.ConfigurationParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			sections := make([]any, len(params.Items))
+			for i := range sections {
+				sections[i] = c.Settings
+			}
+			result = sections
+		}
+	}
+	c.send(&lsp.JSONRPCMessage{ID: msg.ID, Result: result})
+}
+
+func readMessage(reader *bufio.Reader) (*lsp.JSONRPCMessage, error) {
+	length := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			length, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	var msg lsp.JSONRPCMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
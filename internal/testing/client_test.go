@@ -0,0 +1,265 @@
+package testing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	harness "github.com/leona/helix-assist/internal/testing"
+
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+const source = "package main\n\nfunc main() {\n\tfmt.Pr\n}\n"
+
+func newClient(t testing.TB, provider *harness.MockProvider) (*harness.Client, context.Context, string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	root := t.TempDir()
+	client := harness.NewClient(nil, provider)
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			t.Errorf("service stopped with %v", err)
+		}
+	})
+
+	if err := client.Initialize(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	uri := "file://" + root + "/main.go"
+	if err := client.Open(uri, "go", source); err != nil {
+		t.Fatal(err)
+	}
+	return client, ctx, uri
+}
+
+func TestCompletion(t *testing.T) {
+	provider := &harness.MockProvider{Completions: []string{`intln("hello")`}}
+	client, ctx, uri := newClient(t, provider)
+
+	list, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(list.Items))
+	}
+	if got := list.Items[0].TextEdit.NewText; !strings.Contains(got, `intln("hello")`) {
+		t.Errorf("completion inserts %q", got)
+	}
+
+	requests := provider.CompletionRequests()
+	if len(requests) != 1 || !strings.HasSuffix(requests[0].ContentBefore, "\tfmt.Pr") {
+		t.Errorf("provider got %+v", requests)
+	}
+}
+
+func TestStringIDs(t *testing.T) {
+	provider := &harness.MockProvider{Completions: []string{`intln("hello")`}}
+	client, ctx, uri := newClient(t, provider)
+	client.StringIDs = true
+
+	list, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(list.Items))
+	}
+
+	resp, err := client.Request(ctx, lsp.EventCodeAction, lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        lsp.Range{Start: lsp.Position{Line: 3}, End: lsp.Position{Line: 3, Character: 7}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := json.Marshal(resp.ID); !strings.HasPrefix(string(id), `"req-`) {
+		t.Errorf("response id is %s, want the string sent", id)
+	}
+}
+
+func TestIncrementalChange(t *testing.T) {
+	provider := &harness.MockProvider{Completions: []string{`("hello")`}}
+	client, ctx, uri := newClient(t, provider)
+
+	err := client.Change(uri, 2, lsp.ContentChange{
+		Range: &lsp.Range{Start: lsp.Position{Line: 3, Character: 7}, End: lsp.Position{Line: 3, Character: 7}},
+		Text:  "intln",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 12}); err != nil {
+		t.Fatal(err)
+	}
+	requests := provider.CompletionRequests()
+	if len(requests) != 1 || !strings.HasSuffix(requests[0].ContentBefore, "\tfmt.Println") {
+		t.Errorf("provider got %+v", requests)
+	}
+}
+
+func TestCodeAction(t *testing.T) {
+	provider := &harness.MockProvider{ChatResult: "\tfmt.Println(\"hello\")"}
+	client, ctx, uri := newClient(t, provider)
+
+	line := lsp.Range{Start: lsp.Position{Line: 3, Character: 0}, End: lsp.Position{Line: 4, Character: 0}}
+	actions, err := client.CodeActions(ctx, uri, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) == 0 || actions[0].Command == nil {
+		t.Fatalf("got code actions %+v", actions)
+	}
+
+	command := actions[0].Command
+	if _, err := client.ExecuteCommand(ctx, command.Command, command.Arguments...); err != nil {
+		t.Fatal(err)
+	}
+
+	edit, err := client.WaitEdit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := edit.Edit.DocumentChanges; len(changes) != 1 || changes[0].TextDocument.Version != 1 {
+		t.Errorf("edit is not versioned: %+v", edit.Edit)
+	}
+	edits := edit.Edit.Edits(uri)
+	if len(edits) != 1 || edits[0].NewText != "\tfmt.Println(\"hello\")\n" {
+		t.Errorf("got edits %+v", edits)
+	}
+	if prompts := provider.ChatPrompts(); len(prompts) != 1 || !strings.Contains(prompts[0], "fmt.Pr") {
+		t.Errorf("provider got prompts %q", prompts)
+	}
+}
+
+func TestWorkspaceCommand(t *testing.T) {
+	client, ctx, _ := newClient(t, &harness.MockProvider{})
+	var offered []string
+	client.Choose = func(message string, actions []string) string {
+		offered = actions
+		return harness.MockProviderName
+	}
+
+	resp, err := client.ExecuteCommand(ctx, "helix-assist.setProvider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := resp.Result.(string); !strings.Contains(result, harness.MockProviderName) {
+		t.Errorf("setProvider replied %#v", resp.Result)
+	}
+	if len(offered) != 1 || offered[0] != harness.MockProviderName {
+		t.Errorf("setProvider offered %q", offered)
+	}
+}
+
+func TestSessionProvider(t *testing.T) {
+	client, ctx, uri := newClient(t, &harness.MockProvider{})
+	other := &harness.MockProvider{Completions: []string{`intln("other")`}}
+	client.Registry.Register("other", other)
+
+	if _, err := client.ExecuteCommand(ctx, "helix-assist.setProvider", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if current := client.Registry.Current(); current != harness.MockProviderName {
+		t.Errorf("setProvider switched the registry to %s, want only the session switched", current)
+	}
+
+	list, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || len(other.CompletionRequests()) != 1 {
+		t.Errorf("got items %+v, with %d requests to the selected provider", list.Items, len(other.CompletionRequests()))
+	}
+}
+
+func TestShutdownCancelsRequests(t *testing.T) {
+	provider := &harness.MockProvider{Completions: []string{"x"}, Latency: time.Minute}
+	client, ctx, uri := newClient(t, provider)
+
+	go client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7})
+	waitFor(ctx, t, "the completion request", func() bool { return len(provider.CompletionRequests()) > 0 })
+	client.Service.Shutdown()
+	waitFor(ctx, t, "the completion in flight to be cancelled", func() bool { return provider.CancelledCompletions() > 0 })
+}
+
+func waitFor(ctx context.Context, t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for !done() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for " + what)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestAuthenticatedUsers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	own := &harness.MockProvider{Completions: []string{`intln("alice")`}}
+	alice := providers.NewAccount("alice", map[string]providers.Provider{harness.MockProviderName: own})
+	authenticate := func(ctx context.Context, options json.RawMessage) (context.Context, error) {
+		var opts struct{ Token string }
+		json.Unmarshal(options, &opts)
+		if opts.Token != "alice-token" {
+			return nil, errors.New("unknown token")
+		}
+		return providers.WithAccount(ctx, alice), nil
+	}
+	start := func(token string) *harness.Client {
+		client := harness.NewClientWith(nil, &harness.MockProvider{Completions: []string{`intln("shared")`}}, func(svc *lsp.Service) {
+			svc.SetAuthenticator(authenticate)
+		})
+		client.InitializationOptions = map[string]string{"token": token}
+		return client
+	}
+
+	t.Run("wrong token", func(t *testing.T) {
+		client := start("mallory-token")
+		if err := client.Initialize(ctx, t.TempDir()); err == nil || !strings.Contains(err.Error(), "unknown token") {
+			t.Errorf("initialize returned %v, want the token refused", err)
+		}
+		if err := client.Close(); err == nil {
+			t.Error("session went on after refusing the editor")
+		}
+	})
+
+	t.Run("own providers", func(t *testing.T) {
+		client := start("alice-token")
+		defer client.Close()
+		root := t.TempDir()
+		uri := "file://" + root + "/main.go"
+
+		if _, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7}); err == nil || !strings.Contains(err.Error(), "not initialized") {
+			t.Errorf("completion before initialize returned %v, want it refused", err)
+		}
+		if err := client.Initialize(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Open(uri, "go", source); err != nil {
+			t.Fatal(err)
+		}
+		list, err := client.Complete(ctx, uri, lsp.Position{Line: 3, Character: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 1 || !strings.Contains(list.Items[0].TextEdit.NewText, "alice") {
+			t.Errorf("got items %+v, want the completion of alice's own provider", list.Items)
+		}
+	})
+}
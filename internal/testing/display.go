@@ -126,3 +126,35 @@ func (f *Formatter) FormatBatch(results []*TestResult, providerName string) stri
 
 	return sb.String()
 }
+
+func (f *Formatter) FormatSimulation(results []*SimulationResult) string {
+	var sb strings.Builder
+
+	sb.WriteString(f.color(colorYellow, "================================================================================\n"))
+	sb.WriteString(f.color(colorYellow, "Simulation\n"))
+	sb.WriteString(f.color(colorYellow, "================================================================================\n"))
+	sb.WriteString(fmt.Sprintf("  %-7s %8s %8s %8s %8s %8s %10s %10s %10s\n",
+		"speed", "requests", "answered", "calls", "wasted", "waste%", "cancel ms", "max ms", "reply ms"))
+
+	for _, result := range results {
+		waste := fmt.Sprintf("%8s", fmt.Sprintf("%.0f%%", result.WasteRate()*100))
+		if result.Wasted > 0 {
+			waste = f.color(colorRed, waste)
+		}
+		sb.WriteString(fmt.Sprintf("  %-7s %8d %8d %8d %8d %8s %10d %10d %10d\n",
+			fmt.Sprintf("%gx", result.Speed),
+			result.Requests,
+			result.Answered,
+			result.ProviderCalls,
+			result.Wasted,
+			waste,
+			result.CancelLatency.Milliseconds(),
+			result.MaxCancelLatency.Milliseconds(),
+			result.ResponseLatency.Milliseconds(),
+		))
+	}
+
+	sb.WriteString("\n")
+
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package testing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// MockProvider answers every request with canned output and records what
+// it was asked, for driving handlers without a model server.
+type MockProvider struct {
+	// Completions are returned for every completion request.
+	Completions []string
+	// ChatResult is returned for every chat request.
+	ChatResult string
+	// Err, when set, fails every request instead.
+	Err error
+	// Latency delays every completion, like a model server would. A request
+	// cancelled while waiting fails with its context's error.
+	Latency time.Duration
+
+	mu              sync.Mutex
+	completionCalls []providers.CompletionRequest
+	chatPrompts     []string
+	cancelled       int
+}
+
+func (p *MockProvider) Completion(ctx context.Context, req providers.CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	p.mu.Lock()
+	p.completionCalls = append(p.completionCalls, req)
+	p.mu.Unlock()
+
+	if p.Latency > 0 {
+		select {
+		case <-time.After(p.Latency):
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.cancelled++
+			p.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return append([]string(nil), p.Completions...), nil
+}
+
+func (p *MockProvider) Chat(ctx context.Context, systemPrompt, userPrompt string) (*providers.ChatResponse, error) {
+	p.mu.Lock()
+	p.chatPrompts = append(p.chatPrompts, userPrompt)
+	p.mu.Unlock()
+
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return &providers.ChatResponse{Result: p.ChatResult}, nil
+}
+
+// CompletionRequests returns the completion requests received so far.
+func (p *MockProvider) CompletionRequests() []providers.CompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]providers.CompletionRequest(nil), p.completionCalls...)
+}
+
+// CancelledCompletions returns how many completion requests were cancelled
+// while waiting out Latency.
+func (p *MockProvider) CancelledCompletions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cancelled
+}
+
+// ChatPrompts returns the user prompts of the chat requests received so far.
+func (p *MockProvider) ChatPrompts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.chatPrompts...)
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/leona/helix-assist/internal/util"
 )
 
 const cursorMarker = "<CURSOR>"
@@ -28,7 +30,7 @@ func ParseTestFile(path string) (*TestCase, error) {
 	column := cursorIndex - lastNewline - 1
 	contentBefore := originalText[:cursorIndex]
 	contentAfter := originalText[cursorIndex+len(cursorMarker):]
-	languageID, err := DetectLanguage(path)
+	languageID, err := util.DetectLanguage(path)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect language: %w", err)
@@ -0,0 +1,247 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// Backspace is the keystroke text that deletes the character before the
+// cursor.
+const Backspace = "\b"
+
+// Keystroke is one edit of a typing session.
+type Keystroke struct {
+	// DelayMS is the time since the previous keystroke, in milliseconds.
+	DelayMS int `json:"delayMs"`
+	// Text is inserted at the cursor, or is Backspace.
+	Text string `json:"text"`
+	// Complete is set where the editor asked for a completion after the
+	// edit, on a trigger character or once typing paused.
+	Complete bool `json:"complete,omitempty"`
+}
+
+// Session is a typing session to replay: the document it started from and
+// the keystrokes typed into it, starting at Cursor.
+type Session struct {
+	LanguageID string `json:"languageId"`
+	Text       string `json:"text"`
+	// Cursor is the byte offset in Text typing starts at.
+	Cursor     int         `json:"cursor"`
+	Keystrokes []Keystroke `json:"keystrokes"`
+}
+
+// LoadSession reads a session from a JSON file.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parse session %s: %w", path, err)
+	}
+	if session.Cursor < 0 || session.Cursor > len(session.Text) {
+		return nil, fmt.Errorf("session %s: cursor %d is outside the text", path, session.Cursor)
+	}
+	return &session, nil
+}
+
+// TypeOut makes a session typing text between before and after, one
+// character every delay, asking for a completion after each one. That is
+// the most an editor would ask for.
+func TypeOut(languageID, before, text, after string, delay time.Duration) *Session {
+	session := &Session{LanguageID: languageID, Text: before + after, Cursor: len(before)}
+	for _, r := range text {
+		session.Keystrokes = append(session.Keystrokes, Keystroke{
+			DelayMS:  int(delay / time.Millisecond),
+			Text:     string(r),
+			Complete: true,
+		})
+	}
+	return session
+}
+
+// SimulationResult measures how the completion scheduler handled a replayed
+// session.
+type SimulationResult struct {
+	Speed float64
+	// Duration is the time from the first keystroke to the last response.
+	Duration time.Duration
+	// Requests is how many completions the editor asked for, and Answered
+	// how many of them came back with suggestions.
+	Requests int
+	Answered int
+	// ProviderCalls is how many requests reached the provider, and
+	// Cancelled how many of those were cancelled before it answered.
+	ProviderCalls int
+	Cancelled     int
+	// Wasted is how many provider calls produced nothing the editor got,
+	// whether cancelled or thrown away afterwards.
+	Wasted int
+	// CancelLatency is the mean, and MaxCancelLatency the longest, time
+	// from a request being superseded by the next to it being answered.
+	CancelLatency    time.Duration
+	MaxCancelLatency time.Duration
+	// ResponseLatency is the mean time to suggestions for answered
+	// requests.
+	ResponseLatency time.Duration
+}
+
+// ResponseRate is the share of requests answered with suggestions.
+func (r *SimulationResult) ResponseRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Answered) / float64(r.Requests)
+}
+
+// WasteRate is the share of provider calls that were wasted.
+func (r *SimulationResult) WasteRate() float64 {
+	if r.ProviderCalls == 0 {
+		return 0
+	}
+	return float64(r.Wasted) / float64(r.ProviderCalls)
+}
+
+// simulatedRequest is one completion request of a replay.
+type simulatedRequest struct {
+	sent     time.Time
+	answered time.Time
+	items    int
+}
+
+// Simulate replays session against a Service running cfg, with provider
+// answering completions, speed times as fast as it was recorded. A nil cfg
+// is the default configuration. Provider's Completions should be suggestions
+// the handler keeps, or nothing counts as answered.
+func Simulate(ctx context.Context, cfg *config.Config, provider *MockProvider, session *Session, speed float64) (*SimulationResult, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("speed must be positive, got %g", speed)
+	}
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+
+	root, err := os.MkdirTemp("", "helix-assist-simulation")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	callsBefore, cancelledBefore := len(provider.CompletionRequests()), provider.CancelledCompletions()
+
+	client := NewClient(cfg, provider)
+	if err := client.Initialize(ctx, root); err != nil {
+		client.Close()
+		return nil, err
+	}
+	uri := "file://" + filepath.Join(root, "session"+util.ExtensionFor(session.LanguageID))
+	if err := client.Open(uri, session.LanguageID, session.Text); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		requests []*simulatedRequest
+		errs     []error
+	)
+
+	text, cursor := session.Text, session.Cursor
+	start := time.Now()
+	next := start
+	for i, key := range session.Keystrokes {
+		next = next.Add(time.Duration(float64(key.DelayMS) * float64(time.Millisecond) / speed))
+		time.Sleep(time.Until(next))
+
+		var change lsp.ContentChange
+		if key.Text == Backspace {
+			if cursor == 0 {
+				continue
+			}
+			_, size := utf8.DecodeLastRuneInString(text[:cursor])
+			change.Range = &lsp.Range{Start: lsp.PositionAt(text, cursor-size), End: lsp.PositionAt(text, cursor)}
+			text = text[:cursor-size] + text[cursor:]
+			cursor -= size
+		} else {
+			pos := lsp.PositionAt(text, cursor)
+			change = lsp.ContentChange{Range: &lsp.Range{Start: pos, End: pos}, Text: key.Text}
+			text = text[:cursor] + key.Text + text[cursor:]
+			cursor += len(key.Text)
+		}
+		if err := client.Change(uri, i+2, change); err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		if !key.Complete {
+			continue
+		}
+		req := &simulatedRequest{sent: time.Now()}
+		requests = append(requests, req)
+		pos := lsp.PositionAt(text, cursor)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := client.Complete(ctx, uri, pos)
+			mu.Lock()
+			defer mu.Unlock()
+			req.answered = time.Now()
+			req.items = len(list.Items)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := client.Close(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	result := &SimulationResult{
+		Speed:         speed,
+		Duration:      time.Since(start),
+		Requests:      len(requests),
+		ProviderCalls: len(provider.CompletionRequests()) - callsBefore,
+		Cancelled:     provider.CancelledCompletions() - cancelledBefore,
+	}
+
+	var cancelTotal, responseTotal time.Duration
+	superseded := 0
+	for i, req := range requests {
+		if req.items > 0 {
+			result.Answered++
+			responseTotal += req.answered.Sub(req.sent)
+		}
+		if i+1 < len(requests) && req.answered.After(requests[i+1].sent) {
+			latency := req.answered.Sub(requests[i+1].sent)
+			cancelTotal += latency
+			result.MaxCancelLatency = max(result.MaxCancelLatency, latency)
+			superseded++
+		}
+	}
+	result.Wasted = max(result.ProviderCalls-result.Answered, 0)
+	if superseded > 0 {
+		result.CancelLatency = cancelTotal / time.Duration(superseded)
+	}
+	if result.Answered > 0 {
+		result.ResponseLatency = responseTotal / time.Duration(result.Answered)
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package testing_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	harness "github.com/leona/helix-assist/internal/testing"
+)
+
+const (
+	sessionBefore = "package main\n\nfunc main() {\n\t"
+	sessionAfter  = "\n}\n"
+)
+
+func simulationConfig(debounce int) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Debounce = debounce
+	return cfg
+}
+
+func TestSimulateDebouncesFastTyping(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// Typing faster than the debounce: every request but the last is
+	// superseded before it reaches the provider.
+	session := harness.TypeOut("go", sessionBefore, "fmt.Print", sessionAfter, 10*time.Millisecond)
+	provider := &harness.MockProvider{Completions: []string{`ln("hello")`}}
+
+	result, err := harness.Simulate(context.Background(), simulationConfig(200), provider, session, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Requests != len(session.Keystrokes) {
+		t.Errorf("sent %d requests, want %d", result.Requests, len(session.Keystrokes))
+	}
+	if result.ProviderCalls != 1 || result.Answered != 1 || result.Wasted != 0 {
+		t.Errorf("got %d provider calls, %d answered, %d wasted; want 1, 1, 0", result.ProviderCalls, result.Answered, result.Wasted)
+	}
+}
+
+// BenchmarkTypingSession replays the recorded session at several speeds
+// against a provider taking 300ms, reporting wasted provider calls,
+// cancellation latency and response rate per replay.
+func BenchmarkTypingSession(b *testing.B) {
+	b.Setenv("XDG_CONFIG_HOME", b.TempDir())
+	b.Setenv("HOME", b.TempDir())
+
+	recorded, err := harness.LoadSession("testdata/session.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	sessions := map[string]*harness.Session{
+		"recorded":  recorded,
+		"every-key": harness.TypeOut("go", sessionBefore, "for i := range 10 {", sessionAfter, 120*time.Millisecond),
+	}
+
+	for _, name := range []string{"recorded", "every-key"} {
+		for _, speed := range []float64{1, 2, 4} {
+			b.Run(fmt.Sprintf("%s/speed=%g", name, speed), func(b *testing.B) {
+				var wasted, answered, requests int
+				var cancelLatency time.Duration
+				for b.Loop() {
+					provider := &harness.MockProvider{Completions: []string{"simulated()"}, Latency: 300 * time.Millisecond}
+					result, err := harness.Simulate(context.Background(), nil, provider, sessions[name], speed)
+					if err != nil {
+						b.Fatal(err)
+					}
+					wasted += result.Wasted
+					answered += result.Answered
+					requests += result.Requests
+					cancelLatency += result.CancelLatency
+				}
+				b.ReportMetric(float64(wasted)/float64(b.N), "wasted/op")
+				b.ReportMetric(float64(cancelLatency.Milliseconds())/float64(b.N), "cancel-ms/op")
+				b.ReportMetric(float64(answered)/float64(max(requests, 1)), "answered/req")
+			})
+		}
+	}
+}
+
+// BenchmarkCompletionRoundTrip measures the overhead of a completion
+// through the service and handler, without debounce or provider latency.
+func BenchmarkCompletionRoundTrip(b *testing.B) {
+	provider := &harness.MockProvider{Completions: []string{`intln("hello")`}}
+	client, ctx, uri := newClient(b, provider)
+
+	// Alternate positions so no request is dropped as a duplicate of the
+	// one before.
+	positions := []lsp.Position{{Line: 3, Character: 7}, {Line: 3, Character: 6}}
+	i := 0
+	for b.Loop() {
+		if _, err := client.Complete(ctx, uri, positions[i%len(positions)]); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
@@ -23,6 +23,8 @@ func GetContent(contents string, line, column int) ContentParts {
 		line = len(lines) - 1
 	}
 
+	column = max(column, 0)
+
 	beforeLines := make([]string, line+1)
 	copy(beforeLines, lines[:line+1])
 
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzGetContent(f *testing.F) {
+	f.Add("package main\n\nfunc main() {\n\tfmt.Pr\n}\n", 3, 7)
+	f.Add("", 0, 0)
+	f.Add("a\nb", -1, -5)
+	f.Add("héllo 世界\n✓", 0, 3)
+	f.Add("{{{(\n)]}\n", 9, 99)
+
+	f.Fuzz(func(t *testing.T, text string, line, column int) {
+		parts := GetContent(text, line, column)
+
+		// The parts put back together are the document.
+		got := parts.ContentBefore + parts.ContentImmediatelyAfter
+		if last := strings.Count(text, "\n"); min(max(line, 0), last) < last {
+			got += "\n" + parts.ContentAfter
+		}
+		if got != text {
+			t.Fatalf("parts join to %q, want %q", got, text)
+		}
+		if !strings.HasSuffix(parts.ContentBefore, parts.LastLine) || strings.Contains(parts.LastLine, "\n") {
+			t.Fatalf("last line %q does not end %q", parts.LastLine, parts.ContentBefore)
+		}
+	})
+}
+
+func FuzzShortenLongLines(f *testing.F) {
+	f.Add("x\n"+strings.Repeat("abcdefghé", 100), strings.Repeat(")", 500)+"\nend", 40)
+	f.Add("", "", 0)
+	f.Add("short", "lines", 1)
+
+	f.Fuzz(func(t *testing.T, before, after string, limit int) {
+		if !utf8.ValidString(before) || !utf8.ValidString(after) {
+			return
+		}
+		limit %= 1000
+
+		short, shortAfter := ShortenLongLines(before, after, limit)
+		if !utf8.ValidString(short) || !utf8.ValidString(shortAfter) {
+			t.Fatalf("invalid UTF-8 in %q, %q", short, shortAfter)
+		}
+		if strings.Count(short, "\n") != strings.Count(before, "\n") || strings.Count(shortAfter, "\n") != strings.Count(after, "\n") {
+			t.Fatal("line count changed")
+		}
+		if limit <= 0 {
+			return
+		}
+		for _, line := range strings.Split(short+"\n"+shortAfter, "\n") {
+			if n := utf8.RuneCountInString(line); n > limit+utf8.RuneCountInString(Ellipsis) {
+				t.Fatalf("line of %d characters over limit %d", n, limit)
+			}
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings DecodeText recognises.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingShiftJIS    = "shift_jis"
+)
+
+// windows1252 maps the bytes 0x80-0x9F, where Windows-1252 differs from
+// Latin-1, to their characters. Unassigned bytes keep their Latin-1 control
+// codes.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// DecodeText converts file contents to UTF-8 for use in prompts, returning
+// the encoding it detected. Byte order marks are honoured and removed;
+// text that is not UTF-8 is taken as Shift_JIS when its bytes pair up the
+// way Japanese text does, and otherwise as Windows-1252, a superset of
+// Latin-1. Shift_JIS codes outside JIS X 0208, such as the NEC and IBM
+// extensions of CP932, decode to U+FFFD.
+//
+// Documents open in the editor need none of this: the editor decodes them
+// and sends their text as UTF-8, and edits address that text, never the
+// bytes on disk, so no position is ever mapped back to the file's own
+// encoding.
+func DecodeText(data []byte) (string, string) {
+	switch {
+	case len(data) >= 3 && data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf:
+		return string(data[3:]), EncodingUTF8
+	case len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe:
+		return decodeUTF16(data[2:], false), EncodingUTF16LE
+	case len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff:
+		return decodeUTF16(data[2:], true), EncodingUTF16BE
+	case utf8.Valid(data):
+		return string(data), EncodingUTF8
+	case looksShiftJIS(data):
+		return decodeShiftJIS(data), EncodingShiftJIS
+	}
+
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		switch {
+		case c >= 0x80 && c < 0xa0:
+			b.WriteRune(windows1252[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String(), EncodingWindows1252
+}
+
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		lo, hi := data[2*i], data[2*i+1]
+		if bigEndian {
+			lo, hi = hi, lo
+		}
+		units[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	return string(utf16.Decode(units))
+}
+
+var sjisRunes = sync.OnceValue(func() []rune { return []rune(sjisTable) })
+
+// decodeShiftJIS decodes data that looksShiftJIS accepted.
+func decodeShiftJIS(data []byte) string {
+	table := sjisRunes()
+	var b strings.Builder
+	b.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c >= 0xa1 && c <= 0xdf:
+			b.WriteRune(0xff61 + rune(c-0xa1))
+		default:
+			lead := int(c) - 0x81
+			if c >= 0xe0 {
+				// Rows 0xE0-0xEF follow the 31 of 0x81-0x9F.
+				lead = int(c) - 0xe0 + 31
+			}
+			trail := int(data[i+1]) - 0x40
+			if data[i+1] > 0x7f {
+				trail--
+			}
+			b.WriteRune(table[lead*188+trail])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// looksShiftJIS reports whether every byte above ASCII in data pairs up
+// into a Shift_JIS double-byte character, and most of the pairs could not
+// be Windows-1252. An accented letter followed by an ASCII one, as in
+// "r\xe9ponse", is also a valid pair, so only pairs with a trail byte above
+// ASCII or a lead byte of the kana and symbol rows, punctuation that
+// Windows-1252 text rarely has, count for Shift_JIS. Lead bytes of the
+// user-defined area, such as the ü of "M\xfcnchen", are refused.
+func looksShiftJIS(data []byte) bool {
+	pairs, distinct := 0, 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+		case c >= 0xa1 && c <= 0xdf:
+			// Half-width katakana.
+		case c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xef:
+			if i+1 >= len(data) {
+				return false
+			}
+			trail := data[i+1]
+			if trail < 0x40 || trail == 0x7f || trail > 0xfc {
+				return false
+			}
+			pairs++
+			if trail >= 0x80 || c <= 0x84 {
+				distinct++
+			}
+			i++
+		default:
+			return false
+		}
+	}
+	return pairs > 0 && 2*distinct >= pairs
+}
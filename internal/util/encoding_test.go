@@ -0,0 +1,37 @@
+package util
+
+import "testing"
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     string
+		encoding string
+	}{
+		{"utf-8", "héllo", "héllo", EncodingUTF8},
+		{"utf-8 bom", "\xef\xbb\xbfhi", "hi", EncodingUTF8},
+		{"utf-16le", "\xff\xfeh\x00i\x00", "hi", EncodingUTF16LE},
+		{"french", "r\xe9ponse d\xe9taill\xe9e", "réponse détaillée", EncodingWindows1252},
+		{"german", "Gr\xfc\xdfe aus M\xfcnchen", "Grüße aus München", EncodingWindows1252},
+		{"smart quotes", "\x93Hello\x94 \x85 caf\xe9", "“Hello” … café", EncodingWindows1252},
+		{"accented capitals", "\xc9t\xe9 \xe0 Paris", "Été à Paris", EncodingWindows1252},
+		{"kanji", "// \x93\xfa\x96{\x8c\xea\n", "// 日本語\n", EncodingShiftJIS},
+		{"hiragana", "\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd", "こんにちは", EncodingShiftJIS},
+		{"katakana", "\x83e\x83X\x83g", "テスト", EncodingShiftJIS},
+		{"half-width katakana", "\xb6\xc0\xb6\xc5 \x81\x79\x95\xb6\x81\x7a", "ｶﾀｶﾅ 【文】", EncodingShiftJIS},
+		{"last row", "\xea\xa4", "熙", EncodingShiftJIS},
+		{"unassigned", "\x85\x40\x82\xa0", "\ufffdあ", EncodingShiftJIS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, encoding := DecodeText([]byte(tt.data))
+			if encoding != tt.encoding {
+				t.Fatalf("detected %s, want %s", encoding, tt.encoding)
+			}
+			if text != tt.want {
+				t.Errorf("got %q, want %q", text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package util
+
+import "strings"
+
+// templateLanguages have JavaScript template literals.
+var templateLanguages = map[string]bool{
+	"javascript":      true,
+	"javascriptreact": true,
+	"typescript":      true,
+	"typescriptreact": true,
+	"jsx":             true,
+	"tsx":             true,
+	"vue":             true,
+	"svelte":          true,
+}
+
+// interpolationFrame is a syntactic context open at some point of a line.
+type interpolationFrame struct {
+	// kind is 'c' for code, 'i' for code in an interpolation, 't' for the
+	// text of a template literal and 'f' for the text of an f-string.
+	kind byte
+	// quote ends an f-string; depth counts the braces open in code.
+	quote string
+	raw   bool
+	depth int
+}
+
+// InterpolationAt reports whether the end of line, the text before the
+// cursor on its line, is inside a string interpolation: ${...} in a
+// JavaScript or TypeScript template literal, or {...} in a Python
+// f-string. It returns the interpolation's delimiters. Only the cursor line
+// is scanned, so strings opened on earlier lines are not recognised.
+func InterpolationAt(line, languageID string) (open, close string, ok bool) {
+	template := templateLanguages[languageID]
+	python := languageID == "python"
+	if !template && !python {
+		return "", "", false
+	}
+
+	stack := []interpolationFrame{{kind: 'c'}}
+	for i := 0; i < len(line); i++ {
+		top := &stack[len(stack)-1]
+		c := line[i]
+
+		switch top.kind {
+		case 't':
+			switch {
+			case c == '\\':
+				i++
+			case c == '`':
+				stack = stack[:len(stack)-1]
+			case c == '$' && i+1 < len(line) && line[i+1] == '{':
+				stack = append(stack, interpolationFrame{kind: 'i'})
+				i++
+			}
+			continue
+		case 'f':
+			switch {
+			case c == '\\' && !top.raw:
+				i++
+			case strings.HasPrefix(line[i:], top.quote):
+				i += len(top.quote) - 1
+				stack = stack[:len(stack)-1]
+			case strings.HasPrefix(line[i:], "{{"):
+				i++
+			case c == '{':
+				stack = append(stack, interpolationFrame{kind: 'i'})
+			}
+			continue
+		}
+
+		// Code, at the top level or in an interpolation.
+		switch {
+		case c == '#' && python, c == '/' && template && strings.HasPrefix(line[i:], "//"):
+			// The rest of the line is a comment.
+			return "", "", false
+		case c == '`' && template:
+			stack = append(stack, interpolationFrame{kind: 't'})
+		case c == '"' || c == '\'':
+			quote := string(c)
+			if python && strings.HasPrefix(line[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			prefix := strings.ToLower(stringPrefix(line[:i]))
+			if python && strings.Contains(prefix, "f") {
+				stack = append(stack, interpolationFrame{kind: 'f', quote: quote, raw: strings.Contains(prefix, "r")})
+				i += len(quote) - 1
+				continue
+			}
+			end := closingQuote(line, i+len(quote), quote)
+			if end < 0 {
+				// The cursor is in a plain string.
+				return "", "", false
+			}
+			i = end + len(quote) - 1
+		case c == '{':
+			top.depth++
+		case c == '}':
+			if top.kind == 'i' && top.depth == 0 {
+				stack = stack[:len(stack)-1]
+			} else if top.depth > 0 {
+				top.depth--
+			}
+		}
+	}
+
+	if stack[len(stack)-1].kind != 'i' {
+		return "", "", false
+	}
+	if template {
+		return "${", "}", true
+	}
+	return "{", "}", true
+}
+
+// stringPrefix returns the letters right before a quote that make up a
+// Python string prefix such as f or rb, or "" when they are the end of an
+// identifier instead.
+func stringPrefix(before string) string {
+	start := len(before)
+	for start > 0 && start > len(before)-2 && isLetter(before[start-1]) {
+		start--
+	}
+	if start > 0 && (isLetter(before[start-1]) || before[start-1] == '_' || (before[start-1] >= '0' && before[start-1] <= '9')) {
+		return ""
+	}
+	return before[start:]
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// closingQuote returns the index of quote closing a string whose text
+// starts at from, skipping escapes, or -1 if the line ends first.
+func closingQuote(line string, from int, quote string) int {
+	for i := from; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(line[i:], quote) {
+			return i
+		}
+	}
+	return -1
+}
+
+// CutAtInterpolationEnd cuts a completion made inside an interpolation
+// right after the brace that closes it, or at its first line break, so it
+// does not run on into the rest of the string or new statements.
+func CutAtInterpolationEnd(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return text[:i+1]
+			}
+			depth--
+		}
+	}
+	return text
+}
@@ -1,4 +1,4 @@
-package testing
+package util
 
 import (
 	"fmt"
@@ -36,6 +36,7 @@ var extensionToLanguage = map[string]string{
 	".md":   "markdown",
 }
 
+// DetectLanguage returns the LSP language ID for filename's extension.
 func DetectLanguage(filename string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filename))
 	if ext == "" {
@@ -49,3 +50,18 @@ func DetectLanguage(filename string) (string, error) {
 
 	return languageID, nil
 }
+
+// ExtensionFor returns a file extension of languageID, or .txt for a
+// language without one.
+func ExtensionFor(languageID string) string {
+	found := ""
+	for ext, id := range extensionToLanguage {
+		if id == languageID && (found == "" || ext < found) {
+			found = ext
+		}
+	}
+	if found == "" {
+		return ".txt"
+	}
+	return found
+}
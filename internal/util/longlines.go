@@ -0,0 +1,78 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Ellipsis marks where an overlong line was cut.
+const Ellipsis = "…"
+
+// ContextLineLimit is the most characters of a single line sent as context.
+// Minified code packs a whole file into one line; past this only the parts
+// nearest the cursor are useful.
+const ContextLineLimit = 400
+
+// ShortenLongLines cuts lines of before and after longer than limit
+// characters. Elsewhere the middle of a line is dropped, keeping both ends;
+// on the cursor line, split between the last line of before and the first of
+// after, the characters nearest the cursor are kept.
+func ShortenLongLines(before, after string, limit int) (string, string) {
+	return shortenLines(before, limit, true), shortenLines(after, limit, false)
+}
+
+// shortenLines shortens every line of text. The cursor line is the last one
+// when atEnd is set and the first one otherwise.
+func shortenLines(text string, limit int, atEnd bool) string {
+	if limit <= 0 || len(text) <= limit {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	cursor := 0
+	if atEnd {
+		cursor = len(lines) - 1
+	}
+
+	for i, line := range lines {
+		if utf8.RuneCountInString(line) <= limit {
+			continue
+		}
+		switch {
+		case i != cursor:
+			lines[i] = runeHead(line, limit/2) + Ellipsis + runeTail(line, limit/2)
+		case atEnd:
+			lines[i] = Ellipsis + runeTail(line, limit)
+		default:
+			lines[i] = runeHead(line, limit) + Ellipsis
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CursorLineLength is the length in characters of the line the cursor is
+// on.
+func (c ContentParts) CursorLineLength() int {
+	return utf8.RuneCountInString(c.LastLine) + utf8.RuneCountInString(c.ContentImmediatelyAfter)
+}
+
+// runeHead returns the first n characters of s.
+func runeHead(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// runeTail returns the last n characters of s.
+func runeTail(s string, n int) string {
+	i := len(s)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return s[i:]
+}
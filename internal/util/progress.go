@@ -3,83 +3,249 @@ package util
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/leona/helix-assist/internal/config"
 	"github.com/leona/helix-assist/internal/lsp"
 )
 
+// ProgressIndicator reports a request in the editor's statusline through
+// workDoneProgress, with the elapsed time and a preview of the output.
 type ProgressIndicator struct {
 	svc            *lsp.Service
 	enabled        bool
+	title          string
 	updateInterval time.Duration
-	spinnerFrames  []string
-	ctx            context.Context
-	cancel         context.CancelFunc
 	startTime      time.Time
-	mu             sync.Mutex
+	done           chan struct{}
+	stopOnce       sync.Once
+	preview        atomic.Pointer[string]
 }
 
-func NewProgressIndicator(svc *lsp.Service, cfg *config.Config) *ProgressIndicator {
+// ProgressSupported reports whether the client accepts progress tokens
+// created by the server, which both kinds of progress report through.
+func ProgressSupported(svc *lsp.Service) bool {
+	return svc.ClientCapabilities().Window.WorkDoneProgress
+}
+
+// NewProgressIndicator returns a progress that reports nothing when it is
+// disabled in cfg or the client does not support it.
+func NewProgressIndicator(svc *lsp.Service, cfg *config.Config, title string) *ProgressIndicator {
 	return &ProgressIndicator{
 		svc:            svc,
-		enabled:        cfg.EnableProgressSpinner,
+		enabled:        cfg.EnableProgressSpinner && ProgressSupported(svc),
+		title:          title,
 		updateInterval: time.Duration(cfg.ProgressUpdateInterval) * time.Millisecond,
-		spinnerFrames:  []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"},
+		done:           make(chan struct{}),
 	}
 }
 
+// Start begins reporting. Creating the progress token is a round trip to
+// the editor, so it happens in the background rather than delaying the
+// request being reported on.
 func (p *ProgressIndicator) Start() {
 	if !p.enabled {
 		return
 	}
 
-	p.mu.Lock()
-	p.ctx, p.cancel = context.WithCancel(context.Background())
 	p.startTime = time.Now()
-	p.mu.Unlock()
-
-	p.svc.Logger.Log("AI completion started")
-	go p.animate()
+	p.svc.Logger.Log(p.title, "started")
+	go p.run()
 }
 
+// Stop ends the progress. It is safe to call more than once.
 func (p *ProgressIndicator) Stop() {
 	if !p.enabled {
 		return
 	}
 
-	p.mu.Lock()
-	if p.cancel != nil {
-		p.cancel()
-		p.cancel = nil
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.svc.Logger.Log(fmt.Sprintf("%s finished in %s", p.title, p.formatElapsed(time.Since(p.startTime))))
+	})
+}
+
+func (p *ProgressIndicator) run() {
+	token := fmt.Sprintf("helix-assist/%d", time.Now().UnixNano())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	_, err := p.svc.Call(ctx, lsp.EventWorkDoneProgressCreate, lsp.WorkDoneProgressCreateParams{Token: token})
+	cancel()
+	if err != nil {
+		p.svc.Logger.Log("workDoneProgress/create failed:", err.Error())
+		return
 	}
-	elapsed := time.Since(p.startTime)
-	p.mu.Unlock()
 
-	// Show final time
-	p.svc.SendShowMessage(lsp.MessageTypeInfo, fmt.Sprintf("✓ AI completion (%s)", p.formatElapsed(elapsed)))
-	p.svc.Logger.Log(fmt.Sprintf("AI completion finished in %s", p.formatElapsed(elapsed)))
-}
+	select {
+	case <-p.done:
+		// Finished before the editor answered; nothing to show.
+		return
+	default:
+	}
 
-func (p *ProgressIndicator) animate() {
-	// Update every full second (much safer than 200ms intervals)
-	ticker := time.NewTicker(1 * time.Second)
+	p.svc.SendProgressBegin(token, p.title, false)
+
+	ticker := time.NewTicker(p.updateInterval)
 	defer ticker.Stop()
 
+	// Reports only go out when their text changes, at most once a second
+	// for the elapsed time.
+	last := ""
 	for {
 		select {
-		case <-p.ctx.Done():
+		case <-p.done:
+			p.svc.SendProgressEnd(token, p.formatElapsed(time.Since(p.startTime)))
 			return
 		case <-ticker.C:
-			elapsed := time.Since(p.startTime)
-			seconds := int(elapsed.Seconds())
-			p.svc.SendShowMessage(lsp.MessageTypeInfo, fmt.Sprintf("⏳ AI completion (%ds)", seconds))
+			message := fmt.Sprintf("%ds", int(time.Since(p.startTime).Seconds()))
+			if preview := p.preview.Load(); preview != nil {
+				message += ": " + *preview
+			}
+			if message != last {
+				p.svc.SendProgressReport(token, message)
+				last = message
+			}
 		}
 	}
 }
 
+// SetPreview sets the output generated so far, whose latest line is shown
+// with the next update.
+func (p *ProgressIndicator) SetPreview(text string) {
+	if line := PreviewLine(text, previewWidth); line != "" {
+		p.preview.Store(&line)
+	}
+}
+
 func (p *ProgressIndicator) formatElapsed(duration time.Duration) string {
 	seconds := duration.Seconds()
 	return fmt.Sprintf("%.1fs", seconds)
 }
+
+// CancellableProgress reports a long-running action through workDoneProgress
+// with a cancel button and a countdown to the action timeout.
+type CancellableProgress struct {
+	svc        *lsp.Service
+	token      string
+	deadline   time.Time
+	startTime  time.Time
+	done       chan struct{}
+	unregister func()
+	stopOnce   sync.Once
+	generated  atomic.Int64
+	preview    atomic.Pointer[string]
+}
+
+// StartCancellableProgress creates a client-side progress token and begins
+// reporting. Cancelling from the editor calls cancel. It returns false when
+// the client does not support server-initiated progress, in which case the
+// caller should fall back to ProgressIndicator. A zero timeout disables the
+// countdown for callers that report steps instead.
+func StartCancellableProgress(svc *lsp.Service, title string, timeout time.Duration, cancel context.CancelFunc) (*CancellableProgress, bool) {
+	if !ProgressSupported(svc) {
+		return nil, false
+	}
+	token := fmt.Sprintf("helix-assist/%d", time.Now().UnixNano())
+
+	createCtx, createCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer createCancel()
+
+	if _, err := svc.Call(createCtx, lsp.EventWorkDoneProgressCreate, lsp.WorkDoneProgressCreateParams{Token: token}); err != nil {
+		svc.Logger.Log("workDoneProgress/create failed:", err.Error())
+		return nil, false
+	}
+
+	now := time.Now()
+	p := &CancellableProgress{
+		svc:        svc,
+		token:      token,
+		deadline:   now.Add(timeout),
+		startTime:  now,
+		done:       make(chan struct{}),
+		unregister: svc.OnProgressCancel(token, cancel),
+	}
+
+	svc.SendProgressBegin(token, title, true)
+	if timeout > 0 {
+		go p.countdown()
+	}
+	return p, true
+}
+
+func (p *CancellableProgress) countdown() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			left := int(time.Until(p.deadline).Seconds())
+			if left < 0 {
+				left = 0
+			}
+			lines := p.generated.Load()
+			if preview := p.preview.Load(); preview != nil {
+				p.svc.SendProgressReport(p.token, fmt.Sprintf("%d lines, %ds left: %s", lines, left, *preview))
+			} else if lines > 0 {
+				p.svc.SendProgressReport(p.token, fmt.Sprintf("%d lines generated, %ds left (cancel to abort)", lines, left))
+			} else {
+				p.svc.SendProgressReport(p.token, fmt.Sprintf("%ds left (cancel to abort)", left))
+			}
+		}
+	}
+}
+
+// SetGenerated records how many lines have been generated so far, shown with
+// the next countdown update.
+func (p *CancellableProgress) SetGenerated(lines int) {
+	p.generated.Store(int64(lines))
+}
+
+// SetPreview sets the output generated so far, whose latest line is shown
+// with the next countdown update so the user can cancel a generation going
+// the wrong way.
+func (p *CancellableProgress) SetPreview(text string) {
+	if line := PreviewLine(text, previewWidth); line != "" {
+		p.preview.Store(&line)
+	}
+}
+
+// Step reports that done of total steps have finished.
+func (p *CancellableProgress) Step(done, total int, message string) {
+	percentage := 0
+	if total > 0 {
+		percentage = done * 100 / total
+	}
+	p.svc.SendProgressStep(p.token, fmt.Sprintf("%d/%d %s", done, total, message), percentage)
+}
+
+// Stop ends the progress with a final message. It is safe to call more than once.
+func (p *CancellableProgress) Stop(message string) {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.unregister()
+		elapsed := time.Since(p.startTime)
+		p.svc.SendProgressEnd(p.token, fmt.Sprintf("%s (%.1fs)", message, elapsed.Seconds()))
+		p.svc.Logger.Log(fmt.Sprintf("action progress finished in %.1fs: %s", elapsed.Seconds(), message))
+	})
+}
+
+// previewWidth is the most characters of generated output shown in a
+// progress message.
+const previewWidth = 60
+
+// PreviewLine returns the last non-blank line of text, without indentation
+// and cut to width characters from its end.
+func PreviewLine(text string, width int) string {
+	text = strings.TrimRight(text, " \t\n")
+	line := []rune(strings.TrimSpace(text[strings.LastIndexByte(text, '\n')+1:]))
+	if len(line) > width {
+		line = append([]rune("…"), line[len(line)-width+1:]...)
+	}
+	return string(line)
+}